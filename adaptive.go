@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Tuning of the adaptive concurrency
+const (
+	// adaptiveInterval is how often the thread count is adjusted
+	adaptiveInterval = 2 * time.Second
+	// adaptiveMinAttempts avoids adjusting on a handful of hosts
+	adaptiveMinAttempts = 10
+	// adaptiveShrinkRatio is the share of congestion errors above the
+	// baseline that halves the threads, adaptiveGrowRatio the share up to
+	// which threads are added
+	adaptiveShrinkRatio = 0.15
+	adaptiveGrowRatio   = 0.05
+	// adaptiveBaselineWeight is how fast the baseline follows the error
+	// share, which has to adapt to ranges with more dead hosts
+	adaptiveBaselineWeight = 0.1
+)
+
+// congestionError reports whether a failed connection hints at an
+// overloaded network or host rather than a closed port: timeouts and
+// running out of sockets or ports
+func congestionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS,
+		syscall.EADDRNOTAVAIL, syscall.EADDRINUSE} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// adaptiveLimit caps how many workers scan at the same time. It starts at
+// a quarter of the threads, adds threads while the share of timeouts stays
+// at its baseline and halves them when the share jumps.
+type adaptiveLimit struct {
+	max int
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	limit    int
+	active   int
+	attempts int
+	errors   int
+	// baseline is the usual share of congestion errors, -1 until measured
+	baseline float64
+}
+
+func newAdaptiveLimit(threads int) *adaptiveLimit {
+	a := &adaptiveLimit{max: threads, limit: max(1, threads/4), baseline: -1}
+	a.cond = sync.NewCond(&a.mu)
+	return a
+}
+
+// acquire waits until the worker may take a host, false if ctx is done
+func (a *adaptiveLimit) acquire(ctx context.Context) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for a.active >= a.limit {
+		if ctx.Err() != nil {
+			return false
+		}
+		a.cond.Wait()
+	}
+	a.active++
+	return true
+}
+
+func (a *adaptiveLimit) release() {
+	a.mu.Lock()
+	a.active--
+	a.mu.Unlock()
+	a.cond.Signal()
+}
+
+// record counts the outcome of connecting to a host
+func (a *adaptiveLimit) record(err error) {
+	a.mu.Lock()
+	a.attempts++
+	if congestionError(err) {
+		a.errors++
+	}
+	a.mu.Unlock()
+}
+
+// Limit returns the current number of workers allowed to scan
+func (a *adaptiveLimit) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.limit
+}
+
+// adjust updates the limit from the outcomes since the last call and
+// returns the previous limit and the share of congestion errors
+func (a *adaptiveLimit) adjust() (old int, share float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	old = a.limit
+	if a.attempts < adaptiveMinAttempts {
+		return old, 0
+	}
+	share = float64(a.errors) / float64(a.attempts)
+	a.attempts, a.errors = 0, 0
+	if a.baseline < 0 {
+		a.baseline = share
+	}
+	switch {
+	case share > a.baseline+adaptiveShrinkRatio:
+		a.limit = max(1, a.limit/2)
+	case share <= a.baseline+adaptiveGrowRatio:
+		a.limit = min(a.max, a.limit+max(1, a.limit/4))
+		a.cond.Broadcast()
+	}
+	if share < a.baseline {
+		a.baseline = share
+	} else {
+		a.baseline += (share - a.baseline) * adaptiveBaselineWeight
+	}
+	return old, share
+}
+
+// run adjusts the limit until ctx is done, then wakes the waiting workers
+func (a *adaptiveLimit) run(ctx context.Context, s *Scanner) {
+	ticker := time.NewTicker(adaptiveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			old, share := a.adjust()
+			limit := a.Limit()
+			s.Stats.Concurrency.Store(int64(limit))
+			switch {
+			case limit < old:
+				s.log(slog.LevelInfo, "Reducing threads", "threads", limit, "timeouts", fmt.Sprintf("%.0f%%", share*100))
+			case limit > old:
+				s.log(slog.LevelDebug, "Adding threads", "threads", limit, "timeouts", fmt.Sprintf("%.0f%%", share*100))
+			}
+		case <-ctx.Done():
+			a.mu.Lock()
+			a.cond.Broadcast()
+			a.mu.Unlock()
+			return
+		}
+	}
+}
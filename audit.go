@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+)
+
+// auditMaxNames is how many names of a certificate an audit resolves to
+// find the ones pointing at the scanned server
+const auditMaxNames = 5
+
+// auditHost returns how a server of one's own, scanned with
+// ScanConfig.Audit, gives itself away instead of passing for the dest it
+// borrows the certificate of. A Reality server that reveals nothing
+// answers like a feasible dest and returns no findings.
+func (s *Scanner) auditHost(ip net.IP, cert *x509.Certificate, result ScanResult) []string {
+	var findings []string
+	if !result.Feasible && !result.Honeypot {
+		findings = append(findings, fmt.Sprintf("does not pass for a dest, negotiates %s with ALPN %q",
+			result.TLSVersion, result.ALPN))
+	}
+	if selfSigned(cert) {
+		findings = append(findings, "serves a self-signed certificate")
+	}
+	if name := s.ownName(ip, cert); name != "" {
+		findings = append(findings, fmt.Sprintf("serves the certificate of %s, which resolves to this server", name))
+	}
+	switch {
+	case result.CertDiffers:
+		findings = append(findings, fmt.Sprintf("serves another certificate (%s) with the other SNI, "+
+			"revealing SNI routing", result.DualDomain))
+	case tlsAlert(result.DualError):
+		// Unlike a timeout, an alert is the server turning the SNI down
+		findings = append(findings, "rejects the handshake with the other SNI, revealing SNI routing")
+	}
+	return findings
+}
+
+// tlsAlert reports whether the probe error msg is an alert sent by the
+// server, as crypto/tls words them
+func tlsAlert(msg string) bool {
+	return strings.HasPrefix(msg, "remote error: tls: ")
+}
+
+// ownName returns a name of cert resolving to ip, a certificate that
+// exposes the real domain of the server rather than one of a dest
+func (s *Scanner) ownName(ip net.IP, cert *x509.Certificate) string {
+	names := cert.DNSNames
+	if len(names) == 0 && cert.Subject.CommonName != "" {
+		names = []string{cert.Subject.CommonName}
+	}
+	checked := 0
+	for _, name := range names {
+		if strings.HasPrefix(name, "*.") || net.ParseIP(name) != nil {
+			continue
+		}
+		if checked++; checked > auditMaxNames {
+			break
+		}
+		ips, err := s.resolver.LookupIPs(s.ctx, name, s.Config.EnableIPv6)
+		if err != nil {
+			continue
+		}
+		for _, resolved := range ips {
+			if resolved.Equal(ip) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// audit records and logs the findings of auditHost on result
+func (s *Scanner) audit(result *ScanResult, ip net.IP, cert *x509.Certificate) {
+	result.Reveals = s.auditHost(ip, cert, *result)
+	if len(result.Reveals) == 0 {
+		s.log(slog.LevelInfo, "Server passes the audit", "ip", result.IP, "port", result.Port, "domain", result.Domain)
+		return
+	}
+	s.Stats.Revealing.Add(1)
+	for _, finding := range result.Reveals {
+		s.log(slog.LevelWarn, "Server reveals itself", "ip", result.IP, "port", result.Port, "finding", finding)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// destCacheMaxFails is how many verifications in a row a cached dest may
+// fail before it is dropped
+const destCacheMaxFails = 3
+
+// CachedDest is a host that was feasible in an earlier scan
+type CachedDest struct {
+	IP           string    `json:"ip"`
+	Port         int       `json:"port"`
+	Origin       string    `json:"origin"`
+	Domain       string    `json:"domain"`
+	LastFeasible time.Time `json:"last_feasible"`
+	// Fails counts verifications in a row the host was not feasible in
+	Fails int `json:"fails,omitempty"`
+}
+
+// DestCache keeps the feasible hosts of all scans so they can be
+// verified again quickly
+type DestCache struct {
+	path  string
+	mu    sync.Mutex
+	dests map[string]*CachedDest
+}
+
+// defaultDestCachePath is the cache shared by the CLI and the GUI
+func defaultDestCachePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "RealiTLScanner", "dests.json"), nil
+}
+
+// LoadDestCache reads the cache at path, a missing file is an empty cache
+func LoadDestCache(path string) (*DestCache, error) {
+	c := &DestCache{path: path, dests: make(map[string]*CachedDest)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dests []*CachedDest
+	if err := json.Unmarshal(data, &dests); err != nil {
+		return nil, err
+	}
+	for _, d := range dests {
+		c.dests[net.JoinHostPort(d.IP, strconv.Itoa(d.Port))] = d
+	}
+	return c, nil
+}
+
+// Add records a feasible result
+func (c *DestCache) Add(result ScanResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dests[net.JoinHostPort(result.IP, strconv.Itoa(result.Port))] = &CachedDest{
+		IP:           result.IP,
+		Port:         result.Port,
+		Origin:       result.Origin,
+		Domain:       result.Domain,
+		LastFeasible: time.Now(),
+	}
+}
+
+// Hosts returns the cached dests on port as scan input, most recently
+// feasible first
+func (c *DestCache) Hosts(port int) []Host {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var dests []*CachedDest
+	for _, d := range c.dests {
+		if d.Port == port {
+			dests = append(dests, d)
+		}
+	}
+	sort.Slice(dests, func(i, j int) bool {
+		return dests[i].LastFeasible.After(dests[j].LastFeasible)
+	})
+	hosts := make([]Host, 0, len(dests))
+	for i, d := range dests {
+		hosts = append(hosts, knownHost(d.IP, d.Origin, i))
+	}
+	return hosts
+}
+
+// knownHost returns the host to re-check a dest found at ip from origin
+func knownHost(ip, origin string, index int) Host {
+	host := Host{IP: net.ParseIP(ip), Origin: origin, Type: HostTypeIP, Index: index}
+	// Keep sending the SNI the host was found with
+	if net.ParseIP(origin) == nil {
+		if _, _, err := net.ParseCIDR(origin); err != nil && !isIPRangeLine(origin) {
+			host.Type = HostTypeDomain
+		}
+	}
+	return host
+}
+
+// Len returns the number of cached dests
+func (c *DestCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.dests)
+}
+
+// Expire counts a failed verification for every dest on port that was not
+// feasible since t and drops the ones that failed too often
+func (c *DestCache) Expire(port int, t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, d := range c.dests {
+		if d.Port != port || !d.LastFeasible.Before(t) {
+			continue
+		}
+		d.Fails++
+		if d.Fails >= destCacheMaxFails {
+			delete(c.dests, key)
+		}
+	}
+}
+
+// Save writes the cache back to its file
+func (c *DestCache) Save() error {
+	c.mu.Lock()
+	dests := make([]*CachedDest, 0, len(c.dests))
+	for _, d := range c.dests {
+		dests = append(dests, d)
+	}
+	sort.Slice(dests, func(i, j int) bool {
+		return dests[i].LastFeasible.After(dests[j].LastFeasible)
+	})
+	data, err := json.MarshalIndent(dests, "", "  ")
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// hostsChan feeds hosts to a scan
+func hostsChan(hosts []Host) <-chan Host {
+	ch := make(chan Host)
+	go func() {
+		defer close(ch)
+		for _, host := range hosts {
+			ch <- host
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// resultCaps counts the feasible results reported per country and AS
+// number, for Config.MaxPerCountry and MaxPerASN
+type resultCaps struct {
+	maxCountry int
+	maxASN     int
+	mu         sync.Mutex
+	countries  map[string]int
+	asns       map[uint]int
+}
+
+// newResultCaps returns the caps of config, nil when there are none
+func newResultCaps(config *ScanConfig) *resultCaps {
+	if config.MaxPerCountry <= 0 && config.MaxPerASN <= 0 {
+		return nil
+	}
+	return &resultCaps{
+		maxCountry: config.MaxPerCountry,
+		maxASN:     config.MaxPerASN,
+		countries:  make(map[string]int),
+		asns:       make(map[uint]int),
+	}
+}
+
+// full reports whether the country or the AS number already has as many
+// feasible results as allowed. Hosts of no known country or AS are never
+// capped.
+func (c *resultCaps) full(country string, asn uint) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.over(country, asn)
+}
+
+// add counts a feasible result unless its country or AS number is full,
+// reporting whether it was counted
+func (c *resultCaps) add(country string, asn uint) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.over(country, asn) {
+		return false
+	}
+	c.countries[country]++
+	c.asns[asn]++
+	return true
+}
+
+// over is full with c.mu held
+func (c *resultCaps) over(country string, asn uint) bool {
+	return c.maxCountry > 0 && country != "" && c.countries[country] >= c.maxCountry ||
+		c.maxASN > 0 && asn != 0 && c.asns[asn] >= c.maxASN
+}
+
+// countriesFull reports whether every one of countries has reached the cap
+func (c *resultCaps) countriesFull(countries []string) bool {
+	if c.maxCountry <= 0 || len(countries) == 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, country := range countries {
+		if c.countries[country] < c.maxCountry {
+			return false
+		}
+	}
+	return true
+}
+
+// capReached reports whether ip is in a country or AS that already has
+// enough feasible results, so that it need not be scanned
+func (s *Scanner) capReached(ip net.IP) bool {
+	if s.caps == nil {
+		return false
+	}
+	var asn uint
+	if s.caps.maxASN > 0 {
+		asn, _ = s.Geo.GetASN(ip)
+	}
+	return s.caps.full(s.Geo.GetGeo(ip), asn)
+}
+
+// admitCapped counts a feasible result against the caps, reporting whether
+// it is still to be reported. The scan stops once every allowed country is
+// full, as nothing else can be found.
+func (s *Scanner) admitCapped(result ScanResult) bool {
+	if s.caps == nil || !result.Feasible {
+		return true
+	}
+	if !s.caps.add(result.GeoCode, result.ASN) {
+		s.log(slog.LevelDebug, "Dropping feasible host over the cap", "ip", result.IP,
+			"geo", result.GeoCode, "asn", result.ASN)
+		s.Stats.Capped.Add(1)
+		return false
+	}
+	if s.caps.countriesFull(s.Config.AllowCountries) {
+		s.log(slog.LevelInfo, "Every allowed country has enough feasible hosts, stopping",
+			"max-per-country", s.caps.maxCountry)
+		s.Stop()
+	}
+	return true
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats of the handshake captures of Config.CaptureDir
+const (
+	CaptureHex  = "hex"
+	CapturePcap = "pcap"
+)
+
+// captureMaxBytes caps the bytes recorded in each direction, a handshake
+// with a long chain fits well within it
+const captureMaxBytes = 256 << 10
+
+// captureChunk is the data of one read or write on the connection
+type captureChunk struct {
+	sent bool
+	at   time.Time
+	data []byte
+}
+
+// captureConn records the bytes of a connection until stop is called
+type captureConn struct {
+	net.Conn
+	start time.Time
+
+	mu       sync.Mutex
+	chunks   []captureChunk
+	sent     int
+	received int
+	stopped  bool
+}
+
+func newCaptureConn(conn net.Conn) *captureConn {
+	return &captureConn{Conn: conn, start: time.Now()}
+}
+
+func (c *captureConn) record(sent bool, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	total := &c.received
+	if sent {
+		total = &c.sent
+	}
+	if c.stopped || len(data) == 0 || *total >= captureMaxBytes {
+		return
+	}
+	data = data[:min(len(data), captureMaxBytes-*total)]
+	*total += len(data)
+	c.chunks = append(c.chunks, captureChunk{sent: sent, at: time.Now(), data: append([]byte(nil), data...)})
+}
+
+func (c *captureConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.record(false, b[:n])
+	return n, err
+}
+
+func (c *captureConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.record(true, b[:n])
+	return n, err
+}
+
+// stop ends the recording once the handshake is over, returning what was
+// recorded
+func (c *captureConn) stop() []captureChunk {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopped = true
+	return c.chunks
+}
+
+// captureFilename is the name the handshake with hostPort is saved under
+func captureFilename(hostPort, format string) string {
+	ext := ".txt"
+	if format == CapturePcap {
+		ext = ".pcap"
+	}
+	return strings.NewReplacer(":", "_", "[", "", "]", "").Replace(hostPort) + ext
+}
+
+// saveCapture writes the handshake recorded on c to Config.CaptureDir,
+// with the error it failed with if any
+func (s *Scanner) saveCapture(c *captureConn, sni string, handshakeErr error) {
+	chunks := c.stop()
+	hostPort := c.RemoteAddr().String()
+	path := filepath.Join(s.Config.CaptureDir, captureFilename(hostPort, s.Config.CaptureFormat))
+	f, err := os.Create(path)
+	if err != nil {
+		s.log(slog.LevelWarn, "Cannot save handshake capture", "path", path, "err", err)
+		return
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if s.Config.CaptureFormat == CapturePcap {
+		writeCapturePcap(w, c.LocalAddr(), c.RemoteAddr(), c.start, chunks)
+	} else {
+		writeCaptureHex(w, hostPort, sni, c.start, chunks, handshakeErr)
+	}
+	if err := w.Flush(); err != nil {
+		s.log(slog.LevelWarn, "Cannot save handshake capture", "path", path, "err", err)
+	}
+}
+
+// tlsContentTypes names the TLS record types
+var tlsContentTypes = map[byte]string{
+	20: "change_cipher_spec",
+	21: "alert",
+	22: "handshake",
+	23: "application_data",
+}
+
+// tlsHandshakeTypes names the handshake messages sent in the clear
+var tlsHandshakeTypes = map[byte]string{
+	1:  "ClientHello",
+	2:  "ServerHello",
+	4:  "NewSessionTicket",
+	8:  "EncryptedExtensions",
+	11: "Certificate",
+	12: "ServerKeyExchange",
+	13: "CertificateRequest",
+	14: "ServerHelloDone",
+	15: "CertificateVerify",
+	16: "ClientKeyExchange",
+	20: "Finished",
+}
+
+// describeRecord names a TLS record by its type and, for handshake records
+// in the clear, its first message
+func describeRecord(record []byte) string {
+	name, ok := tlsContentTypes[record[0]]
+	if !ok {
+		return fmt.Sprintf("unknown record type %d", record[0])
+	}
+	body := record[5:]
+	switch {
+	case record[0] == 22 && len(body) > 0:
+		message, ok := tlsHandshakeTypes[body[0]]
+		if !ok {
+			// Handshake messages after a TLS 1.2 ChangeCipherSpec are
+			// encrypted
+			return name + " (encrypted)"
+		}
+		if body[0] == 2 && isHelloRetry(body) {
+			message = "HelloRetryRequest"
+		}
+		return name + " " + message
+	case record[0] == 23:
+		return name + " (encrypted)"
+	}
+	return name
+}
+
+// writeCaptureHex writes a transcript of the TLS records of chunks, each
+// as a hex dump with the time since the connection was opened
+func writeCaptureHex(w io.Writer, hostPort, sni string, start time.Time, chunks []captureChunk, handshakeErr error) {
+	fmt.Fprintf(w, "# TLS handshake with %s, SNI %q, at %s\n", hostPort, sni, start.UTC().Format(time.RFC3339))
+	if handshakeErr != nil {
+		fmt.Fprintf(w, "# failed: %v\n", handshakeErr)
+	}
+	// Records may be split over reads, and reads may hold several records
+	var pending [2][]byte
+	for _, chunk := range chunks {
+		dir, arrow := 0, "<"
+		if chunk.sent {
+			dir, arrow = 1, ">"
+		}
+		pending[dir] = append(pending[dir], chunk.data...)
+		for len(pending[dir]) >= 5 {
+			size := 5 + int(binary.BigEndian.Uint16(pending[dir][3:5]))
+			if len(pending[dir]) < size {
+				break
+			}
+			record := pending[dir][:size]
+			pending[dir] = pending[dir][size:]
+			fmt.Fprintf(w, "\n%s %.3f ms %s, %d bytes\n", arrow,
+				float64(chunk.at.Sub(start).Microseconds())/1000, describeRecord(record), len(record))
+			_, _ = io.WriteString(w, hex.Dump(record))
+		}
+	}
+	for dir, rest := range pending {
+		if len(rest) > 0 {
+			fmt.Fprintf(w, "\n%s incomplete record, %d bytes\n", [2]string{"<", ">"}[dir], len(rest))
+			_, _ = io.WriteString(w, hex.Dump(rest))
+		}
+	}
+}
+
+// pcapSegment is the most payload put into one packet of a pcap capture
+const pcapSegment = 1400
+
+// writeCapturePcap writes chunks as a pcap file of raw IP packets that
+// Wireshark dissects as TLS. The packets are made up from the data: the
+// TCP handshake, sequence numbers and acknowledgements are synthesized and
+// checksums are left at zero.
+func writeCapturePcap(w io.Writer, local, remote net.Addr, start time.Time, chunks []captureChunk) {
+	laddr, _ := local.(*net.TCPAddr)
+	raddr, _ := remote.(*net.TCPAddr)
+	if laddr == nil || raddr == nil {
+		return
+	}
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	// LINKTYPE_RAW, packets start with the IP header
+	binary.LittleEndian.PutUint32(header[20:], 101)
+	_, _ = w.Write(header)
+
+	const (
+		flagFIN = 0x01
+		flagSYN = 0x02
+		flagPSH = 0x08
+		flagACK = 0x10
+	)
+	// seq[0] is the next sequence number of the client, seq[1] of the server
+	seq := [2]uint32{1000, 5000}
+	packet := func(at time.Time, fromClient bool, flags byte, payload []byte) {
+		src, dst := laddr, raddr
+		from, to := 0, 1
+		if !fromClient {
+			src, dst = raddr, laddr
+			from, to = 1, 0
+		}
+		tcp := make([]byte, 20, 20+len(payload))
+		binary.BigEndian.PutUint16(tcp[0:], uint16(src.Port))
+		binary.BigEndian.PutUint16(tcp[2:], uint16(dst.Port))
+		binary.BigEndian.PutUint32(tcp[4:], seq[from])
+		if flags&flagACK != 0 {
+			binary.BigEndian.PutUint32(tcp[8:], seq[to])
+		}
+		tcp[12] = 5 << 4
+		tcp[13] = flags
+		binary.BigEndian.PutUint16(tcp[14:], 65535)
+		tcp = append(tcp, payload...)
+		seq[from] += uint32(len(payload))
+		if flags&(flagSYN|flagFIN) != 0 {
+			seq[from]++
+		}
+
+		var ip []byte
+		if src4, dst4 := src.IP.To4(), dst.IP.To4(); src4 != nil && dst4 != nil {
+			ip = make([]byte, 20, 20+len(tcp))
+			ip[0] = 0x45
+			binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+			ip[8] = 64
+			ip[9] = 6
+			copy(ip[12:], src4)
+			copy(ip[16:], dst4)
+		} else {
+			ip = make([]byte, 40, 40+len(tcp))
+			ip[0] = 0x60
+			binary.BigEndian.PutUint16(ip[4:], uint16(len(tcp)))
+			ip[6] = 6
+			ip[7] = 64
+			copy(ip[8:], src.IP.To16())
+			copy(ip[24:], dst.IP.To16())
+		}
+		ip = append(ip, tcp...)
+
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[0:], uint32(at.Unix()))
+		binary.LittleEndian.PutUint32(record[4:], uint32(at.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(ip)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(ip)))
+		_, _ = w.Write(record)
+		_, _ = w.Write(ip)
+	}
+
+	packet(start, true, flagSYN, nil)
+	packet(start, false, flagSYN|flagACK, nil)
+	packet(start, true, flagACK, nil)
+	for _, chunk := range chunks {
+		for data := chunk.data; len(data) > 0; {
+			n := min(len(data), pcapSegment)
+			packet(chunk.at, chunk.sent, flagPSH|flagACK, data[:n])
+			data = data[n:]
+		}
+	}
+}
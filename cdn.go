@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"crypto/x509"
+	_ "embed"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// CDN providers
+const (
+	CDNCloudflare = "Cloudflare"
+	CDNFastly     = "Fastly"
+	CDNAkamai     = "Akamai"
+	CDNCloudFront = "CloudFront"
+	CDNGCore      = "GCore"
+)
+
+// cdnRangesData lists the published edge ranges of CDNs
+//
+//go:embed cdn_ranges.txt
+var cdnRangesData string
+
+type cdnRange struct {
+	prefix   netip.Prefix
+	provider string
+}
+
+var (
+	cdnOnce   sync.Once
+	cdnRanges []cdnRange
+)
+
+// cdnASNs are autonomous systems that only serve CDN edges
+var cdnASNs = map[uint]string{
+	13335:  CDNCloudflare,
+	209242: CDNCloudflare,
+	54113:  CDNFastly,
+	20940:  CDNAkamai,
+	16625:  CDNAkamai,
+	16702:  CDNAkamai,
+	21342:  CDNAkamai,
+	32787:  CDNAkamai,
+	199524: CDNGCore,
+	202422: CDNGCore,
+}
+
+// cdnCertSuffixes are certificate names of CDN edges themselves
+var cdnCertSuffixes = []struct {
+	suffix   string
+	provider string
+}{
+	{".cloudflaressl.com", CDNCloudflare},
+	{".cloudfront.net", CDNCloudFront},
+	{".fastly.net", CDNFastly},
+	{".akamaized.net", CDNAkamai},
+	{".akamaihd.net", CDNAkamai},
+	{".edgekey.net", CDNAkamai},
+	{".gcdn.co", CDNGCore},
+}
+
+// cdnServers are substrings of the lower case Server header of CDN edges
+var cdnServers = []struct {
+	server   string
+	provider string
+}{
+	{"cloudflare", CDNCloudflare},
+	{"cloudfront", CDNCloudFront},
+	{"akamaighost", CDNAkamai},
+	{"akamainetstorage", CDNAkamai},
+	{"gcore", CDNGCore},
+}
+
+// loadCDNRanges parses the embedded ranges once
+func loadCDNRanges() []cdnRange {
+	cdnOnce.Do(func() {
+		scanner := bufio.NewScanner(strings.NewReader(cdnRangesData))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			prefix, err := netip.ParsePrefix(fields[1])
+			if err != nil {
+				slog.Warn("Invalid CDN range", "range", fields[1])
+				continue
+			}
+			cdnRanges = append(cdnRanges, cdnRange{prefix: prefix.Masked(), provider: fields[0]})
+		}
+	})
+	return cdnRanges
+}
+
+// DetectCDN returns the CDN a host belongs to, "" if none is recognized.
+// It checks the published edge ranges, the AS number (0 if unknown), the
+// certificate issuer and names, and the Server header ("" if not probed).
+func DetectCDN(ip net.IP, asn uint, cert *x509.Certificate, server string) string {
+	if addr, ok := netip.AddrFromSlice(ip); ok {
+		addr = addr.Unmap()
+		for _, r := range loadCDNRanges() {
+			if r.prefix.Contains(addr) {
+				return r.provider
+			}
+		}
+	}
+	if provider, ok := cdnASNs[asn]; ok {
+		return provider
+	}
+	if cert != nil {
+		for _, org := range cert.Issuer.Organization {
+			if strings.HasPrefix(strings.ToLower(org), "cloudflare") {
+				return CDNCloudflare
+			}
+		}
+		for _, name := range append([]string{cert.Subject.CommonName}, cert.DNSNames...) {
+			name = strings.ToLower(name)
+			for _, c := range cdnCertSuffixes {
+				if strings.HasSuffix(name, c.suffix) {
+					return c.provider
+				}
+			}
+		}
+	}
+	server = strings.ToLower(server)
+	for _, c := range cdnServers {
+		if server != "" && strings.Contains(server, c.server) {
+			return c.provider
+		}
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// chainPEM encodes the certificates sent by a host, leaf first
+func chainPEM(certs []*x509.Certificate) []string {
+	chain := make([]string, 0, len(certs))
+	for _, cert := range certs {
+		chain = append(chain, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})))
+	}
+	return chain
+}
+
+// certsFilename is the name the chain of result is saved under, colons of
+// IPv6 addresses are not allowed in Windows file names
+func certsFilename(result ScanResult) string {
+	return fmt.Sprintf("%s_%d.pem", strings.ReplaceAll(result.IP, ":", "-"), result.Port)
+}
+
+// saveCertChain writes the chain of result to a PEM file in dir
+func saveCertChain(dir string, result ScanResult) error {
+	return os.WriteFile(filepath.Join(dir, certsFilename(result)), []byte(strings.Join(result.Chain, "")), 0644)
+}
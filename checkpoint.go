@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// checkpointInterval is how often the scan position is persisted
+const checkpointInterval = 5 * time.Second
+
+// CheckpointState is the on-disk representation of a scan position
+type CheckpointState struct {
+	Source string `json:"source"`
+	Port   int    `json:"port"`
+	Offset int    `json:"offset"`
+	// Output is the expanded path of the output file, which a resumed
+	// scan keeps writing to even if its placeholders expand differently
+	Output  string    `json:"output,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// Checkpoint tracks which hosts have been scanned and periodically saves
+// the position below which every host is done, so an interrupted scan can
+// be continued with the same source
+type Checkpoint struct {
+	path   string
+	source string
+	port   int
+
+	mu     sync.Mutex
+	offset int
+	output string
+	done   map[int]struct{}
+	dirty  bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// LoadCheckpoint opens the state file at path. The saved offset is only
+// reused if it was written for the same source and port.
+func LoadCheckpoint(path, source string, port int) (*Checkpoint, error) {
+	c := &Checkpoint{
+		path:   path,
+		source: source,
+		port:   port,
+		done:   make(map[int]struct{}),
+		stop:   make(chan struct{}),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	var state CheckpointState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if state.Source != source || state.Port != port {
+		slog.Warn("Checkpoint belongs to a different scan, starting over",
+			"path", path, "source", state.Source, "port", state.Port)
+		return c, nil
+	}
+	c.offset = state.Offset
+	c.output = state.Output
+	return c, nil
+}
+
+// Output returns the output path saved by the interrupted run, "" if none
+func (c *Checkpoint) Output() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.output
+}
+
+// SetOutput records the output path the scan writes to
+func (c *Checkpoint) SetOutput(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.output = path
+	c.dirty = true
+}
+
+// Offset returns the number of leading hosts that are already scanned
+func (c *Checkpoint) Offset() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset
+}
+
+// Done marks the host with the given iterator index as scanned
+func (c *Checkpoint) Done(index int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index < c.offset {
+		return
+	}
+	c.done[index] = struct{}{}
+	for {
+		if _, ok := c.done[c.offset]; !ok {
+			break
+		}
+		delete(c.done, c.offset)
+		c.offset++
+		c.dirty = true
+	}
+}
+
+// Start saves the checkpoint in the background until Close is called
+func (c *Checkpoint) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(checkpointInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.Save(); err != nil {
+					slog.Warn("Failed to save checkpoint", "err", err)
+				}
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Save writes the current position to the state file if it changed
+func (c *Checkpoint) Save() error {
+	c.mu.Lock()
+	if !c.dirty {
+		c.mu.Unlock()
+		return nil
+	}
+	state := CheckpointState{
+		Source:  c.source,
+		Port:    c.port,
+		Offset:  c.offset,
+		Output:  c.output,
+		Updated: time.Now(),
+	}
+	c.dirty = false
+	c.mu.Unlock()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a torn state
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// Close stops background saving and writes the final position. When the
+// scan completed the state file is removed instead.
+func (c *Checkpoint) Close(completed bool) error {
+	close(c.stop)
+	c.wg.Wait()
+	if completed {
+		err := os.Remove(c.path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return c.Save()
+}
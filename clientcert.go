@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+)
+
+// loadClientCert loads the client certificate of the configuration, nil
+// without one. The key is read from ClientKey, or from the certificate
+// file when it holds both.
+func (c *ScanConfig) loadClientCert() (*tls.Certificate, error) {
+	if c.ClientCert == "" {
+		if c.ClientKey != "" {
+			return nil, fmt.Errorf("client key %s given without a client certificate", c.ClientKey)
+		}
+		return nil, nil
+	}
+	keyFile := c.ClientKey
+	if keyFile == "" {
+		keyFile = c.ClientCert
+	}
+	cert, err := tls.LoadX509KeyPair(c.ClientCert, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// setupClientCert loads the client certificate presented to the hosts
+func (s *Scanner) setupClientCert() {
+	cert, err := s.Config.loadClientCert()
+	if err != nil {
+		s.log(slog.LevelError, "Scanning without a client certificate", "err", err)
+		return
+	}
+	s.clientCert = cert
+}
+
+// clientAuth makes tlsCfg present the client certificate to hosts asking
+// for one. It is sent whatever authorities the host accepts, as mTLS
+// servers often do not list them.
+func (s *Scanner) clientAuth(tlsCfg *tls.Config) *tls.Config {
+	if s.clientCert != nil {
+		cert := s.clientCert
+		tlsCfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
+		}
+	}
+	return tlsCfg
+}
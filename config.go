@@ -1,26 +1,306 @@
 package main
 
-import "context"
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 // ScanConfig contains all scanning parameters
 type ScanConfig struct {
-	Port       int
-	Thread     int
-	Timeout    int
-	EnableIPv6 bool
-	Verbose    bool
+	Port       int  `json:"port"`
+	Thread     int  `json:"thread"`
+	Timeout    int  `json:"timeout"`
+	EnableIPv6 bool `json:"enable_ipv6"`
+	Verbose    bool `json:"verbose"`
+	// HappyEyeballs races the IPv6 and IPv4 addresses of dual-stack
+	// domains and scans the domain once over the first to connect, filling
+	// ScanResult.Family and Families. It needs EnableIPv6.
+	HappyEyeballs bool `json:"happy_eyeballs"`
+	// IdleTest is how long (in seconds) feasible connections are held idle
+	// to check that they are not dropped, 0 disables the test
+	IdleTest int `json:"idle_test"`
+	// EnableASN downloads GeoLite2-ASN and fills ScanResult.ASN and ASOrg
+	EnableASN bool `json:"enable_asn"`
+	// SourcePortMin and SourcePortMax restrict local ports to a range that
+	// is picked from at random, 0 lets the operating system choose
+	SourcePortMin int `json:"source_port_min"`
+	SourcePortMax int `json:"source_port_max"`
+	// ReuseAddr sets SO_REUSEADDR on outgoing sockets
+	ReuseAddr bool `json:"reuse_addr"`
+	// KeepAlive is the TCP keepalive period in seconds, 0 for the default
+	// of 15 seconds and negative to turn keepalives off
+	KeepAlive int `json:"keep_alive"`
+	// FastOpen sends the ClientHello with the SYN using TCP Fast Open, for
+	// hosts that have handed out a cookie before. Linux only.
+	FastOpen bool `json:"fast_open"`
+	// BindDevice binds outgoing sockets to a network interface such as a
+	// PPPoE or VPN link with SO_BINDTODEVICE, regardless of the routing
+	// table. Linux only, usually needs CAP_NET_RAW.
+	BindDevice string `json:"bind_device"`
+	// ExpandPrefix also scans the network of this IPv4 prefix length around
+	// every feasible host, e.g. 24, 0 disables
+	ExpandPrefix int `json:"expand_prefix"`
+	// NetworkCap limits how many hosts of one IPv4 /16 (IPv6 /48) are
+	// scanned at the same time, 0 disables the limit
+	NetworkCap int `json:"network_cap"`
+	// SkipScannedDays skips IPs the Session store has scanned within this
+	// many days, 0 scans everything
+	SkipScannedDays int `json:"skip_scanned_days"`
+	// ProbePQ checks feasible hosts for the X25519MLKEM768 hybrid key share
+	// and fills ScanResult.Curve
+	ProbePQ bool `json:"probe_pq"`
+	// RateLimit caps how many connections per second all workers open
+	// together, 0 disables the limit
+	RateLimit float64 `json:"rate_limit"`
+	// ProbeHTTP sends an HTTP/2 GET / to feasible hosts and fills the HTTP
+	// fields of ScanResult
+	ProbeHTTP bool `json:"probe_http"`
+	// ServerName replaces the SNI sent to every host, NoSNI sends none.
+	// By default domains are sent as SNI and IPs go without.
+	ServerName string `json:"server_name"`
+	NoSNI      bool   `json:"no_sni"`
+	// DualProbe repeats the handshake with feasible hosts with the other
+	// SNI choice and fills ScanResult.DualDomain and CertDiffers
+	DualProbe bool `json:"dual_probe"`
+	// SNIMatrix are candidate SNIs the handshake is repeated with for every
+	// host, filling ScanResult.SNIs
+	SNIMatrix []string `json:"sni_matrix,omitempty"`
+	// DedupeBloom keeps the IP:port pairs scanned in the session in a bloom
+	// filter sized for this many hosts instead of an exact set, for ranges
+	// too large to hold in memory, 0 uses the exact set
+	DedupeBloom int `json:"dedupe_bloom"`
+	// SaveCerts fills ScanResult.Chain with the certificates every host
+	// sent
+	SaveCerts bool `json:"save_certs"`
+	// CaptureDir is a directory to save the raw bytes of every handshake
+	// in, one file per target in CaptureFormat: CaptureHex for an
+	// annotated hex dump of the TLS records, CapturePcap for Wireshark
+	CaptureDir    string `json:"capture_dir,omitempty"`
+	CaptureFormat string `json:"capture_format,omitempty"`
+	// KeyLogFile is a file the TLS secrets of every handshake are appended
+	// to, for Wireshark to decrypt captured traffic of the scan
+	KeyLogFile string `json:"key_log_file,omitempty"`
+	// SourceAddrs are local IPs outgoing connections are bound to in turn,
+	// hosts of an address family without one are dialed from the default
+	// address
+	SourceAddrs []string `json:"source_addrs,omitempty"`
+	// TLSDetails fills ScanResult.CipherSuite and KeyExchange
+	TLSDetails bool `json:"tls_details"`
+	// ClientCert is a PEM certificate presented to hosts asking for one,
+	// to scan servers behind mutual TLS. ClientKey is its private key,
+	// read from ClientCert when empty.
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
+	// GeoDB and ASNDB are database files used instead of the downloaded
+	// ones, GeoMirror replaces the download URL and GeoProxy is a proxy
+	// for the downloads
+	GeoDB     string `json:"geo_db,omitempty"`
+	ASNDB     string `json:"asn_db,omitempty"`
+	GeoMirror string `json:"geo_mirror,omitempty"`
+	GeoProxy  string `json:"geo_proxy,omitempty"`
+	// GeoCity opens the GeoLite2-City database, or CityDB instead, and
+	// fills ScanResult.City, Latitude and Longitude
+	GeoCity bool   `json:"geo_city"`
+	CityDB  string `json:"city_db,omitempty"`
+	// GeoLicenseKey downloads the databases from MaxMind, it is kept out
+	// of manifests
+	GeoLicenseKey string `json:"-"`
+	// GeoProviders are the country providers asked in turn, see
+	// GeoOptions.Providers
+	GeoProviders  []string `json:"geo_providers,omitempty"`
+	DBIPDB        string   `json:"dbip_db,omitempty"`
+	IP2LocationDB string   `json:"ip2location_db,omitempty"`
+	GeoAPI        string   `json:"geo_api,omitempty"`
+	// GeoUpdateHours checks for new databases this often while scanning,
+	// 0 only checks before the scan
+	GeoUpdateHours int `json:"geo_update_hours"`
+	// DetectCDN fills ScanResult.CDN, SkipCDN also reports hosts of a CDN
+	// as not feasible
+	DetectCDN bool `json:"detect_cdn"`
+	SkipCDN   bool `json:"skip_cdn"`
+	// DetectHoneypots reports hosts that look like honeypots or tarpits
+	// as not feasible and sets ScanResult.Honeypot
+	DetectHoneypots bool `json:"detect_honeypots"`
+	// Audit checks the hosts as servers of one's own that should pass for
+	// a dest and fills ScanResult.Reveals with how they give themselves
+	// away
+	Audit bool `json:"audit,omitempty"`
+	// TopList is set when the domains of the source come from a top list
+	// and adds ScanResult.Rank to the outputs
+	TopList bool `json:"top_list,omitempty"`
+	// PortColumn is set when the hosts of the source can have their own
+	// port, as in masscan or ZMap output, and adds ScanResult.Port to CSV
+	// outputs
+	PortColumn bool `json:"port_column,omitempty"`
+	// Retries is how many times a host is tried again after a timeout or
+	// a dropped connection, with growing delays in between
+	Retries int `json:"retries"`
+	// Adaptive starts with fewer workers and adds or removes some as the
+	// share of timeouts changes, Thread is the most that run
+	Adaptive bool `json:"adaptive"`
+	// CheckOCSP fills ScanResult.OCSP and OCSPStapled for feasible hosts,
+	// asking the responder of certificates the host did not staple
+	CheckOCSP bool `json:"check_ocsp"`
+	// Shuffle scans the addresses of every CIDR block in a pseudo-random
+	// order instead of from the first to the last, so that a partial scan
+	// samples the whole block
+	Shuffle bool `json:"shuffle"`
+	// Subdomains are prefixes tried under every domain of the source, e.g.
+	// www and cdn, as the origin of a site is often on a subdomain while
+	// the apex is behind a CDN. SubdomainCT also scans the subdomains of
+	// every domain found in Certificate Transparency logs.
+	Subdomains  []string `json:"subdomains,omitempty"`
+	SubdomainCT bool     `json:"subdomain_ct,omitempty"`
+	// ProbeH3 tries a QUIC handshake with feasible hosts on the UDP port
+	// of the scan and fills ScanResult.H3
+	ProbeH3 bool `json:"probe_h3"`
+	// ProbeResumption repeats the handshake with feasible hosts presenting
+	// the session ticket they issued and fills ScanResult.Resumption
+	ProbeResumption bool `json:"probe_resumption"`
+	// ProbeHRR repeats the handshake with feasible hosts offering more
+	// groups than X25519 and fills ScanResult.HRR
+	ProbeHRR bool `json:"probe_hrr"`
+	// DNSMatch resolves the certificate domain of feasible hosts and fills
+	// ScanResult.DNSMatch
+	DNSMatch bool `json:"dns_match"`
+	// SpeedTestKB downloads up to this many KB of the page of feasible
+	// hosts over HTTP/2 and fills ScanResult.SpeedKBps, 0 disables
+	SpeedTestKB int `json:"speedtest_kb"`
+	// PreCheckThreads workers connect to every host with a timeout of
+	// PreCheckTimeout milliseconds before the TLS stage, which only gets
+	// the hosts that accepted the connection, 0 disables the pre-check
+	PreCheckThreads int `json:"precheck_threads"`
+	PreCheckTimeout int `json:"precheck_timeout"`
+	// AllowCountries are the upper case country codes hosts are scanned
+	// in, hosts elsewhere are skipped before connecting, empty allows all
+	AllowCountries []string `json:"allow_countries,omitempty"`
+	// MaxPerCountry and MaxPerASN cap the feasible hosts reported per
+	// country and AS number, hosts of a full one are no longer scanned.
+	// 0 disables a cap. AS numbers are looked up for MaxPerASN even
+	// without EnableASN.
+	MaxPerCountry int `json:"max_per_country"`
+	MaxPerASN     int `json:"max_per_asn"`
+	// DNSServers resolve the domains of the source instead of the system
+	// resolver, tried in turn: IP:port of DNS servers and https URLs of
+	// DNS-over-HTTPS endpoints. A lookup times out after DNSTimeout
+	// seconds, 0 for the default.
+	DNSServers []string `json:"dns_servers,omitempty"`
+	DNSTimeout int      `json:"dns_timeout"`
+	// Feasibility decides which hosts are reported as feasible, the zero
+	// value is the default rule
+	Feasibility FeasibilityPolicy `json:"feasibility"`
+	// Timing is the timing profile pacing connections: paranoid, slow and
+	// normal wait a random time before each connection and cap the rate
+	// to every /24, fast and "" do not
+	Timing string `json:"timing,omitempty"`
+}
+
+// GeoOptions returns the database options of the configuration
+func (c *ScanConfig) GeoOptions() GeoOptions {
+	return GeoOptions{CountryPath: c.GeoDB, ASNPath: c.ASNDB, Mirror: c.GeoMirror, Proxy: c.GeoProxy,
+		LicenseKey: c.GeoLicenseKey, City: c.GeoCity, CityPath: c.CityDB, Providers: c.GeoProviders,
+		DBIPPath: c.DBIPDB, IP2LocationPath: c.IP2LocationDB, APIURL: c.GeoAPI}
 }
 
 // ScanResult represents the scan result for one host
 type ScanResult struct {
-	IP         string
-	Origin     string
-	Domain     string
-	Issuer     string
-	GeoCode    string
-	Feasible   bool
-	TLSVersion string
-	ALPN       string
+	IP         string   `json:"ip"`
+	Port       int      `json:"port"`
+	Origin     string   `json:"origin"`
+	Domain     string   `json:"domain"`
+	Issuer     string   `json:"issuer"`
+	GeoCode    string   `json:"geo_code"`
+	Feasible   bool     `json:"feasible"`
+	TLSVersion string   `json:"tls_version"`
+	ALPN       string   `json:"alpn"`
+	Idle       string   `json:"idle,omitempty"`
+	ASN        uint     `json:"asn,omitempty"`
+	ASOrg      string   `json:"as_org,omitempty"`
+	SANs       []string `json:"sans,omitempty"`
+	// Curve is the best key exchange group the host accepted, only set
+	// when the PQ probe is enabled
+	Curve string `json:"curve,omitempty"`
+	// HTTPStatus, HTTPServer and HTTPContent are the answer to GET / when
+	// the HTTP probe is enabled, a status of 0 means the request failed
+	HTTPStatus  int    `json:"http_status,omitempty"`
+	HTTPServer  string `json:"http_server,omitempty"`
+	HTTPContent bool   `json:"http_content,omitempty"`
+	// DualDomain is the certificate domain served to the dual probe and
+	// CertDiffers whether its certificate was another one. DualError is why
+	// the probe got no certificate to compare.
+	DualDomain  string `json:"dual_domain,omitempty"`
+	CertDiffers bool   `json:"cert_differs,omitempty"`
+	DualError   string `json:"dual_error,omitempty"`
+	// SNIs is the certificate served to every SNI of the SNI matrix, only
+	// set when ScanConfig.SNIMatrix is
+	SNIs []SNIProbe `json:"sni_matrix,omitempty"`
+	// CipherSuite and KeyExchange are the negotiated cipher suite and key
+	// exchange group, only set when TLSDetails is enabled
+	CipherSuite string `json:"cipher_suite,omitempty"`
+	KeyExchange string `json:"key_exchange,omitempty"`
+	// CDN is the CDN provider of the host, only set when DetectCDN or
+	// SkipCDN is enabled
+	CDN string `json:"cdn,omitempty"`
+	// Honeypot is whether the host looks like a honeypot or tarpit, only
+	// set when DetectHoneypots is enabled
+	Honeypot bool `json:"honeypot,omitempty"`
+	// OCSP is the revocation status of the certificate and OCSPStapled
+	// whether the host stapled it, only set when CheckOCSP is enabled
+	OCSP        string `json:"ocsp,omitempty"`
+	OCSPStapled bool   `json:"ocsp_stapled,omitempty"`
+	// H3 is whether the host completed a QUIC handshake for HTTP/3, only
+	// set when ProbeH3 is enabled
+	H3 bool `json:"h3,omitempty"`
+	// Resumption is whether the host issued a session ticket and resumed
+	// the session with it: none, ticket or resumed, empty when the probe
+	// is disabled or failed
+	Resumption string `json:"resumption,omitempty"`
+	// HRR is the group the host asked for with a TLS 1.3 HelloRetryRequest
+	// when offered X25519, P-256, P-384 and P-521 with an X25519 key
+	// share, HRRNone without one, empty when the probe is disabled or
+	// failed
+	HRR string `json:"hrr,omitempty"`
+	// Reveals holds how the host gives itself away as a server of its own
+	// rather than a dest, only set when Audit is enabled
+	Reveals []string `json:"reveals,omitempty"`
+	// Rank is the rank of the origin in the top list of the source, 0 for
+	// other sources
+	Rank int `json:"rank,omitempty"`
+	// Family is the address family that won the Happy Eyeballs race of a
+	// dual-stack domain and Families how each family did, only set when
+	// HappyEyeballs is enabled
+	Family   string         `json:"family,omitempty"`
+	Families []FamilyResult `json:"families,omitempty"`
+	// DNSMatch is whether the certificate domain resolves to the IP of the
+	// host: match, mismatch or unresolved, empty when the check is
+	// disabled or the host is not feasible
+	DNSMatch string `json:"dns_match,omitempty"`
+	// SpeedKBps is the download throughput from the host in KB/s, 0 when
+	// the speed test is disabled or failed
+	SpeedKBps int `json:"speed_kbps,omitempty"`
+	// City, Latitude and Longitude locate the host, only set when the
+	// city database is open
+	City      string  `json:"city,omitempty"`
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	// Chain is the PEM encoded certificate chain sent by the host, leaf
+	// first, only set when SaveCerts is enabled
+	Chain []string `json:"chain,omitempty"`
+	// Score rates from 0 to 100 how well the certificate of a feasible
+	// dest passes for a real site, 0 for hosts that are not feasible
+	Score float64 `json:"score"`
+	// ConnectMs is the TCP connect time and HandshakeMs the TLS handshake
+	// time, both in milliseconds
+	ConnectMs   int `json:"connect_ms"`
+	HandshakeMs int `json:"handshake_ms"`
 }
 
 // ScanCallbacks contains callback functions for GUI
@@ -29,50 +309,289 @@ type ScanCallbacks struct {
 	OnProgress  func(current, total int)
 	OnLog       func(level, message string)
 	OnGeoStatus func(status string)
+	OnEvent     func(event ScanEvent)
 }
 
 // Scanner manages the scanning process
 type Scanner struct {
-	Config    *ScanConfig
-	Callbacks *ScanCallbacks
-	Geo       *Geo
-	ctx       context.Context
-	cancel    context.CancelFunc
+	Config     *ScanConfig
+	Callbacks  *ScanCallbacks
+	Geo        *Geo
+	Checkpoint *Checkpoint  // records which hosts have been scanned, may be nil
+	Session    *Session     // records results in a Store, may be nil
+	Cache      *DestCache   // collects feasible hosts, may be nil
+	Notifier   *Notifier    // pushes feasible hosts, may be nil
+	Webhook    *Webhook     // posts feasible hosts, may be nil
+	Exclude    *ExcludeList // hosts never scanned, may be nil
+	Processors []Processor  // run in turn on every result before it is reported
+	Total      int          // hosts in the source for OnProgress, 0 if unknown
+	Stats      ScanStats
+	progress   atomic.Int64 // source hosts done
+	started    atomic.Pointer[time.Time]
+	rate       rateMeter
+	skip       map[string]bool
+	idle       *IdleQueue
+	limiter    *RateLimiter
+	pacer      *pacer // nil unless Config.Timing paces connections
+	seen       seenSet
+	sources    *sourceAddrs
+	resolver   *Resolver
+	clientCert *tls.Certificate  // nil unless Config.ClientCert
+	keyLog     *os.File          // nil unless Config.KeyLogFile
+	adaptive   *adaptiveLimit    // nil unless Config.Adaptive
+	caps       *resultCaps       // nil unless Config caps results
+	honeypots  *honeypotDetector // nil unless Config.DetectHoneypots
+	queue      *hostQueue
+	gateMu     sync.Mutex
+	gate       chan struct{} // closed on Resume, nil while not paused
+	events     eventLog
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{} // closed when Run returns
 }
 
 // NewScanner creates a new Scanner instance
 func NewScanner(config *ScanConfig, callbacks *ScanCallbacks) *Scanner {
+	return newScanner(config, callbacks, nil)
+}
+
+// newScanner creates a Scanner that looks up hosts in geo, or in a newly
+// loaded Geo when geo is nil
+func newScanner(config *ScanConfig, callbacks *ScanCallbacks, geo *Geo) *Scanner {
 	ctx, cancel := context.WithCancel(context.Background())
-	
-	// Notify about GeoIP initialization start
-	if callbacks != nil && callbacks.OnGeoStatus != nil {
-		callbacks.OnGeoStatus("Checking GeoIP database...")
-	}
-	
-	geo := NewGeo()
-	
-	// Notify about completion
-	if callbacks != nil && callbacks.OnGeoStatus != nil {
-		if geo.geoReader != nil {
-			callbacks.OnGeoStatus("GeoIP ready")
-		} else {
-			callbacks.OnGeoStatus("GeoIP unavailable")
-		}
-	}
-	
-	return &Scanner{
+	s := &Scanner{
 		Config:    config,
 		Callbacks: callbacks,
-		Geo:       geo,
 		ctx:       ctx,
 		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	s.setPhase(PhaseInit)
+
+	if geo == nil {
+		// Notify about GeoIP initialization start
+		if callbacks != nil && callbacks.OnGeoStatus != nil {
+			callbacks.OnGeoStatus("Checking GeoIP database...")
+		}
+
+		s.setPhase(PhaseGeoUpdate)
+		geo = NewGeo(config.EnableASN || config.MaxPerASN > 0, config.GeoOptions())
+
+		// Notify about completion
+		if callbacks != nil && callbacks.OnGeoStatus != nil {
+			if geo.countryReady() {
+				callbacks.OnGeoStatus("GeoIP ready")
+			} else if geo.rir != nil {
+				callbacks.OnGeoStatus("GeoIP unavailable, using RIR country hints")
+			} else {
+				callbacks.OnGeoStatus("GeoIP unavailable")
+			}
+		}
+	}
+
+	s.Geo = geo
+	if config.IdleTest > 0 {
+		s.idle = NewIdleQueue(ctx, time.Duration(config.IdleTest)*time.Second, idleQueueSize)
+	}
+	if config.RateLimit > 0 {
+		s.limiter = NewRateLimiter(config.RateLimit, 1)
+	}
+	s.pacer = newPacer(config.Timing)
+	s.sources = newSourceAddrs(config.SourceAddrs)
+	s.resolver = configResolver(config)
+	s.setupClientCert()
+	s.setupKeyLog()
+	if config.Adaptive {
+		s.adaptive = newAdaptiveLimit(config.Thread)
+	}
+	s.caps = newResultCaps(config)
+	s.honeypots = newHoneypotDetector(config)
+	return s
+}
+
+// Run scans all hosts from hostChan with Config.Thread workers and blocks
+// until the channel is drained or the scan is stopped. Networks around
+// feasible hosts are added to the work while scanning if enabled.
+func (s *Scanner) Run(hostChan <-chan Host) {
+	if s.Session != nil && s.Config.SkipScannedDays > 0 {
+		since := time.Now().AddDate(0, 0, -s.Config.SkipScannedDays)
+		skip, err := s.Session.store.ScannedSince(s.Config.Port, since)
+		if err != nil {
+			s.log(slog.LevelWarn, "Cannot load scanned hosts", "err", err)
+		} else {
+			s.log(slog.LevelInfo, "Skipping recently scanned hosts", "count", len(skip))
+			s.skip = skip
+		}
+	}
+	s.seen = newSeenSet(s.Config.DedupeBloom)
+	started := time.Now()
+	s.started.Store(&started)
+	s.rate.reset(started)
+	s.setPhase(PhaseScanning)
+	updateCtx, stopUpdates := context.WithCancel(s.ctx)
+	if s.Config.GeoUpdateHours > 0 {
+		go s.Geo.AutoUpdate(updateCtx, time.Duration(s.Config.GeoUpdateHours)*time.Hour)
+	}
+	s.Stats.Concurrency.Store(int64(s.Config.Thread))
+	if s.adaptive != nil {
+		s.Stats.Concurrency.Store(int64(s.adaptive.Limit()))
+		go s.adaptive.run(updateCtx, s)
+	}
+	if len(s.Config.Subdomains) > 0 || s.Config.SubdomainCT {
+		hostChan = s.expandSubdomains(hostChan)
+	}
+	if s.Config.PreCheckThreads > 0 {
+		hostChan = s.preCheck(hostChan)
+	}
+	s.queue = newHostQueue(hostChan, s.Config.NetworkCap)
+	var wg sync.WaitGroup
+	wg.Add(s.Config.Thread)
+	for i := 0; i < s.Config.Thread; i++ {
+		go func() {
+			defer wg.Done()
+			for {
+				s.waitPaused()
+				if s.adaptive != nil && !s.adaptive.acquire(s.ctx) {
+					return
+				}
+				host, ok := s.queue.Next(s.ctx)
+				if !ok {
+					if s.adaptive != nil {
+						s.adaptive.release()
+					}
+					return
+				}
+				ScanTLS(host, s)
+				// A host cut short by Stop is left to a resumed run
+				if s.ctx.Err() == nil {
+					s.finishHost(host)
+				}
+				s.queue.Done(host)
+				if s.adaptive != nil {
+					s.adaptive.release()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	stopUpdates()
+	s.setPhase(PhaseFinishing)
+	if s.idle != nil {
+		s.idle.Wait()
+	}
+	s.closeKeyLog()
+	if s.Session != nil && s.ctx.Err() == nil {
+		if err := s.Session.Finish(); err != nil {
+			s.log(slog.LevelWarn, "Cannot finish session", "err", err)
+		}
+	}
+	if s.Cache != nil {
+		if err := s.Cache.Save(); err != nil {
+			s.log(slog.LevelWarn, "Cannot save dest cache", "err", err)
+		}
+	}
+	if s.Notifier != nil {
+		state := "finished"
+		if s.ctx.Err() != nil {
+			state = "stopped"
+		}
+		s.Notifier.Close(fmt.Sprintf("Scan %s: %d hosts scanned, %d feasible", state,
+			s.Stats.Hosts.Load(), s.Stats.Feasible.Load()))
+	}
+	if s.Webhook != nil {
+		s.Webhook.Close()
+	}
+	s.setPhase(PhaseDone)
+	close(s.done)
+}
+
+// finishHost counts host as scanned and records the progress
+func (s *Scanner) finishHost(host Host) {
+	s.Stats.Hosts.Add(1)
+	if s.Checkpoint != nil && host.Index >= 0 {
+		s.Checkpoint.Done(host.Index)
+	}
+	// Hosts of expanded networks are not part of the total
+	if host.Index < 0 {
+		return
+	}
+	done := s.progress.Add(1)
+	if s.Callbacks != nil && s.Callbacks.OnProgress != nil {
+		s.Callbacks.OnProgress(int(done), s.Total)
 	}
 }
 
 // Stop stops the scanning process
 func (s *Scanner) Stop() {
-	if s.cancel != nil {
+	if s.cancel != nil && s.ctx.Err() == nil {
 		s.cancel()
+		s.event(ScanEvent{Kind: EventStopped})
+	}
+}
+
+// Shutdown stops the scan and waits until Run has finished the handshakes
+// in progress and handed over their results, at most timeout. It reports
+// whether Run returned in time.
+func (s *Scanner) Shutdown(timeout time.Duration) bool {
+	s.Stop()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-s.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// ShutdownTimeout is how long Shutdown should wait for the handshakes in
+// progress, which give up after the timeout of the scan
+func (s *Scanner) ShutdownTimeout() time.Duration {
+	return time.Duration(s.Config.Timeout)*time.Second + shutdownGrace
+}
+
+// Pause makes the workers stop taking new hosts once their current one is
+// done, the scan keeps its position and can be resumed
+func (s *Scanner) Pause() {
+	s.gateMu.Lock()
+	defer s.gateMu.Unlock()
+	if s.gate != nil || s.ctx.Err() != nil {
+		return
+	}
+	s.gate = make(chan struct{})
+	s.setPhase(PhasePaused)
+}
+
+// Resume continues a paused scan
+func (s *Scanner) Resume() {
+	s.gateMu.Lock()
+	defer s.gateMu.Unlock()
+	if s.gate == nil {
+		return
+	}
+	close(s.gate)
+	s.gate = nil
+	s.setPhase(PhaseScanning)
+}
+
+// Paused reports whether the scan is paused
+func (s *Scanner) Paused() bool {
+	s.gateMu.Lock()
+	defer s.gateMu.Unlock()
+	return s.gate != nil
+}
+
+// waitPaused blocks a worker while the scan is paused
+func (s *Scanner) waitPaused() {
+	s.gateMu.Lock()
+	gate := s.gate
+	s.gateMu.Unlock()
+	if gate == nil {
+		return
+	}
+	select {
+	case <-gate:
+	case <-s.ctx.Done():
 	}
 }
 
@@ -80,3 +599,53 @@ func (s *Scanner) Stop() {
 func (s *Scanner) Context() context.Context {
 	return s.ctx
 }
+
+// emit delivers a finished result to the OnResult callback
+func (s *Scanner) emit(result ScanResult) {
+	for _, p := range s.Processors {
+		if err := p.OnResult(&result); errors.Is(err, ErrDropResult) {
+			return
+		} else if err != nil {
+			s.log(slog.LevelWarn, "Result processor failed", "ip", result.IP, "err", err)
+		}
+	}
+	if !s.admitCapped(result) {
+		return
+	}
+	s.Stats.addResult(result)
+	if s.Cache != nil && result.Feasible {
+		s.Cache.Add(result)
+	}
+	if s.Notifier != nil && result.Feasible {
+		s.Notifier.Add(result)
+	}
+	if s.Webhook != nil && result.Feasible {
+		s.Webhook.Add(result)
+	}
+	if s.Session != nil {
+		if err := s.Session.AddResult(result); err != nil {
+			s.log(slog.LevelWarn, "Cannot store result", "ip", result.IP, "err", err)
+		}
+	}
+	if s.Callbacks != nil && s.Callbacks.OnResult != nil {
+		s.Callbacks.OnResult(result)
+	}
+}
+
+// log sends a message to the OnLog callback if set, otherwise to slog.
+// Debug messages only reach OnLog in verbose mode.
+func (s *Scanner) log(level slog.Level, msg string, args ...any) {
+	if s.Callbacks == nil || s.Callbacks.OnLog == nil {
+		slog.Log(context.Background(), level, msg, args...)
+		return
+	}
+	if level < slog.LevelInfo && !s.Config.Verbose {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	s.Callbacks.OnLog(levelName(level), b.String())
+}
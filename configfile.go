@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// A config file sets command line options, its keys are the flag names
+// without the dash:
+//
+//	addr: 1.2.3.0/24
+//	thread: 20
+//	out: "{source}_{date}.csv"
+//	countries: [NL, DE, FI]
+//	h3: true
+//
+// Lists are joined with commas. TOML is read for .toml files, YAML (and so
+// JSON) otherwise.
+
+// configFormat returns the format of a config file from its extension
+func configFormat(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		return "toml"
+	}
+	return "yaml"
+}
+
+// loadConfigFile sets the flags named in the config file at path. Flags
+// given on the command line keep their value.
+func loadConfigFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]any)
+	if configFormat(path) == "toml" {
+		err = toml.Unmarshal(data, &values)
+	} else {
+		err = yaml.Unmarshal(data, &values)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if name == "config" || flag.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %q in %s", name, path)
+		}
+		if isFlagSet(name) || values[name] == nil {
+			continue
+		}
+		value, err := configValue(values[name])
+		if err != nil {
+			return fmt.Errorf("option %q in %s: %w", name, path, err)
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("option %q in %s: %w", name, path, err)
+		}
+	}
+	return nil
+}
+
+// configValue turns a value of a config file into the text of a flag
+func configValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			text, err := configValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = text
+		}
+		return strings.Join(items, ","), nil
+	}
+	return "", errors.New("value must be a string, number, boolean or list")
+}
+
+// writeConfigFile writes options as a config file in format
+func writeConfigFile(w io.Writer, format string, options map[string]any) error {
+	if format == "toml" {
+		return toml.NewEncoder(w).Encode(options)
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(options); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ctSearchURL is the crt.sh JSON search endpoint
+const ctSearchURL = "https://crt.sh/"
+
+// ctTimeout bounds a Certificate Transparency search, crt.sh can be slow
+const ctTimeout = 2 * time.Minute
+
+type ctEntry struct {
+	CommonName string `json:"common_name"`
+	NameValue  string `json:"name_value"`
+}
+
+// ctQuery turns a plain domain into a crt.sh pattern matching its
+// subdomains. Patterns that already contain % wildcards are kept.
+func ctQuery(query string) string {
+	query = strings.TrimSpace(query)
+	if strings.Contains(query, "%") {
+		return query
+	}
+	return "%." + strings.TrimPrefix(query, "*.")
+}
+
+// FetchCTDomains searches Certificate Transparency logs through crt.sh and
+// returns the sorted unique hostnames found in matching certificates
+func FetchCTDomains(ctx context.Context, query string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ctTimeout)
+	defer cancel()
+	params := neturl.Values{}
+	params.Set("q", ctQuery(query))
+	params.Set("output", "json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ctSearchURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query crt.sh: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	var entries []ctEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode crt.sh response: %w", err)
+	}
+	var domains []string
+	for _, entry := range entries {
+		names := strings.Split(entry.NameValue, "\n")
+		names = append(names, entry.CommonName)
+		for _, name := range names {
+			name = strings.ToLower(strings.TrimSpace(name))
+			// A wildcard certificate still tells us the parent name exists
+			name = strings.TrimPrefix(name, "*.")
+			if name == "" || strings.Contains(name, "*") || !ValidateDomainName(name) {
+				continue
+			}
+			domains = append(domains, name)
+		}
+	}
+	domains = RemoveDuplicateStr(domains)
+	sort.Strings(domains)
+	return domains, nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// sourcePortAttempts is how many random local ports are tried before
+// giving up on a connection because all of them were in use
+const sourcePortAttempts = 5
+
+// ParsePortRange parses a "min-max" local port range, an empty string
+// leaves the choice to the operating system
+func ParsePortRange(value string) (int, int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, 0, nil
+	}
+	lo, hi, found := strings.Cut(value, "-")
+	if !found {
+		hi = lo
+	}
+	low, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	high, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil || low < 1 || high > 65535 || low > high {
+		return 0, 0, fmt.Errorf("invalid port range: %q", value)
+	}
+	return low, high, nil
+}
+
+// ParsePortList parses comma separated ports and "min-max" ranges of
+// ports to scan
+func ParsePortList(value string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		low, high, err := ParsePortRange(item)
+		if err != nil {
+			return nil, err
+		}
+		for p := low; p <= high; p++ {
+			if !seen[p] {
+				seen[p] = true
+				ports = append(ports, p)
+			}
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports in %q", value)
+	}
+	return ports, nil
+}
+
+// ParseSourceAddrs parses comma separated local IPs and interface names
+// into the IPs to bind outgoing connections to. An interface stands for
+// all of its global unicast addresses.
+func ParseSourceAddrs(value string) ([]string, error) {
+	var addrs []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if ip := net.ParseIP(item); ip != nil {
+			addrs = append(addrs, ip.String())
+			continue
+		}
+		iface, err := net.InterfaceByName(item)
+		if err != nil {
+			return nil, fmt.Errorf("not an IP or interface: %q", item)
+		}
+		ifAddrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read addresses of %s: %w", item, err)
+		}
+		found := false
+		for _, a := range ifAddrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+				addrs = append(addrs, ipNet.IP.String())
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("interface %s has no usable address", item)
+		}
+	}
+	return addrs, nil
+}
+
+// sourceAddrs hands out the local IPs connections are bound to in turn,
+// separately for each address family
+type sourceAddrs struct {
+	v4, v6         []net.IP
+	nextV4, nextV6 atomic.Uint64
+}
+
+// newSourceAddrs returns the rotation of addrs, nil if none is valid
+func newSourceAddrs(addrs []string) *sourceAddrs {
+	a := &sourceAddrs{}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil:
+		case ip.To4() != nil:
+			a.v4 = append(a.v4, ip)
+		default:
+			a.v6 = append(a.v6, ip)
+		}
+	}
+	if len(a.v4) == 0 && len(a.v6) == 0 {
+		return nil
+	}
+	return a
+}
+
+// pick returns the next local IP of the family of target, nil if there is
+// none and the operating system has to choose
+func (a *sourceAddrs) pick(target net.IP) net.IP {
+	ips, next := a.v6, &a.nextV6
+	if target.To4() != nil {
+		ips, next = a.v4, &a.nextV4
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	return ips[(next.Add(1)-1)%uint64(len(ips))]
+}
+
+// errSocketOption is the error of socket options the system lacks
+var errSocketOption = errors.New("TCP Fast Open and binding to a device are only supported on Linux")
+
+// ValidateSocketOptions checks that the socket options of config can be
+// set on this system
+func ValidateSocketOptions(config *ScanConfig) error {
+	if !socketOptionsSupported && (config.FastOpen || config.BindDevice != "") {
+		return errSocketOption
+	}
+	if config.BindDevice != "" {
+		if _, err := net.InterfaceByName(config.BindDevice); err != nil {
+			return fmt.Errorf("no interface %q to bind to", config.BindDevice)
+		}
+	}
+	return nil
+}
+
+// dialer builds the net.Dialer used for a connection attempt to address
+func (s *Scanner) dialer(address string) *net.Dialer {
+	d := &net.Dialer{
+		Timeout:   time.Duration(s.Config.Timeout) * time.Second,
+		KeepAlive: time.Duration(s.Config.KeepAlive) * time.Second,
+	}
+	var local net.TCPAddr
+	if s.sources != nil {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			if ip := net.ParseIP(host); ip != nil {
+				local.IP = s.sources.pick(ip)
+			}
+		}
+	}
+	if s.Config.SourcePortMin > 0 {
+		local.Port = s.Config.SourcePortMin + rand.IntN(s.Config.SourcePortMax-s.Config.SourcePortMin+1)
+	}
+	if local.IP != nil || local.Port > 0 {
+		d.LocalAddr = &local
+	}
+	if s.Config.ReuseAddr || s.Config.FastOpen || s.Config.BindDevice != "" {
+		d.Control = func(network, address string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				sockErr = s.setSocketOptions(fd)
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		}
+	}
+	return d
+}
+
+// setSocketOptions applies the socket options of the scan configuration
+// to a socket before it connects
+func (s *Scanner) setSocketOptions(fd uintptr) error {
+	if s.Config.ReuseAddr {
+		if err := setReuseAddr(fd); err != nil {
+			return err
+		}
+	}
+	if s.Config.FastOpen {
+		if err := setFastOpen(fd); err != nil {
+			return fmt.Errorf("cannot enable TCP Fast Open: %w", err)
+		}
+	}
+	if s.Config.BindDevice != "" {
+		if err := setBindDevice(fd, s.Config.BindDevice); err != nil {
+			return fmt.Errorf("cannot bind to %s: %w", s.Config.BindDevice, err)
+		}
+	}
+	return nil
+}
+
+// dial opens a TCP connection to address honoring the socket options of
+// the scan configuration
+func (s *Scanner) dial(ctx context.Context, address string) (net.Conn, error) {
+	if err := s.pace(ctx, address); err != nil {
+		return nil, err
+	}
+	return s.dialNow(ctx, address)
+}
+
+// pace waits until a connection to address may be opened under the timing
+// profile and the rate limit of the scan
+func (s *Scanner) pace(ctx context.Context, address string) error {
+	if s.pacer != nil {
+		if err := s.pacer.Wait(ctx, address); err != nil {
+			return err
+		}
+	}
+	if s.limiter != nil {
+		return s.limiter.Wait(ctx)
+	}
+	return nil
+}
+
+// dialNow opens the connection of dial without pacing it
+func (s *Scanner) dialNow(ctx context.Context, address string) (net.Conn, error) {
+	attempts := 1
+	if s.Config.SourcePortMin > 0 {
+		attempts = sourcePortAttempts
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		var conn net.Conn
+		conn, err = s.dialer(address).DialContext(ctx, "tcp", address)
+		if err == nil {
+			return newCountedConn(conn, &s.Stats.OpenConns), nil
+		}
+		// Only a busy local port is worth another try with a new one
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			break
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package main
+
+import "syscall"
+
+// tcpFastOpenConnect is TCP_FASTOPEN_CONNECT, which sends the first write
+// of a connection with its SYN, missing from package syscall
+const tcpFastOpenConnect = 30
+
+// socketOptionsSupported reports whether setFastOpen and setBindDevice work
+// on this system
+const socketOptionsSupported = true
+
+func setFastOpen(fd uintptr) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpenConnect, 1)
+}
+
+func setBindDevice(fd uintptr, device string) error {
+	return syscall.BindToDevice(int(fd), device)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+// socketOptionsSupported reports whether setFastOpen and setBindDevice work
+// on this system
+const socketOptionsSupported = false
+
+func setFastOpen(fd uintptr) error {
+	return errSocketOption
+}
+
+func setBindDevice(fd uintptr, device string) error {
+	return errSocketOption
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Kinds of changes between two scans
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// ResultChange is a host feasible in both scans whose certificate changed
+type ResultChange struct {
+	Old ScanResult
+	New ScanResult
+}
+
+// ResultsDiff is what changed between the feasible results of two scans of
+// the same hosts, matched by IP and port
+type ResultsDiff struct {
+	// Added are the hosts only feasible in the new scan, Removed those only
+	// feasible in the old one, either absent or infeasible in the other
+	Added   []ScanResult
+	Removed []ScanResult
+	// Changed are the hosts feasible in both with another certificate domain,
+	// issuer, SANs or leaf certificate
+	Changed []ResultChange
+	// Unchanged counts the hosts feasible in both with the same certificate
+	Unchanged int
+	// Old and New count the feasible results of each scan
+	Old, New int
+}
+
+// DiffResults compares the feasible results of an old and a new scan.
+// Added and Changed follow the order of the new results, Removed that of
+// the old ones.
+func DiffResults(old, new []ScanResult) *ResultsDiff {
+	diff := &ResultsDiff{}
+	before := make(map[string]ScanResult, len(old))
+	for _, result := range old {
+		key := resultKey(result)
+		if _, ok := before[key]; result.Feasible && !ok {
+			before[key] = result
+			diff.Old++
+		}
+	}
+	after := make(map[string]bool, len(new))
+	for _, result := range new {
+		key := resultKey(result)
+		if !result.Feasible || after[key] {
+			continue
+		}
+		after[key] = true
+		diff.New++
+		previous, ok := before[key]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, result)
+		case certChanged(previous, result):
+			diff.Changed = append(diff.Changed, ResultChange{Old: previous, New: result})
+		default:
+			diff.Unchanged++
+		}
+	}
+	for _, result := range old {
+		key := resultKey(result)
+		if result.Feasible && !after[key] {
+			// Only once for hosts listed twice
+			after[key] = true
+			diff.Removed = append(diff.Removed, result)
+		}
+	}
+	return diff
+}
+
+// certChanged reports whether a host serves another certificate. SANs and
+// the leaf certificate are only compared when both scans recorded them.
+func certChanged(old, new ScanResult) bool {
+	if old.Domain != new.Domain || old.Issuer != new.Issuer {
+		return true
+	}
+	if len(old.SANs) > 0 && len(new.SANs) > 0 {
+		oldSANs, newSANs := slices.Clone(old.SANs), slices.Clone(new.SANs)
+		slices.Sort(oldSANs)
+		slices.Sort(newSANs)
+		if !slices.Equal(oldSANs, newSANs) {
+			return true
+		}
+	}
+	return len(old.Chain) > 0 && len(new.Chain) > 0 && old.Chain[0] != new.Chain[0]
+}
+
+// Empty reports whether nothing changed
+func (d *ResultsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Text renders the diff as plain text tables
+func (d *ResultsDiff) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Feasible before: %d, now: %d\n", d.Old, d.New)
+	fmt.Fprintf(&b, "Newly feasible: %d, disappeared: %d, changed certificate: %d, unchanged: %d\n",
+		len(d.Added), len(d.Removed), len(d.Changed), d.Unchanged)
+	writeRows := func(title string, rows [][]string) {
+		b.WriteString("\n" + title + "\n")
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+	}
+	hostRows := func(results []ScanResult) [][]string {
+		rows := [][]string{{"HOST", "DOMAIN", "ISSUER", "COUNTRY"}}
+		for _, result := range results {
+			rows = append(rows, []string{resultKey(result), result.Domain, result.Issuer, result.GeoCode})
+		}
+		return rows
+	}
+	if len(d.Added) > 0 {
+		writeRows("Newly feasible", hostRows(d.Added))
+	}
+	if len(d.Removed) > 0 {
+		writeRows("Disappeared", hostRows(d.Removed))
+	}
+	if len(d.Changed) > 0 {
+		rows := [][]string{{"HOST", "OLD DOMAIN", "OLD ISSUER", "NEW DOMAIN", "NEW ISSUER"}}
+		for _, change := range d.Changed {
+			rows = append(rows, []string{resultKey(change.New), change.Old.Domain, change.Old.Issuer,
+				change.New.Domain, change.New.Issuer})
+		}
+		writeRows("Changed certificate", rows)
+	}
+	return b.String()
+}
+
+// diffLine is a change in the JSON lines output of a diff, old is omitted
+// for added hosts and new for removed ones
+type diffLine struct {
+	Change string      `json:"change"`
+	Old    *ScanResult `json:"old,omitempty"`
+	New    *ScanResult `json:"new,omitempty"`
+}
+
+// WriteJSONL writes every change as a line of JSON
+func (d *ResultsDiff) WriteJSONL(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for i := range d.Added {
+		if err := enc.Encode(diffLine{Change: DiffAdded, New: &d.Added[i]}); err != nil {
+			return err
+		}
+	}
+	for i := range d.Removed {
+		if err := enc.Encode(diffLine{Change: DiffRemoved, Old: &d.Removed[i]}); err != nil {
+			return err
+		}
+	}
+	for i := range d.Changed {
+		if err := enc.Encode(diffLine{Change: DiffChanged, Old: &d.Changed[i].Old, New: &d.Changed[i].New}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readResultsFile reads the results of a file written by a scan, in the
+// format of its extension
+func readResultsFile(name string, data []byte, port int) ([]ScanResult, error) {
+	format, err := outputFormat("", name)
+	if err != nil {
+		return nil, err
+	}
+	return readResults(data, format, port)
+}
+
+// runDiff implements -diff, which compares the results files of two scans,
+// the old one first, and prints what changed
+func runDiff(files []string) {
+	if len(files) != 2 {
+		slog.Error("`diff` needs two results files, the old one and the new one", "files", len(files))
+		return
+	}
+	var scans [2][]ScanResult
+	for i, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			slog.Error("Error reading file", "path", name, "err", err)
+			return
+		}
+		// CSV files carry no port, their results are taken to be on `port`
+		if scans[i], err = readResultsFile(name, data, port); err != nil {
+			slog.Error("Error parsing results", "path", name, "err", err)
+			return
+		}
+	}
+	diff := DiffResults(scans[0], scans[1])
+	switch strings.ToLower(outFormat) {
+	case "":
+		fmt.Print(diff.Text())
+	case FormatJSONL:
+		if err := diff.WriteJSONL(os.Stdout); err != nil {
+			slog.Error("Error writing diff", "err", err)
+		}
+	default:
+		slog.Error("Unknown diff format, use jsonl or leave `format` unset for text", "format", outFormat)
+	}
+}
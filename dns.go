@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// defaultDNSTimeout is the timeout of a lookup in seconds
+	defaultDNSTimeout = 5
+	// dohResponseLimit caps the size of a DNS-over-HTTPS answer
+	dohResponseLimit = 64 << 10
+)
+
+// ParseDNSServers parses comma separated DNS servers: IPs with an optional
+// port, 53 by default, and DNS-over-HTTPS URLs such as
+// https://1.1.1.1/dns-query
+func ParseDNSServers(value string) ([]string, error) {
+	var servers []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.HasPrefix(item, "https://") {
+			if u, err := neturl.Parse(item); err != nil || u.Host == "" {
+				return nil, fmt.Errorf("invalid DNS-over-HTTPS URL: %q", item)
+			}
+			servers = append(servers, item)
+			continue
+		}
+		if ip := net.ParseIP(item); ip != nil {
+			servers = append(servers, net.JoinHostPort(ip.String(), "53"))
+			continue
+		}
+		host, port, err := net.SplitHostPort(item)
+		if err != nil || net.ParseIP(host) == nil || port == "" {
+			return nil, fmt.Errorf("not a DNS server IP or https URL: %q", item)
+		}
+		servers = append(servers, item)
+	}
+	return servers, nil
+}
+
+// Resolver looks up the IPs of domains with DNS servers and
+// DNS-over-HTTPS endpoints, tried in turn until one answers, or with the
+// system resolver when there are none
+type Resolver struct {
+	servers []string
+	timeout time.Duration
+	client  *http.Client
+}
+
+// NewResolver creates a resolver for servers parsed by ParseDNSServers,
+// each lookup times out after timeout
+func NewResolver(servers []string, timeout time.Duration) *Resolver {
+	return &Resolver{servers: servers, timeout: timeout, client: &http.Client{}}
+}
+
+// configResolver creates the resolver of the DNS settings of config
+func configResolver(config *ScanConfig) *Resolver {
+	timeout := config.DNSTimeout
+	if timeout <= 0 {
+		timeout = defaultDNSTimeout
+	}
+	return NewResolver(config.DNSServers, time.Duration(timeout)*time.Second)
+}
+
+// LookupIPs returns the distinct IPs of host, IPv6 addresses only when
+// enableIPv6 is set
+func (r *Resolver) LookupIPs(ctx context.Context, host string, enableIPv6 bool) ([]net.IP, error) {
+	network := "ip4"
+	if enableIPv6 {
+		network = "ip"
+	}
+	if len(r.servers) == 0 {
+		ctx, cancel := context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+		return lookupResult(net.DefaultResolver.LookupIP(ctx, network, host))
+	}
+	var errs []error
+	for _, server := range r.servers {
+		ctx, cancel := context.WithTimeout(ctx, r.timeout)
+		var ips []net.IP
+		var err error
+		if strings.HasPrefix(server, "https://") {
+			ips, err = lookupResult(r.lookupDoH(ctx, server, host, enableIPv6))
+		} else {
+			ips, err = lookupResult(dnsServerResolver(server).LookupIP(ctx, network, host))
+		}
+		cancel()
+		if err == nil {
+			return ips, nil
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			// The domain does not exist, other servers will not know better
+			return nil, err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", server, err))
+	}
+	return nil, errors.Join(errs...)
+}
+
+// lookupResult drops repeated IPs of a lookup and fails it without any
+func lookupResult(ips []net.IP, err error) ([]net.IP, error) {
+	if err != nil {
+		return nil, fmt.Errorf("failed to lookup: %w", err)
+	}
+	ips = slices.CompactFunc(slices.SortedFunc(slices.Values(ips), func(a, b net.IP) int {
+		return bytes.Compare(a.To16(), b.To16())
+	}), net.IP.Equal)
+	if len(ips) == 0 {
+		return nil, errors.New("no IP found")
+	}
+	return ips, nil
+}
+
+// dnsServerResolver sends the queries of the Go resolver to server
+func dnsServerResolver(server string) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, server)
+		},
+	}
+}
+
+// lookupDoH asks the DNS-over-HTTPS endpoint for the A records of host, and
+// its AAAA records when enableIPv6 is set
+func (r *Resolver) lookupDoH(ctx context.Context, endpoint, host string, enableIPv6 bool) ([]net.IP, error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, err
+	}
+	types := []dnsmessage.Type{dnsmessage.TypeA}
+	if enableIPv6 {
+		types = append(types, dnsmessage.TypeAAAA)
+	}
+	var ips []net.IP
+	for _, qtype := range types {
+		answers, err := r.queryDoH(ctx, endpoint, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, answers...)
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, Server: endpoint, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+// queryDoH sends one question as an RFC 8484 POST request
+func (r *Resolver) queryDoH(ctx context.Context, endpoint string, name dnsmessage.Name, qtype dnsmessage.Type) ([]net.IP, error) {
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS-over-HTTPS endpoint returned %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, dohResponseLimit))
+	if err != nil {
+		return nil, err
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(data); err != nil {
+		return nil, fmt.Errorf("invalid DNS answer: %w", err)
+	}
+	switch msg.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, &net.DNSError{Err: "no such host", Name: name.String(), Server: endpoint, IsNotFound: true}
+	default:
+		return nil, fmt.Errorf("DNS-over-HTTPS endpoint answered %s", msg.RCode)
+	}
+	var ips []net.IP
+	for _, answer := range msg.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			ips = append(ips, net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			ips = append(ips, net.IP(body.AAAA[:]))
+		}
+	}
+	return ips, nil
+}
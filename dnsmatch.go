@@ -0,0 +1,41 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+)
+
+// Outcomes of the DNS match check of ScanResult.DNSMatch
+const (
+	// DNSMatchYes is a certificate domain resolving to the scanned IP
+	DNSMatchYes = "match"
+	// DNSMatchNo is a certificate domain resolving to other IPs only
+	DNSMatchNo = "mismatch"
+	// DNSMatchUnresolved is a certificate without a name to look up or one
+	// that did not resolve
+	DNSMatchUnresolved = "unresolved"
+)
+
+// checkDNSMatch resolves the domain a Reality config would take from the
+// certificate of result as serverName and reports whether ip is among its
+// records. A dest the domain really points at holds up when a censor
+// resolves the SNI of a connection and compares.
+func (s *Scanner) checkDNSMatch(ip net.IP, result ScanResult) string {
+	names := xrayServerNames(result)
+	if len(names) == 0 || net.ParseIP(names[0]) != nil {
+		return DNSMatchUnresolved
+	}
+	// AAAA records are needed to match an IPv6 host
+	ips, err := s.resolver.LookupIPs(s.ctx, names[0], s.Config.EnableIPv6 || ip.To4() == nil)
+	if err != nil {
+		s.log(slog.LevelDebug, "Cannot resolve the certificate domain", "ip", ip, "domain", names[0], "err", err)
+		return DNSMatchUnresolved
+	}
+	for _, resolved := range ips {
+		if resolved.Equal(ip) {
+			return DNSMatchYes
+		}
+	}
+	s.log(slog.LevelDebug, "Certificate domain resolves elsewhere", "ip", ip, "domain", names[0], "resolved", ips)
+	return DNSMatchNo
+}
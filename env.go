@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// envPrefix starts the environment variables setting command line options.
+// The rest of the name is the flag name in upper case with underscores for
+// dashes, e.g. SCANNER_THREAD=20 or SCANNER_GEO_UPDATE=24.
+const envPrefix = "SCANNER_"
+
+// envAliases are the names of options that read better as variables
+var envAliases = map[string]string{
+	"THREADS": "thread",
+	"INPUT":   "in",
+	"OUTPUT":  "out",
+}
+
+// envFlagName returns the flag set by the variable named key, "" if there
+// is none
+func envFlagName(key string) string {
+	name := strings.TrimPrefix(key, envPrefix)
+	if alias, ok := envAliases[name]; ok {
+		return alias
+	}
+	name = strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	if flag.Lookup(name) == nil {
+		return ""
+	}
+	return name
+}
+
+// serviceLink reports whether value is the address of a linked service,
+// such as SCANNER_PORT=tcp://10.0.0.1:443 set by Kubernetes and Docker
+// links for a service named scanner
+func serviceLink(value string) bool {
+	return strings.HasPrefix(value, "tcp://") || strings.HasPrefix(value, "udp://")
+}
+
+// loadEnv sets the flags named by SCANNER_ variables, for containers that
+// are configured through the environment. Flags given on the command line
+// keep their value, and are not changed by a config file after. Unknown
+// names are skipped, as service discovery sets variables of the same
+// prefix.
+func loadEnv() error {
+	var keys []string
+	for _, entry := range os.Environ() {
+		key, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(key, envPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value := os.Getenv(key)
+		if serviceLink(value) {
+			slog.Debug("Skipping service link environment variable", "name", key)
+			continue
+		}
+		name := envFlagName(key)
+		if name == "" {
+			slog.Warn("Unknown option in environment variable, skipping it", "name", key)
+			continue
+		}
+		if isFlagSet(name) || value == "" {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// hasDisplay reports whether a window can be opened. Without a display, as
+// in containers and on servers, the GUI is never started.
+func hasDisplay() bool {
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		return true
+	}
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ScanPhase is a stage of the scan lifecycle
+type ScanPhase string
+
+const (
+	PhaseInit      ScanPhase = "init"
+	PhaseGeoUpdate ScanPhase = "geo update"
+	PhaseResolving ScanPhase = "resolving"
+	PhaseScanning  ScanPhase = "scanning"
+	PhasePaused    ScanPhase = "paused"
+	PhaseFinishing ScanPhase = "finishing"
+	PhaseDone      ScanPhase = "done"
+)
+
+// ScanEventKind tells phase changes apart from notable events
+type ScanEventKind string
+
+const (
+	EventPhase      ScanEventKind = "phase"
+	EventStopped    ScanEventKind = "stopped"
+	EventErrorSpike ScanEventKind = "error spike"
+)
+
+// ScanEvent is one entry of the structured scan event log
+type ScanEvent struct {
+	Time    time.Time
+	Kind    ScanEventKind
+	Phase   ScanPhase
+	Message string
+}
+
+const (
+	// errorWindow is the period failures are counted over
+	errorWindow = 10 * time.Second
+	// errorSpikeMinAttempts avoids reporting spikes on a handful of hosts
+	errorSpikeMinAttempts = 20
+	// errorSpikeJump is how far the failure ratio of a window has to rise
+	// above the baseline to be reported as a spike. Most addresses of a
+	// range are dead, so a high ratio alone is no spike.
+	errorSpikeJump = 0.3
+	// errorBaselineWeight is how fast the baseline follows the failure
+	// ratio of past windows
+	errorBaselineWeight = 0.1
+)
+
+// eventLog keeps the current phase and detects error spikes
+type eventLog struct {
+	mu          sync.Mutex
+	phase       ScanPhase
+	windowStart time.Time
+	attempts    int
+	failures    int
+	inSpike     bool
+	// baseline is the usual failure ratio, valid once measured is set
+	baseline float64
+	measured bool
+}
+
+// setPhase records a phase change and notifies the OnEvent callback
+func (s *Scanner) setPhase(phase ScanPhase) {
+	s.events.mu.Lock()
+	if s.events.phase == phase {
+		s.events.mu.Unlock()
+		return
+	}
+	s.events.phase = phase
+	s.events.mu.Unlock()
+	s.event(ScanEvent{Kind: EventPhase, Phase: phase})
+}
+
+// SetPhase lets callers that prepare the input, such as URL crawling,
+// report their progress on the scan timeline
+func (s *Scanner) SetPhase(phase ScanPhase) {
+	s.setPhase(phase)
+}
+
+// Phase returns the current lifecycle phase
+func (s *Scanner) Phase() ScanPhase {
+	s.events.mu.Lock()
+	defer s.events.mu.Unlock()
+	return s.events.phase
+}
+
+// event delivers an event to the OnEvent callback
+func (s *Scanner) event(e ScanEvent) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Phase == "" {
+		e.Phase = s.Phase()
+	}
+	if s.Callbacks != nil && s.Callbacks.OnEvent != nil {
+		s.Callbacks.OnEvent(e)
+	}
+}
+
+// recordAttempt counts connection outcomes and emits an error spike event
+// when the failure ratio within the window jumps above its baseline
+func (s *Scanner) recordAttempt(err error) {
+	ok := err == nil
+	if s.adaptive != nil {
+		s.adaptive.record(err)
+	}
+	s.Stats.Attempts.Add(1)
+	if !ok {
+		s.Stats.Failures.Add(1)
+	}
+	l := &s.events
+	l.mu.Lock()
+	now := time.Now()
+	if now.Sub(l.windowStart) > errorWindow {
+		l.updateBaseline()
+		l.windowStart = now
+		l.attempts = 0
+		l.failures = 0
+	}
+	l.attempts++
+	if !ok {
+		l.failures++
+	}
+	spike := l.measured && l.attempts >= errorSpikeMinAttempts &&
+		float64(l.failures)/float64(l.attempts) >= l.baseline+errorSpikeJump
+	report := spike && !l.inSpike
+	if l.attempts >= errorSpikeMinAttempts {
+		l.inSpike = spike
+	}
+	failures, attempts := l.failures, l.attempts
+	l.mu.Unlock()
+	if report {
+		s.event(ScanEvent{
+			Kind:    EventErrorSpike,
+			Message: fmt.Sprintf("%d/%d connections failed", failures, attempts),
+		})
+	}
+}
+
+// updateBaseline folds the failure ratio of the window that ended into the
+// baseline. It drops at once and rises slowly, like the one of the
+// adaptive concurrency. l.mu must be held.
+func (l *eventLog) updateBaseline() {
+	if l.attempts < errorSpikeMinAttempts {
+		return
+	}
+	ratio := float64(l.failures) / float64(l.attempts)
+	switch {
+	case !l.measured || ratio < l.baseline:
+		l.baseline = ratio
+		l.measured = true
+	default:
+		l.baseline += (ratio - l.baseline) * errorBaselineWeight
+	}
+}
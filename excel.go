@@ -0,0 +1,391 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Sheets of the workbook written by writeExcel. Workbooks of earlier
+// versions have a single sheet of feasible results, legacySheet.
+const (
+	feasibleSheet = "Feasible"
+	allSheet      = "All Results"
+	summarySheet  = "Summary"
+	legacySheet   = "Scan Results"
+)
+
+// summaryChartRows is how many of the most common values the charts of
+// the summary sheet show
+const summaryChartRows = 10
+
+// writeExcel writes the results as an Excel workbook: the feasible ones,
+// all of them and a summary with charts
+func writeExcel(writer io.Writer, results []ScanResult) error {
+	// Create new Excel file
+	f := excelize.NewFile()
+	defer f.Close()
+
+	// The default sheet becomes the first one
+	if err := f.SetSheetName(f.GetSheetName(0), feasibleSheet); err != nil {
+		return err
+	}
+	for _, name := range []string{allSheet, summarySheet} {
+		if _, err := f.NewSheet(name); err != nil {
+			return err
+		}
+	}
+	f.SetActiveSheet(0)
+
+	// Create header style
+	headerStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+			Size: 12,
+		},
+		Fill: excelize.Fill{
+			Type:    "pattern",
+			Pattern: 1,
+			Color:   []string{"#E0E0E0"},
+		},
+		Alignment: &excelize.Alignment{
+			Horizontal: "center",
+			Vertical:   "center",
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var feasible []ScanResult
+	for _, result := range results {
+		if result.Feasible {
+			feasible = append(feasible, result)
+		}
+	}
+	writeResultsSheet(f, feasibleSheet, feasible, headerStyle)
+	writeResultsSheet(f, allSheet, results, headerStyle)
+	if err := writeSummarySheet(f, results, headerStyle); err != nil {
+		return err
+	}
+
+	// Write to the provided writer
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(buf.Bytes())
+	return err
+}
+
+// writeResultsSheet writes results as rows of sheetName
+func writeResultsSheet(f *excelize.File, sheetName string, results []ScanResult, headerStyle int) {
+	// Write headers
+	headers := []string{"IP", "Origin", "Domain", "Issuer", "Geo", "TLS Version", "ALPN", "Feasible", "Idle", "ASN", "AS Org", "Connect ms", "Handshake ms", "Curve", "HTTP Status", "HTTP Server", "HTTP Content", "Dual Domain", "Cert Differs", "Score", "Cipher Suite", "Key Exchange", "CDN", "OCSP", "OCSP Stapled", "H3", "SNI Certs", "Resumption", "Speed KB/s", "HRR", "Honeypot", "Rank", "Family", "Families", "DNS Match", "Dual Error"}
+	for col, header := range headers {
+		cell, _ := excelize.CoordinatesToCellName(col+1, 1)
+		f.SetCellValue(sheetName, cell, header)
+		f.SetCellStyle(sheetName, cell, cell, headerStyle)
+	}
+
+	// Set column widths
+	f.SetColWidth(sheetName, "A", "A", 15) // IP
+	f.SetColWidth(sheetName, "B", "B", 20) // Origin
+	f.SetColWidth(sheetName, "C", "C", 30) // Domain
+	f.SetColWidth(sheetName, "D", "D", 40) // Issuer
+	f.SetColWidth(sheetName, "E", "E", 8)  // Geo
+	f.SetColWidth(sheetName, "F", "F", 12) // TLS Version
+	f.SetColWidth(sheetName, "G", "G", 10) // ALPN
+	f.SetColWidth(sheetName, "H", "H", 10) // Feasible
+	f.SetColWidth(sheetName, "I", "I", 18) // Idle
+	f.SetColWidth(sheetName, "J", "J", 10) // ASN
+	f.SetColWidth(sheetName, "K", "K", 30) // AS Org
+	f.SetColWidth(sheetName, "L", "M", 14) // Latency
+	f.SetColWidth(sheetName, "N", "N", 16) // Curve
+	f.SetColWidth(sheetName, "O", "O", 12) // HTTP Status
+	f.SetColWidth(sheetName, "P", "P", 20) // HTTP Server
+	f.SetColWidth(sheetName, "Q", "Q", 14) // HTTP Content
+	f.SetColWidth(sheetName, "R", "R", 30) // Dual Domain
+	f.SetColWidth(sheetName, "S", "S", 12) // Cert Differs
+	f.SetColWidth(sheetName, "T", "T", 8)  // Score
+	f.SetColWidth(sheetName, "U", "U", 30) // Cipher Suite
+	f.SetColWidth(sheetName, "V", "V", 14) // Key Exchange
+	f.SetColWidth(sheetName, "W", "W", 12) // CDN
+	f.SetColWidth(sheetName, "X", "X", 10) // OCSP
+	f.SetColWidth(sheetName, "Y", "Y", 12) // OCSP Stapled
+	f.SetColWidth(sheetName, "Z", "Z", 6)  // H3
+
+	// Columns past Z are named by two letters
+	f.SetColWidth(sheetName, "AA", "AA", 40) // SNI Certs
+	f.SetColWidth(sheetName, "AB", "AB", 12) // Resumption
+	f.SetColWidth(sheetName, "AC", "AC", 12) // Speed KB/s
+	f.SetColWidth(sheetName, "AD", "AD", 12) // HRR
+	f.SetColWidth(sheetName, "AE", "AE", 10) // Honeypot
+	f.SetColWidth(sheetName, "AF", "AF", 10) // Rank
+	f.SetColWidth(sheetName, "AG", "AG", 8)  // Family
+	f.SetColWidth(sheetName, "AH", "AH", 50) // Families
+	f.SetColWidth(sheetName, "AI", "AI", 12) // DNS Match
+	f.SetColWidth(sheetName, "AJ", "AJ", 30) // Dual Error
+
+	// Write data
+	row := 2
+	for _, result := range results {
+		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), result.IP)
+		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), result.Origin)
+		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), result.Domain)
+		f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), result.Issuer)
+		f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), result.GeoCode)
+		f.SetCellValue(sheetName, fmt.Sprintf("F%d", row), result.TLSVersion)
+		f.SetCellValue(sheetName, fmt.Sprintf("G%d", row), result.ALPN)
+		if result.Feasible {
+			f.SetCellValue(sheetName, fmt.Sprintf("H%d", row), "Yes")
+		} else {
+			f.SetCellValue(sheetName, fmt.Sprintf("H%d", row), "No")
+		}
+		f.SetCellValue(sheetName, fmt.Sprintf("I%d", row), result.Idle)
+		if result.ASN != 0 {
+			f.SetCellValue(sheetName, fmt.Sprintf("J%d", row), result.ASN)
+		}
+		f.SetCellValue(sheetName, fmt.Sprintf("K%d", row), result.ASOrg)
+		f.SetCellValue(sheetName, fmt.Sprintf("L%d", row), result.ConnectMs)
+		f.SetCellValue(sheetName, fmt.Sprintf("M%d", row), result.HandshakeMs)
+		f.SetCellValue(sheetName, fmt.Sprintf("N%d", row), result.Curve)
+		if result.HTTPStatus != 0 {
+			f.SetCellValue(sheetName, fmt.Sprintf("O%d", row), result.HTTPStatus)
+		}
+		f.SetCellValue(sheetName, fmt.Sprintf("P%d", row), result.HTTPServer)
+		if result.HTTPContent {
+			f.SetCellValue(sheetName, fmt.Sprintf("Q%d", row), "Yes")
+		}
+		f.SetCellValue(sheetName, fmt.Sprintf("R%d", row), result.DualDomain)
+		if result.CertDiffers {
+			f.SetCellValue(sheetName, fmt.Sprintf("S%d", row), "Yes")
+		}
+		f.SetCellValue(sheetName, fmt.Sprintf("T%d", row), result.Score)
+		f.SetCellValue(sheetName, fmt.Sprintf("U%d", row), result.CipherSuite)
+		f.SetCellValue(sheetName, fmt.Sprintf("V%d", row), result.KeyExchange)
+		f.SetCellValue(sheetName, fmt.Sprintf("W%d", row), result.CDN)
+		f.SetCellValue(sheetName, fmt.Sprintf("X%d", row), result.OCSP)
+		f.SetCellValue(sheetName, fmt.Sprintf("Y%d", row), result.OCSPStapled)
+		if result.H3 {
+			f.SetCellValue(sheetName, fmt.Sprintf("Z%d", row), "Yes")
+		}
+		f.SetCellValue(sheetName, fmt.Sprintf("AA%d", row), formatSNICerts(result.SNIs))
+		f.SetCellValue(sheetName, fmt.Sprintf("AB%d", row), result.Resumption)
+		if result.SpeedKBps > 0 {
+			f.SetCellValue(sheetName, fmt.Sprintf("AC%d", row), result.SpeedKBps)
+		}
+		f.SetCellValue(sheetName, fmt.Sprintf("AD%d", row), result.HRR)
+		if result.Honeypot {
+			f.SetCellValue(sheetName, fmt.Sprintf("AE%d", row), "Yes")
+		}
+		if result.Rank > 0 {
+			f.SetCellValue(sheetName, fmt.Sprintf("AF%d", row), result.Rank)
+		}
+		f.SetCellValue(sheetName, fmt.Sprintf("AG%d", row), result.Family)
+		f.SetCellValue(sheetName, fmt.Sprintf("AH%d", row), formatFamilies(result.Families))
+		f.SetCellValue(sheetName, fmt.Sprintf("AI%d", row), result.DNSMatch)
+		f.SetCellValue(sheetName, fmt.Sprintf("AJ%d", row), result.DualError)
+		row++
+	}
+
+	// Enable auto-filter
+	if row > 2 {
+		lastCell, _ := excelize.CoordinatesToCellName(len(headers), row-1)
+		f.AutoFilter(sheetName, fmt.Sprintf("A1:%s", lastCell), []excelize.AutoFilterOptions{})
+	}
+}
+
+// summaryCount is a row of a summary table: how many results have a value
+// and how many of them are feasible
+type summaryCount struct {
+	Value    string
+	Results  int
+	Feasible int
+}
+
+// summaryCounts counts the results by the value of key, the most common
+// first
+func summaryCounts(results []ScanResult, key func(ScanResult) string) []summaryCount {
+	index := make(map[string]int)
+	var counts []summaryCount
+	for _, result := range results {
+		value := key(result)
+		if value == "" {
+			value = "Unknown"
+		}
+		i, ok := index[value]
+		if !ok {
+			i = len(counts)
+			index[value] = i
+			counts = append(counts, summaryCount{Value: value})
+		}
+		counts[i].Results++
+		if result.Feasible {
+			counts[i].Feasible++
+		}
+	}
+	slices.SortStableFunc(counts, func(a, b summaryCount) int {
+		return cmp.Or(b.Results-a.Results, strings.Compare(a.Value, b.Value))
+	})
+	return counts
+}
+
+// writeSummarySheet writes the totals and the results counted by country,
+// issuer and TLS version side by side, with a chart of each
+func writeSummarySheet(f *excelize.File, results []ScanResult, headerStyle int) error {
+	feasible := 0
+	for _, result := range results {
+		if result.Feasible {
+			feasible++
+		}
+	}
+	f.SetCellValue(summarySheet, "A1", "Results")
+	f.SetCellValue(summarySheet, "B1", len(results))
+	f.SetCellValue(summarySheet, "A2", "Feasible")
+	f.SetCellValue(summarySheet, "B2", feasible)
+
+	tables := []struct {
+		title string
+		key   func(ScanResult) string
+	}{
+		{"Country", func(r ScanResult) string { return r.GeoCode }},
+		{"Issuer", func(r ScanResult) string { return r.Issuer }},
+		{"TLS Version", func(r ScanResult) string { return r.TLSVersion }},
+	}
+	for i, table := range tables {
+		// Tables take three columns and a blank one, from row 4
+		col := i*4 + 1
+		valueCol, _ := excelize.ColumnNumberToName(col)
+		resultsCol, _ := excelize.ColumnNumberToName(col + 1)
+		feasibleCol, _ := excelize.ColumnNumberToName(col + 2)
+		for j, header := range []string{table.title, "Results", "Feasible"} {
+			cell, _ := excelize.CoordinatesToCellName(col+j, 4)
+			f.SetCellValue(summarySheet, cell, header)
+			f.SetCellStyle(summarySheet, cell, cell, headerStyle)
+		}
+		f.SetColWidth(summarySheet, valueCol, valueCol, 30)
+		f.SetColWidth(summarySheet, resultsCol, feasibleCol, 10)
+
+		counts := summaryCounts(results, table.key)
+		for j, count := range counts {
+			row := j + 5
+			f.SetCellValue(summarySheet, fmt.Sprintf("%s%d", valueCol, row), count.Value)
+			f.SetCellValue(summarySheet, fmt.Sprintf("%s%d", resultsCol, row), count.Results)
+			f.SetCellValue(summarySheet, fmt.Sprintf("%s%d", feasibleCol, row), count.Feasible)
+		}
+		if len(counts) == 0 {
+			continue
+		}
+
+		// Charts are stacked right of the tables
+		last := min(len(counts), summaryChartRows) + 4
+		series := func(col string) excelize.ChartSeries {
+			return excelize.ChartSeries{
+				Name:       fmt.Sprintf("%s!$%s$4", summarySheet, col),
+				Categories: fmt.Sprintf("%s!$%s$5:$%s$%d", summarySheet, valueCol, valueCol, last),
+				Values:     fmt.Sprintf("%s!$%s$5:$%s$%d", summarySheet, col, col, last),
+			}
+		}
+		if err := f.AddChart(summarySheet, fmt.Sprintf("M%d", i*16+1), &excelize.Chart{
+			Type:   excelize.Col,
+			Series: []excelize.ChartSeries{series(resultsCol), series(feasibleCol)},
+			Title:  []excelize.RichTextRun{{Text: table.title}},
+			Legend: excelize.ChartLegend{Position: "bottom"},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readExcel reads back the results of a workbook written by writeExcel
+func readExcel(reader io.Reader) ([]ScanResult, error) {
+	f, err := excelize.OpenReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Older workbooks only have the feasible results
+	sheet := allSheet
+	if index, _ := f.GetSheetIndex(allSheet); index < 0 {
+		sheet = legacySheet
+	}
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("missing header row")
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	if _, ok := columns["IP"]; !ok {
+		return nil, errors.New("missing IP column")
+	}
+
+	var results []ScanResult
+	for _, row := range rows[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		if field("IP") == "" {
+			continue
+		}
+		result := ScanResult{
+			IP:          field("IP"),
+			Origin:      field("Origin"),
+			Domain:      field("Domain"),
+			Issuer:      field("Issuer"),
+			GeoCode:     field("Geo"),
+			TLSVersion:  field("TLS Version"),
+			ALPN:        field("ALPN"),
+			Feasible:    field("Feasible") == "Yes",
+			Idle:        field("Idle"),
+			ASOrg:       field("AS Org"),
+			Curve:       field("Curve"),
+			HTTPServer:  field("HTTP Server"),
+			HTTPContent: field("HTTP Content") == "Yes",
+			DualDomain:  field("Dual Domain"),
+			CertDiffers: field("Cert Differs") == "Yes",
+			CipherSuite: field("Cipher Suite"),
+			KeyExchange: field("Key Exchange"),
+			CDN:         field("CDN"),
+			OCSP:        field("OCSP"),
+			Resumption:  field("Resumption"),
+			HRR:         field("HRR"),
+		}
+		if asn, err := strconv.ParseUint(field("ASN"), 10, 32); err == nil {
+			result.ASN = uint(asn)
+		}
+		result.ConnectMs, _ = strconv.Atoi(field("Connect ms"))
+		result.HandshakeMs, _ = strconv.Atoi(field("Handshake ms"))
+		result.SpeedKBps, _ = strconv.Atoi(field("Speed KB/s"))
+		result.Rank, _ = strconv.Atoi(field("Rank"))
+		result.Family = field("Family")
+		result.Families = parseFamilies(field("Families"))
+		result.DNSMatch = field("DNS Match")
+		result.DualError = field("Dual Error")
+		result.HTTPStatus, _ = strconv.Atoi(field("HTTP Status"))
+		result.Score, _ = strconv.ParseFloat(field("Score"), 64)
+		result.OCSPStapled, _ = strconv.ParseBool(field("OCSP Stapled"))
+		result.H3 = field("H3") == "Yes"
+		result.Honeypot = field("Honeypot") == "Yes"
+		result.SNIs = parseSNICerts(field("SNI Certs"))
+		results = append(results, result)
+	}
+	return results, nil
+}
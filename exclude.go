@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ExcludeList holds targets that are never scanned: networks, autonomous
+// systems and countries
+type ExcludeList struct {
+	prefixes  []netip.Prefix
+	asns      map[uint]bool
+	countries map[string]bool
+}
+
+// ParseExcludeList reads entries separated by whitespace, commas or new
+// lines. An entry is an IP, a CIDR, an AS number such as AS13335 or a two
+// letter country code, # starts a comment.
+func ParseExcludeList(r io.Reader) (*ExcludeList, error) {
+	list := &ExcludeList{
+		asns:      make(map[uint]bool),
+		countries: make(map[string]bool),
+	}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		for _, entry := range strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == ';' || r == ' ' || r == '\t'
+		}) {
+			if err := list.add(entry); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// LoadExcludeFile reads an exclusion list from the file at path
+func LoadExcludeFile(path string) (*ExcludeList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseExcludeList(f)
+}
+
+func (l *ExcludeList) add(entry string) error {
+	if prefix, err := netip.ParsePrefix(entry); err == nil {
+		l.prefixes = append(l.prefixes, prefix.Masked())
+		return nil
+	}
+	if addr, err := netip.ParseAddr(entry); err == nil {
+		addr = addr.Unmap()
+		l.prefixes = append(l.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		return nil
+	}
+	if len(entry) > 2 && strings.EqualFold(entry[:2], "AS") {
+		asn, err := strconv.ParseUint(entry[2:], 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid AS number %q", entry)
+		}
+		l.asns[uint(asn)] = true
+		return nil
+	}
+	if len(entry) == 2 && isLetter(entry[0]) && isLetter(entry[1]) {
+		l.countries[strings.ToUpper(entry)] = true
+		return nil
+	}
+	return fmt.Errorf("not an IP, CIDR, AS number or country code: %q", entry)
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Len returns the number of entries
+func (l *ExcludeList) Len() int {
+	return len(l.prefixes) + len(l.asns) + len(l.countries)
+}
+
+// NeedsASN reports whether the list has AS numbers, which can only be
+// matched with ASN lookup enabled
+func (l *ExcludeList) NeedsASN() bool {
+	return len(l.asns) > 0
+}
+
+// Match returns the entry excluding ip, or "" if it may be scanned.
+// Countries and AS numbers are looked up in geo.
+func (l *ExcludeList) Match(ip net.IP, geo *Geo) string {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return ""
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return prefix.String()
+		}
+	}
+	if geo == nil {
+		return ""
+	}
+	if len(l.countries) > 0 {
+		if code := geo.GetGeo(ip); l.countries[code] {
+			return code
+		}
+	}
+	if len(l.asns) > 0 {
+		if asn, _ := geo.GetASN(ip); l.asns[asn] {
+			return "AS" + strconv.FormatUint(uint64(asn), 10)
+		}
+	}
+	return ""
+}
+
+// ParseCountries parses two letter country codes separated by commas or
+// whitespace, such as "NL,DE,FI", into upper case codes
+func ParseCountries(value string) ([]string, error) {
+	var codes []string
+	for _, code := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t'
+	}) {
+		if len(code) != 2 || !isLetter(code[0]) || !isLetter(code[1]) {
+			return nil, fmt.Errorf("not a country code: %q", code)
+		}
+		if code = strings.ToUpper(code); !slices.Contains(codes, code) {
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+// countryAllowed reports whether ip is in one of Config.AllowCountries,
+// every host is allowed when the list is empty
+func (s *Scanner) countryAllowed(ip net.IP) bool {
+	return len(s.Config.AllowCountries) == 0 || slices.Contains(s.Config.AllowCountries, s.Geo.GetGeo(ip))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultALPN is the protocol a feasible host has to select when the
+// policy names none, the one of the browsers Reality imitates
+const defaultALPN = "h2"
+
+// FeasibilityPolicy decides which hosts are feasible as Reality dests. The
+// zero value is the default rule: TLS 1.3, h2 selected through ALPN and a
+// certificate naming a domain and an issuer organization.
+type FeasibilityPolicy struct {
+	// ALPN are the protocols a feasible host may select, h2 when empty.
+	// They are offered in the handshake besides h2 and http/1.1.
+	ALPN []string `json:"alpn,omitempty"`
+	// AllowTLS12 also accepts hosts that only negotiate TLS 1.2
+	AllowTLS12 bool `json:"allow_tls12"`
+	// Issuers are case-insensitive parts of the issuer organization, one of
+	// which it has to contain, any issuer is accepted when empty
+	Issuers []string `json:"issuers,omitempty"`
+	// ExcludeIssuers are case-insensitive parts of issuer organizations
+	// that make a host not feasible, e.g. Cloudflare for the certificates
+	// of its proxies
+	ExcludeIssuers []string `json:"exclude_issuers,omitempty"`
+	// MinValidDays is how many more days the certificate has to be valid,
+	// 0 does not check its expiry
+	MinValidDays int `json:"min_valid_days"`
+	// MatchSNI requires the certificate to be valid for the SNI sent,
+	// hosts scanned without SNI pass
+	MatchSNI bool `json:"match_sni"`
+}
+
+// ParseALPN parses comma or space separated ALPN protocol IDs
+func ParseALPN(value string) ([]string, error) {
+	var protocols []string
+	for _, protocol := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	}) {
+		if len(protocol) > 255 {
+			return nil, fmt.Errorf("ALPN protocol too long: %q", protocol)
+		}
+		if !slices.Contains(protocols, protocol) {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols, nil
+}
+
+// ParseIssuers parses comma separated parts of issuer organizations, which
+// may contain spaces
+func ParseIssuers(value string) []string {
+	var issuers []string
+	for _, issuer := range strings.Split(value, ",") {
+		if issuer = strings.TrimSpace(issuer); issuer != "" {
+			issuers = append(issuers, issuer)
+		}
+	}
+	return issuers
+}
+
+// Validate reports settings no host could meet
+func (p *FeasibilityPolicy) Validate() error {
+	if p.MinValidDays < 0 {
+		return fmt.Errorf("invalid minimum certificate validity %d", p.MinValidDays)
+	}
+	for _, protocol := range p.ALPN {
+		if protocol == "" || len(protocol) > 255 {
+			return errors.New("invalid ALPN protocol")
+		}
+	}
+	return nil
+}
+
+// IsDefault reports whether the policy is the default rule
+func (p *FeasibilityPolicy) IsDefault() bool {
+	return (len(p.ALPN) == 0 || slices.Equal(p.ALPN, []string{defaultALPN})) && !p.AllowTLS12 &&
+		len(p.Issuers) == 0 && len(p.ExcludeIssuers) == 0 && p.MinValidDays == 0 && !p.MatchSNI
+}
+
+// IssuerAllowed reports whether issuer organizations pass Issuers and
+// ExcludeIssuers. Exports apply it to results that were judged by another
+// policy, such as those loaded from history.
+func (p *FeasibilityPolicy) IssuerAllowed(issuers string) bool {
+	issuers = strings.ToLower(issuers)
+	contains := func(part string) bool {
+		return strings.Contains(issuers, strings.ToLower(part))
+	}
+	if len(p.Issuers) > 0 && !slices.ContainsFunc(p.Issuers, contains) {
+		return false
+	}
+	return !slices.ContainsFunc(p.ExcludeIssuers, contains)
+}
+
+// nextProtos returns the ALPN protocols offered in the handshake
+func (p *FeasibilityPolicy) nextProtos() []string {
+	protocols := []string{"h2", "http/1.1"}
+	for _, protocol := range p.ALPN {
+		if !slices.Contains(protocols, protocol) {
+			protocols = append(protocols, protocol)
+		}
+	}
+	return protocols
+}
+
+// Feasible reports whether a host is feasible from its handshake, the
+// domain and issuer organizations of its certificate and the SNI it was
+// sent
+func (p *FeasibilityPolicy) Feasible(state tls.ConnectionState, domain, issuers, sni string, now time.Time) bool {
+	if len(state.PeerCertificates) == 0 || domain == "" || issuers == "" {
+		return false
+	}
+	switch {
+	case state.Version == tls.VersionTLS13:
+	case state.Version == tls.VersionTLS12 && p.AllowTLS12:
+	default:
+		return false
+	}
+	alpn := p.ALPN
+	if len(alpn) == 0 {
+		alpn = []string{defaultALPN}
+	}
+	if !slices.Contains(alpn, state.NegotiatedProtocol) {
+		return false
+	}
+	if !p.IssuerAllowed(issuers) {
+		return false
+	}
+	cert := state.PeerCertificates[0]
+	if p.MinValidDays > 0 && cert.NotAfter.Before(now.AddDate(0, 0, p.MinValidDays)) {
+		return false
+	}
+	if p.MatchSNI && sni != "" && cert.VerifyHostname(sni) != nil {
+		return false
+	}
+	return true
+}
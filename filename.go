@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultFilenameTemplate is used for files saved from the GUI
+const defaultFilenameTemplate = "{source}_{date}_{time}"
+
+// maxFilenameCounter bounds the search for a free {n} value
+const maxFilenameCounter = 10000
+
+// FilenameVars holds the values available to output filename templates
+type FilenameVars struct {
+	Tag    string
+	Source string
+	Port   int
+	Time   time.Time
+}
+
+// ExpandFilename replaces the placeholders {date}, {time}, {tag}, {source}
+// and {port} in tmpl. A {n} placeholder becomes the smallest counter
+// starting from 1 for which no file exists yet, so consecutive runs never
+// overwrite each other.
+func ExpandFilename(tmpl string, vars FilenameVars) string {
+	if vars.Time.IsZero() {
+		vars.Time = time.Now()
+	}
+	name := strings.NewReplacer(
+		"{date}", vars.Time.Format("20060102"),
+		"{time}", vars.Time.Format("150405"),
+		"{tag}", sanitizeForFilename(vars.Tag),
+		"{source}", sanitizeForFilename(vars.Source),
+		"{port}", strconv.Itoa(vars.Port),
+	).Replace(tmpl)
+	if !strings.Contains(name, "{n}") {
+		return name
+	}
+	for i := 1; i < maxFilenameCounter; i++ {
+		candidate := strings.ReplaceAll(name, "{n}", strconv.Itoa(i))
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+	return strings.ReplaceAll(name, "{n}", fmt.Sprint(vars.Time.Unix()))
+}
+
+// sourceLabel turns a scan input into a short label for filenames. URLs
+// are reduced to their host and files to their base name.
+func sourceLabel(input string, isFile bool) string {
+	if isFile {
+		return strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	}
+	if _, rest, ok := strings.Cut(input, "://"); ok {
+		host, _, _ := strings.Cut(rest, "/")
+		return host
+	}
+	return input
+}
+
+// sanitizeForFilename makes input safe to use in a file name
+func sanitizeForFilename(input string) string {
+	// Remove or replace invalid filename characters
+	replacer := strings.NewReplacer(
+		"/", "_",
+		"\\", "_",
+		":", "_",
+		"*", "_",
+		"?", "_",
+		"\"", "_",
+		"<", "_",
+		">", "_",
+		"|", "_",
+		" ", "_",
+	)
+	sanitized := replacer.Replace(input)
+
+	// Limit length to 50 characters
+	if len(sanitized) > 50 {
+		sanitized = sanitized[:50]
+	}
+
+	// Remove trailing dots and underscores
+	sanitized = strings.TrimRight(sanitized, "._")
+
+	if sanitized == "" {
+		sanitized = "scan"
+	}
+
+	return sanitized
+}
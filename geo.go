@@ -1,29 +1,135 @@
 package main
 
 import (
+	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
+	neturl "net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
-
-	"github.com/oschwald/geoip2-golang"
 )
 
-const geoDBURL = "https://github.com/P3TERX/GeoLite.mmdb/releases/latest/download/GeoLite2-Country.mmdb"
+// geoDBMirror is where the databases are downloaded from by default
+const geoDBMirror = "https://github.com/P3TERX/GeoLite.mmdb/releases/latest/download/"
+
+const geoDBFile = "GeoLite2-Country.mmdb"
 const geoDBPath = "Country.mmdb"
-const geoDBTempPath = "Country.mmdb.tmp"
+
+const asnDBFile = "GeoLite2-ASN.mmdb"
+const asnDBPath = "ASN.mmdb"
+
+const cityDBFile = "GeoLite2-City.mmdb"
+const cityDBPath = "City.mmdb"
+
+// GeoOptions locate the databases and the server they are downloaded from
+type GeoOptions struct {
+	// CountryPath and ASNPath replace the default database files. A given
+	// file that exists is used as it is, without checking for updates.
+	CountryPath string
+	ASNPath     string
+	// City opens the GeoLite2-City database for the location of hosts,
+	// CityPath replaces its default file
+	City     bool
+	CityPath string
+	// Mirror replaces the base URL the GeoLite2-Country.mmdb and
+	// GeoLite2-ASN.mmdb files are downloaded from
+	Mirror string
+	// Proxy is an http, https or socks5 proxy URL for the downloads
+	Proxy string
+	// LicenseKey downloads the databases from MaxMind instead of a mirror
+	LicenseKey string
+	// Providers are the country providers asked in turn, GeoLite2 alone
+	// when empty
+	Providers []string
+	// DBIPPath replaces the downloaded DB-IP lite country database and
+	// IP2LocationPath is an IP2Location LITE database in MMDB format,
+	// which has to be downloaded by hand
+	DBIPPath        string
+	IP2LocationPath string
+	// APIURL is the lookup URL of the online provider with {ip} standing
+	// for the IP, answering with the country code
+	APIURL string
+}
 
 type Geo struct {
-	geoReader *geoip2.Reader
-	mu        sync.Mutex
+	// providers answer country lookups in turn
+	providers []GeoProvider
+	asnDB     *mmdbDB
+	// cityDB is only opened when GeoOptions.City is set
+	cityDB *mmdbDB
+	// rir is a coarse country table used when no database can be opened
+	rir       *rirTable
+	enableASN bool
+	opts      GeoOptions
+	transport http.RoundTripper
+	// updateMu keeps updates of several scans sharing the Geo apart
+	updateMu sync.Mutex
+	// cache keeps the answers for the IPs looked up last
+	cache *geoCache
+}
+
+// geoTransport returns the transport downloads go through, using proxy if
+// it is set
+func geoTransport(proxy string) (http.RoundTripper, error) {
+	if proxy == "" {
+		return http.DefaultTransport, nil
+	}
+	proxyURL, err := neturl.Parse(proxy)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL: %q", proxy)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return transport, nil
+}
+
+// dbSource returns the path of a database and the URL it is downloaded
+// from, "" if a file given by the user is used as it is
+func (o *Geo) dbSource(custom, path, file string) (string, string) {
+	mirror := geoDBMirror
+	if o.opts.Mirror != "" {
+		mirror = strings.TrimSuffix(o.opts.Mirror, "/") + "/"
+	}
+	if custom != "" {
+		if _, err := os.Stat(custom); err == nil {
+			return custom, ""
+		}
+		path = custom
+	}
+	if o.opts.LicenseKey != "" {
+		return path, maxmindURL(strings.TrimSuffix(file, ".mmdb"), o.opts.LicenseKey)
+	}
+	return path, mirror + file
+}
+
+// countrySource, asnSource and citySource are the dbSource of each database
+func (o *Geo) countrySource() (string, string) {
+	return o.dbSource(o.opts.CountryPath, geoDBPath, geoDBFile)
+}
+
+func (o *Geo) asnSource() (string, string) {
+	return o.dbSource(o.opts.ASNPath, asnDBPath, asnDBFile)
+}
+
+func (o *Geo) citySource() (string, string) {
+	return o.dbSource(o.opts.CityPath, cityDBPath, cityDBFile)
+}
+
+// isGzipURL reports whether url is a database compressed with gzip, as
+// DB-IP publishes them
+func isGzipURL(url string) bool {
+	return strings.HasSuffix(url, ".gz")
 }
 
 // needsUpdate checks if database update is needed
-func needsUpdate(localPath string) (bool, error) {
+func needsUpdate(transport http.RoundTripper, localPath, url string) (bool, error) {
 	// Check local file existence
 	localInfo, err := os.Stat(localPath)
 	if os.IsNotExist(err) {
@@ -35,11 +141,12 @@ func needsUpdate(localPath string) (bool, error) {
 
 	// HEAD request to GitHub to get file size
 	client := &http.Client{
-		Timeout: 5 * time.Second,
+		Timeout:   5 * time.Second,
+		Transport: transport,
 	}
-	resp, err := client.Head(geoDBURL)
+	resp, err := client.Head(url)
 	if err != nil {
-		slog.Debug("Failed to check GeoIP database updates", "err", err)
+		slog.Debug("Failed to check GeoIP database updates", "err", redactError(err))
 		return false, nil // if we can't check - use old database
 	}
 	defer resp.Body.Close()
@@ -48,6 +155,18 @@ func needsUpdate(localPath string) (bool, error) {
 		return false, nil
 	}
 
+	// MaxMind and DB-IP serve archives, whose size says nothing about the
+	// database. Downloaded databases carry the modification time of their
+	// archive.
+	if isMaxMindURL(url) || isGzipURL(url) {
+		remote := lastModified(resp)
+		if !remote.IsZero() && remote.After(localInfo.ModTime()) {
+			slog.Info("GeoIP database update available", "path", localPath, "released", remote)
+			return true, nil
+		}
+		return false, nil
+	}
+
 	remoteSize := resp.ContentLength
 	if remoteSize <= 0 {
 		return false, nil
@@ -62,16 +181,18 @@ func needsUpdate(localPath string) (bool, error) {
 	return false, nil
 }
 
-// downloadCountryDB downloads the Country.mmdb database
-func downloadCountryDB() error {
-	slog.Info("Downloading GeoIP database...", "url", geoDBURL)
+// downloadDB downloads a database from url and atomically replaces path
+func downloadDB(transport http.RoundTripper, url, path string) error {
+	slog.Info("Downloading GeoIP database...", "url", redactURL(url))
+	tmpPath := path + ".tmp"
 
 	client := &http.Client{
-		Timeout: 60 * time.Second,
+		Timeout:   60 * time.Second,
+		Transport: transport,
 	}
-	resp, err := client.Get(geoDBURL)
+	resp, err := client.Get(url)
 	if err != nil {
-		return fmt.Errorf("failed to download: %w", err)
+		return fmt.Errorf("failed to download: %w", redactError(err))
 	}
 	defer resp.Body.Close()
 
@@ -79,24 +200,38 @@ func downloadCountryDB() error {
 		return fmt.Errorf("bad status code: %d", resp.StatusCode)
 	}
 
+	var body io.Reader = resp.Body
+	totalSize := resp.ContentLength
+	if isMaxMindURL(url) {
+		body, totalSize, err = mmdbFromArchive(resp.Body)
+		if err != nil {
+			return err
+		}
+	} else if isGzipURL(url) {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		body, totalSize = gz, -1
+	}
+
 	// Create temporary file
-	tmpFile, err := os.Create(geoDBTempPath)
+	tmpFile, err := os.Create(tmpPath)
 	if err != nil {
 		return fmt.Errorf("failed to create temp file: %w", err)
 	}
 	defer tmpFile.Close()
 
 	// Copy content with progress display
-	totalSize := resp.ContentLength
 	var downloaded int64
 	buffer := make([]byte, 32*1024)
 
 	for {
-		n, err := resp.Body.Read(buffer)
+		n, err := body.Read(buffer)
 		if n > 0 {
 			_, writeErr := tmpFile.Write(buffer[:n])
 			if writeErr != nil {
-				os.Remove(geoDBTempPath)
+				os.Remove(tmpPath)
 				return fmt.Errorf("failed to write: %w", writeErr)
 			}
 			downloaded += int64(n)
@@ -112,7 +247,7 @@ func downloadCountryDB() error {
 			break
 		}
 		if err != nil {
-			os.Remove(geoDBTempPath)
+			os.Remove(tmpPath)
 			return fmt.Errorf("failed to read: %w", err)
 		}
 	}
@@ -120,84 +255,256 @@ func downloadCountryDB() error {
 	tmpFile.Close()
 
 	// Atomically rename temporary file
-	if err := os.Rename(geoDBTempPath, geoDBPath); err != nil {
-		os.Remove(geoDBTempPath)
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
 		return fmt.Errorf("failed to rename: %w", err)
 	}
+	if modified := lastModified(resp); (isMaxMindURL(url) || isGzipURL(url)) && !modified.IsZero() {
+		// Later update checks compare against the release time
+		_ = os.Chtimes(path, modified, modified)
+	}
 
 	slog.Info("GeoIP database downloaded successfully", "size_mb", downloaded/(1024*1024))
 	return nil
 }
 
-func NewGeo() *Geo {
+func NewGeo(enableASN bool, opts GeoOptions) *Geo {
 	geo := &Geo{
-		mu: sync.Mutex{},
+		enableASN: enableASN,
+		opts:      opts,
+		cache:     newGeoCache(),
 	}
-
-	// Check if update is needed
-	needUpdate, err := needsUpdate(geoDBPath)
+	transport, err := geoTransport(opts.Proxy)
 	if err != nil {
-		slog.Warn("Failed to check GeoIP database updates", "err", err)
+		slog.Warn("Downloading GeoIP databases without proxy", "err", err)
+		transport = http.DefaultTransport
 	}
+	geo.transport = transport
 
-	if needUpdate {
-		if err := downloadCountryDB(); err != nil {
-			slog.Warn("Failed to download GeoIP database", "err", err)
+	if enableASN {
+		path, url := geo.asnSource()
+		geo.asnDB = openMMDB(transport, "GeoLite2-ASN", path, url)
+		if geo.asnDB.open() {
+			slog.Info("Enabled ASN lookup")
 		}
 	}
 
-	// Open database
-	reader, err := geoip2.Open(geoDBPath)
-	if err != nil {
-		slog.Warn("Cannot open Country.mmdb", "err", err)
+	if opts.City {
+		path, url := geo.citySource()
+		geo.cityDB = openMMDB(transport, "GeoLite2-City", path, url)
+		if geo.cityDB.open() {
+			slog.Info("Enabled city lookup")
+		}
+	}
+
+	providers := opts.Providers
+	if len(providers) == 0 {
+		providers = []string{GeoProviderGeoLite2}
+	}
+	for _, name := range providers {
+		var provider GeoProvider
+		switch name {
+		case GeoProviderGeoLite2:
+			path, url := geo.countrySource()
+			provider = openMMDB(transport, "GeoLite2-Country", path, url)
+		case GeoProviderDBIP:
+			path, url := geo.dbipSource()
+			provider = openMMDB(transport, "DB-IP", path, url)
+		case GeoProviderIP2Location:
+			if opts.IP2LocationPath == "" {
+				slog.Warn("IP2Location needs a database file, skipping it")
+				continue
+			}
+			provider = openMMDB(transport, "IP2Location", opts.IP2LocationPath, "")
+		case GeoProviderOnline:
+			provider = newOnlineProvider(opts.APIURL, transport)
+		default:
+			slog.Warn("Unknown geo provider", "name", name)
+			continue
+		}
+		geo.providers = append(geo.providers, provider)
+	}
+
+	if !geo.countryReady() {
+		geo.rir = loadRIRTable()
 		return geo
 	}
-	slog.Info("Enabled GeoIP")
-	geo.geoReader = reader
+	slog.Info("Enabled GeoIP", "providers", strings.Join(providers, ","))
 	return geo
 }
 
+// countryReady reports whether a country database or the online provider
+// is available
+func (o *Geo) countryReady() bool {
+	for _, provider := range o.providers {
+		if db, ok := provider.(*mmdbDB); !ok || db.open() {
+			return true
+		}
+	}
+	return false
+}
+
+// dbipSource is the dbSource of the DB-IP lite country database
+func (o *Geo) dbipSource() (string, string) {
+	if o.opts.DBIPPath != "" {
+		if _, err := os.Stat(o.opts.DBIPPath); err == nil {
+			return o.opts.DBIPPath, ""
+		}
+		return o.opts.DBIPPath, dbipURL(time.Now())
+	}
+	return dbipDBPath, dbipURL(time.Now())
+}
+
+// GeoDBInfo describes a database lookups are served from
+type GeoDBInfo struct {
+	Type  string    `json:"type"`
+	Path  string    `json:"path,omitempty"`
+	Built time.Time `json:"built,omitempty"`
+}
+
+// Databases describes the loaded databases and providers, or the embedded
+// RIR table when no country provider is available
+func (o *Geo) Databases() []GeoDBInfo {
+	var dbs []GeoDBInfo
+	for _, provider := range o.providers {
+		switch p := provider.(type) {
+		case *mmdbDB:
+			if info, ok := p.info(); ok {
+				dbs = append(dbs, info)
+			}
+		case *onlineProvider:
+			dbs = append(dbs, GeoDBInfo{Type: p.Name(), Path: p.url})
+		}
+	}
+	for _, db := range []*mmdbDB{o.asnDB, o.cityDB} {
+		if db == nil {
+			continue
+		}
+		if info, ok := db.info(); ok {
+			dbs = append(dbs, info)
+		}
+	}
+	if !o.countryReady() && o.rir != nil {
+		dbs = append(dbs, GeoDBInfo{Type: "RIR delegations (embedded)"})
+	}
+	return dbs
+}
+
+// cached returns the record of ip with the field looked up by lookup, from
+// the cache if it has it. lookup reports whether its answer may be cached.
+func (o *Geo) cached(ip net.IP, field geoFields, lookup func(record *geoRecord) bool) geoRecord {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		var record geoRecord
+		lookup(&record)
+		return record
+	}
+	addr = addr.Unmap()
+	if record, ok := o.cache.get(addr); ok && record.have&field != 0 {
+		return record
+	}
+	record := geoRecord{have: field}
+	if lookup(&record) {
+		o.cache.add(addr, record)
+	}
+	return record
+}
+
+// GetGeo returns the country code of ip from the first provider that
+// knows it, "N/A" when no provider is available
 func (o *Geo) GetGeo(ip net.IP) string {
-	if o.geoReader == nil {
+	return o.cached(ip, geoCountry, func(record *geoRecord) bool {
+		record.country = o.lookupCountry(ip)
+		// An unknown IP may be known after a failed online lookup
+		return record.country != ""
+	}).country
+}
+
+// lookupCountry asks the providers for the country of ip
+func (o *Geo) lookupCountry(ip net.IP) string {
+	if !o.countryReady() {
+		if o.rir != nil {
+			if code := o.rir.Lookup(ip); code != "" {
+				return code
+			}
+		}
 		return "N/A"
 	}
-	o.mu.Lock()
-	defer o.mu.Unlock()
-	country, err := o.geoReader.Country(ip)
-	if err != nil {
-		slog.Debug("Error reading geo", "err", err)
-		return "N/A"
+	for _, provider := range o.providers {
+		if code := provider.Country(ip); code != "" {
+			return code
+		}
 	}
-	return country.Country.IsoCode
+	return ""
 }
 
-// CheckAndUpdate checks if GeoIP database needs update and updates it
-func (g *Geo) CheckAndUpdate() error {
-	needUpdate, err := needsUpdate(geoDBPath)
-	if err != nil {
-		return err
+// hasASN reports whether the ASN database is open
+func (o *Geo) hasASN() bool {
+	return o.asnDB != nil && o.asnDB.open()
+}
+
+// GetASN returns the autonomous system number and organization of ip,
+// or zero values when ASN lookup is disabled or fails
+func (o *Geo) GetASN(ip net.IP) (uint, string) {
+	if o.asnDB == nil {
+		return 0, ""
 	}
-	
-	if needUpdate {
-		if err := downloadCountryDB(); err != nil {
-			return err
+	record := o.cached(ip, geoASN, func(record *geoRecord) bool {
+		record.asn, record.asOrg = o.asnDB.asn(ip)
+		return true
+	})
+	return record.asn, record.asOrg
+}
+
+// GetLocation returns the coordinates and English city name of ip, ok is
+// false when the city database is not open or does not know the IP
+func (o *Geo) GetLocation(ip net.IP) (lat, lon float64, city string, ok bool) {
+	if o.cityDB == nil {
+		return 0, 0, "", false
+	}
+	record := o.cached(ip, geoLocation, func(record *geoRecord) bool {
+		record.lat, record.lon, record.city, record.located = o.cityDB.location(ip)
+		return true
+	})
+	return record.lat, record.lon, record.city, record.located
+}
+
+// CheckAndUpdate checks if GeoIP databases need update and updates them
+func (g *Geo) CheckAndUpdate() error {
+	g.updateMu.Lock()
+	defer g.updateMu.Unlock()
+	dbs := []*mmdbDB{g.asnDB, g.cityDB}
+	for _, provider := range g.providers {
+		if db, ok := provider.(*mmdbDB); ok {
+			dbs = append(dbs, db)
 		}
-		
-		// Reopen database with new file
-		g.mu.Lock()
-		defer g.mu.Unlock()
-		
-		if g.geoReader != nil {
-			g.geoReader.Close()
+	}
+	for _, db := range dbs {
+		if db == nil {
+			continue
 		}
-		
-		reader, err := geoip2.Open(geoDBPath)
-		if err != nil {
+		if err := db.update(g.transport); err != nil {
+			g.cache.clear()
 			return err
 		}
-		g.geoReader = reader
-		slog.Info("GeoIP database updated and reloaded")
 	}
-	
+	g.cache.clear()
 	return nil
 }
+
+// AutoUpdate calls CheckAndUpdate every interval until ctx is done, so
+// long scans pick up new database releases
+func (g *Geo) AutoUpdate(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := g.CheckAndUpdate(); err != nil {
+				slog.Warn("GeoIP update failed", "err", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// countryCentroidsData holds a central point of every country
+//
+//go:embed country_centroids.txt
+var countryCentroidsData string
+
+var (
+	centroidsOnce sync.Once
+	centroids     map[string][2]float64
+)
+
+// loadCountryCentroids parses the embedded points once, by country code
+func loadCountryCentroids() map[string][2]float64 {
+	centroidsOnce.Do(func() {
+		centroids = make(map[string][2]float64)
+		scanner := bufio.NewScanner(strings.NewReader(countryCentroidsData))
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 3 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			lat, err1 := strconv.ParseFloat(fields[1], 64)
+			lon, err2 := strconv.ParseFloat(fields[2], 64)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			centroids[fields[0]] = [2]float64{lat, lon}
+		}
+	})
+	return centroids
+}
+
+// countryCentroid returns the latitude and longitude of a point central to
+// the country of code, ok is false for unknown codes
+func countryCentroid(code string) (lat, lon float64, ok bool) {
+	point, ok := loadCountryCentroids()[code]
+	return point[0], point[1], ok
+}
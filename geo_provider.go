@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Country providers of GeoOptions.Providers
+const (
+	GeoProviderGeoLite2    = "geolite2"
+	GeoProviderDBIP        = "dbip"
+	GeoProviderIP2Location = "ip2location"
+	GeoProviderOnline      = "online"
+)
+
+// GeoProvider looks up the country of IPs. Geo asks its providers in the
+// configured order until one knows the IP, as single databases often get
+// the hosting ranges wrong.
+type GeoProvider interface {
+	// Name identifies the provider in the list of databases
+	Name() string
+	// Country returns the ISO code of the country of ip, "" when the
+	// provider does not know it
+	Country(ip net.IP) string
+}
+
+// ParseGeoProviders parses a comma separated list of country providers
+func ParseGeoProviders(list string) ([]string, error) {
+	var providers []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "":
+		case GeoProviderGeoLite2, GeoProviderDBIP, GeoProviderIP2Location, GeoProviderOnline:
+			providers = append(providers, name)
+		default:
+			return nil, fmt.Errorf("unknown geo provider %q, must be geolite2, dbip, ip2location or online", name)
+		}
+	}
+	return RemoveDuplicateStr(providers), nil
+}
+
+// mmdbDB is a database in the MaxMind format, which GeoLite2, DB-IP lite
+// and IP2Location LITE all come in. A database with a url is downloaded
+// when missing and kept up to date by Geo.CheckAndUpdate.
+type mmdbDB struct {
+	name string
+	path string
+	url  string
+
+	// reader is swapped by update while lookups go on without a lock
+	reader atomic.Pointer[mmdbReader]
+}
+
+// mmdbReader is an open database with the count of lookups using it, so
+// that an update closes it only once they are done
+type mmdbReader struct {
+	*maxminddb.Reader
+	users atomic.Int64
+}
+
+// acquire returns the open reader marked as used until release, nil when
+// the database is not open
+func (db *mmdbDB) acquire() *mmdbReader {
+	for {
+		r := db.reader.Load()
+		if r == nil {
+			return nil
+		}
+		r.users.Add(1)
+		// An update may have swapped the reader out before it was marked
+		if db.reader.Load() == r {
+			return r
+		}
+		r.users.Add(-1)
+	}
+}
+
+func (r *mmdbReader) release() {
+	r.users.Add(-1)
+}
+
+// retire closes a reader swapped out of its database once the lookups
+// using it are done
+func (r *mmdbReader) retire() {
+	for r.users.Load() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	r.Close()
+}
+
+// openMMDB downloads the database at path if it is missing or outdated and
+// opens it. The database is returned even when it cannot be opened, so that
+// a later update may bring it.
+func openMMDB(transport http.RoundTripper, name, path, url string) *mmdbDB {
+	db := &mmdbDB{name: name, path: path, url: url}
+	needUpdate := false
+	if url != "" {
+		var err error
+		needUpdate, err = needsUpdate(transport, path, url)
+		if err != nil {
+			slog.Warn("Failed to check GeoIP database updates", "path", path, "err", err)
+		}
+	}
+	if needUpdate {
+		if err := downloadDB(transport, url, path); err != nil {
+			slog.Warn("Failed to download GeoIP database", "path", path, "err", err)
+		}
+	}
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		slog.Warn("Cannot open GeoIP database", "path", path, "err", err)
+		return db
+	}
+	db.reader.Store(&mmdbReader{Reader: reader})
+	return db
+}
+
+// open reports whether the database could be opened
+func (db *mmdbDB) open() bool {
+	return db.reader.Load() != nil
+}
+
+// lookup decodes the record of ip into result, reporting whether the
+// database has one
+func (db *mmdbDB) lookup(ip net.IP, result any) bool {
+	r := db.acquire()
+	if r == nil {
+		return false
+	}
+	defer r.release()
+	if err := r.Lookup(ip, result); err != nil {
+		slog.Debug("Error reading GeoIP database", "path", db.path, "err", err)
+		return false
+	}
+	return true
+}
+
+func (db *mmdbDB) Name() string {
+	return db.name
+}
+
+func (db *mmdbDB) Country(ip net.IP) string {
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	db.lookup(ip, &record)
+	return record.Country.ISOCode
+}
+
+// asn returns the autonomous system of ip from an ASN database
+func (db *mmdbDB) asn(ip net.IP) (uint, string) {
+	var record struct {
+		Number       uint   `maxminddb:"autonomous_system_number"`
+		Organization string `maxminddb:"autonomous_system_organization"`
+	}
+	db.lookup(ip, &record)
+	return record.Number, record.Organization
+}
+
+// location returns the coordinates and English city name of ip from a
+// city database
+func (db *mmdbDB) location(ip net.IP) (lat, lon float64, city string, ok bool) {
+	var record struct {
+		City struct {
+			Names map[string]string `maxminddb:"names"`
+		} `maxminddb:"city"`
+		Location struct {
+			Latitude  float64 `maxminddb:"latitude"`
+			Longitude float64 `maxminddb:"longitude"`
+		} `maxminddb:"location"`
+	}
+	if !db.lookup(ip, &record) || record.Location.Latitude == 0 && record.Location.Longitude == 0 {
+		return 0, 0, "", false
+	}
+	return record.Location.Latitude, record.Location.Longitude, record.City.Names["en"], true
+}
+
+// info describes the database, ok is false when it is not open
+func (db *mmdbDB) info() (GeoDBInfo, bool) {
+	r := db.acquire()
+	if r == nil {
+		return GeoDBInfo{}, false
+	}
+	defer r.release()
+	meta := r.Metadata
+	return GeoDBInfo{
+		Type:  meta.DatabaseType,
+		Path:  db.path,
+		Built: time.Unix(int64(meta.BuildEpoch), 0).UTC(),
+	}, true
+}
+
+// update downloads a newer release of the database and swaps it in, a
+// database without url is left as it is
+func (db *mmdbDB) update(transport http.RoundTripper) error {
+	if db.url == "" {
+		return nil
+	}
+	needUpdate, err := needsUpdate(transport, db.path, db.url)
+	if err != nil || !needUpdate {
+		return err
+	}
+	// The open database cannot be replaced on every system, the new one
+	// is put in place once the lookups still using it are done. Lookups
+	// meanwhile find the database closed.
+	newPath := db.path + ".new"
+	if err := downloadDB(transport, db.url, newPath); err != nil {
+		return err
+	}
+	if old := db.reader.Swap(nil); old != nil {
+		old.retire()
+	}
+	if err := os.Rename(newPath, db.path); err != nil {
+		os.Remove(newPath)
+		if reader, err := maxminddb.Open(db.path); err == nil {
+			db.reader.Store(&mmdbReader{Reader: reader})
+		}
+		return fmt.Errorf("failed to rename: %w", err)
+	}
+	reader, err := maxminddb.Open(db.path)
+	if err != nil {
+		return err
+	}
+	db.reader.Store(&mmdbReader{Reader: reader})
+	slog.Info("GeoIP database updated and reloaded", "path", db.path)
+	return nil
+}
+
+// dbipDBPath is where the DB-IP lite country database is downloaded to
+const dbipDBPath = "DBIP-Country.mmdb"
+
+// dbipURL returns the download URL of the DB-IP lite country database of
+// the month of now, which DB-IP publishes at the start of every month
+func dbipURL(now time.Time) string {
+	return "https://download.db-ip.com/free/dbip-country-lite-" + now.UTC().Format("2006-01") + ".mmdb.gz"
+}
+
+// defaultGeoAPI answers with the country code of {ip} as plain text
+const defaultGeoAPI = "https://ipapi.co/{ip}/country/"
+
+// geoAPITimeout bounds one lookup of the online provider
+const geoAPITimeout = 5 * time.Second
+
+// geoAPICacheSize is how many networks the online provider remembers
+// before it starts over
+const geoAPICacheSize = 65536
+
+// Backoff of the online provider, so that a failing or rate limiting API
+// does not hold up every host for geoAPITimeout
+const (
+	// geoAPIFailureTTL is how long a network whose lookup failed is not
+	// asked for again
+	geoAPIFailureTTL = time.Minute
+	// geoAPIMaxRateLimits is how many answers in a row with status 429
+	// make the provider stop asking for geoAPIRateLimitPause
+	geoAPIMaxRateLimits  = 3
+	geoAPIRateLimitPause = time.Hour
+)
+
+// errGeoAPIRateLimited is the answer of an API over its rate limit
+var errGeoAPIRateLimited = errors.New("rate limited")
+
+// onlineProvider asks a web API for the country of IPs. Answers are cached
+// per /24 or /48 network, whose hosts share a country, to spare the rate
+// limits of the API during a scan of whole ranges.
+type onlineProvider struct {
+	// url is the lookup URL with {ip} standing for the IP
+	url    string
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]string
+	// failed is when networks whose lookup failed may be asked for again
+	failed map[string]time.Time
+	// rateLimits counts the answers in a row with status 429, no lookups
+	// are made before pausedUntil
+	rateLimits  int
+	pausedUntil time.Time
+}
+
+func newOnlineProvider(url string, transport http.RoundTripper) *onlineProvider {
+	if url == "" {
+		url = defaultGeoAPI
+	}
+	return &onlineProvider{
+		url:    url,
+		client: &http.Client{Timeout: geoAPITimeout, Transport: transport},
+		cache:  make(map[string]string),
+		failed: make(map[string]time.Time),
+	}
+}
+
+func (p *onlineProvider) Name() string {
+	return "Online API"
+}
+
+// network is the cache key of ip
+func (p *onlineProvider) network(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String()
+}
+
+func (p *onlineProvider) Country(ip net.IP) string {
+	network := p.network(ip)
+	now := time.Now()
+	p.mu.Lock()
+	code, ok := p.cache[network]
+	skip := now.Before(p.failed[network]) || now.Before(p.pausedUntil)
+	p.mu.Unlock()
+	if ok || skip {
+		return code
+	}
+	code, err := p.fetch(ip)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil {
+		// Failures are tried again after a while, and a rate limiting API
+		// is left alone for longer
+		slog.Debug("Online country lookup failed", "ip", ip, "err", err)
+		if len(p.failed) >= geoAPICacheSize {
+			p.failed = make(map[string]time.Time)
+		}
+		p.failed[network] = now.Add(geoAPIFailureTTL)
+		if errors.Is(err, errGeoAPIRateLimited) {
+			if p.rateLimits++; p.rateLimits >= geoAPIMaxRateLimits {
+				slog.Warn("Online country API is rate limiting, pausing lookups", "pause", geoAPIRateLimitPause)
+				p.pausedUntil = now.Add(geoAPIRateLimitPause)
+				p.rateLimits = 0
+			}
+		}
+		return ""
+	}
+	p.rateLimits = 0
+	if len(p.cache) >= geoAPICacheSize {
+		p.cache = make(map[string]string)
+	}
+	p.cache[network] = code
+	delete(p.failed, network)
+	return code
+}
+
+// fetch asks the API for the country of ip. Plain text answers are taken
+// as the code, JSON ones are searched for the fields common APIs use.
+func (p *onlineProvider) fetch(ip net.IP) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), geoAPITimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.ReplaceAll(p.url, "{ip}", ip.String()), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", errGeoAPIRateLimited
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return "", err
+	}
+	text := strings.TrimSpace(string(body))
+	if strings.HasPrefix(text, "{") {
+		var fields map[string]any
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return "", err
+		}
+		text = ""
+		for _, key := range []string{"country_code", "countryCode", "country"} {
+			if code, ok := fields[key].(string); ok && len(code) == 2 {
+				text = code
+				break
+			}
+		}
+	}
+	if len(text) != 2 {
+		// Unknown addresses, such as reserved ones
+		return "", nil
+	}
+	return strings.ToUpper(text), nil
+}
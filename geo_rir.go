@@ -0,0 +1,115 @@
+package main
+
+//go:generate go run ./tools/rirgen -out rir_country.txt.gz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// rirCountryData is a coarse prefix to country table derived from RIR
+// delegation statistics, regenerated with `go generate`
+//
+//go:embed rir_country.txt.gz
+var rirCountryData []byte
+
+type rirRange struct {
+	first   netip.Addr
+	last    netip.Addr
+	country string
+}
+
+// rirTable resolves IPs to the country an address block was delegated to.
+// It is used when no GeoIP database is available.
+type rirTable struct {
+	ranges []rirRange
+}
+
+var (
+	rirOnce     sync.Once
+	rirFallback *rirTable
+)
+
+// loadRIRTable parses the embedded table once, returning nil if it cannot
+// be read
+func loadRIRTable() *rirTable {
+	rirOnce.Do(func() {
+		t, err := parseRIRTable(rirCountryData)
+		if err != nil {
+			// Development builds embed an empty table, release builds run
+			// go generate first
+			slog.Debug("Cannot load RIR country table", "err", err)
+			return
+		}
+		slog.Info("Enabled RIR country fallback", "ranges", len(t.ranges))
+		rirFallback = t
+	})
+	return rirFallback
+}
+
+func parseRIRTable(data []byte) (*rirTable, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	t := &rirTable{}
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		first, err1 := netip.ParseAddr(fields[0])
+		last, err2 := netip.ParseAddr(fields[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		t.ranges = append(t.ranges, rirRange{first: first, last: last, country: fields[2]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// A table without ranges is a build that skipped `go generate`
+	if len(t.ranges) == 0 {
+		return nil, errors.New("table has no ranges, regenerate it with go generate")
+	}
+	sort.Slice(t.ranges, func(i, j int) bool {
+		return t.ranges[i].first.Less(t.ranges[j].first)
+	})
+	return t, nil
+}
+
+// Lookup returns the delegated country of ip or an empty string
+func (t *rirTable) Lookup(ip net.IP) string {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return ""
+	}
+	addr = addr.Unmap()
+	// Find the last range starting at or before addr
+	i := sort.Search(len(t.ranges), func(i int) bool {
+		return addr.Less(t.ranges[i].first)
+	}) - 1
+	if i < 0 {
+		return ""
+	}
+	r := t.ranges[i]
+	if r.first.BitLen() != addr.BitLen() || r.last.Less(addr) {
+		return ""
+	}
+	return r.country
+}
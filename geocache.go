@@ -0,0 +1,127 @@
+package main
+
+import (
+	"container/list"
+	"hash/maphash"
+	"net/netip"
+	"sync"
+)
+
+// geoCacheSize is how many IPs the lookup cache of a Geo remembers, split
+// evenly between its shards
+const geoCacheSize = 1 << 16
+
+// geoCacheShards is the number of independently locked parts of the
+// cache, so that workers looking up different IPs rarely wait on each
+// other
+const geoCacheShards = 16
+
+// geoFields are the lookups a geoRecord holds the answer of
+type geoFields uint8
+
+const (
+	geoCountry geoFields = 1 << iota
+	geoASN
+	geoLocation
+)
+
+// geoRecord is what the databases know about an IP. A host is looked up
+// several times during a scan: by the exclusion list, the country filter
+// and caps before connecting, and for its result.
+type geoRecord struct {
+	have     geoFields
+	country  string
+	asn      uint
+	asOrg    string
+	lat, lon float64
+	city     string
+	located  bool
+}
+
+// merge adds the fields of other that r does not have
+func (r *geoRecord) merge(other geoRecord) {
+	if other.have&geoCountry != 0 {
+		r.country = other.country
+	}
+	if other.have&geoASN != 0 {
+		r.asn, r.asOrg = other.asn, other.asOrg
+	}
+	if other.have&geoLocation != 0 {
+		r.lat, r.lon, r.city, r.located = other.lat, other.lon, other.city, other.located
+	}
+	r.have |= other.have
+}
+
+// geoCacheEntry is an element of the recency list of a shard
+type geoCacheEntry struct {
+	addr   netip.Addr
+	record geoRecord
+}
+
+type geoCacheShard struct {
+	mu      sync.Mutex
+	entries map[netip.Addr]*list.Element
+	// recent holds the entries from the most recently used one
+	recent list.List
+}
+
+// geoCache keeps the records of the IPs looked up last, dropping the least
+// recently used ones when full
+type geoCache struct {
+	seed   maphash.Seed
+	shards [geoCacheShards]geoCacheShard
+}
+
+func newGeoCache() *geoCache {
+	c := &geoCache{seed: maphash.MakeSeed()}
+	for i := range c.shards {
+		c.shards[i].entries = make(map[netip.Addr]*list.Element)
+	}
+	return c
+}
+
+func (c *geoCache) shard(addr netip.Addr) *geoCacheShard {
+	return &c.shards[maphash.Comparable(c.seed, addr)%geoCacheShards]
+}
+
+// get returns the record of addr, ok is false when it is not cached
+func (c *geoCache) get(addr netip.Addr) (record geoRecord, ok bool) {
+	s := c.shard(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[addr]
+	if !ok {
+		return geoRecord{}, false
+	}
+	s.recent.MoveToFront(e)
+	return e.Value.(*geoCacheEntry).record, true
+}
+
+// add merges record into the one cached for addr
+func (c *geoCache) add(addr netip.Addr, record geoRecord) {
+	s := c.shard(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[addr]; ok {
+		e.Value.(*geoCacheEntry).record.merge(record)
+		s.recent.MoveToFront(e)
+		return
+	}
+	s.entries[addr] = s.recent.PushFront(&geoCacheEntry{addr: addr, record: record})
+	if s.recent.Len() > geoCacheSize/geoCacheShards {
+		oldest := s.recent.Back()
+		s.recent.Remove(oldest)
+		delete(s.entries, oldest.Value.(*geoCacheEntry).addr)
+	}
+}
+
+// clear forgets all records, after the databases were updated
+func (c *geoCache) clear() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		clear(s.entries)
+		s.recent.Init()
+		s.mu.Unlock()
+	}
+}
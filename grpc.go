@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes returned by the API
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+	grpcUnauthenticated = 16
+)
+
+// grpcMaxMessage caps the size of a request message
+const grpcMaxMessage = 4 << 20
+
+// grpcError is an error returned to the client with a gRPC status code
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string { return e.msg }
+
+// grpcMethod serves a call of one method of the gRPC API described in
+// api/scanner.proto. req is the request message and send writes a
+// response message, once for unary methods.
+type grpcMethod func(ctx context.Context, req []byte, send func(msg protoBuffer) error) error
+
+// grpc adapts a gRPC method to HTTP/2, the status is sent in the trailers
+func (srv *Server) grpc(method grpcMethod) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			writeError(w, http.StatusUnsupportedMediaType, "gRPC needs HTTP/2 and application/grpc")
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		code := grpcOK
+		if err := srv.serveGRPC(w, r, method); err != nil {
+			var grpcErr *grpcError
+			if !errors.As(err, &grpcErr) {
+				grpcErr = &grpcError{code: grpcInternal, msg: err.Error()}
+			}
+			code = grpcErr.code
+			w.Header().Set("Grpc-Message", neturl.PathEscape(grpcErr.msg))
+		}
+		w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	}
+}
+
+func (srv *Server) serveGRPC(w http.ResponseWriter, r *http.Request, method grpcMethod) error {
+	if srv.Token != "" && r.Header.Get("Authorization") != "Bearer "+srv.Token {
+		return &grpcError{code: grpcUnauthenticated, msg: "missing or invalid token"}
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, grpcMaxMessage+6))
+	if err != nil {
+		return err
+	}
+	// Requests hold a single length prefixed message
+	if len(body) < 5 {
+		return &grpcError{code: grpcInvalidArgument, msg: "missing request message"}
+	}
+	if body[0] != 0 {
+		return &grpcError{code: grpcUnimplemented, msg: "compressed messages are not supported"}
+	}
+	if size := binary.BigEndian.Uint32(body[1:5]); size > grpcMaxMessage || int(size) != len(body)-5 {
+		return &grpcError{code: grpcInvalidArgument, msg: "invalid request message length"}
+	}
+	rc := http.NewResponseController(w)
+	return method(r.Context(), body[5:], func(msg protoBuffer) error {
+		frame := make([]byte, 5, 5+len(msg))
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+		if _, err := w.Write(append(frame, msg...)); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+}
+
+func (srv *Server) grpcStartScan(_ context.Context, data []byte, send func(protoBuffer) error) error {
+	var req ScanRequest
+	if err := req.unmarshalProto(data); err != nil {
+		return &grpcError{code: grpcInvalidArgument, msg: err.Error()}
+	}
+	job, err := srv.start(req, "")
+	var reqErr requestError
+	if errors.As(err, &reqErr) {
+		return &grpcError{code: grpcInvalidArgument, msg: err.Error()}
+	}
+	if err != nil {
+		return err
+	}
+	return send(job.status().marshalProto())
+}
+
+func (srv *Server) grpcStreamResults(ctx context.Context, data []byte, send func(protoBuffer) error) error {
+	var id string
+	follow := true
+	err := decodeProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			id = f.string()
+		case 2:
+			follow = !f.bool()
+		}
+		return nil
+	})
+	if err != nil {
+		return &grpcError{code: grpcInvalidArgument, msg: err.Error()}
+	}
+	job := srv.jobByID(id)
+	if job == nil {
+		return &grpcError{code: grpcNotFound, msg: "scan not found"}
+	}
+	return job.stream(ctx, follow, func(batch []ScanResult) error {
+		for _, result := range batch {
+			if err := send(result.marshalProto()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (srv *Server) grpcCancelScan(_ context.Context, data []byte, send func(protoBuffer) error) error {
+	var id string
+	err := decodeProto(data, func(f protoField) error {
+		if f.num == 1 {
+			id = f.string()
+		}
+		return nil
+	})
+	if err != nil {
+		return &grpcError{code: grpcInvalidArgument, msg: err.Error()}
+	}
+	job := srv.jobByID(id)
+	if job == nil {
+		return &grpcError{code: grpcNotFound, msg: "scan not found"}
+	}
+	job.scanner.Stop()
+	return send(job.status().marshalProto())
+}
+
+// unmarshalProto decodes the ScanRequest message of api/scanner.proto
+func (req *ScanRequest) unmarshalProto(data []byte) error {
+	return decodeProto(data, func(f protoField) error {
+		switch f.num {
+		case 1:
+			req.Addr = f.string()
+		case 2:
+			req.Targets = append(req.Targets, f.string())
+		case 3:
+			req.URL = f.string()
+		case 4:
+			req.CT = f.string()
+		case 5:
+			req.Port = f.int()
+		case 6:
+			req.Thread = f.int()
+		case 7:
+			req.Timeout = f.int()
+		case 8:
+			req.IPv6 = f.bool()
+		case 9:
+			req.Idle = f.int()
+		case 10:
+			req.ASN = f.bool()
+		case 11:
+			req.Expand = f.int()
+		case 12:
+			req.NetCap = f.int()
+		case 13:
+			req.PQ = f.bool()
+		case 14:
+			req.Rate = f.double()
+		case 15:
+			req.HTTP = f.bool()
+		case 16:
+			req.SNI = f.string()
+		case 17:
+			req.NoSNI = f.bool()
+		case 18:
+			req.Dual = f.bool()
+		case 19:
+			req.Bloom = f.int()
+		case 20:
+			req.Certs = f.bool()
+		case 21:
+			req.Exclude = append(req.Exclude, f.string())
+		case 22:
+			req.Shodan = f.string()
+		case 23:
+			req.Censys = f.string()
+		case 24:
+			req.SearchLimit = f.int()
+		case 25:
+			req.TLSDetails = f.bool()
+		case 26:
+			req.CDN = f.bool()
+		case 27:
+			req.SkipCDN = f.bool()
+		case 28:
+			req.Retries = f.int()
+		case 29:
+			req.Adaptive = f.bool()
+		case 30:
+			req.OCSP = f.bool()
+		case 31:
+			req.Shuffle = f.bool()
+		case 32:
+			req.H3 = f.bool()
+		case 33:
+			req.PreCheck = f.int()
+		case 34:
+			req.PreCheckTimeout = f.int()
+		case 35:
+			req.Countries = append(req.Countries, f.string())
+		case 36:
+			req.DNS = append(req.DNS, f.string())
+		case 37:
+			req.DNSTimeout = f.int()
+		case 38:
+			req.FeasibleALPN = append(req.FeasibleALPN, f.string())
+		case 39:
+			req.FeasibleTLS12 = f.bool()
+		case 40:
+			req.FeasibleIssuers = append(req.FeasibleIssuers, f.string())
+		case 41:
+			req.FeasibleMinDays = f.int()
+		case 42:
+			req.FeasibleSNI = f.bool()
+		case 43:
+			req.Timing = f.string()
+		case 44:
+			req.SNIMatrix = append(req.SNIMatrix, f.string())
+		case 45:
+			req.Resumption = f.bool()
+		case 46:
+			req.SpeedTest = f.int()
+		case 47:
+			req.MaxPerCountry = f.int()
+		case 48:
+			req.MaxPerASN = f.int()
+		case 49:
+			req.Subdomains = append(req.Subdomains, f.string())
+		case 50:
+			req.SubdomainCT = f.bool()
+		case 51:
+			req.HRR = f.bool()
+		case 52:
+			req.FeasibleExcludeIssuers = append(req.FeasibleExcludeIssuers, f.string())
+		case 53:
+			req.Honeypots = f.bool()
+		case 54:
+			req.HappyEyeballs = f.bool()
+		case 55:
+			req.DNSMatch = f.bool()
+		}
+		return nil
+	})
+}
+
+// marshalProto encodes the ScanJob message of api/scanner.proto
+func (st ScanJobStatus) marshalProto() protoBuffer {
+	var b protoBuffer
+	b.string(1, st.ID)
+	b.string(2, st.Source)
+	b.string(3, st.State)
+	b.string(4, string(st.Phase))
+	b.string(5, st.Error)
+	b.int(6, st.Created.Unix())
+	b.int(7, int64(st.Answered))
+	b.int(8, int64(st.Feasible))
+	return b
+}
+
+// marshalProto encodes the ScanResult message of api/scanner.proto
+func (r ScanResult) marshalProto() protoBuffer {
+	var b protoBuffer
+	b.string(1, r.IP)
+	b.int(2, int64(r.Port))
+	b.string(3, r.Origin)
+	b.string(4, r.Domain)
+	b.string(5, r.Issuer)
+	b.string(6, r.GeoCode)
+	b.bool(7, r.Feasible)
+	b.string(8, r.TLSVersion)
+	b.string(9, r.ALPN)
+	b.string(10, r.Idle)
+	b.uint(11, uint64(r.ASN))
+	b.string(12, r.ASOrg)
+	b.strings(13, r.SANs)
+	b.string(14, r.Curve)
+	b.int(15, int64(r.HTTPStatus))
+	b.string(16, r.HTTPServer)
+	b.bool(17, r.HTTPContent)
+	b.string(18, r.DualDomain)
+	b.bool(19, r.CertDiffers)
+	b.string(20, r.CipherSuite)
+	b.string(21, r.KeyExchange)
+	b.string(22, r.CDN)
+	b.strings(23, r.Chain)
+	b.double(24, r.Score)
+	b.int(25, int64(r.ConnectMs))
+	b.int(26, int64(r.HandshakeMs))
+	b.string(27, r.OCSP)
+	b.bool(28, r.OCSPStapled)
+	b.bool(29, r.H3)
+	for _, probe := range r.SNIs {
+		b.message(30, probe.marshalProto())
+	}
+	b.string(31, r.Resumption)
+	b.int(32, int64(r.SpeedKBps))
+	b.string(33, r.HRR)
+	b.bool(34, r.Honeypot)
+	b.int(35, int64(r.Rank))
+	b.string(36, r.Family)
+	for _, family := range r.Families {
+		b.message(37, family.marshalProto())
+	}
+	b.string(38, r.DNSMatch)
+	b.string(39, r.DualError)
+	return b
+}
@@ -1,13 +1,19 @@
+//go:build !nogui
+
 package main
 
 import (
-	"embed"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
-	"sort"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"fyne.io/fyne/v2"
@@ -19,11 +25,8 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/storage"
 	"fyne.io/fyne/v2/widget"
-	"github.com/xuri/excelize/v2"
 )
 
-//go:embed translations
-var translations embed.FS
 
 type GUI struct {
 	app        fyne.App
@@ -35,13 +38,25 @@ type GUI struct {
 	statusText binding.String
 	logText    binding.String
 	
-	// Sorting state
-	sortColumn    int
+	// Table columns, shown ones in order, and the sorting state
+	allColumns    []resultColumn
+	columns       []tableColumn
+	sortColumn    string
 	sortAscending bool
 	
-	// Double-click detection
-	lastClickCell widget.TableCellID
-	lastClickTime time.Time
+	// Filter bar, view holds the indexes of the results passing filter
+	filter         resultFilter
+	view           []int
+	geoCodes       map[string]bool
+	geoChanged     bool
+	filterEntry    *widget.Entry
+	feasibleFilter *widget.Check
+	geoFilter      *widget.Select
+	filterCount    *widget.Label
+	
+	// Rows ticked in the checkbox column by resultKey, guarded by resultsMu
+	checked      map[string]bool
+	selectionBtn *widget.Button
 	
 	// Input widgets
 	sourceRadio *widget.RadioGroup
@@ -49,42 +64,157 @@ type GUI struct {
 	portEntry   *widget.Entry
 	threadEntry *widget.Entry
 	timeoutEntry *widget.Entry
+	retriesEntry *widget.Entry
+	idleEntry   *widget.Entry
+	expandEntry *widget.Entry
+	filenameEntry *widget.Entry
 	ipv6Check   *widget.Check
+	happyEyeballsCheck *widget.Check
 	verboseCheck *widget.Check
+	asnCheck    *widget.Check
+	pqCheck     *widget.Check
+	httpCheck   *widget.Check
+	noSNICheck  *widget.Check
+	dualCheck   *widget.Check
+	tlsCheck    *widget.Check
+	cdnCheck    *widget.Check
+	skipCDNCheck *widget.Check
+	honeypotCheck *widget.Check
+	adaptiveCheck *widget.Check
+	shuffleCheck *widget.Check
+	subdomainsCheck *widget.Check
+	precheckCheck *widget.Check
+	ocspCheck   *widget.Check
+	h3Check     *widget.Check
+	resumptionCheck *widget.Check
+	hrrCheck *widget.Check
+	dnsMatchCheck *widget.Check
+	cityCheck   *widget.Check
+	sniEntry    *widget.Entry
+	sniMatrixEntry *widget.Entry
+	historyCheck *widget.Check
+	skipDaysEntry *widget.Entry
+	rateEntry   *widget.Entry
+	speedEntry  *widget.Entry
+	timingSelect *widget.Select
+	excludeEntry *widget.Entry
+	countriesEntry *widget.Entry
+	dnsEntry    *widget.Entry
+	geoDBEntry  *widget.Entry
+	
+	// Feasibility criteria edited in their own dialog
+	feasibility FeasibilityPolicy
+	
+	// Saved profiles
+	profileSelect *widget.Select
 	
 	// Control widgets
 	startBtn     *widget.Button
 	stopBtn      *widget.Button
+	pauseBtn     *widget.Button
 	saveCSVBtn   *widget.Button
 	saveExcelBtn *widget.Button
+	appendCheck  *widget.Check
+	xrayBtn      *widget.Button
+	historyBtn   *widget.Button
+	verifyBtn    *widget.Button
+	reverifyBtn  *widget.Button
+	shareBtn     *widget.Button
+	
+	// Configuration of the running scan and the run queued after it
+	running      *scanParams
+	queued       *scanParams
+	runningLabel *widget.Label
+	queueBtn     *widget.Button
+	runningBox   *fyne.Container
+	
+	// Last clicked result, used by per-row actions
+	selected *ScanResult
 	
 	// Results table
 	resultsTable *widget.Table
 	
-	// Log area
-	logScroll *container.Scroll
+	// Side panel with the certificates of the clicked result, detailSeq
+	// discards handshakes that finish after another row was clicked
+	detailPanel *fyne.Container
+	detailTitle *widget.Label
+	detailLabel *widget.Label
+	detailSeq   int
+	
+	// Tabs showing the results as a table or on the map
+	resultTabs *container.AppTabs
+	mapTab     *container.TabItem
+	worldMap   *WorldMap
+	mapLegend  *widget.Label
+	
+	// Scan phase timeline
+	timeline *Timeline
+	
+	// Progress of the source, for scans whose host count is known
+	progressBar   *widget.ProgressBar
+	progressDone  atomic.Int64
+	progressTotal int
+	
+	// Workers allowed to scan, shown during adaptive scans
+	concurrencyLabel *widget.Label
+	// Hosts per second, elapsed time and success ratio of the scan
+	throughputLabel *widget.Label
+	
+	// History database, opened on first use
+	store *Store
+	
+	// Runs saved profiles on their schedules
+	scheduler *Scheduler
+	
+	// Log area, logMu guards the kept messages and the log file
+	logScroll  *container.Scroll
+	logger     *slog.Logger
+	logLevel   slog.LevelVar
+	logMu      sync.Mutex
+	logEntries []logEntry
+	logFile    *RotatingFile
+	logPending atomic.Bool
+	
+	// System tray, nil menu on desktops without one
+	tray trayState
 }
 
-func runGUI() {
-	myApp := app.NewWithID("com.realitlscanner.app")
+func runGUI(openPath string) {
+	if openPath != "" {
+		if abs, err := filepath.Abs(openPath); err == nil {
+			openPath = abs
+		}
+	}
 	
-	// Detect system language and set accordingly
-	sysLang := lang.SystemLocale().String()
-	if strings.HasPrefix(sysLang, "ru") {
-		os.Setenv("LANG", "ru")
+	// Hand the file over to an already running instance if there is one
+	var gui *GUI
+	instance, err := AcquireInstance(openPath, func(path string) {
+		fyne.Do(func() {
+			if gui != nil {
+				gui.openSource(path)
+			}
+		})
+	})
+	if err != nil {
+		fmt.Printf("Warning: Failed to set up single-instance guard: %v\n", err)
+	} else if instance == nil {
+		fmt.Println("Passed to the running RealiTLScanner window")
+		return
 	} else {
-		os.Setenv("LANG", "en")
+		defer instance.Release()
 	}
 	
-	// Initialize translations
-	if err := lang.AddTranslationsFS(translations, "translations"); err != nil {
+	myApp := app.NewWithID("com.realitlscanner.app")
+	
+	// Initialize translations in the chosen or the system language
+	if err := setupLanguages(myApp.Preferences().String(languagePref)); err != nil {
 		fmt.Printf("Warning: Failed to load translations: %v\n", err)
 	}
 	
 	myWindow := myApp.NewWindow(lang.X("app.title", "RealiTLScanner"))
 	myWindow.Resize(fyne.NewSize(1000, 700))
 	
-	gui := &GUI{
+	gui = &GUI{
 		app:      myApp,
 		window:   myWindow,
 		results:  make([]ScanResult, 0),
@@ -95,24 +225,80 @@ func runGUI() {
 	
 	gui.logText = binding.NewString()
 	gui.logText.Set("")
+	gui.setupLog()
 	
+	gui.applyAppearance()
 	content := gui.buildUI()
 	myWindow.SetContent(content)
+	myWindow.SetMainMenu(gui.buildMainMenu())
+	if openPath != "" {
+		gui.openSource(openPath)
+	}
+	gui.startScheduler()
+	// Let a running scan record its last results before the app quits
+	myWindow.SetCloseIntercept(func() {
+		if gui.closeToTray() {
+			gui.hideToTray()
+			return
+		}
+		gui.quit()
+	})
 	myWindow.ShowAndRun()
+	if gui.store != nil {
+		gui.store.Close()
+	}
+}
+
+// buildMainMenu returns the menu of the window, setting up the tray menu
+// on desktops that have one
+func (g *GUI) buildMainMenu() *fyne.MainMenu {
+	viewMenu := fyne.NewMenu(lang.X("menu.view", "View"),
+		fyne.NewMenuItem(lang.X("menu.appearance", "Appearance..."), g.showAppearance),
+		fyne.NewMenuItem(lang.X("menu.columns", "Columns..."), g.showColumnChooser),
+	)
+	if g.setupTray() {
+		viewMenu.Items = append(viewMenu.Items, g.trayMenuItems()...)
+	}
+	return fyne.NewMainMenu(
+		fyne.NewMenu(lang.X("menu.file", "File"),
+			fyne.NewMenuItem(lang.X("menu.compare", "Compare results..."), g.onCompareResults),
+			fyne.NewMenuItem(lang.X("menu.export_config", "Export settings to config..."), g.onExportConfig),
+			fyne.NewMenuItem(lang.X("menu.schedules", "Schedules..."), g.onSchedules),
+		),
+		viewMenu,
+		fyne.NewMenu(lang.X("menu.help", "Help"),
+			fyne.NewMenuItem(lang.X("menu.help_contents", "How it works"), g.showHelp),
+		),
+	)
+}
+
+// openSource selects path as the file source, as requested by a second
+// launch of the application
+func (g *GUI) openSource(path string) {
+	g.window.RequestFocus()
+	if path == "" {
+		return
+	}
+	g.sourceRadio.SetSelected(lang.X("source.file", "File"))
+	g.inputEntry.SetText(path)
+	g.statusText.Set(lang.X("status.opened", "Opened: {{.Path}}", map[string]any{"Path": path}))
 }
 
 func (g *GUI) buildUI() fyne.CanvasObject {
 	// Create Entry first (before RadioGroup)
 	g.inputEntry = widget.NewEntry()
-	g.inputEntry.SetPlaceHolder(lang.X("placeholder.ip", "Enter IP, CIDR or domain"))
+	g.inputEntry.SetPlaceHolder(lang.X("placeholder.ip", "Enter IP, CIDR, IP range or domain"))
 	
 	// Source selection
 	g.sourceRadio = widget.NewRadioGroup([]string{
 		lang.X("source.ip", "IP/CIDR/Domain"),
 		lang.X("source.file", "File"),
 		lang.X("source.url", "URL"),
+		lang.X("source.ct", "CT log"),
+		lang.X("source.toplist", "Top list"),
 	}, func(value string) {
 		g.inputEntry.SetPlaceHolder(g.getPlaceholder(value))
+		g.updateRunning()
 	})
 	g.sourceRadio.SetSelected(lang.X("source.ip", "IP/CIDR/Domain"))
 	g.sourceRadio.Horizontal = true
@@ -130,7 +316,7 @@ func (g *GUI) buildUI() fyne.CanvasObject {
 		fileDialog.Show()
 	})
 	
-	inputContainer := container.NewBorder(nil, nil, nil, fileBrowseBtn, g.inputEntry)
+	inputContainer := sideBorder(nil, fileBrowseBtn, g.inputEntry)
 	
 	sourceBox := container.NewVBox(
 		widget.NewLabel(lang.X("source.label", "Source:")),
@@ -151,18 +337,151 @@ func (g *GUI) buildUI() fyne.CanvasObject {
 	g.timeoutEntry.SetText("10")
 	g.timeoutEntry.SetPlaceHolder("10")
 	
+	g.retriesEntry = widget.NewEntry()
+	g.retriesEntry.SetText("0")
+	g.retriesEntry.SetPlaceHolder("0")
+	
+	g.idleEntry = widget.NewEntry()
+	g.idleEntry.SetText("0")
+	g.idleEntry.SetPlaceHolder("0")
+	
+	g.expandEntry = widget.NewEntry()
+	g.expandEntry.SetText("0")
+	g.expandEntry.SetPlaceHolder("24")
+	
+	g.skipDaysEntry = widget.NewEntry()
+	g.skipDaysEntry.SetText("0")
+	g.skipDaysEntry.SetPlaceHolder("0")
+	
+	g.rateEntry = widget.NewEntry()
+	g.rateEntry.SetText("0")
+	g.rateEntry.SetPlaceHolder("0")
+	
+	g.speedEntry = widget.NewEntry()
+	g.speedEntry.SetText("0")
+	g.speedEntry.SetPlaceHolder("1024")
+	
+	// Options follow the order of timingProfiles
+	g.timingSelect = widget.NewSelect([]string{
+		lang.X("timing.paranoid", "Paranoid"),
+		lang.X("timing.slow", "Slow"),
+		lang.X("timing.normal", "Normal"),
+		lang.X("timing.fast", "Fast"),
+	}, func(string) { g.updateRunning() })
+	g.timingSelect.SetSelectedIndex(slices.Index(timingProfiles, TimingFast))
+	
+	g.sniEntry = widget.NewEntry()
+	g.sniEntry.SetPlaceHolder(lang.X("placeholder.sni", "scanned domain"))
+	
+	g.sniMatrixEntry = widget.NewEntry()
+	g.sniMatrixEntry.SetPlaceHolder(lang.X("placeholder.sni_matrix", "off, or a.com, www.a.com"))
+	
+	g.countriesEntry = widget.NewEntry()
+	g.countriesEntry.SetPlaceHolder(lang.X("placeholder.countries", "all, or NL, DE, FI"))
+	
+	g.dnsEntry = widget.NewEntry()
+	g.dnsEntry.SetPlaceHolder(lang.X("placeholder.dns", "system, or 1.1.1.1, https://…"))
+	
+	g.excludeEntry = widget.NewEntry()
+	g.excludeEntry.SetPlaceHolder(lang.X("placeholder.exclude", "CIDRs, AS numbers, country codes"))
+	excludeBrowseBtn := widget.NewButton("...", func() {
+		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+			data, err := io.ReadAll(reader)
+			if err != nil {
+				dialog.ShowError(err, g.window)
+				return
+			}
+			g.excludeEntry.SetText(excludeEntryText(string(data)))
+		}, g.window)
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".txt"}))
+		fileDialog.Show()
+	})
+	
+	g.geoDBEntry = widget.NewEntry()
+	g.geoDBEntry.SetPlaceHolder(lang.X("placeholder.geo_db", "downloaded Country.mmdb"))
+	geoDBBrowseBtn := widget.NewButton("...", func() {
+		fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			reader.Close()
+			g.geoDBEntry.SetText(reader.URI().Path())
+		}, g.window)
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".mmdb"}))
+		fileDialog.Show()
+	})
+	
+	g.filenameEntry = widget.NewEntry()
+	g.filenameEntry.SetText(defaultFilenameTemplate)
+	g.filenameEntry.SetPlaceHolder(defaultFilenameTemplate)
+	
 	g.ipv6Check = widget.NewCheck(lang.X("settings.ipv6", "IPv6"), nil)
+	g.happyEyeballsCheck = widget.NewCheck(lang.X("settings.happy_eyeballs", "Happy Eyeballs"), nil)
 	g.verboseCheck = widget.NewCheck(lang.X("settings.verbose", "Verbose"), nil)
+	g.asnCheck = widget.NewCheck(lang.X("settings.asn", "ASN"), nil)
+	g.pqCheck = widget.NewCheck(lang.X("settings.pq", "PQ probe"), nil)
+	g.httpCheck = widget.NewCheck(lang.X("settings.http", "HTTP probe"), nil)
+	g.noSNICheck = widget.NewCheck(lang.X("settings.no_sni", "No SNI"), nil)
+	g.dualCheck = widget.NewCheck(lang.X("settings.dual", "Dual SNI probe"), nil)
+	g.tlsCheck = widget.NewCheck(lang.X("settings.tls_details", "TLS details"), nil)
+	g.cdnCheck = widget.NewCheck(lang.X("settings.cdn", "Flag CDN"), nil)
+	g.skipCDNCheck = widget.NewCheck(lang.X("settings.skip_cdn", "Skip CDN"), nil)
+	g.honeypotCheck = widget.NewCheck(lang.X("settings.honeypots", "Skip honeypots"), nil)
+	g.ocspCheck = widget.NewCheck(lang.X("settings.ocsp", "OCSP"), nil)
+	g.h3Check = widget.NewCheck(lang.X("settings.h3", "H3 probe"), nil)
+	g.resumptionCheck = widget.NewCheck(lang.X("settings.resumption", "Resumption"), nil)
+	g.hrrCheck = widget.NewCheck(lang.X("settings.hrr", "HRR probe"), nil)
+	g.dnsMatchCheck = widget.NewCheck(lang.X("settings.dns_match", "DNS match"), nil)
+	g.cityCheck = widget.NewCheck(lang.X("settings.city", "City map"), nil)
+	g.adaptiveCheck = widget.NewCheck(lang.X("settings.adaptive", "Adaptive threads"), nil)
+	g.shuffleCheck = widget.NewCheck(lang.X("settings.shuffle", "Shuffle CIDRs"), nil)
+	g.subdomainsCheck = widget.NewCheck(lang.X("settings.subdomains", "Subdomains"), nil)
+	g.precheckCheck = widget.NewCheck(lang.X("settings.precheck", "TCP pre-check"), nil)
+	g.historyCheck = widget.NewCheck(lang.X("settings.history", "Save history"), nil)
 	
 	settingsGrid := container.New(layout.NewGridLayout(6),
 		widget.NewLabel(lang.X("settings.port", "Port:")), g.portEntry,
 		widget.NewLabel(lang.X("settings.threads", "Threads:")), g.threadEntry,
 		widget.NewLabel(lang.X("settings.timeout", "Timeout:")), g.timeoutEntry,
+		widget.NewLabel(lang.X("settings.retries", "Retries:")), g.retriesEntry,
+		widget.NewLabel(lang.X("settings.idle", "Idle test:")), g.idleEntry,
+		widget.NewLabel(lang.X("settings.expand", "Neighbors /:")), g.expandEntry,
+		widget.NewLabel(lang.X("settings.skip_days", "Skip scanned (days):")), g.skipDaysEntry,
+		widget.NewLabel(lang.X("settings.rate", "Conn/s limit:")), g.rateEntry,
+		widget.NewLabel(lang.X("settings.sni", "SNI:")), g.sniEntry,
+		widget.NewLabel(lang.X("settings.filename", "File name:")), g.filenameEntry,
+		widget.NewLabel(lang.X("settings.countries", "Countries:")), g.countriesEntry,
+		widget.NewLabel(lang.X("settings.dns", "DNS:")), g.dnsEntry,
+		widget.NewLabel(lang.X("settings.timing", "Timing:")), g.timingSelect,
+		widget.NewLabel(lang.X("settings.sni_matrix", "SNI matrix:")), g.sniMatrixEntry,
+		widget.NewLabel(lang.X("settings.speedtest", "Speed test (KB):")), g.speedEntry,
 	)
 	
-	checksBox := container.NewHBox(g.ipv6Check, g.verboseCheck)
+	checksBox := hbox(g.ipv6Check, g.happyEyeballsCheck, g.verboseCheck, g.asnCheck, g.pqCheck, g.httpCheck, g.noSNICheck, g.dualCheck, g.tlsCheck, g.cdnCheck, g.skipCDNCheck, g.honeypotCheck, g.ocspCheck, g.h3Check, g.resumptionCheck, g.hrrCheck, g.dnsMatchCheck, g.cityCheck, g.adaptiveCheck, g.shuffleCheck, g.subdomainsCheck, g.precheckCheck, g.historyCheck)
+	
+	excludeBox := sideBorder(widget.NewLabel(lang.X("settings.exclude", "Exclude:")), excludeBrowseBtn, g.excludeEntry)
+	
+	geoDBBox := sideBorder(widget.NewLabel(lang.X("settings.geo_db", "GeoIP database:")), geoDBBrowseBtn, g.geoDBEntry)
 	
-	settingsBox := container.NewVBox(settingsGrid, checksBox)
+	feasibilityBtn := widget.NewButton(lang.X("btn.feasibility", "Feasibility..."), g.showFeasibilityDialog)
+	
+	settingsBox := container.NewVBox(g.buildProfileBar(), settingsGrid, excludeBox, geoDBBox,
+		sideBorder(nil, feasibilityBtn, checksBox))
+	
+	// Show edits made while scanning against the running configuration
+	for _, entry := range []*widget.Entry{g.inputEntry, g.portEntry, g.threadEntry, g.timeoutEntry, g.retriesEntry,
+		g.idleEntry, g.expandEntry, g.skipDaysEntry, g.rateEntry, g.speedEntry, g.sniEntry, g.sniMatrixEntry, g.excludeEntry,
+		g.countriesEntry, g.dnsEntry, g.geoDBEntry} {
+		entry.OnChanged = func(string) { g.updateRunning() }
+	}
+	for _, check := range []*widget.Check{g.ipv6Check, g.happyEyeballsCheck, g.verboseCheck, g.asnCheck, g.pqCheck, g.httpCheck, g.noSNICheck, g.dualCheck,
+		g.tlsCheck, g.cdnCheck, g.skipCDNCheck, g.honeypotCheck, g.ocspCheck, g.h3Check, g.resumptionCheck, g.hrrCheck, g.dnsMatchCheck, g.cityCheck, g.adaptiveCheck, g.shuffleCheck, g.subdomainsCheck, g.precheckCheck, g.historyCheck} {
+		check.OnChanged = func(bool) { g.updateRunning() }
+	}
 	
 	// Control buttons
 	g.startBtn = widget.NewButton(lang.X("btn.start", "Start"), g.onStart)
@@ -171,47 +490,84 @@ func (g *GUI) buildUI() fyne.CanvasObject {
 	g.stopBtn = widget.NewButton(lang.X("btn.stop", "Stop"), g.onStop)
 	g.stopBtn.Disable()
 	
+	g.pauseBtn = widget.NewButton(lang.X("btn.pause", "Pause"), g.onPause)
+	g.pauseBtn.Disable()
+	
 	g.saveCSVBtn = widget.NewButton(lang.X("btn.save_csv", "Save CSV"), g.onSaveCSV)
 	g.saveCSVBtn.Disable()
 	
 	g.saveExcelBtn = widget.NewButton(lang.X("btn.save_excel", "Save Excel"), g.onSaveExcel)
 	g.saveExcelBtn.Disable()
 	
-	controlBox := container.NewHBox(
+	// Saving adds to a chosen file instead of writing a new one
+	g.appendCheck = widget.NewCheck(lang.X("btn.append", "Append"), nil)
+	
+	g.xrayBtn = widget.NewButton(lang.X("btn.xray_config", "Xray config"), g.onXrayConfig)
+	g.xrayBtn.Disable()
+	
+	g.historyBtn = widget.NewButton(lang.X("btn.history", "History"), g.onHistory)
+	
+	g.shareBtn = widget.NewButton(lang.X("btn.share_links", "Share links"), g.onShareLinks)
+	
+	g.verifyBtn = widget.NewButton(lang.X("btn.verify_cache", "Quick verify"), g.onVerifyCache)
+	
+	g.reverifyBtn = widget.NewButton(lang.X("btn.reverify", "Re-verify results"), g.onReverify)
+	
+	controlBox := hbox(
 		g.startBtn,
+		g.pauseBtn,
 		g.stopBtn,
+		g.verifyBtn,
+		g.reverifyBtn,
 		layout.NewSpacer(),
+		g.historyBtn,
+		g.shareBtn,
+		g.xrayBtn,
 		g.saveCSVBtn,
 		g.saveExcelBtn,
+		g.appendCheck,
 	)
 	
+	g.runningLabel = widget.NewLabel("")
+	g.runningLabel.Wrapping = fyne.TextWrapWord
+	g.runningLabel.Alignment = readingAlign()
+	g.queueBtn = widget.NewButton(lang.X("btn.queue", "Run next"), g.onQueue)
+	g.runningBox = sideBorder(nil, g.queueBtn, g.runningLabel)
+	g.runningBox.Hide()
+	
+	g.timeline = newTimeline()
+	
 	// Results table
+	g.loadTableLayout()
 	g.resultsTable = widget.NewTable(
 		func() (int, int) {
 			g.resultsMu.Lock()
 			defer g.resultsMu.Unlock()
-			return len(g.results) + 1, 6
+			return len(g.view) + 1, len(g.columns) + 1
 		},
 		func() fyne.CanvasObject {
-			return widget.NewLabel("Cell")
+			return newResultCell(g)
 		},
 		func(id widget.TableCellID, cell fyne.CanvasObject) {
-			label := cell.(*widget.Label)
+			label := cell.(*resultCell)
+			label.row = id.Row
+			if id.Col > len(g.columns) {
+				return
+			}
 			g.resultsMu.Lock()
 			defer g.resultsMu.Unlock()
 			
+			// The first column holds the checkboxes
+			if id.Col == 0 {
+				label.SetText(g.checkboxText(id.Row))
+				label.TextStyle = fyne.TextStyle{}
+				return
+			}
+			column, _ := g.columnDef(g.columns[id.Col-1].id)
 			if id.Row == 0 {
 				// Header with sort indicator
-				headers := []string{
-					lang.X("table.ip", "IP"),
-					lang.X("table.origin", "Origin"),
-					lang.X("table.domain", "Domain"),
-					lang.X("table.issuer", "Issuer"),
-					lang.X("table.geo", "Geo"),
-					lang.X("table.feasible", "Feasible"),
-				}
-				headerText := headers[id.Col]
-				if g.sortColumn == id.Col {
+				headerText := column.title
+				if g.sortColumn == column.id {
 					if g.sortAscending {
 						headerText += " ▲"
 					} else {
@@ -222,123 +578,73 @@ func (g *GUI) buildUI() fyne.CanvasObject {
 				label.TextStyle = fyne.TextStyle{Bold: true}
 			} else {
 				// Data
-				if id.Row-1 < len(g.results) {
-					result := g.results[id.Row-1]
-					var text string
-					switch id.Col {
-					case 0:
-						text = result.IP
-					case 1:
-						text = result.Origin
-					case 2:
-						text = result.Domain
-					case 3:
-						text = result.Issuer
-					case 4:
-						text = result.GeoCode
-					case 5:
-						if result.Feasible {
-							text = "✓"
-						} else {
-							text = "✗"
-						}
-					}
-					label.SetText(text)
+				if result, ok := g.viewResult(id.Row); ok {
+					label.SetText(column.text(result))
 					label.TextStyle = fyne.TextStyle{}
 				}
 			}
 		},
 	)
 	
-	// Add click handler for sorting and double-click copying
+	// Clicking a header sorts by its column, clicking a row selects it and
+	// shows its details, right-clicking a row opens its menu. Clicking a
+	// checkbox ticks the row, the one of the header all shown rows.
 	g.resultsTable.OnSelected = func(id widget.TableCellID) {
-		now := time.Now()
-		
-		if id.Row == 0 {
-			// Clicked on header - sort by this column
-			g.sortByColumn(id.Col)
+		if id.Col == 0 {
+			g.toggleChecked(id.Row)
+		} else if id.Row == 0 {
+			g.sortByColumn(id.Col - 1)
 		} else {
-			// Clicked on data cell - check for double-click
-			isDoubleClick := id.Row == g.lastClickCell.Row && 
-							 id.Col == g.lastClickCell.Col && 
-							 now.Sub(g.lastClickTime) < 500*time.Millisecond
-			
-			if isDoubleClick {
-				// Double-click detected - copy to clipboard
-				g.resultsMu.Lock()
-				if id.Row-1 < len(g.results) {
-					result := g.results[id.Row-1]
-					var text string
-					switch id.Col {
-					case 0:
-						text = result.IP
-					case 1:
-						text = result.Origin
-					case 2:
-						text = result.Domain
-					case 3:
-						text = result.Issuer
-					case 4:
-						text = result.GeoCode
-					case 5:
-						if result.Feasible {
-							text = "true"
-						} else {
-							text = "false"
-						}
-					}
-					g.resultsMu.Unlock()
-					
-					if text != "" {
-						g.window.Clipboard().SetContent(text)
-						// Show brief notification
-						fyne.Do(func() {
-							oldStatus, _ := g.statusText.Get()
-							g.statusText.Set(lang.X("status.copied", "Copied: {{.Text}}", map[string]any{"Text": text}))
-							time.AfterFunc(2*time.Second, func() {
-								fyne.Do(func() {
-									currentStatus, _ := g.statusText.Get()
-									copiedPrefix := lang.X("status.copied", "Copied: {{.Text}}", map[string]any{"Text": ""})
-									copiedPrefix = copiedPrefix[:len("Copied:")]
-									if strings.HasPrefix(currentStatus, copiedPrefix) {
-										g.statusText.Set(oldStatus)
-									}
-								})
-							})
-						})
-					}
-					
-					// Reset click tracking
-					g.lastClickCell = widget.TableCellID{}
-					g.lastClickTime = time.Time{}
-				} else {
-					g.resultsMu.Unlock()
-				}
-			} else {
-				// First click - remember for double-click detection
-				g.lastClickCell = id
-				g.lastClickTime = now
+			g.resultsMu.Lock()
+			result, ok := g.viewResult(id.Row)
+			g.resultsMu.Unlock()
+			if ok {
+				g.selected = &result
+				g.xrayBtn.Enable()
+				g.showDetails(result)
 			}
 		}
 		// Deselect after processing
 		g.resultsTable.UnselectAll()
 	}
 	
-	g.resultsTable.SetColumnWidth(0, 120)
-	g.resultsTable.SetColumnWidth(1, 150)
-	g.resultsTable.SetColumnWidth(2, 200)
-	g.resultsTable.SetColumnWidth(3, 200)
-	g.resultsTable.SetColumnWidth(4, 50)
-	g.resultsTable.SetColumnWidth(5, 80)
+	g.applyTableLayout()
 	
+	// The details follow the table in reading order
+	resultsSplit := container.NewHSplit(g.resultsTable, g.buildDetailPanel())
+	resultsSplit.Offset = 0.65
+	if rtlLayout.Load() {
+		resultsSplit = container.NewHSplit(resultsSplit.Trailing, resultsSplit.Leading)
+		resultsSplit.Offset = 0.35
+	}
+	g.mapTab = container.NewTabItem(lang.X("tab.map", "Map"), g.buildMapTab())
+	g.resultTabs = container.NewAppTabs(
+		container.NewTabItem(lang.X("tab.table", "Table"), resultsSplit),
+		g.mapTab,
+	)
+	g.resultTabs.OnSelected = func(tab *container.TabItem) {
+		if tab == g.mapTab {
+			g.updateMap()
+		}
+	}
 	resultsContainer := container.NewBorder(
-		widget.NewLabel(lang.X("label.results", "Results:")),
+		sideBorder(widget.NewLabel(lang.X("label.results", "Results:")), nil, g.buildFilterBar()),
 		nil, nil, nil,
-		g.resultsTable,
+		g.resultTabs,
 	)
 	
 	// Status and log
 	statusLabel := widget.NewLabelWithData(g.statusText)
+	statusLabel.Alignment = readingAlign()
+	
+	g.progressBar = widget.NewProgressBar()
+	g.progressBar.TextFormatter = g.progressText
+	g.progressBar.Hide()
+	
+	g.concurrencyLabel = widget.NewLabel("")
+	g.concurrencyLabel.Hide()
+	g.throughputLabel = widget.NewLabel("")
+	g.throughputLabel.Hide()
 	
 	logLabel := widget.NewLabelWithData(g.logText)
 	logLabel.Wrapping = fyne.TextWrapWord
@@ -346,7 +652,7 @@ func (g *GUI) buildUI() fyne.CanvasObject {
 	g.logScroll.SetMinSize(fyne.NewSize(0, 100))
 	
 	logContainer := container.NewBorder(
-		widget.NewLabel(lang.X("label.log", "Log:")),
+		sideBorder(widget.NewLabel(lang.X("label.log", "Log:")), g.buildLogBar(), nil),
 		nil, nil, nil,
 		g.logScroll,
 	)
@@ -358,6 +664,8 @@ func (g *GUI) buildUI() fyne.CanvasObject {
 		settingsBox,
 		widget.NewSeparator(),
 		controlBox,
+		g.runningBox,
+		g.timeline,
 		widget.NewSeparator(),
 	)
 	
@@ -369,7 +677,8 @@ func (g *GUI) buildUI() fyne.CanvasObject {
 	
 	mainContainer := container.NewBorder(
 		topSection,
-		container.NewVBox(widget.NewSeparator(), statusLabel),
+		container.NewVBox(widget.NewSeparator(), g.progressBar,
+			sideBorder(nil, hbox(g.throughputLabel, g.concurrencyLabel), statusLabel)),
 		nil, nil,
 		splitContainer,
 	)
@@ -381,14 +690,20 @@ func (g *GUI) getPlaceholder(source string) string {
 	ipLabel := lang.X("source.ip", "IP/CIDR/Domain")
 	fileLabel := lang.X("source.file", "File")
 	urlLabel := lang.X("source.url", "URL")
+	ctLabel := lang.X("source.ct", "CT log")
+	topListLabel := lang.X("source.toplist", "Top list")
 	
 	switch source {
 	case ipLabel:
-		return lang.X("placeholder.ip", "Enter IP, CIDR or domain")
+		return lang.X("placeholder.ip", "Enter IP, CIDR, IP range or domain")
 	case fileLabel:
 		return lang.X("placeholder.file", "Select file with address list")
 	case urlLabel:
 		return lang.X("placeholder.url", "Enter URL to parse domains from")
+	case ctLabel:
+		return lang.X("placeholder.ct", "Enter domain or %pattern% to search in CT logs")
+	case topListLabel:
+		return lang.X("placeholder.toplist", "Enter ranks of the Tranco list, e.g. 1k-100k")
 	default:
 		return ""
 	}
@@ -419,141 +734,142 @@ func sanitizeNumericInput(input string) string {
 	}, strings.TrimSpace(input))
 }
 
-func sanitizeForFilename(input string) string {
-	// Remove or replace invalid filename characters
-	replacer := strings.NewReplacer(
-		"/", "_",
-		"\\", "_",
-		":", "_",
-		"*", "_",
-		"?", "_",
-		"\"", "_",
-		"<", "_",
-		">", "_",
-		"|", "_",
-		" ", "_",
-	)
-	sanitized := replacer.Replace(input)
-	
-	// Limit length to 50 characters
-	if len(sanitized) > 50 {
-		sanitized = sanitized[:50]
-	}
-	
-	// Remove trailing dots and underscores
-	sanitized = strings.TrimRight(sanitized, "._")
-	
-	if sanitized == "" {
-		sanitized = "scan"
-	}
-	
-	return sanitized
+func (g *GUI) onStart() {
+	g.startScan(false)
 }
 
-func (g *GUI) onStart() {
+// onVerifyCache re-checks the feasible hosts of earlier scans
+func (g *GUI) onVerifyCache() {
+	g.startScan(true)
+}
+
+// onReverify re-checks the feasible hosts of a results file and shows which
+// of them are still feasible when done
+func (g *GUI) onReverify() {
 	if g.isScanning {
 		return
 	}
-	
-	// Sanitize and validate inputs
-	sanitizedInput := sanitizeInput(g.inputEntry.Text)
-	if sanitizedInput == "" {
-		dialog.ShowError(fmt.Errorf(lang.X("error.no_source", "Please specify scan source")), g.window)
+	g.openResultsFile(lang.X("dialog.reverify", "Choose the results to re-verify"), func(results []ScanResult) {
+		if len(ReverifyHosts(results)) == 0 {
+			dialog.ShowInformation(lang.X("btn.reverify", "Re-verify results"),
+				lang.X("dialog.reverify_empty", "The file has no feasible results"), g.window)
+			return
+		}
+		p, err := g.readParams(true)
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		p.Reverify = results
+		g.applyParams(p)
+		g.launch(p)
+	})
+}
+
+// startScan scans the selected source, or the dest cache if verify is set
+func (g *GUI) startScan(verify bool) {
+	if g.isScanning {
 		return
 	}
 	
-	// Update input field with sanitized value
-	if sanitizedInput != g.inputEntry.Text {
-		g.inputEntry.SetText(sanitizedInput)
+	p, err := g.readParams(verify)
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
 	}
-	
-	// Sanitize numeric inputs
-	portStr := sanitizeNumericInput(g.portEntry.Text)
-	if portStr == "" {
-		portStr = "443"
-		g.portEntry.SetText(portStr)
+	g.applyParams(p)
+	g.launch(p)
+}
+
+// launch starts a scan with p, which is kept as the running configuration
+func (g *GUI) launch(p scanParams) {
+	port := p.Config.Port
+	verify := p.Verify
+	
+	var cache *DestCache
+	if path, err := defaultDestCachePath(); err == nil {
+		cache, err = LoadDestCache(path)
+		if err != nil && verify {
+			dialog.ShowError(err, g.window)
+			return
+		}
 	}
-	
-	port, err := strconv.Atoi(portStr)
-	if err != nil || port <= 0 || port > 65535 {
-		dialog.ShowError(fmt.Errorf(lang.X("error.invalid_port", "Invalid port")), g.window)
+	if verify && p.Reverify == nil && (cache == nil || len(cache.Hosts(port)) == 0) {
+		dialog.ShowInformation(lang.X("btn.verify_cache", "Quick verify"),
+			lang.X("dialog.cache_empty", "No cached dests for this port yet, run a scan first"), g.window)
 		return
 	}
 	
-	threadStr := sanitizeNumericInput(g.threadEntry.Text)
-	if threadStr == "" {
-		threadStr = "2"
-		g.threadEntry.SetText(threadStr)
+	var store *Store
+	if p.History || p.Config.SkipScannedDays > 0 || p.Schedule != "" {
+		var err error
+		store, err = g.openHistory()
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
 	}
 	
-	threads, err := strconv.Atoi(threadStr)
-	if err != nil || threads <= 0 {
-		dialog.ShowError(fmt.Errorf(lang.X("error.invalid_threads", "Invalid thread count")), g.window)
-		return
+	// Clear previous results and log
+	g.setResults(make([]ScanResult, 0))
+	g.refreshResults()
+	g.timeline.Reset()
+	g.selected = nil
+	g.xrayBtn.Disable()
+	if p.Config.TLSDetails {
+		g.showColumns("cipher_suite", "key_exchange")
 	}
-	
-	timeoutStr := sanitizeNumericInput(g.timeoutEntry.Text)
-	if timeoutStr == "" {
-		timeoutStr = "10"
-		g.timeoutEntry.SetText(timeoutStr)
+	if p.Config.DetectHoneypots {
+		g.showColumns("honeypot")
 	}
-	
-	timeout, err := strconv.Atoi(timeoutStr)
-	if err != nil || timeout <= 0 {
-		dialog.ShowError(fmt.Errorf(lang.X("error.invalid_timeout", "Invalid timeout")), g.window)
-		return
+	if p.Config.DNSMatch {
+		g.showColumns("dns_match")
 	}
 	
-	// Clear previous results and log
-	g.resultsMu.Lock()
-	g.results = make([]ScanResult, 0)
-	g.resultsMu.Unlock()
-	g.resultsTable.Refresh()
-	g.logText.Set("") // Clear log
-	
-	// Setup config
-	config := &ScanConfig{
-		Port:       port,
-		Thread:     threads,
-		Timeout:    timeout,
-		EnableIPv6: g.ipv6Check.Checked,
-		Verbose:    g.verboseCheck.Checked,
+	// Setup config, the scan works on its own copy
+	g.running = &p
+	config := p.Config
+	exclude, _ := p.exclude()
+	if exclude != nil && exclude.NeedsASN() {
+		// AS numbers can only be matched with the ASN database
+		config.EnableASN = true
 	}
 	
 	callbacks := &ScanCallbacks{
 		OnResult: func(result ScanResult) {
-			g.resultsMu.Lock()
-			g.results = append(g.results, result)
-			count := len(g.results)
-			g.resultsMu.Unlock()
+			count := g.addResult(result)
 			
 			// Update UI through fyne.Do
 			fyne.Do(func() {
-				g.resultsTable.Refresh()
-				g.statusText.Set(lang.X("status.scanning", "Scanning... Found: {{.Count}}", map[string]any{"Count": count}))
+				g.refreshResults()
+				status := lang.X("status.scanning", "Scanning... Found: {{.Count}}", map[string]any{"Count": count})
+				g.statusText.Set(status)
+				g.updateTray(status)
+				g.notifyFeasible(result)
 			})
 		},
-		OnLog: func(level, message string) {
-			currentLog, _ := g.logText.Get()
-			timestamp := time.Now().Format("15:04:05")
-			newLog := fmt.Sprintf("[%s] %s: %s\n%s", timestamp, level, message, currentLog)
-			if len(newLog) > 10000 {
-				newLog = newLog[:10000]
-			}
+		OnLog: g.appendLog,
+		OnGeoStatus: func(status string) {
 			fyne.Do(func() {
-				g.logText.Set(newLog)
+				g.statusText.Set(status)
 			})
 		},
-		OnGeoStatus: func(status string) {
+		OnEvent: func(event ScanEvent) {
 			fyne.Do(func() {
-				g.statusText.Set(status)
+				g.timeline.Add(event)
 			})
 		},
+		OnProgress: func(current, total int) {
+			// Shown by the timeline ticker, not for every host
+			g.progressDone.Store(int64(current))
+		},
 	}
 	
 	// Create Scanner in background to avoid blocking UI during GeoIP loading
 	g.statusText.Set(lang.X("status.initializing", "Initializing..."))
 	g.startBtn.Disable()
+	g.verifyBtn.Disable()
+	g.reverifyBtn.Disable()
 	go func() {
 		// Check and update GeoIP database before creating scanner
 		if g.scanner != nil && g.scanner.Geo != nil {
@@ -565,41 +881,73 @@ func (g *GUI) onStart() {
 			}
 		}
 		
-		g.scanner = NewScanner(config, callbacks)
+		g.scanner = NewScanner(&config, callbacks)
+		g.scanner.Cache = cache
+		g.scanner.Exclude = exclude
+		if store != nil {
+			source := p.Source + ":" + p.Input
+			if p.Reverify != nil {
+				source = "reverify"
+			} else if verify {
+				source = "verify"
+			}
+			// Runs of a schedule are tagged with it to be compared
+			session, err := store.StartSession(source, port, p.Schedule)
+			if err != nil {
+				callbacks.OnLog("error", fmt.Sprintf("Failed to record session: %v", err))
+			} else {
+				g.scanner.Session = session
+			}
+		}
 		
 		// After initialization start scanning
 		// Update UI state
 		fyne.Do(func() {
 			g.isScanning = true
+			g.updateRunning()
 			g.stopBtn.Enable()
+			g.pauseBtn.Enable()
 			g.saveCSVBtn.Disable()
 			g.saveExcelBtn.Disable()
-			g.statusText.Set(lang.X("status.scanning", "Scanning... Found: {{.Count}}", map[string]any{"Count": 0}))
+			status := lang.X("status.scanning", "Scanning... Found: {{.Count}}", map[string]any{"Count": 0})
+			g.statusText.Set(status)
+			g.updateTray(status)
 		})
 		
 		// Start scanning in background
-		go g.runScan()
+		go g.runScan(p)
 	}()
 }
 
-func (g *GUI) runScan() {
+func (g *GUI) runScan(p scanParams) {
 	// Check that scanner is initialized
 	if g.scanner == nil {
 		fyne.Do(func() {
 			g.statusText.Set(lang.X("error.scanner_not_init", "Error: Scanner not initialized"))
 			g.isScanning = false
 			g.startBtn.Enable()
+			g.verifyBtn.Enable()
+			g.reverifyBtn.Enable()
 			g.stopBtn.Disable()
+			g.pauseBtn.Disable()
+			g.pauseBtn.SetText(lang.X("btn.pause", "Pause"))
 		})
 		return
 	}
 	
+	scanner := g.scanner
+	started := time.Now()
+	source := lang.X("btn.verify_cache", "Quick verify")
+	if p.Reverify != nil {
+		source = lang.X("btn.reverify", "Re-verify results")
+	} else if !p.Verify {
+		source = p.Source + ": " + p.Input
+	}
+	
 	// Log scan start
 	if g.scanner.Callbacks != nil && g.scanner.Callbacks.OnLog != nil {
-		source := g.sourceRadio.Selected
-		input := sanitizeInput(g.inputEntry.Text)
 		g.scanner.Callbacks.OnLog("info", lang.X("status.scan_start", "Starting scan: {{.Source}} - {{.Input}}", 
-			map[string]any{"Source": source, "Input": input}))
+			map[string]any{"Source": p.Source, "Input": p.Input}))
 	}
 	
 	defer func() {
@@ -612,26 +960,93 @@ func (g *GUI) runScan() {
 			g.scanner.Callbacks.OnLog("info", lang.X("status.scan_complete_log", "Scan completed. Found: {{.Count}} results", 
 				map[string]any{"Count": count}))
 		}
+		// A complete run of a schedule is compared with the last one
+		if p.Schedule != "" && scanner.Session != nil && scanner.Context().Err() == nil {
+			g.notifyScheduleChanges(p.Schedule, scanner.Session)
+		}
 		
 		fyne.Do(func() {
 			g.isScanning = false
 			g.startBtn.Enable()
+			g.verifyBtn.Enable()
+			g.reverifyBtn.Enable()
 			g.stopBtn.Disable()
+			g.pauseBtn.Disable()
+			g.pauseBtn.SetText(lang.X("btn.pause", "Pause"))
+			g.updateProgress()
+			g.updateConcurrency()
+			g.updateThroughput()
 			if count > 0 {
 				g.saveCSVBtn.Enable()
 				g.saveExcelBtn.Enable()
 			}
-			g.statusText.Set(lang.X("status.completed", "Scanning completed. Found: {{.Count}}", map[string]any{"Count": count}))
+			status := lang.X("status.completed", "Scanning completed. Found: {{.Count}}", map[string]any{"Count": count})
+			g.statusText.Set(status)
+			g.updateTray(status)
+			g.notifyCompleted(status)
+			g.updateRunning()
+			g.showReport(scanner.Stats.Report(source, started))
+			if p.Reverify != nil {
+				g.resultsMu.Lock()
+				diff := DiffResults(p.Reverify, g.results)
+				g.resultsMu.Unlock()
+				g.showDiff(diff)
+			}
+			if next := g.queued; next != nil {
+				g.queued = nil
+				g.launch(*next)
+			}
 		})
 	}()
 	
+	// Keep the running phase of the timeline growing
+	timelineDone := make(chan struct{})
+	defer close(timelineDone)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				fyne.Do(func() {
+					g.timeline.Refresh()
+					g.updateProgress()
+					g.updateConcurrency()
+					g.updateThroughput()
+				})
+			case <-timelineDone:
+				return
+			}
+		}
+	}()
+	
+	if p.Reverify != nil {
+		hosts := ReverifyHosts(p.Reverify)
+		g.startProgress(len(hosts))
+		g.scanner.Run(hostsChan(hosts))
+		return
+	}
+	if p.Verify {
+		start := time.Now()
+		g.startProgress(len(g.scanner.Cache.Hosts(g.scanner.Config.Port)))
+		g.scanner.Run(hostsChan(g.scanner.Cache.Hosts(g.scanner.Config.Port)))
+		// Dests a stopped run did not get to are kept
+		if g.scanner.Context().Err() == nil {
+			g.scanner.Cache.Expire(g.scanner.Config.Port, start)
+		}
+		if err := g.scanner.Cache.Save(); err != nil && g.scanner.Callbacks.OnLog != nil {
+			g.scanner.Callbacks.OnLog("error", fmt.Sprintf("Failed to save dest cache: %v", err))
+		}
+		return
+	}
+	
 	var hostChan <-chan Host
-	source := g.sourceRadio.Selected
-	input := sanitizeInput(g.inputEntry.Text)
+	input := p.Input
 	
-	switch source {
+	switch p.Source {
 	case lang.X("source.ip", "IP/CIDR/Domain"):
-		hostChan = IterateAddr(input, g.scanner.Config.EnableIPv6)
+		g.startProgress(CountAddrHosts(input, g.scanner.Config.EnableIPv6))
+		hostChan = IterateAddr(g.scanner.Context(), g.scanner.resolver, input, g.scanner.Config.EnableIPv6, g.scanner.Config.Shuffle)
 	case lang.X("source.file", "File"):
 		f, err := os.Open(input)
 		if err != nil {
@@ -641,33 +1056,151 @@ func (g *GUI) runScan() {
 			return
 		}
 		defer f.Close()
-		hostChan = Iterate(f, g.scanner.Config.EnableIPv6)
+		total, err := CountHosts(f, g.scanner.Config.EnableIPv6)
+		if err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			if g.scanner.Callbacks != nil && g.scanner.Callbacks.OnLog != nil {
+				g.scanner.Callbacks.OnLog("error", fmt.Sprintf("Failed to read file: %v", err))
+			}
+			return
+		}
+		g.startProgress(total)
+		hostChan = Iterate(f, g.scanner.Config.EnableIPv6, g.scanner.Config.Shuffle)
 	case lang.X("source.url", "URL"):
-		// TODO: implement URL parsing
+		g.scanner.SetPhase(PhaseResolving)
+		domains, err := FetchURLDomains(g.scanner.Context(), input)
+		if err != nil {
+			if g.scanner.Callbacks != nil && g.scanner.Callbacks.OnLog != nil {
+				g.scanner.Callbacks.OnLog("error", fmt.Sprintf("Failed to fetch URL: %v", err))
+			}
+			return
+		}
 		if g.scanner.Callbacks != nil && g.scanner.Callbacks.OnLog != nil {
-			g.scanner.Callbacks.OnLog("info", "URL parsing not yet implemented in GUI")
+			g.scanner.Callbacks.OnLog("info", fmt.Sprintf("Found %d domains on the page", len(domains)))
 		}
-		return
-	}
-	
-	var wg sync.WaitGroup
-	wg.Add(g.scanner.Config.Thread)
-	
-	for i := 0; i < g.scanner.Config.Thread; i++ {
-		go func() {
-			defer wg.Done()
-			for host := range hostChan {
-				select {
-				case <-g.scanner.Context().Done():
-					return
-				default:
-					ScanTLSWithCallbacks(host, g.scanner)
-				}
+		g.startProgress(len(domains))
+		hostChan = Iterate(strings.NewReader(strings.Join(domains, "\n")), g.scanner.Config.EnableIPv6, g.scanner.Config.Shuffle)
+	case lang.X("source.ct", "CT log"):
+		g.scanner.SetPhase(PhaseResolving)
+		domains, err := FetchCTDomains(g.scanner.Context(), input)
+		if err != nil {
+			if g.scanner.Callbacks != nil && g.scanner.Callbacks.OnLog != nil {
+				g.scanner.Callbacks.OnLog("error", fmt.Sprintf("Failed to search CT logs: %v", err))
 			}
-		}()
+			return
+		}
+		if g.scanner.Callbacks != nil && g.scanner.Callbacks.OnLog != nil {
+			g.scanner.Callbacks.OnLog("info", fmt.Sprintf("Found %d domains in CT logs", len(domains)))
+		}
+		g.startProgress(len(domains))
+		hostChan = Iterate(strings.NewReader(strings.Join(domains, "\n")), g.scanner.Config.EnableIPv6, g.scanner.Config.Shuffle)
+	case lang.X("source.toplist", "Top list"):
+		g.scanner.SetPhase(PhaseResolving)
+		// The window was checked by readParams
+		ranks, _ := ParseRankWindow(input)
+		domains, err := FetchTopList(g.scanner.Context(), "", ranks)
+		if err != nil {
+			if g.scanner.Callbacks != nil && g.scanner.Callbacks.OnLog != nil {
+				g.scanner.Callbacks.OnLog("error", fmt.Sprintf("Failed to fetch the top list: %v", err))
+			}
+			return
+		}
+		if g.scanner.Callbacks != nil && g.scanner.Callbacks.OnLog != nil {
+			g.scanner.Callbacks.OnLog("info", fmt.Sprintf("Found %d domains in the top list", len(domains)))
+		}
+		g.startProgress(len(domains))
+		hostChan = IterateRanked(domains, 0)
 	}
 	
-	wg.Wait()
+	g.scanner.Run(hostChan)
+}
+
+// startProgress shows the progress bar for a scan of total hosts, or
+// hides it if the total is unknown. Called before the scan is run.
+func (g *GUI) startProgress(total int) {
+	g.scanner.Total = total
+	g.progressDone.Store(0)
+	fyne.Do(func() {
+		g.progressTotal = total
+		if total <= 0 {
+			g.progressBar.Hide()
+			return
+		}
+		g.progressBar.SetValue(0)
+		g.progressBar.Show()
+	})
+}
+
+// updateProgress moves the progress bar to the hosts done so far
+func (g *GUI) updateProgress() {
+	if g.progressTotal <= 0 {
+		return
+	}
+	g.progressBar.SetValue(float64(g.progressDone.Load()) / float64(g.progressTotal))
+}
+
+// updateConcurrency shows how many threads an adaptive scan currently runs
+func (g *GUI) updateConcurrency() {
+	if g.scanner == nil || !g.isScanning || !g.scanner.Config.Adaptive {
+		g.concurrencyLabel.Hide()
+		return
+	}
+	g.concurrencyLabel.SetText(lang.X("status.concurrency", "Threads: {{.Current}} of {{.Max}}",
+		map[string]any{"Current": g.scanner.Stats.Concurrency.Load(), "Max": g.scanner.Config.Thread}))
+	g.concurrencyLabel.Show()
+}
+
+// updateThroughput shows the hosts per second, elapsed time and success
+// ratio of the running scan, as collected by the scanner
+func (g *GUI) updateThroughput() {
+	if g.scanner == nil || !g.isScanning {
+		g.throughputLabel.Hide()
+		return
+	}
+	p := g.scanner.Progress()
+	g.throughputLabel.SetText(lang.X("status.throughput", "{{.Rate}} hosts/s · {{.Elapsed}} · {{.Success}}% answered",
+		map[string]any{
+			"Rate":    fmt.Sprintf("%.1f", p.Rate),
+			"Elapsed": p.Elapsed.Round(time.Second).String(),
+			"Success": fmt.Sprintf("%.1f", p.SuccessRatio()*100),
+		}))
+	g.throughputLabel.Show()
+}
+
+// progressText labels the progress bar with the host count and the time
+// left at the rate of the scan so far
+func (g *GUI) progressText() string {
+	done := g.progressDone.Load()
+	text := lang.X("progress.hosts", "{{.Done}} / {{.Total}} hosts", map[string]any{"Done": done, "Total": g.progressTotal})
+	if g.scanner == nil {
+		return text
+	}
+	left := g.scanner.Progress().Left()
+	if left <= 0 {
+		return text
+	}
+	return text + " · " + lang.X("progress.eta", "{{.Left}} left", map[string]any{"Left": left.Round(time.Second).String()})
+}
+
+// onPause suspends the running scan or resumes the paused one
+func (g *GUI) onPause() {
+	if g.scanner == nil || !g.isScanning {
+		return
+	}
+	if g.scanner.Paused() {
+		g.scanner.Resume()
+		g.pauseBtn.SetText(lang.X("btn.pause", "Pause"))
+		g.resultsMu.Lock()
+		count := len(g.results)
+		g.resultsMu.Unlock()
+		g.statusText.Set(lang.X("status.scanning", "Scanning... Found: {{.Count}}", map[string]any{"Count": count}))
+		return
+	}
+	g.scanner.Pause()
+	g.pauseBtn.SetText(lang.X("btn.resume", "Resume"))
+	g.statusText.Set(lang.X("status.paused", "Paused, hosts in progress are finishing"))
 }
 
 func (g *GUI) onStop() {
@@ -677,6 +1210,20 @@ func (g *GUI) onStop() {
 	}
 }
 
+// defaultFilename expands the filename template for the current scan
+func (g *GUI) defaultFilename(ext string) string {
+	tmpl := strings.TrimSpace(g.filenameEntry.Text)
+	if tmpl == "" {
+		tmpl = defaultFilenameTemplate
+	}
+	port, _ := strconv.Atoi(sanitizeNumericInput(g.portEntry.Text))
+	isFile := g.sourceRadio.Selected == lang.X("source.file", "File")
+	return ExpandFilename(tmpl+ext, FilenameVars{
+		Source: sourceLabel(sanitizeInput(g.inputEntry.Text), isFile),
+		Port:   port,
+	})
+}
+
 func (g *GUI) onSaveCSV() {
 	g.resultsMu.Lock()
 	resultsCount := len(g.results)
@@ -688,10 +1235,13 @@ func (g *GUI) onSaveCSV() {
 		return
 	}
 	
+	if g.appendCheck.Checked {
+		g.onAppendResults(FormatCSV, ".csv")
+		return
+	}
+	
 	// Generate default filename based on scan target
-	timestamp := time.Now().Format("20060102_150405")
-	target := sanitizeForFilename(g.inputEntry.Text)
-	defaultFilename := fmt.Sprintf("%s_%s.csv", target, timestamp)
+	defaultFilename := g.defaultFilename(".csv")
 	
 	// Create file save dialog
 	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
@@ -707,16 +1257,16 @@ func (g *GUI) onSaveCSV() {
 		g.resultsMu.Lock()
 		defer g.resultsMu.Unlock()
 		
-		// Write CSV header
-		_, _ = writer.Write([]byte("IP,ORIGIN,CERT_DOMAIN,CERT_ISSUER,GEO_CODE\n"))
+		// Write CSV header, results may have been loaded from history
+		results := g.exportResults()
+		config := resultsConfig(results)
+		_, _ = writer.Write([]byte(csvHeader(config)))
 		
 		// Write results
 		savedCount := 0
-		for _, result := range g.results {
+		for _, result := range results {
 			if result.Feasible {
-				line := fmt.Sprintf("%s,%s,%s,\"%s\",%s\n",
-					result.IP, result.Origin, result.Domain, result.Issuer, result.GeoCode)
-				_, _ = writer.Write([]byte(line))
+				_, _ = writer.Write([]byte(csvLine(result, config)))
 				savedCount++
 			}
 		}
@@ -743,10 +1293,13 @@ func (g *GUI) onSaveExcel() {
 		return
 	}
 	
+	if g.appendCheck.Checked {
+		g.onAppendResults(FormatXLSX, ".xlsx")
+		return
+	}
+	
 	// Generate default filename based on scan target
-	timestamp := time.Now().Format("20060102_150405")
-	target := sanitizeForFilename(g.inputEntry.Text)
-	defaultFilename := fmt.Sprintf("%s_%s.xlsx", target, timestamp)
+	defaultFilename := g.defaultFilename(".xlsx")
 	
 	// Create file save dialog
 	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
@@ -760,12 +1313,12 @@ func (g *GUI) onSaveExcel() {
 		defer writer.Close()
 		
 		if err := g.saveToExcel(writer); err != nil {
-			dialog.ShowError(fmt.Errorf(lang.X("dialog.failed_save_excel", "Failed to save Excel: {{.Error}}", 
+			dialog.ShowError(errors.New(lang.X("dialog.failed_save_excel", "Failed to save Excel: {{.Error}}", 
 				map[string]any{"Error": err.Error()})), g.window)
 		} else {
 			g.resultsMu.Lock()
 			savedCount := 0
-			for _, result := range g.results {
+			for _, result := range g.exportResults() {
 				if result.Feasible {
 					savedCount++
 				}
@@ -784,43 +1337,148 @@ func (g *GUI) onSaveExcel() {
 	fileDialog.Show()
 }
 
+// onAppendResults merges the feasible results into an existing file in
+// format, skipping the IPs and ports the file already has
+func (g *GUI) onAppendResults(format, ext string) {
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		uri := reader.URI()
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		
+		// CSV files carry no port, their rows are taken to be on the scanned one
+		var existing []ScanResult
+		if len(strings.TrimSpace(string(data))) > 0 {
+			port, _ := strconv.Atoi(sanitizeNumericInput(g.portEntry.Text))
+			if existing, err = readResults(data, format, port); err != nil {
+				dialog.ShowError(errors.New(lang.X("dialog.failed_read_append", "Cannot read {{.Name}}: {{.Error}}",
+					map[string]any{"Name": uri.Name(), "Error": err.Error()})), g.window)
+				return
+			}
+		}
+		g.resultsMu.Lock()
+		results := g.exportResults()
+		merged, added := mergeResults(existing, results)
+		feasible := 0
+		for _, result := range results {
+			if result.Feasible {
+				feasible++
+			}
+		}
+		g.resultsMu.Unlock()
+		
+		writer, err := storage.Writer(uri)
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		defer writer.Close()
+		if format == FormatXLSX {
+			err = writeExcel(writer, merged)
+		} else {
+			config := resultsConfig(merged)
+			_, err = writer.Write([]byte(csvHeader(config)))
+			for _, result := range merged {
+				if err == nil {
+					_, err = writer.Write([]byte(csvLine(result, config)))
+				}
+			}
+		}
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		
+		dialog.ShowInformation(lang.X("dialog.saved", "Saved"),
+			lang.X("dialog.appended_msg", "Added {{.Count}} feasible results, skipped {{.Skipped}} already in the file",
+				map[string]any{"Count": added, "Skipped": feasible - added}), g.window)
+	}, g.window)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{ext}))
+	fileDialog.Show()
+}
+
+// onXrayConfig shows an Xray Reality config for the selected result
+func (g *GUI) onXrayConfig() {
+	if g.selected == nil {
+		return
+	}
+	result := *g.selected
+	keys, err := NewXrayKeys()
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+	data, err := XrayConfig(result, keys)
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+	
+	configEntry := widget.NewMultiLineEntry()
+	configEntry.SetText(string(data))
+	configEntry.SetMinRowsVisible(20)
+	
+	copyBtn := widget.NewButton(lang.X("btn.copy", "Copy"), func() {
+		g.window.Clipboard().SetContent(configEntry.Text)
+	})
+	saveBtn := widget.NewButton(lang.X("btn.save", "Save"), func() {
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, g.window)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+			_, _ = writer.Write([]byte(configEntry.Text))
+		}, g.window)
+		fileDialog.SetFileName(sanitizeForFilename(result.Domain) + "_xray.json")
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".json"}))
+		fileDialog.Show()
+	})
+	
+	content := container.NewBorder(
+		widget.NewLabel(lang.X("dialog.xray_hint", "Public key for clients: {{.Key}}", map[string]any{"Key": keys.PublicKey})),
+		container.NewHBox(layout.NewSpacer(), copyBtn, saveBtn),
+		nil, nil,
+		configEntry,
+	)
+	d := dialog.NewCustom(lang.X("dialog.xray_title", "Xray Reality config: {{.Dest}}", map[string]any{"Dest": xrayDest(result)}),
+		lang.X("btn.close", "Close"), content, g.window)
+	d.Resize(fyne.NewSize(700, 560))
+	d.Show()
+}
+
+// sortByColumn sorts the results by a column of the table, the other way
+// round when they are already sorted by it
 func (g *GUI) sortByColumn(col int) {
+	if col >= len(g.columns) {
+		return
+	}
 	g.resultsMu.Lock()
 	defer g.resultsMu.Unlock()
 	
 	// Toggle sort direction if same column, otherwise ascending
-	if g.sortColumn == col {
+	if id := g.columns[col].id; g.sortColumn == id {
 		g.sortAscending = !g.sortAscending
 	} else {
-		g.sortColumn = col
+		g.sortColumn = id
 		g.sortAscending = true
 	}
-	
-	// Sort results based on column
-	sort.Slice(g.results, func(i, j int) bool {
-		var less bool
-		switch col {
-		case 0: // IP
-			less = g.results[i].IP < g.results[j].IP
-		case 1: // Origin
-			less = g.results[i].Origin < g.results[j].Origin
-		case 2: // Domain
-			less = g.results[i].Domain < g.results[j].Domain
-		case 3: // Issuer
-			less = g.results[i].Issuer < g.results[j].Issuer
-		case 4: // Geo
-			less = g.results[i].GeoCode < g.results[j].GeoCode
-		case 5: // Feasible
-			less = !g.results[i].Feasible && g.results[j].Feasible
-		default:
-			less = false
-		}
-		
-		if !g.sortAscending {
-			less = !less
-		}
-		return less
-	})
+	g.sortResults()
+	g.rebuildView()
+	g.saveTableLayout()
 	
 	// Refresh table
 	fyne.Do(func() {
@@ -831,84 +1489,5 @@ func (g *GUI) sortByColumn(col int) {
 func (g *GUI) saveToExcel(writer fyne.URIWriteCloser) error {
 	g.resultsMu.Lock()
 	defer g.resultsMu.Unlock()
-	
-	// Create new Excel file
-	f := excelize.NewFile()
-	defer f.Close()
-	
-	sheetName := "Scan Results"
-	index, err := f.NewSheet(sheetName)
-	if err != nil {
-		return err
-	}
-	f.SetActiveSheet(index)
-	
-	// Create header style
-	headerStyle, err := f.NewStyle(&excelize.Style{
-		Font: &excelize.Font{
-			Bold: true,
-			Size: 12,
-		},
-		Fill: excelize.Fill{
-			Type:    "pattern",
-			Pattern: 1,
-			Color:   []string{"#E0E0E0"},
-		},
-		Alignment: &excelize.Alignment{
-			Horizontal: "center",
-			Vertical:   "center",
-		},
-	})
-	if err != nil {
-		return err
-	}
-	
-	// Write headers
-	headers := []string{"IP", "Origin", "Domain", "Issuer", "Geo", "TLS Version", "ALPN", "Feasible"}
-	for col, header := range headers {
-		cell, _ := excelize.CoordinatesToCellName(col+1, 1)
-		f.SetCellValue(sheetName, cell, header)
-		f.SetCellStyle(sheetName, cell, cell, headerStyle)
-	}
-	
-	// Set column widths
-	f.SetColWidth(sheetName, "A", "A", 15) // IP
-	f.SetColWidth(sheetName, "B", "B", 20) // Origin
-	f.SetColWidth(sheetName, "C", "C", 30) // Domain
-	f.SetColWidth(sheetName, "D", "D", 40) // Issuer
-	f.SetColWidth(sheetName, "E", "E", 8)  // Geo
-	f.SetColWidth(sheetName, "F", "F", 12) // TLS Version
-	f.SetColWidth(sheetName, "G", "G", 10) // ALPN
-	f.SetColWidth(sheetName, "H", "H", 10) // Feasible
-	
-	// Write data (only feasible results)
-	row := 2
-	for _, result := range g.results {
-		if result.Feasible {
-			f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), result.IP)
-			f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), result.Origin)
-			f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), result.Domain)
-			f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), result.Issuer)
-			f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), result.GeoCode)
-			f.SetCellValue(sheetName, fmt.Sprintf("F%d", row), result.TLSVersion)
-			f.SetCellValue(sheetName, fmt.Sprintf("G%d", row), result.ALPN)
-			f.SetCellValue(sheetName, fmt.Sprintf("H%d", row), "Yes")
-			row++
-		}
-	}
-	
-	// Enable auto-filter
-	if row > 2 {
-		lastCell, _ := excelize.CoordinatesToCellName(len(headers), row-1)
-		f.AutoFilter(sheetName, fmt.Sprintf("A1:%s", lastCell), []excelize.AutoFilterOptions{})
-	}
-	
-	// Write to the provided writer
-	buf, err := f.WriteToBuffer()
-	if err != nil {
-		return err
-	}
-	
-	_, err = writer.Write(buf.Bytes())
-	return err
+	return writeExcel(writer, g.exportResults())
 }
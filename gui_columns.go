@@ -0,0 +1,295 @@
+//go:build !nogui
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Preference keys of the table layout. The columns are saved as the shown
+// ones in order with their widths, e.g. "ip:120,domain:200".
+const (
+	tableColumnsPref = "table_columns"
+	tableSortPref    = "table_sort"
+	tableSortAscPref = "table_sort_ascending"
+)
+
+// resultColumn is a column the results table can show
+type resultColumn struct {
+	id    string
+	title string
+	width float32
+	text  func(ScanResult) string
+	// less orders the results by the column, by text when nil
+	less func(a, b ScanResult) bool
+}
+
+// tableColumn is a shown column and its width
+type tableColumn struct {
+	id    string
+	width float32
+}
+
+// defaultColumns are the columns shown until the user picks others
+var defaultColumns = []string{"ip", "origin", "domain", "issuer", "geo", "feasible", "connect_ms", "handshake_ms", "score"}
+
+// resultColumns returns every column of the results table
+func resultColumns() []resultColumn {
+	return []resultColumn{
+		{id: "ip", title: lang.X("table.ip", "IP"), width: 120,
+			text: func(r ScanResult) string { return r.IP }},
+		{id: "origin", title: lang.X("table.origin", "Origin"), width: 150,
+			text: func(r ScanResult) string { return r.Origin }},
+		{id: "domain", title: lang.X("table.domain", "Domain"), width: 200,
+			text: func(r ScanResult) string { return r.Domain }},
+		{id: "issuer", title: lang.X("table.issuer", "Issuer"), width: 200,
+			text: func(r ScanResult) string { return r.Issuer }},
+		{id: "geo", title: lang.X("table.geo", "Geo"), width: 50,
+			text: func(r ScanResult) string { return r.GeoCode }},
+		{id: "feasible", title: lang.X("table.feasible", "Feasible"), width: 80,
+			text: func(r ScanResult) string {
+				if r.Feasible {
+					return "✓"
+				}
+				return "✗"
+			},
+			less: func(a, b ScanResult) bool { return !a.Feasible && b.Feasible }},
+		{id: "connect_ms", title: lang.X("table.connect_ms", "Connect ms"), width: 100,
+			text: func(r ScanResult) string { return strconv.Itoa(r.ConnectMs) },
+			less: func(a, b ScanResult) bool { return a.ConnectMs < b.ConnectMs }},
+		{id: "handshake_ms", title: lang.X("table.handshake_ms", "Handshake ms"), width: 110,
+			text: func(r ScanResult) string { return strconv.Itoa(r.HandshakeMs) },
+			less: func(a, b ScanResult) bool { return a.HandshakeMs < b.HandshakeMs }},
+		{id: "latency", title: lang.X("table.latency", "Latency ms"), width: 100,
+			text: func(r ScanResult) string { return strconv.Itoa(r.ConnectMs + r.HandshakeMs) },
+			less: func(a, b ScanResult) bool { return a.ConnectMs+a.HandshakeMs < b.ConnectMs+b.HandshakeMs }},
+		{id: "score", title: lang.X("table.score", "Score"), width: 70,
+			text: func(r ScanResult) string { return strconv.FormatFloat(r.Score, 'f', -1, 64) },
+			less: func(a, b ScanResult) bool { return a.Score < b.Score }},
+		{id: "tls_version", title: lang.X("table.tls_version", "TLS version"), width: 90,
+			text: func(r ScanResult) string { return r.TLSVersion }},
+		{id: "alpn", title: "ALPN", width: 70,
+			text: func(r ScanResult) string { return r.ALPN }},
+		{id: "asn", title: "ASN", width: 80,
+			text: func(r ScanResult) string {
+				if r.ASN == 0 {
+					return ""
+				}
+				return fmt.Sprintf("AS%d", r.ASN)
+			},
+			less: func(a, b ScanResult) bool { return a.ASN < b.ASN }},
+		{id: "as_org", title: lang.X("table.as_org", "AS org"), width: 180,
+			text: func(r ScanResult) string { return r.ASOrg }},
+		{id: "sans", title: lang.X("table.sans", "SANs"), width: 250,
+			text: func(r ScanResult) string { return strings.Join(r.SANs, " ") }},
+		{id: "cipher_suite", title: lang.X("table.cipher_suite", "Cipher suite"), width: 220,
+			text: func(r ScanResult) string { return r.CipherSuite }},
+		{id: "key_exchange", title: lang.X("table.key_exchange", "Key exchange"), width: 110,
+			text: func(r ScanResult) string { return r.KeyExchange }},
+		{id: "honeypot", title: lang.X("table.honeypot", "Honeypot"), width: 80,
+			text: func(r ScanResult) string {
+				if r.Honeypot {
+					return "✓"
+				}
+				return ""
+			}},
+		{id: "dns_match", title: lang.X("table.dns_match", "DNS match"), width: 90,
+			text: func(r ScanResult) string { return r.DNSMatch }},
+	}
+}
+
+// columnDef returns the definition of the column with id
+func (g *GUI) columnDef(id string) (resultColumn, bool) {
+	i := slices.IndexFunc(g.allColumns, func(c resultColumn) bool { return c.id == id })
+	if i < 0 {
+		return resultColumn{}, false
+	}
+	return g.allColumns[i], true
+}
+
+// loadTableLayout reads the shown columns and the sort order from the
+// preferences
+func (g *GUI) loadTableLayout() {
+	g.allColumns = resultColumns()
+	prefs := g.app.Preferences()
+	g.columns = nil
+	for _, item := range strings.Split(prefs.String(tableColumnsPref), ",") {
+		id, width, _ := strings.Cut(item, ":")
+		def, ok := g.columnDef(id)
+		if !ok || slices.ContainsFunc(g.columns, func(c tableColumn) bool { return c.id == id }) {
+			continue
+		}
+		column := tableColumn{id: id, width: def.width}
+		if w, err := strconv.ParseFloat(width, 32); err == nil && w > 0 {
+			column.width = float32(w)
+		}
+		g.columns = append(g.columns, column)
+	}
+	if len(g.columns) == 0 {
+		for _, id := range defaultColumns {
+			def, _ := g.columnDef(id)
+			g.columns = append(g.columns, tableColumn{id: id, width: def.width})
+		}
+	}
+	g.sortColumn = prefs.String(tableSortPref)
+	g.sortAscending = prefs.BoolWithFallback(tableSortAscPref, true)
+}
+
+// saveTableLayout saves the shown columns and the sort order
+func (g *GUI) saveTableLayout() {
+	items := make([]string, len(g.columns))
+	for i, column := range g.columns {
+		items[i] = column.id + ":" + strconv.FormatFloat(float64(column.width), 'f', -1, 32)
+	}
+	prefs := g.app.Preferences()
+	prefs.SetString(tableColumnsPref, strings.Join(items, ","))
+	prefs.SetString(tableSortPref, g.sortColumn)
+	prefs.SetBool(tableSortAscPref, g.sortAscending)
+}
+
+// applyTableLayout sizes the columns of the results table, after the
+// checkbox column
+func (g *GUI) applyTableLayout() {
+	g.resultsTable.SetColumnWidth(0, checkboxColumnWidth)
+	for i, column := range g.columns {
+		g.resultsTable.SetColumnWidth(i+1, column.width)
+	}
+	g.resultsTable.Refresh()
+}
+
+// showColumns adds the columns with ids that are hidden at the end of the
+// table, for values a scan fills that are otherwise empty
+func (g *GUI) showColumns(ids ...string) {
+	changed := false
+	for _, id := range ids {
+		def, ok := g.columnDef(id)
+		if ok && !slices.ContainsFunc(g.columns, func(c tableColumn) bool { return c.id == id }) {
+			g.columns = append(g.columns, tableColumn{id: id, width: def.width})
+			changed = true
+		}
+	}
+	if changed {
+		g.saveTableLayout()
+		g.applyTableLayout()
+	}
+}
+
+// showColumnChooser lets the user pick, order and size the columns of the
+// results table
+func (g *GUI) showColumnChooser() {
+	// Shown columns first in their order, then the hidden ones
+	type choice struct {
+		def   resultColumn
+		shown bool
+		width string
+	}
+	var choices []choice
+	for _, column := range g.columns {
+		def, _ := g.columnDef(column.id)
+		choices = append(choices, choice{def, true, strconv.FormatFloat(float64(column.width), 'f', -1, 32)})
+	}
+	for _, def := range g.allColumns {
+		if !slices.ContainsFunc(g.columns, func(c tableColumn) bool { return c.id == def.id }) {
+			choices = append(choices, choice{def, false, strconv.FormatFloat(float64(def.width), 'f', -1, 32)})
+		}
+	}
+
+	rows := container.NewVBox()
+	var rebuild func()
+	rebuild = func() {
+		rows.Objects = nil
+		for i := range choices {
+			c := &choices[i]
+			check := widget.NewCheck(c.def.title, func(on bool) { c.shown = on })
+			check.Checked = c.shown
+			widthEntry := widget.NewEntry()
+			widthEntry.SetText(c.width)
+			widthEntry.OnChanged = func(text string) { c.width = text }
+			up := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+				choices[i-1], choices[i] = choices[i], choices[i-1]
+				rebuild()
+			})
+			if i == 0 {
+				up.Disable()
+			}
+			down := widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() {
+				choices[i], choices[i+1] = choices[i+1], choices[i]
+				rebuild()
+			})
+			if i == len(choices)-1 {
+				down.Disable()
+			}
+			rows.Add(container.NewBorder(nil, nil, nil,
+				container.NewHBox(container.NewGridWrap(fyne.NewSize(70, widthEntry.MinSize().Height), widthEntry), up, down),
+				check))
+		}
+		rows.Refresh()
+	}
+	rebuild()
+
+	header := container.NewBorder(nil, nil, nil, widget.NewLabel(lang.X("columns.width", "Width")),
+		widget.NewLabel(lang.X("columns.column", "Column")))
+	content := container.NewBorder(header, nil, nil, nil, container.NewVScroll(rows))
+	d := dialog.NewCustomConfirm(lang.X("dialog.columns", "Table columns"), lang.X("btn.apply", "Apply"),
+		lang.X("btn.cancel", "Cancel"), content, func(ok bool) {
+			if !ok {
+				return
+			}
+			var columns []tableColumn
+			for _, c := range choices {
+				if !c.shown {
+					continue
+				}
+				width := c.def.width
+				if w, err := strconv.ParseFloat(strings.TrimSpace(c.width), 32); err == nil && w > 0 {
+					width = float32(w)
+				}
+				columns = append(columns, tableColumn{id: c.def.id, width: width})
+			}
+			if len(columns) == 0 {
+				dialog.ShowError(errors.New(lang.X("error.no_columns", "Show at least one column")), g.window)
+				return
+			}
+			g.columns = columns
+			g.saveTableLayout()
+			g.applyTableLayout()
+		}, g.window)
+	d.Resize(fyne.NewSize(420, 520))
+	d.Show()
+}
+
+// sortResults orders the results by the sort column, resultsMu must be
+// held and the view rebuilt after
+func (g *GUI) sortResults() {
+	def, ok := g.columnDef(g.sortColumn)
+	if !ok {
+		return
+	}
+	less := def.less
+	if less == nil {
+		less = func(a, b ScanResult) bool { return def.text(a) < def.text(b) }
+	}
+	slices.SortStableFunc(g.results, func(a, b ScanResult) int {
+		if !g.sortAscending {
+			a, b = b, a
+		}
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		}
+		return 0
+	})
+}
@@ -0,0 +1,124 @@
+//go:build !nogui
+
+package main
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/storage"
+)
+
+// onExportConfig saves the current settings as a config file for -config
+func (g *GUI) onExportConfig() {
+	p, err := g.readParams(false)
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+	options := configOptions(p, strings.TrimSpace(g.filenameEntry.Text))
+	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		if err := writeConfigFile(writer, configFormat(writer.URI().Name()), options); err != nil {
+			dialog.ShowError(err, g.window)
+		}
+	}, g.window)
+	fileDialog.SetFileName("scan.yaml")
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".yaml", ".yml", ".toml"}))
+	fileDialog.Show()
+}
+
+// configOptions returns the command line options of a scan with the
+// parameters of p, writing CSV results to files named after filename,
+// leaving out those at their default
+func configOptions(p scanParams, filename string) map[string]any {
+	c := p.Config
+	options := map[string]any{
+		"port":    c.Port,
+		"thread":  c.Thread,
+		"timeout": c.Timeout,
+	}
+	switch p.Source {
+	case lang.X("source.file", "File"):
+		options["in"] = p.Input
+	case lang.X("source.url", "URL"):
+		options["url"] = p.Input
+	case lang.X("source.ct", "CT log"):
+		options["ct"] = p.Input
+	case lang.X("source.toplist", "Top list"):
+		options["tranco"] = p.Input
+	default:
+		options["addr"] = p.Input
+	}
+	if filename == "" {
+		filename = defaultFilenameTemplate
+	}
+	options["out"] = filename + ".csv"
+	set := func(name string, value any, on bool) {
+		if on {
+			options[name] = value
+		}
+	}
+	set("retries", c.Retries, c.Retries > 0)
+	set("idle", c.IdleTest, c.IdleTest > 0)
+	set("expand", c.ExpandPrefix, c.ExpandPrefix > 0)
+	set("rate", c.RateLimit, c.RateLimit > 0)
+	set("speedtest", c.SpeedTestKB, c.SpeedTestKB > 0)
+	set("timing", c.Timing, c.Timing != "")
+	set("sni", c.ServerName, c.ServerName != "")
+	set("sni-matrix", c.SNIMatrix, len(c.SNIMatrix) > 0)
+	set("subdomains", c.Subdomains, len(c.Subdomains) > 0)
+	set("subdomain-ct", true, c.SubdomainCT)
+	set("countries", c.AllowCountries, len(c.AllowCountries) > 0)
+	set("dns", c.DNSServers, len(c.DNSServers) > 0)
+	set("geo-db", c.GeoDB, c.GeoDB != "")
+	set("exclude", excludeEntryText(p.Exclude), p.Exclude != "")
+	set("precheck", c.PreCheckThreads, c.PreCheckThreads > 0)
+	if p.History || c.SkipScannedDays > 0 {
+		if path, err := historyPath(); err == nil {
+			options["db"] = path
+		}
+		set("skip-days", c.SkipScannedDays, c.SkipScannedDays > 0)
+	}
+	f := c.Feasibility
+	set("feasible-alpn", f.ALPN, len(f.ALPN) > 0)
+	set("feasible-tls12", true, f.AllowTLS12)
+	set("feasible-issuers", f.Issuers, len(f.Issuers) > 0)
+	set("feasible-exclude-issuers", f.ExcludeIssuers, len(f.ExcludeIssuers) > 0)
+	set("feasible-min-days", f.MinValidDays, f.MinValidDays > 0)
+	set("feasible-sni", true, f.MatchSNI)
+	for name, on := range map[string]bool{
+		"46":             c.EnableIPv6,
+		"happy-eyeballs": c.HappyEyeballs,
+		"v":              c.Verbose,
+		"asn":            c.EnableASN,
+		"pq":             c.ProbePQ,
+		"http":           c.ProbeHTTP,
+		"no-sni":         c.NoSNI,
+		"dual":           c.DualProbe,
+		"tls-details":    c.TLSDetails,
+		"cdn":            c.DetectCDN,
+		"skip-cdn":       c.SkipCDN,
+		"honeypots":      c.DetectHoneypots,
+		"ocsp":           c.CheckOCSP,
+		"h3":             c.ProbeH3,
+		"resumption":     c.ProbeResumption,
+		"hrr":            c.ProbeHRR,
+		"dns-match":      c.DNSMatch,
+		"city":           c.GeoCity,
+		"adaptive":       c.Adaptive,
+		"shuffle":        c.Shuffle,
+	} {
+		set(name, true, on)
+	}
+	return options
+}
@@ -0,0 +1,241 @@
+//go:build !nogui
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// detailTimeout limits the handshake fetching the certificates of a result
+const detailTimeout = 10 * time.Second
+
+// buildDetailPanel creates the side panel showing the certificates and
+// handshake of the clicked result, hidden until a row is clicked
+func (g *GUI) buildDetailPanel() fyne.CanvasObject {
+	g.detailTitle = widget.NewLabel("")
+	g.detailTitle.TextStyle = fyne.TextStyle{Bold: true}
+	g.detailTitle.Truncation = fyne.TextTruncateEllipsis
+	g.detailLabel = widget.NewLabel("")
+	g.detailLabel.TextStyle = fyne.TextStyle{Monospace: true}
+	g.detailLabel.Selectable = true
+	closeBtn := widget.NewButtonWithIcon("", theme.CancelIcon(), func() {
+		g.detailSeq++
+		g.detailPanel.Hide()
+	})
+	closeBtn.Importance = widget.LowImportance
+	g.detailPanel = container.NewBorder(container.NewBorder(nil, nil, nil, closeBtn, g.detailTitle),
+		nil, nil, nil, container.NewScroll(g.detailLabel))
+	g.detailPanel.Hide()
+	return g.detailPanel
+}
+
+// showDetails fills the detail panel with result. Its certificates are
+// fetched again from the host unless the result carries its chain.
+func (g *GUI) showDetails(result ScanResult) {
+	g.detailSeq++
+	seq := g.detailSeq
+	port := result.Port
+	if port == 0 {
+		port = 443
+	}
+	hostPort := net.JoinHostPort(result.IP, strconv.Itoa(port))
+	g.detailTitle.SetText(lang.X("detail.title", "Details: {{.Host}}", map[string]any{"Host": hostPort}))
+	g.detailPanel.Show()
+
+	if len(result.Chain) > 0 {
+		var certs []*x509.Certificate
+		for _, data := range result.Chain {
+			if block, _ := pem.Decode([]byte(data)); block != nil {
+				if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+					certs = append(certs, cert)
+				}
+			}
+		}
+		g.detailLabel.SetText(resultDetails(result, nil, certs))
+		return
+	}
+
+	sni := ""
+	switch {
+	case g.noSNICheck.Checked:
+	case strings.TrimSpace(g.sniEntry.Text) != "":
+		sni = strings.TrimSpace(g.sniEntry.Text)
+	case net.ParseIP(result.Origin) == nil && ValidateDomainName(result.Origin):
+		sni = result.Origin
+	}
+	g.detailLabel.SetText(lang.X("detail.fetching", "Connecting to {{.Host}}...", map[string]any{"Host": hostPort}))
+	go func() {
+		state, err := fetchHandshake(hostPort, sni)
+		fyne.Do(func() {
+			// Another row was clicked or the panel closed in the meantime
+			if seq != g.detailSeq {
+				return
+			}
+			if err != nil {
+				g.detailLabel.SetText(resultDetails(result, nil, nil) + "\n" +
+					lang.X("detail.failed", "Cannot fetch the certificates: {{.Error}}", map[string]any{"Error": err.Error()}))
+				return
+			}
+			g.detailLabel.SetText(resultDetails(result, &state, state.PeerCertificates))
+		})
+	}()
+}
+
+// fetchHandshake completes a TLS handshake with hostPort the way the
+// scanner does and returns its state
+func fetchHandshake(hostPort, sni string) (tls.ConnectionState, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), detailTimeout)
+	defer cancel()
+	conn, err := (&tls.Dialer{Config: &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+		CurvePreferences:   []tls.CurveID{tls.X25519},
+		ServerName:         sni,
+	}}).DialContext(ctx, "tcp", hostPort)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer conn.Close()
+	return conn.(*tls.Conn).ConnectionState(), nil
+}
+
+// resultDetails renders the host, handshake and certificates of result.
+// state is the handshake fetched for the panel, if any, otherwise the
+// handshake details recorded by the scan are shown.
+func resultDetails(result ScanResult, state *tls.ConnectionState, certs []*x509.Certificate) string {
+	var b strings.Builder
+	line := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "  %-14s %s\n", key+":", value)
+		}
+	}
+	b.WriteString(lang.X("detail.host", "Host") + "\n")
+	line(lang.X("detail.origin", "Origin"), result.Origin)
+	if result.Rank > 0 {
+		line(lang.X("detail.rank", "Top list rank"), strconv.Itoa(result.Rank))
+	}
+	line(lang.X("detail.geo", "Geo"), result.GeoCode)
+	if result.ASN != 0 {
+		line("ASN", fmt.Sprintf("AS%d %s", result.ASN, result.ASOrg))
+	}
+	line("CDN", result.CDN)
+	if result.Honeypot {
+		line(lang.X("detail.honeypot", "Honeypot"), lang.X("detail.honeypot_value", "looks like a honeypot or tarpit"))
+	}
+
+	b.WriteString("\n" + lang.X("detail.handshake", "Handshake") + "\n")
+	version, alpn, cipher, kex := result.TLSVersion, result.ALPN, result.CipherSuite, result.KeyExchange
+	if state != nil {
+		version, alpn = tls.VersionName(state.Version), state.NegotiatedProtocol
+		cipher, kex = tls.CipherSuiteName(state.CipherSuite), keyExchange(*state)
+	}
+	line(lang.X("detail.version", "Version"), version)
+	line("ALPN", alpn)
+	line(lang.X("detail.cipher", "Cipher suite"), cipher)
+	line(lang.X("detail.key_exchange", "Key exchange"), kex)
+	line(lang.X("detail.pq", "PQ curve"), result.Curve)
+	line(lang.X("detail.timing", "Timing"), lang.X("detail.timing_value", "connect {{.Connect}} ms, handshake {{.Handshake}} ms",
+		map[string]any{"Connect": result.ConnectMs, "Handshake": result.HandshakeMs}))
+	if state != nil {
+		line(lang.X("detail.sni", "SNI sent"), state.ServerName)
+		line(lang.X("detail.ocsp_staple", "OCSP staple"), strconv.FormatBool(len(state.OCSPResponse) > 0))
+		line("SCTs", strconv.Itoa(len(state.SignedCertificateTimestamps)))
+	}
+	line("OCSP", result.OCSP)
+	if result.H3 {
+		line("HTTP/3", "true")
+	}
+	line(lang.X("detail.resumption", "Resumption"), result.Resumption)
+	line(lang.X("detail.hrr", "HelloRetryRequest"), result.HRR)
+	line(lang.X("detail.dns_match", "DNS match"), result.DNSMatch)
+	if result.SpeedKBps > 0 {
+		line(lang.X("detail.speed", "Download speed"), lang.X("detail.speed_value", "{{.Speed}} KB/s",
+			map[string]any{"Speed": result.SpeedKBps}))
+	}
+
+	if len(result.Families) > 0 {
+		b.WriteString("\n" + lang.X("detail.happy_eyeballs", "Happy Eyeballs") + "\n")
+		for _, f := range result.Families {
+			status := lang.X("detail.family_lost", "still connecting when the other family connected")
+			switch f.Status {
+			case FamilyConnected:
+				status = lang.X("detail.family_connected", "connected first in {{.Ms}} ms", map[string]any{"Ms": f.ConnectMs})
+			case FamilyFailed:
+				status = lang.X("detail.family_failed", "failed to connect")
+			}
+			line(f.Family+" "+f.IP, status)
+		}
+	}
+
+	if len(result.SNIs) > 0 {
+		b.WriteString("\n" + lang.X("detail.sni_matrix", "SNI matrix") + "\n")
+		for _, probe := range result.SNIs {
+			status := lang.X("detail.sni_failed", "handshake failed")
+			switch {
+			case probe.Valid:
+				status = lang.X("detail.sni_valid", "valid, {{.Domain}} [{{.Cert}}]",
+					map[string]any{"Domain": probe.Domain, "Cert": probe.Cert})
+			case probe.Cert != "":
+				status = lang.X("detail.sni_invalid", "invalid, {{.Domain}} [{{.Cert}}]",
+					map[string]any{"Domain": probe.Domain, "Cert": probe.Cert})
+			}
+			line(probe.SNI, status)
+		}
+	}
+
+	now := time.Now()
+	for i, cert := range certs {
+		b.WriteString("\n" + lang.X("detail.certificate", "Certificate {{.N}}", map[string]any{"N": i + 1}) + "\n")
+		line(lang.X("detail.subject", "Subject"), cert.Subject.String())
+		var sans []string
+		sans = append(sans, cert.DNSNames...)
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		line("SANs", strings.Join(sans, ", "))
+		line(lang.X("detail.issuer", "Issuer"), cert.Issuer.String())
+		validity := cert.NotBefore.Format(time.DateOnly) + " - " + cert.NotAfter.Format(time.DateOnly)
+		if now.After(cert.NotAfter) {
+			validity += " (" + lang.X("detail.expired", "expired") + ")"
+		}
+		line(lang.X("detail.valid", "Valid"), validity)
+		line(lang.X("detail.key", "Key"), publicKeyName(cert))
+		line(lang.X("detail.signature", "Signature"), cert.SignatureAlgorithm.String())
+		line(lang.X("detail.serial", "Serial"), cert.SerialNumber.Text(16))
+		sum := sha256.Sum256(cert.Raw)
+		line("SHA-256", hex.EncodeToString(sum[:]))
+	}
+	return b.String()
+}
+
+// publicKeyName describes the key type and size of a certificate
+func publicKeyName(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
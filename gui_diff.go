@@ -0,0 +1,77 @@
+//go:build !nogui
+
+package main
+
+import (
+	"errors"
+	"io"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// resultsFileExtensions are the results files that can be compared
+var resultsFileExtensions = []string{".csv", ".json", ".jsonl", ".ndjson", ".xlsx"}
+
+// onCompareResults asks for the results files of an old and a new scan and
+// shows what changed between them
+func (g *GUI) onCompareResults() {
+	g.openResultsFile(lang.X("dialog.diff_old", "Choose the results of the old scan"), func(old []ScanResult) {
+		g.openResultsFile(lang.X("dialog.diff_new", "Choose the results of the new scan"), func(new []ScanResult) {
+			g.showDiff(DiffResults(old, new))
+		})
+	})
+}
+
+// openResultsFile picks a results file, with title telling which, and
+// passes its results to onRead
+func (g *GUI) openResultsFile(title string, onRead func([]ScanResult)) {
+	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		// CSV files carry no port, their rows are taken to be on the scanned one
+		port, _ := strconv.Atoi(sanitizeNumericInput(g.portEntry.Text))
+		results, err := readResultsFile(reader.URI().Name(), data, port)
+		if err != nil {
+			dialog.ShowError(errors.New(lang.X("dialog.failed_read_append", "Cannot read {{.Name}}: {{.Error}}",
+				map[string]any{"Name": reader.URI().Name(), "Error": err.Error()})), g.window)
+			return
+		}
+		onRead(results)
+	}, g.window)
+	fileDialog.SetFilter(storage.NewExtensionFileFilter(resultsFileExtensions))
+	fileDialog.SetTitleText(title)
+	fileDialog.Show()
+}
+
+// showDiff shows the hosts that became feasible, disappeared or changed
+// certificate between two scans
+func (g *GUI) showDiff(diff *ResultsDiff) {
+	text := widget.NewLabel(diff.Text())
+	text.TextStyle = fyne.TextStyle{Monospace: true}
+	text.Selectable = true
+	if diff.Empty() {
+		text.SetText(lang.X("dialog.diff_none", "No changes, the same {{.Count}} hosts are feasible",
+			map[string]any{"Count": diff.New}))
+	}
+	d := dialog.NewCustom(lang.X("dialog.diff_title", "Compare Results"), lang.X("btn.close", "Close"),
+		container.NewScroll(text), g.window)
+	d.Resize(fyne.NewSize(700, 500))
+	d.Show()
+}
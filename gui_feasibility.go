@@ -0,0 +1,145 @@
+//go:build !nogui
+
+package main
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// commonIssuers are offered in the issuer lists besides the issuers of the
+// results
+var commonIssuers = []string{"Let's Encrypt", "Google Trust Services", "DigiCert", "Sectigo", "GlobalSign",
+	"ZeroSSL", "Amazon", "Microsoft", "Cloudflare"}
+
+// issuerName shortens an issuer organization to the part before a comma,
+// as lists of issuers are separated by commas in config files and flags
+func issuerName(issuer string) string {
+	name, _, _ := strings.Cut(issuer, ",")
+	return strings.TrimSpace(name)
+}
+
+// issuerOptions returns the issuers to pick from: the common ones, those
+// of the results and those already picked
+func (g *GUI) issuerOptions(picked ...[]string) []string {
+	options := slices.Clone(commonIssuers)
+	g.resultsMu.Lock()
+	for _, result := range g.results {
+		for _, issuer := range strings.Split(result.Issuer, " | ") {
+			if name := issuerName(issuer); name != "" {
+				options = append(options, name)
+			}
+		}
+	}
+	g.resultsMu.Unlock()
+	for _, list := range picked {
+		options = append(options, list...)
+	}
+	slices.SortFunc(options, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+	return slices.CompactFunc(options, strings.EqualFold)
+}
+
+// issuerPicker is a list of issuers to check, with an entry adding names
+// that are not offered
+func issuerPicker(options, selected []string) (*widget.CheckGroup, fyne.CanvasObject) {
+	group := widget.NewCheckGroup(options, nil)
+	group.SetSelected(selected)
+	addEntry := widget.NewEntry()
+	addEntry.SetPlaceHolder(lang.X("feasibility.add_issuer", "Other issuer"))
+	add := func() {
+		issuer := issuerName(addEntry.Text)
+		if issuer == "" {
+			return
+		}
+		if !slices.Contains(group.Options, issuer) {
+			group.Append(issuer)
+		}
+		group.SetSelected(append(slices.Clone(group.Selected), issuer))
+		addEntry.SetText("")
+	}
+	addEntry.OnSubmitted = func(string) { add() }
+	scroll := container.NewVScroll(group)
+	scroll.SetMinSize(fyne.NewSize(300, 120))
+	return group, container.NewBorder(nil,
+		container.NewBorder(nil, nil, nil, widget.NewButtonWithIcon("", theme.ContentAddIcon(), add), addEntry),
+		nil, nil, scroll)
+}
+
+// exportResults returns the results to save, resultsMu must be held. Hosts
+// whose issuer the lists of the feasibility policy reject are no longer
+// feasible, for results loaded from history or judged before the lists
+// changed.
+func (g *GUI) exportResults() []ScanResult {
+	results := slices.Clone(g.results)
+	for i, result := range results {
+		if result.Feasible && !g.feasibility.IssuerAllowed(result.Issuer) {
+			results[i].Feasible = false
+		}
+	}
+	return results
+}
+
+// showFeasibilityDialog edits the feasibility policy of the next scans
+func (g *GUI) showFeasibilityDialog() {
+	p := g.feasibility
+	alpnEntry := widget.NewEntry()
+	alpnEntry.SetPlaceHolder(defaultALPN)
+	alpnEntry.SetText(strings.Join(p.ALPN, ", "))
+	alpnEntry.Validator = func(s string) error {
+		_, err := ParseALPN(s)
+		return err
+	}
+	tls12Check := widget.NewCheck(lang.X("feasibility.tls12", "Also accept TLS 1.2"), nil)
+	tls12Check.SetChecked(p.AllowTLS12)
+	options := g.issuerOptions(p.Issuers, p.ExcludeIssuers)
+	issuersGroup, issuersPicker := issuerPicker(options, p.Issuers)
+	excludeGroup, excludePicker := issuerPicker(options, p.ExcludeIssuers)
+	daysEntry := widget.NewEntry()
+	daysEntry.SetText(strconv.Itoa(p.MinValidDays))
+	daysEntry.Validator = func(s string) error {
+		if days, err := strconv.Atoi(strings.TrimSpace(s)); err != nil || days < 0 {
+			return errors.New(lang.X("error.invalid_days", "Invalid number of days"))
+		}
+		return nil
+	}
+	sniCheck := widget.NewCheck(lang.X("feasibility.sni", "Certificate matches the SNI"), nil)
+	sniCheck.SetChecked(p.MatchSNI)
+
+	dialog.ShowForm(lang.X("dialog.feasibility", "Feasibility Criteria"), lang.X("btn.save", "Save"),
+		lang.X("btn.cancel", "Cancel"),
+		[]*widget.FormItem{
+			widget.NewFormItem(lang.X("feasibility.alpn", "ALPN:"), alpnEntry),
+			widget.NewFormItem("", tls12Check),
+			widget.NewFormItem(lang.X("feasibility.issuers", "Only issuers:"), issuersPicker),
+			widget.NewFormItem(lang.X("feasibility.exclude_issuers", "Exclude issuers:"), excludePicker),
+			widget.NewFormItem(lang.X("feasibility.min_days", "Valid for days:"), daysEntry),
+			widget.NewFormItem("", sniCheck),
+		},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			alpn, _ := ParseALPN(alpnEntry.Text)
+			days, _ := strconv.Atoi(strings.TrimSpace(daysEntry.Text))
+			g.feasibility = FeasibilityPolicy{
+				ALPN:           alpn,
+				AllowTLS12:     tls12Check.Checked,
+				Issuers:        issuersGroup.Selected,
+				ExcludeIssuers: excludeGroup.Selected,
+				MinValidDays:   days,
+				MatchSNI:       sniCheck.Checked,
+			}
+			g.updateRunning()
+		}, g.window)
+}
@@ -0,0 +1,163 @@
+//go:build !nogui
+
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/widget"
+)
+
+// resultFilter narrows the results table, the zero value shows every result
+type resultFilter struct {
+	// Text is matched case insensitively against every column
+	Text         string
+	FeasibleOnly bool
+	// Geo is the country code to show, "" for all
+	Geo string
+}
+
+// match reports whether result is shown
+func (f resultFilter) match(result ScanResult) bool {
+	if f.FeasibleOnly && !result.Feasible {
+		return false
+	}
+	if f.Geo != "" && result.GeoCode != f.Geo {
+		return false
+	}
+	if f.Text == "" {
+		return true
+	}
+	text := strings.ToLower(f.Text)
+	for _, column := range []string{result.IP, result.Origin, result.Domain, result.Issuer, result.GeoCode,
+		strconv.Itoa(result.ConnectMs), strconv.Itoa(result.HandshakeMs),
+		strconv.FormatFloat(result.Score, 'f', -1, 64), result.CipherSuite, result.KeyExchange, result.CDN, result.OCSP} {
+		if strings.Contains(strings.ToLower(column), text) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildFilterBar creates the search box and toggles above the results table
+func (g *GUI) buildFilterBar() fyne.CanvasObject {
+	allGeo := lang.X("filter.all_geo", "All countries")
+	g.filterEntry = widget.NewEntry()
+	g.filterEntry.SetPlaceHolder(lang.X("placeholder.filter", "Filter by any column"))
+	g.feasibleFilter = widget.NewCheck(lang.X("filter.feasible", "Feasible only"), nil)
+	g.geoFilter = widget.NewSelect([]string{allGeo}, nil)
+	g.geoFilter.SetSelected(allGeo)
+	g.filterCount = widget.NewLabel("")
+
+	apply := func() {
+		geo := g.geoFilter.Selected
+		if geo == allGeo {
+			geo = ""
+		}
+		g.resultsMu.Lock()
+		g.filter = resultFilter{
+			Text:         strings.TrimSpace(g.filterEntry.Text),
+			FeasibleOnly: g.feasibleFilter.Checked,
+			Geo:          geo,
+		}
+		g.rebuildView()
+		g.resultsMu.Unlock()
+		g.refreshResults()
+	}
+	g.filterEntry.OnChanged = func(string) { apply() }
+	g.feasibleFilter.OnChanged = func(bool) { apply() }
+	g.geoFilter.OnChanged = func(string) { apply() }
+
+	g.selectionBtn = widget.NewButton("", nil)
+	g.selectionBtn.OnTapped = g.showSelectionMenu
+	g.updateSelection()
+
+	return container.NewBorder(nil, nil, nil,
+		container.NewHBox(g.feasibleFilter, g.geoFilter, g.filterCount, g.selectionBtn), g.filterEntry)
+}
+
+// rebuildView recomputes the rows shown from all results, resultsMu must be
+// held
+func (g *GUI) rebuildView() {
+	g.view = g.view[:0]
+	g.geoCodes = make(map[string]bool)
+	g.geoChanged = true
+	for i, result := range g.results {
+		g.geoCodes[result.GeoCode] = true
+		if g.filter.match(result) {
+			g.view = append(g.view, i)
+		}
+	}
+}
+
+// addResult appends a result and shows it if it passes the filter
+func (g *GUI) addResult(result ScanResult) int {
+	g.resultsMu.Lock()
+	defer g.resultsMu.Unlock()
+	g.results = append(g.results, result)
+	if g.geoCodes == nil {
+		g.geoCodes = make(map[string]bool)
+	}
+	if !g.geoCodes[result.GeoCode] {
+		g.geoCodes[result.GeoCode] = true
+		g.geoChanged = true
+	}
+	if g.filter.match(result) {
+		g.view = append(g.view, len(g.results)-1)
+	}
+	return len(g.results)
+}
+
+// setResults replaces all results, nil clears the table, and unticks all
+// rows
+func (g *GUI) setResults(results []ScanResult) {
+	g.resultsMu.Lock()
+	g.results = results
+	g.checked = nil
+	g.sortResults()
+	g.rebuildView()
+	g.resultsMu.Unlock()
+}
+
+// viewResult returns the result shown in a data row of the table,
+// resultsMu must be held
+func (g *GUI) viewResult(row int) (ScanResult, bool) {
+	if row < 1 || row > len(g.view) {
+		return ScanResult{}, false
+	}
+	return g.results[g.view[row-1]], true
+}
+
+// refreshResults redraws the table and updates the filter bar to the
+// results, it must run on the UI goroutine
+func (g *GUI) refreshResults() {
+	g.resultsMu.Lock()
+	shown, total := len(g.view), len(g.results)
+	update := g.geoChanged
+	var codes []string
+	if update {
+		for code := range g.geoCodes {
+			codes = append(codes, code)
+		}
+		g.geoChanged = false
+	}
+	g.resultsMu.Unlock()
+
+	if update {
+		slices.Sort(codes)
+		g.geoFilter.Options = append([]string{g.geoFilter.Options[0]}, codes...)
+		g.geoFilter.Refresh()
+	}
+	g.filterCount.SetText(lang.X("filter.count", "{{.Shown}} of {{.Total}}",
+		map[string]any{"Shown": shown, "Total": total}))
+	g.updateSelection()
+	g.resultsTable.Refresh()
+	if g.resultTabs.Selected() == g.mapTab {
+		g.updateMap()
+	}
+}
@@ -0,0 +1,105 @@
+//go:build !nogui
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/widget"
+)
+
+// historyPath is the database the GUI records sessions in
+func historyPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "RealiTLScanner")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "history.db"), nil
+}
+
+// openHistory opens the history database once and keeps it open
+func (g *GUI) openHistory() (*Store, error) {
+	if g.store != nil {
+		return g.store, nil
+	}
+	path, err := historyPath()
+	if err != nil {
+		return nil, err
+	}
+	store, err := OpenStore(path)
+	if err != nil {
+		return nil, err
+	}
+	g.store = store
+	return store, nil
+}
+
+// onHistory lists the recorded sessions and loads the one picked into the
+// results table
+func (g *GUI) onHistory() {
+	store, err := g.openHistory()
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+	sessions, err := store.Sessions()
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+	if len(sessions) == 0 {
+		dialog.ShowInformation(lang.X("dialog.history_title", "History"),
+			lang.X("dialog.history_empty", "No sessions recorded yet, enable \"Save history\" before scanning"), g.window)
+		return
+	}
+
+	var d dialog.Dialog
+	list := widget.NewList(
+		func() int { return len(sessions) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			s := sessions[id]
+			text := fmt.Sprintf("#%d  %s  %s:%d  %s", s.ID, s.Started.Format(time.DateTime), s.Source, s.Port,
+				lang.X("dialog.history_counts", "{{.Feasible}} feasible of {{.Results}}",
+					map[string]any{"Feasible": s.Feasible, "Results": s.Results}))
+			if s.Finished.IsZero() {
+				text += "  " + lang.X("dialog.history_interrupted", "(interrupted)")
+			}
+			item.(*widget.Label).SetText(text)
+		},
+	)
+	list.OnSelected = func(id widget.ListItemID) {
+		results, err := store.Results(sessions[id].ID, false)
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		g.setResults(results)
+		if resultsConfig(results).TLSDetails {
+			g.showColumns("cipher_suite", "key_exchange")
+		}
+		g.selected = nil
+		g.xrayBtn.Disable()
+		g.refreshResults()
+		if len(results) > 0 && !g.isScanning {
+			g.saveCSVBtn.Enable()
+			g.saveExcelBtn.Enable()
+		}
+		g.statusText.Set(lang.X("status.history_loaded", "Loaded session #{{.ID}}: {{.Count}} results",
+			map[string]any{"ID": sessions[id].ID, "Count": len(results)}))
+		d.Hide()
+	}
+	d = dialog.NewCustom(lang.X("dialog.history_title", "History"), lang.X("btn.close", "Close"), list, g.window)
+	d.Resize(fyne.NewSize(640, 420))
+	d.Show()
+}
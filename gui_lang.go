@@ -0,0 +1,179 @@
+//go:build !nogui
+
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"slices"
+	"sync/atomic"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+//go:embed translations
+var translations embed.FS
+
+// languagePref is the preference key of the interface language, empty to
+// follow the system
+const languagePref = "language"
+
+// uiLanguage is a language the interface is translated to
+type uiLanguage struct {
+	code string
+	// name is the name of the language in itself
+	name string
+	rtl  bool
+}
+
+// uiLanguages are the languages of translations/, the first is used when
+// the system language is none of them
+var uiLanguages = []uiLanguage{
+	{code: "en", name: "English"},
+	{code: "ru", name: "Русский"},
+	{code: "fa", name: "فارسی", rtl: true},
+	{code: "zh", name: "中文"},
+}
+
+var (
+	i18nBundle *i18n.Bundle
+	localizer  atomic.Pointer[i18n.Localizer]
+	// rtlLayout is set while the interface is in a right-to-left language
+	rtlLayout atomic.Bool
+)
+
+// setupLanguages loads the translations and makes lang.X translate into
+// the language of code. Fyne picks the language of lang.X once from the
+// system, its own localizer is replaced so that it can be switched while
+// the app runs.
+func setupLanguages(code string) error {
+	i18nBundle = i18n.NewBundle(language.English)
+	i18nBundle.RegisterUnmarshalFunc("json", json.Unmarshal)
+	files, err := translations.ReadDir("translations")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := translations.ReadFile("translations/" + file.Name())
+		if err != nil {
+			return err
+		}
+		if _, err := i18nBundle.ParseMessageFileBytes(data, file.Name()); err != nil {
+			return err
+		}
+	}
+	setLanguage(code)
+	lang.X = localizeKey
+	return nil
+}
+
+// setLanguage translates the strings built from now on into the language
+// of code, the system language when empty
+func setLanguage(code string) {
+	if code == "" {
+		code = systemLanguage()
+	}
+	localizer.Store(i18n.NewLocalizer(i18nBundle, code))
+	rtlLayout.Store(slices.ContainsFunc(uiLanguages, func(l uiLanguage) bool { return l.code == code && l.rtl }))
+}
+
+// systemLanguage returns the code of the language in uiLanguages closest to
+// the one of the system
+func systemLanguage() string {
+	tags := make([]language.Tag, len(uiLanguages))
+	for i, l := range uiLanguages {
+		tags[i] = language.Make(l.code)
+	}
+	_, i, confidence := language.NewMatcher(tags).Match(language.Make(lang.SystemLocale().String()))
+	if confidence == language.No {
+		return uiLanguages[0].code
+	}
+	return uiLanguages[i].code
+}
+
+// localizeKey translates the string of key like lang.LocalizeKey, in the
+// chosen language
+func localizeKey(key, fallback string, data ...any) string {
+	var templateData any
+	if len(data) > 0 {
+		templateData = data[0]
+	}
+	text, err := localizer.Load().Localize(&i18n.LocalizeConfig{
+		DefaultMessage: &i18n.Message{ID: key, Other: fallback},
+		TemplateData:   templateData,
+	})
+	// Keys without a translation come back as the fallback with an error
+	if err != nil && text == "" {
+		return lang.LocalizeKey(key, fallback, data...)
+	}
+	return text
+}
+
+// hbox lays out objects in reading order, right to left in an RTL language
+func hbox(objects ...fyne.CanvasObject) *fyne.Container {
+	if rtlLayout.Load() {
+		slices.Reverse(objects)
+	}
+	return container.NewHBox(objects...)
+}
+
+// sideBorder places leading before center and trailing after it in reading
+// order, any may be nil
+func sideBorder(leading, trailing, center fyne.CanvasObject) *fyne.Container {
+	if rtlLayout.Load() {
+		leading, trailing = trailing, leading
+	}
+	if center == nil {
+		return container.NewBorder(nil, nil, leading, trailing)
+	}
+	return container.NewBorder(nil, nil, leading, trailing, center)
+}
+
+// readingAlign is the alignment of text starting a line in the interface
+// language
+func readingAlign() fyne.TextAlign {
+	if rtlLayout.Load() {
+		return fyne.TextAlignTrailing
+	}
+	return fyne.TextAlignLeading
+}
+
+// onLanguage switches the interface to the language of code, the system
+// language when empty, rebuilding the window with its settings, filters
+// and results kept. During a scan the choice is saved for the next start.
+func (g *GUI) onLanguage(code string) {
+	if g.isScanning {
+		g.app.Preferences().SetString(languagePref, code)
+		dialog.ShowInformation(lang.X("dialog.language", "Language"),
+			lang.X("dialog.language_restart", "The language changes on the next start, a scan is running"), g.window)
+		return
+	}
+	profile, err := g.currentProfile()
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+	g.app.Preferences().SetString(languagePref, code)
+	setLanguage(code)
+
+	g.window.SetTitle(lang.X("app.title", "RealiTLScanner"))
+	g.window.SetContent(g.buildUI())
+	g.window.SetMainMenu(g.buildMainMenu())
+	g.loadProfile(profile)
+	g.selected = nil
+	g.refreshResults()
+	g.resultsMu.Lock()
+	hasResults := len(g.results) > 0
+	g.resultsMu.Unlock()
+	if hasResults {
+		g.saveCSVBtn.Enable()
+		g.saveExcelBtn.Enable()
+	}
+	g.statusText.Set(lang.X("status.ready", "Ready to scan"))
+	g.refreshLog()
+}
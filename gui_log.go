@@ -0,0 +1,280 @@
+//go:build !nogui
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Preference keys of the log area
+const (
+	logLevelPref = "log_level"
+	logFilePref  = "log_file"
+)
+
+// logHistoryMax is how many messages the log keeps for the view and Save
+// log, logViewMax how many of the latest the view shows
+const (
+	logHistoryMax = 10000
+	logViewMax    = 500
+)
+
+// logEntry is a message of the log area
+type logEntry struct {
+	time  time.Time
+	level slog.Level
+	text  string
+}
+
+// line formats the entry with the time in layout
+func (e logEntry) line(layout string) string {
+	return fmt.Sprintf("[%s] %s: %s", e.time.Format(layout), levelName(e.level), e.text)
+}
+
+// guiLogHandler is the slog handler of the GUI. Messages of every level
+// are kept in order for the log area, which shows those of the chosen
+// level and above, and written to the log file if one is set.
+type guiLogHandler struct {
+	g *GUI
+	// attrs are the attributes of WithAttrs formatted as " key=value",
+	// groups prefix the keys
+	attrs string
+	group string
+}
+
+func (h guiLogHandler) Enabled(context.Context, slog.Level) bool {
+	return true
+}
+
+func (h guiLogHandler) Handle(_ context.Context, record slog.Record) error {
+	var b strings.Builder
+	b.WriteString(record.Message)
+	b.WriteString(h.attrs)
+	record.Attrs(func(attr slog.Attr) bool {
+		writeLogAttr(&b, h.group, attr)
+		return true
+	})
+	entry := logEntry{time: record.Time, level: record.Level, text: b.String()}
+	if entry.time.IsZero() {
+		entry.time = time.Now()
+	}
+
+	g := h.g
+	g.logMu.Lock()
+	g.logEntries = append(g.logEntries, entry)
+	// Trimmed in steps rather than on every message
+	if len(g.logEntries) > logHistoryMax+logHistoryMax/10 {
+		g.logEntries = append([]logEntry(nil), g.logEntries[len(g.logEntries)-logHistoryMax:]...)
+	}
+	var err error
+	if g.logFile != nil && entry.level >= g.logLevel.Level() {
+		_, err = fmt.Fprintln(g.logFile, entry.line(time.DateTime))
+	}
+	g.logMu.Unlock()
+	g.refreshLog()
+	return err
+}
+
+func (h guiLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var b strings.Builder
+	b.WriteString(h.attrs)
+	for _, attr := range attrs {
+		writeLogAttr(&b, h.group, attr)
+	}
+	h.attrs = b.String()
+	return h
+}
+
+func (h guiLogHandler) WithGroup(name string) slog.Handler {
+	if name != "" {
+		h.group += name + "."
+	}
+	return h
+}
+
+// writeLogAttr writes attr as " key=value", with groups flattened
+func writeLogAttr(b *strings.Builder, prefix string, attr slog.Attr) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() == slog.KindGroup {
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+		for _, member := range attr.Value.Group() {
+			writeLogAttr(b, prefix, member)
+		}
+		return
+	}
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+	fmt.Fprintf(b, " %s%s=%v", prefix, attr.Key, attr.Value)
+}
+
+// setupLog routes slog, and with it the messages of the scans, to the log
+// area, restoring the level and log file of the last run
+func (g *GUI) setupLog() {
+	prefs := g.app.Preferences()
+	if level, err := ParseLogLevel(prefs.StringWithFallback(logLevelPref, "info")); err == nil {
+		g.logLevel.Set(level)
+	}
+	if path := prefs.String(logFilePref); path != "" {
+		file, err := OpenRotatingFile(path)
+		if err != nil {
+			prefs.SetString(logFilePref, "")
+			defer slog.Warn("Cannot open log file", "path", path, "err", err)
+		} else {
+			g.logFile = file
+		}
+	}
+	g.logger = slog.New(guiLogHandler{g: g})
+	slog.SetDefault(g.logger)
+}
+
+// appendLog adds a message of level, as named by OnLog, to the log
+func (g *GUI) appendLog(level, message string) {
+	lvl, err := ParseLogLevel(level)
+	if err != nil {
+		lvl = slog.LevelInfo
+	}
+	g.logger.Log(context.Background(), lvl, message)
+}
+
+// visibleLog returns the kept messages of the chosen level and above,
+// oldest first
+func (g *GUI) visibleLog() []logEntry {
+	level := g.logLevel.Level()
+	g.logMu.Lock()
+	defer g.logMu.Unlock()
+	var entries []logEntry
+	for _, entry := range g.logEntries {
+		if entry.level >= level {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// refreshLog shows the latest messages in the log area. Messages arriving
+// before the view was updated are shown together.
+func (g *GUI) refreshLog() {
+	if g.logPending.Swap(true) {
+		return
+	}
+	fyne.Do(func() {
+		g.logPending.Store(false)
+		entries := g.visibleLog()
+		if len(entries) > logViewMax {
+			entries = entries[len(entries)-logViewMax:]
+		}
+		lines := make([]string, len(entries))
+		for i, entry := range entries {
+			lines[i] = entry.line("15:04:05")
+		}
+		g.logText.Set(strings.Join(lines, "\n"))
+		if g.logScroll != nil {
+			g.logScroll.ScrollToBottom()
+		}
+	})
+}
+
+// buildLogBar returns the level, log file and save controls of the log
+// area
+func (g *GUI) buildLogBar() fyne.CanvasObject {
+	prefs := g.app.Preferences()
+	levelSelect := widget.NewSelect(LogLevels, func(name string) {
+		level, err := ParseLogLevel(name)
+		if err != nil {
+			return
+		}
+		g.logLevel.Set(level)
+		prefs.SetString(logLevelPref, name)
+		g.refreshLog()
+	})
+	levelSelect.SetSelected(levelName(g.logLevel.Level()))
+
+	var fileCheck *widget.Check
+	fileCheck = widget.NewCheck(lang.X("log.to_file", "Log to file"), nil)
+	fileCheck.Checked = g.logFile != nil
+	onFile := func(on bool) {
+		if !on {
+			g.setLogFile(nil)
+			return
+		}
+		if g.logFile != nil {
+			return
+		}
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			var file *RotatingFile
+			if err == nil && writer != nil {
+				path := writer.URI().Path()
+				writer.Close()
+				file, err = OpenRotatingFile(path)
+			}
+			if err != nil {
+				dialog.ShowError(err, g.window)
+			}
+			if file == nil {
+				fileCheck.SetChecked(false)
+				return
+			}
+			g.setLogFile(file)
+		}, g.window)
+		fileDialog.SetFileName("RealiTLScanner.log")
+		fileDialog.Show()
+	}
+	fileCheck.OnChanged = onFile
+
+	saveBtn := widget.NewButton(lang.X("btn.save_log", "Save log"), g.onSaveLog)
+	return container.NewHBox(levelSelect, fileCheck, saveBtn)
+}
+
+// setLogFile starts writing the log to file, or stops with nil
+func (g *GUI) setLogFile(file *RotatingFile) {
+	g.logMu.Lock()
+	old := g.logFile
+	g.logFile = file
+	g.logMu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+	path := ""
+	if file != nil {
+		path = file.Path()
+	}
+	g.app.Preferences().SetString(logFilePref, path)
+}
+
+// onSaveLog saves the kept messages of the chosen level and above
+func (g *GUI) onSaveLog() {
+	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		var b strings.Builder
+		for _, entry := range g.visibleLog() {
+			b.WriteString(entry.line(time.DateTime) + "\n")
+		}
+		if _, err := writer.Write([]byte(b.String())); err != nil {
+			dialog.ShowError(err, g.window)
+		}
+	}, g.window)
+	fileDialog.SetFileName("scan-" + time.Now().Format("20060102-150405") + ".log")
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".log", ".txt"}))
+	fileDialog.Show()
+}
@@ -0,0 +1,248 @@
+//go:build !nogui
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"sort"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	// mapGraticule is the spacing of the latitude and longitude lines in
+	// degrees
+	mapGraticule = 30
+	// mapMarkerMin and mapMarkerMax bound the marker diameter in pixels
+	mapMarkerMin = 6
+	mapMarkerMax = 40
+)
+
+// mapPoint is a place on the map with the number of hosts found there
+type mapPoint struct {
+	lat, lon float64
+	count    int
+}
+
+// WorldMap plots points on an equirectangular world projection, markers
+// growing with the number of hosts at a place. Country centroids are drawn
+// faintly as a backdrop in place of coastlines.
+type WorldMap struct {
+	widget.BaseWidget
+
+	mu     sync.Mutex
+	points []mapPoint
+}
+
+func newWorldMap() *WorldMap {
+	m := &WorldMap{}
+	m.ExtendBaseWidget(m)
+	return m
+}
+
+// SetPoints replaces the plotted points
+func (m *WorldMap) SetPoints(points []mapPoint) {
+	m.mu.Lock()
+	m.points = points
+	m.mu.Unlock()
+	m.Refresh()
+}
+
+func (m *WorldMap) CreateRenderer() fyne.WidgetRenderer {
+	r := &worldMapRenderer{worldMap: m}
+	r.background = canvas.NewRectangle(theme.Color(theme.ColorNameInputBackground))
+	for lon := -180 + mapGraticule; lon < 180; lon += mapGraticule {
+		r.meridians = append(r.meridians, r.gridLine())
+	}
+	for lat := -90 + mapGraticule; lat < 90; lat += mapGraticule {
+		r.parallels = append(r.parallels, r.gridLine())
+	}
+	for _, point := range loadCountryCentroids() {
+		dot := canvas.NewCircle(theme.Color(theme.ColorNamePlaceHolder))
+		r.countries = append(r.countries, dot)
+		r.countryPoints = append(r.countryPoints, point)
+	}
+	r.rebuild()
+	return r
+}
+
+type worldMapRenderer struct {
+	worldMap      *WorldMap
+	background    *canvas.Rectangle
+	meridians     []*canvas.Line
+	parallels     []*canvas.Line
+	countries     []*canvas.Circle
+	countryPoints [][2]float64
+	markers       []*canvas.Circle
+	counts        []*canvas.Text
+	points        []mapPoint
+}
+
+func (r *worldMapRenderer) gridLine() *canvas.Line {
+	line := canvas.NewLine(theme.Color(theme.ColorNameSeparator))
+	line.StrokeWidth = 1
+	return line
+}
+
+// rebuild recreates the markers for the current points, the largest first
+// so that small ones stay visible on top
+func (r *worldMapRenderer) rebuild() {
+	m := r.worldMap
+	m.mu.Lock()
+	r.points = append(r.points[:0], m.points...)
+	m.mu.Unlock()
+	sort.SliceStable(r.points, func(i, j int) bool { return r.points[i].count > r.points[j].count })
+
+	fill := theme.Color(theme.ColorNamePrimary)
+	red, green, blue, _ := fill.RGBA()
+	r.markers = r.markers[:0]
+	r.counts = r.counts[:0]
+	for _, point := range r.points {
+		marker := canvas.NewCircle(color.NRGBA{R: uint8(red >> 8), G: uint8(green >> 8), B: uint8(blue >> 8), A: 0xb0})
+		marker.StrokeColor = fill
+		marker.StrokeWidth = 1
+		count := canvas.NewText(fmt.Sprint(point.count), theme.Color(theme.ColorNameForeground))
+		count.TextSize = theme.CaptionTextSize()
+		r.markers = append(r.markers, marker)
+		r.counts = append(r.counts, count)
+	}
+}
+
+// markerSize returns the diameter of the marker for count hosts, growing
+// with the square root so that its area follows the count
+func markerSize(count, most int) float32 {
+	if most <= 1 {
+		return mapMarkerMin
+	}
+	scale := math.Sqrt(float64(count)) / math.Sqrt(float64(most))
+	return mapMarkerMin + float32(scale)*(mapMarkerMax-mapMarkerMin)
+}
+
+func (r *worldMapRenderer) Layout(size fyne.Size) {
+	// Keep the 2:1 aspect of the projection, centered in the widget
+	width, height := size.Width, size.Width/2
+	if height > size.Height {
+		width, height = size.Height*2, size.Height
+	}
+	origin := fyne.NewPos((size.Width-width)/2, (size.Height-height)/2)
+	project := func(lat, lon float64) fyne.Position {
+		return fyne.NewPos(origin.X+float32((lon+180)/360)*width, origin.Y+float32((90-lat)/180)*height)
+	}
+
+	r.background.Move(origin)
+	r.background.Resize(fyne.NewSize(width, height))
+	for i, line := range r.meridians {
+		x := project(0, float64(-180+(i+1)*mapGraticule)).X
+		line.Position1 = fyne.NewPos(x, origin.Y)
+		line.Position2 = fyne.NewPos(x, origin.Y+height)
+	}
+	for i, line := range r.parallels {
+		y := project(float64(-90+(i+1)*mapGraticule), 0).Y
+		line.Position1 = fyne.NewPos(origin.X, y)
+		line.Position2 = fyne.NewPos(origin.X+width, y)
+	}
+	for i, dot := range r.countries {
+		center := project(r.countryPoints[i][0], r.countryPoints[i][1])
+		dot.Move(center.SubtractXY(1.5, 1.5))
+		dot.Resize(fyne.NewSquareSize(3))
+	}
+
+	most := 0
+	for _, point := range r.points {
+		most = max(most, point.count)
+	}
+	for i, point := range r.points {
+		center := project(point.lat, point.lon)
+		diameter := markerSize(point.count, most)
+		r.markers[i].Move(center.SubtractXY(diameter/2, diameter/2))
+		r.markers[i].Resize(fyne.NewSquareSize(diameter))
+		count := r.counts[i]
+		textSize := count.MinSize()
+		// Only label markers wide enough to hold the number
+		count.Hidden = point.count < 2 || textSize.Width > diameter
+		count.Move(center.SubtractXY(textSize.Width/2, textSize.Height/2))
+	}
+}
+
+func (r *worldMapRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(200, 100)
+}
+
+func (r *worldMapRenderer) Refresh() {
+	r.background.FillColor = theme.Color(theme.ColorNameInputBackground)
+	r.rebuild()
+	r.Layout(r.worldMap.Size())
+	canvas.Refresh(r.worldMap)
+}
+
+func (r *worldMapRenderer) Objects() []fyne.CanvasObject {
+	objects := []fyne.CanvasObject{r.background}
+	for _, line := range r.meridians {
+		objects = append(objects, line)
+	}
+	for _, line := range r.parallels {
+		objects = append(objects, line)
+	}
+	for _, dot := range r.countries {
+		objects = append(objects, dot)
+	}
+	for i := range r.markers {
+		objects = append(objects, r.markers[i], r.counts[i])
+	}
+	return objects
+}
+
+func (r *worldMapRenderer) Destroy() {}
+
+// buildMapTab creates the map of the feasible results shown by the filter
+func (g *GUI) buildMapTab() fyne.CanvasObject {
+	g.worldMap = newWorldMap()
+	g.mapLegend = widget.NewLabel("")
+	return container.NewBorder(nil, g.mapLegend, nil, nil, g.worldMap)
+}
+
+// updateMap plots the feasible results of the current view, at their city
+// when it is known and at the center of their country otherwise
+func (g *GUI) updateMap() {
+	places := make(map[[2]float64]int)
+	hosts, unplaced := 0, 0
+	g.resultsMu.Lock()
+	for _, i := range g.view {
+		result := g.results[i]
+		if !result.Feasible {
+			continue
+		}
+		hosts++
+		lat, lon := result.Latitude, result.Longitude
+		if lat == 0 && lon == 0 {
+			var ok bool
+			if lat, lon, ok = countryCentroid(result.GeoCode); !ok {
+				unplaced++
+				continue
+			}
+		}
+		// Hosts of the same city share a marker
+		places[[2]float64{math.Round(lat*10) / 10, math.Round(lon*10) / 10}]++
+	}
+	g.resultsMu.Unlock()
+
+	points := make([]mapPoint, 0, len(places))
+	for place, count := range places {
+		points = append(points, mapPoint{lat: place[0], lon: place[1], count: count})
+	}
+	g.worldMap.SetPoints(points)
+	legend := lang.X("map.legend", "{{.Hosts}} feasible hosts in {{.Places}} places",
+		map[string]any{"Hosts": hosts, "Places": len(points)})
+	if unplaced > 0 {
+		legend += ", " + lang.X("map.unplaced", "{{.Count}} without a location", map[string]any{"Count": unplaced})
+	}
+	g.mapLegend.SetText(legend)
+}
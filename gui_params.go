@@ -0,0 +1,358 @@
+//go:build !nogui
+
+package main
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/widget"
+)
+
+// scanParams is a scan as configured in the settings fields. A running scan
+// keeps its own copy, so fields edited meanwhile only apply to the next run.
+type scanParams struct {
+	Source string // label of the selected source, empty for a verify run
+	Input  string
+	Verify bool
+	// Reverify are the results of an earlier scan whose feasible hosts a
+	// verify run re-checks instead of the dest cache
+	Reverify []ScanResult
+	History  bool
+	// Schedule names the schedule that started the run, whose runs are
+	// recorded in the history and compared
+	Schedule string
+	// Exclude is the text of the exclusion list field
+	Exclude string
+	Config  ScanConfig
+}
+
+// entryInt parses a numeric field, an empty field is def
+func entryInt(entry *widget.Entry, def int) (int, error) {
+	s := sanitizeNumericInput(entry.Text)
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// readParams validates the settings fields without changing them
+func (g *GUI) readParams(verify bool) (scanParams, error) {
+	p := scanParams{
+		Verify:  verify,
+		History: g.historyCheck.Checked,
+		Exclude: strings.TrimSpace(g.excludeEntry.Text),
+		Config: ScanConfig{
+			EnableIPv6:      g.ipv6Check.Checked,
+			HappyEyeballs:   g.ipv6Check.Checked && g.happyEyeballsCheck.Checked,
+			Verbose:         g.verboseCheck.Checked,
+			EnableASN:       g.asnCheck.Checked,
+			ProbePQ:         g.pqCheck.Checked,
+			ProbeHTTP:       g.httpCheck.Checked,
+			ServerName:      sanitizeInput(g.sniEntry.Text),
+			NoSNI:           g.noSNICheck.Checked,
+			DualProbe:       g.dualCheck.Checked,
+			TLSDetails:      g.tlsCheck.Checked,
+			DetectCDN:       g.cdnCheck.Checked,
+			SkipCDN:         g.skipCDNCheck.Checked,
+			DetectHoneypots: g.honeypotCheck.Checked,
+			Adaptive:        g.adaptiveCheck.Checked,
+			Shuffle:         g.shuffleCheck.Checked,
+			CheckOCSP:       g.ocspCheck.Checked,
+			ProbeH3:         g.h3Check.Checked,
+			ProbeResumption: g.resumptionCheck.Checked,
+			ProbeHRR:        g.hrrCheck.Checked,
+			DNSMatch:        g.dnsMatchCheck.Checked,
+			GeoCity:         g.cityCheck.Checked,
+			GeoDB:           strings.TrimSpace(g.geoDBEntry.Text),
+			Feasibility:     g.feasibility,
+			Timing:          g.timing(),
+		},
+	}
+	if !verify {
+		p.Source = g.sourceRadio.Selected
+		p.Input = sanitizeInput(g.inputEntry.Text)
+		if p.Input == "" {
+			return p, errors.New(lang.X("error.no_source", "Please specify scan source"))
+		}
+		if p.Source == lang.X("source.toplist", "Top list") {
+			if _, err := ParseRankWindow(p.Input); err != nil {
+				return p, errors.New(lang.X("error.invalid_ranks", "Invalid ranks, enter a window like 1k-100k"))
+			}
+			p.Config.TopList = true
+		}
+	}
+
+	if _, err := p.exclude(); err != nil {
+		return p, errors.New(lang.X("error.invalid_exclude", "Invalid exclusion list: {{.Error}}", map[string]any{"Error": err}))
+	}
+	c := &p.Config
+	if g.subdomainsCheck.Checked {
+		c.Subdomains = DefaultSubdomains
+	}
+	if c.GeoDB != "" {
+		if _, err := os.Stat(c.GeoDB); err != nil {
+			return p, errors.New(lang.X("error.invalid_geo_db", "GeoIP database not found: {{.Path}}", map[string]any{"Path": c.GeoDB}))
+		}
+	}
+	var err error
+	if c.AllowCountries, err = ParseCountries(g.countriesEntry.Text); err != nil {
+		return p, errors.New(lang.X("error.invalid_countries", "Invalid country list: {{.Error}}", map[string]any{"Error": err}))
+	}
+	if c.DNSServers, err = ParseDNSServers(g.dnsEntry.Text); err != nil {
+		return p, errors.New(lang.X("error.invalid_dns", "Invalid DNS servers: {{.Error}}", map[string]any{"Error": err}))
+	}
+	if c.SNIMatrix, err = ParseSNIList(g.sniMatrixEntry.Text); err != nil {
+		return p, errors.New(lang.X("error.invalid_sni_matrix", "Invalid SNI matrix: {{.Error}}", map[string]any{"Error": err}))
+	}
+	if c.ServerName != "" && (c.NoSNI || !ValidateDomainName(c.ServerName)) {
+		return p, errors.New(lang.X("error.invalid_sni", "Invalid SNI, enter a domain or clear the field for no override"))
+	}
+	if c.Port, err = entryInt(g.portEntry, 443); err != nil || c.Port <= 0 || c.Port > 65535 {
+		return p, errors.New(lang.X("error.invalid_port", "Invalid port"))
+	}
+	if c.Thread, err = entryInt(g.threadEntry, 2); err != nil || c.Thread <= 0 {
+		return p, errors.New(lang.X("error.invalid_threads", "Invalid thread count"))
+	}
+	if c.Timeout, err = entryInt(g.timeoutEntry, 10); err != nil || c.Timeout <= 0 {
+		return p, errors.New(lang.X("error.invalid_timeout", "Invalid timeout"))
+	}
+	if g.precheckCheck.Checked {
+		c.PreCheckThreads = c.Thread * preCheckFactor
+		c.PreCheckTimeout = defaultPreCheckTimeout
+	}
+	if c.Retries, err = entryInt(g.retriesEntry, 0); err != nil || c.Retries < 0 {
+		return p, errors.New(lang.X("error.invalid_retries", "Invalid retry count"))
+	}
+	if c.IdleTest, err = entryInt(g.idleEntry, 0); err != nil {
+		return p, errors.New(lang.X("error.invalid_idle", "Invalid idle test duration"))
+	}
+	if c.ExpandPrefix, err = entryInt(g.expandEntry, 0); err != nil ||
+		(c.ExpandPrefix != 0 && (c.ExpandPrefix < 16 || c.ExpandPrefix > 32)) {
+		return p, errors.New(lang.X("error.invalid_expand", "Neighbors prefix must be 0 or between 16 and 32"))
+	}
+	if c.SkipScannedDays, err = entryInt(g.skipDaysEntry, 0); err != nil {
+		return p, errors.New(lang.X("error.invalid_skip_days", "Invalid number of days"))
+	}
+	if c.SpeedTestKB, err = entryInt(g.speedEntry, 0); err != nil || c.SpeedTestKB < 0 {
+		return p, errors.New(lang.X("error.invalid_speedtest", "Invalid speed test size"))
+	}
+	if rate := strings.TrimSpace(g.rateEntry.Text); rate != "" {
+		if c.RateLimit, err = strconv.ParseFloat(rate, 64); err != nil || c.RateLimit < 0 {
+			return p, errors.New(lang.X("error.invalid_rate", "Invalid connection rate"))
+		}
+	}
+	return p, nil
+}
+
+// exclude parses the exclusion list, nil if it is empty
+func (p scanParams) exclude() (*ExcludeList, error) {
+	if p.Exclude == "" {
+		return nil, nil
+	}
+	return ParseExcludeList(strings.NewReader(p.Exclude))
+}
+
+// excludeEntryText joins the entries of an exclusion list file to fit the
+// one line field, dropping comments
+func excludeEntryText(data string) string {
+	var entries []string
+	for _, line := range strings.Split(data, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	return strings.Join(entries, ", ")
+}
+
+// applyParams writes the sanitized values and defaults back to the fields
+func (g *GUI) applyParams(p scanParams) {
+	setText := func(entry *widget.Entry, text string) {
+		if entry.Text != text {
+			entry.SetText(text)
+		}
+	}
+	if !p.Verify {
+		setText(g.inputEntry, p.Input)
+	}
+	setText(g.portEntry, strconv.Itoa(p.Config.Port))
+	setText(g.threadEntry, strconv.Itoa(p.Config.Thread))
+	setText(g.timeoutEntry, strconv.Itoa(p.Config.Timeout))
+	setText(g.retriesEntry, strconv.Itoa(p.Config.Retries))
+	setText(g.idleEntry, strconv.Itoa(p.Config.IdleTest))
+	setText(g.expandEntry, strconv.Itoa(p.Config.ExpandPrefix))
+	setText(g.skipDaysEntry, strconv.Itoa(p.Config.SkipScannedDays))
+	setText(g.rateEntry, strconv.FormatFloat(p.Config.RateLimit, 'g', -1, 64))
+	setText(g.speedEntry, strconv.Itoa(p.Config.SpeedTestKB))
+	setText(g.sniEntry, p.Config.ServerName)
+	setText(g.sniMatrixEntry, strings.Join(p.Config.SNIMatrix, ", "))
+	setText(g.countriesEntry, strings.Join(p.Config.AllowCountries, ", "))
+	setText(g.dnsEntry, strings.Join(p.Config.DNSServers, ", "))
+	g.feasibility = p.Config.Feasibility
+	timing := p.Config.Timing
+	if timing == "" {
+		timing = TimingFast
+	}
+	if i := slices.Index(timingProfiles, timing); i != g.timingSelect.SelectedIndex() {
+		g.timingSelect.SetSelectedIndex(i)
+	}
+}
+
+// timing returns the selected timing profile, "" for the default
+func (g *GUI) timing() string {
+	i := g.timingSelect.SelectedIndex()
+	if i < 0 || timingProfiles[i] == TimingFast {
+		return ""
+	}
+	return timingProfiles[i]
+}
+
+// summary describes the parameters in one line
+func (p scanParams) summary() string {
+	c := p.Config
+	source := lang.X("btn.verify_cache", "Quick verify")
+	if p.Reverify != nil {
+		source = lang.X("running.reverify", "re-verify {{.Count}} hosts",
+			map[string]any{"Count": len(ReverifyHosts(p.Reverify))})
+	} else if !p.Verify {
+		source = p.Source + ": " + p.Input
+	}
+	parts := []string{
+		source,
+		lang.X("running.port", "port {{.Port}}", map[string]any{"Port": c.Port}),
+		lang.X("running.threads", "{{.Count}} threads", map[string]any{"Count": c.Thread}),
+		lang.X("running.timeout", "timeout {{.Seconds}}s", map[string]any{"Seconds": c.Timeout}),
+	}
+	if c.Retries > 0 {
+		parts = append(parts, lang.X("running.retries", "{{.Count}} retries", map[string]any{"Count": c.Retries}))
+	}
+	if c.IdleTest > 0 {
+		parts = append(parts, lang.X("running.idle", "idle test {{.Seconds}}s", map[string]any{"Seconds": c.IdleTest}))
+	}
+	if c.ExpandPrefix > 0 {
+		parts = append(parts, lang.X("running.expand", "neighbors /{{.Bits}}", map[string]any{"Bits": c.ExpandPrefix}))
+	}
+	if c.SkipScannedDays > 0 {
+		parts = append(parts, lang.X("running.skip_days", "skip scanned {{.Days}}d", map[string]any{"Days": c.SkipScannedDays}))
+	}
+	if c.RateLimit > 0 {
+		parts = append(parts, lang.X("running.rate", "{{.Rate}} conn/s", map[string]any{"Rate": c.RateLimit}))
+	}
+	if c.SpeedTestKB > 0 {
+		parts = append(parts, lang.X("running.speedtest", "speed test {{.KB}} KB", map[string]any{"KB": c.SpeedTestKB}))
+	}
+	if exclude, err := p.exclude(); err == nil && exclude != nil {
+		parts = append(parts, lang.X("running.exclude", "{{.Count}} excluded", map[string]any{"Count": exclude.Len()}))
+	}
+	if c.Timing != "" {
+		parts = append(parts, lang.X("running.timing", "{{.Profile}} timing", map[string]any{"Profile": c.Timing}))
+	}
+	if !c.Feasibility.IsDefault() {
+		parts = append(parts, lang.X("running.feasibility", "custom feasibility"))
+	}
+	if len(c.AllowCountries) > 0 {
+		parts = append(parts, lang.X("running.countries", "only {{.Countries}}",
+			map[string]any{"Countries": strings.Join(c.AllowCountries, ", ")}))
+	}
+	if len(c.DNSServers) > 0 {
+		parts = append(parts, lang.X("running.dns", "DNS {{.Servers}}",
+			map[string]any{"Servers": strings.Join(c.DNSServers, ", ")}))
+	}
+	if c.ServerName != "" {
+		parts = append(parts, lang.X("running.sni", "SNI {{.Name}}", map[string]any{"Name": c.ServerName}))
+	}
+	if len(c.SNIMatrix) > 0 {
+		parts = append(parts, lang.X("running.sni_matrix", "SNI matrix of {{.Count}}", map[string]any{"Count": len(c.SNIMatrix)}))
+	}
+	for _, flag := range []struct {
+		on   bool
+		name string
+	}{
+		{c.EnableIPv6, lang.X("settings.ipv6", "IPv6")},
+		{c.HappyEyeballs, lang.X("settings.happy_eyeballs", "Happy Eyeballs")},
+		{c.Verbose, lang.X("settings.verbose", "Verbose")},
+		{c.EnableASN, lang.X("settings.asn", "ASN")},
+		{c.ProbePQ, lang.X("settings.pq", "PQ probe")},
+		{c.ProbeHTTP, lang.X("settings.http", "HTTP probe")},
+		{c.NoSNI, lang.X("settings.no_sni", "No SNI")},
+		{c.DualProbe, lang.X("settings.dual", "Dual SNI probe")},
+		{c.TLSDetails, lang.X("settings.tls_details", "TLS details")},
+		{c.DetectCDN, lang.X("settings.cdn", "Flag CDN")},
+		{c.SkipCDN, lang.X("settings.skip_cdn", "Skip CDN")},
+		{c.DetectHoneypots, lang.X("settings.honeypots", "Skip honeypots")},
+		{c.CheckOCSP, lang.X("settings.ocsp", "OCSP")},
+		{c.ProbeH3, lang.X("settings.h3", "H3 probe")},
+		{c.ProbeResumption, lang.X("settings.resumption", "Resumption")},
+		{c.ProbeHRR, lang.X("settings.hrr", "HRR probe")},
+		{c.DNSMatch, lang.X("settings.dns_match", "DNS match")},
+		{c.GeoCity, lang.X("settings.city", "City map")},
+		{c.Adaptive, lang.X("settings.adaptive", "Adaptive threads")},
+		{c.Shuffle, lang.X("settings.shuffle", "Shuffle CIDRs")},
+		{len(c.Subdomains) > 0 || c.SubdomainCT, lang.X("settings.subdomains", "Subdomains")},
+		{c.PreCheckThreads > 0, lang.X("settings.precheck", "TCP pre-check")},
+		{p.History, lang.X("settings.history", "Save history")},
+	} {
+		if flag.on {
+			parts = append(parts, flag.name)
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// updateRunning shows the parameters of the running scan and whether the
+// fields have been edited since it started
+func (g *GUI) updateRunning() {
+	if g.runningBox == nil {
+		return
+	}
+	if !g.isScanning || g.running == nil {
+		g.runningBox.Hide()
+		return
+	}
+	text := lang.X("running.label", "Running: {{.Params}}", map[string]any{"Params": g.running.summary()})
+	current, err := g.readParams(g.running.Verify)
+	current.Reverify = g.running.Reverify
+	current.Schedule = g.running.Schedule
+	edited := err != nil || !reflect.DeepEqual(current, *g.running)
+	if edited {
+		text += "\n" + lang.X("running.edited", "Edited settings do not affect the running scan")
+	}
+	if g.queued != nil {
+		text += "\n" + lang.X("running.queued", "Next: {{.Params}}", map[string]any{"Params": g.queued.summary()})
+		g.queueBtn.SetText(lang.X("btn.unqueue", "Cancel next run"))
+		g.queueBtn.Enable()
+	} else {
+		g.queueBtn.SetText(lang.X("btn.queue", "Run next"))
+		if edited {
+			g.queueBtn.Enable()
+		} else {
+			g.queueBtn.Disable()
+		}
+	}
+	g.runningLabel.SetText(text)
+	g.runningBox.Show()
+}
+
+// onQueue queues the edited settings to be scanned when the running scan
+// ends, or cancels the queued run
+func (g *GUI) onQueue() {
+	if g.queued != nil {
+		g.queued = nil
+		g.updateRunning()
+		return
+	}
+	p, err := g.readParams(false)
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+	g.queued = &p
+	g.updateRunning()
+}
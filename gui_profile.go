@@ -0,0 +1,200 @@
+//go:build !nogui
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/widget"
+)
+
+// profilesPref is the preference key holding the saved profiles as JSON
+const profilesPref = "profiles"
+
+// scanProfile is a named scan setup saved in the app preferences
+type scanProfile struct {
+	Name string `json:"name"`
+	// Source is the index of the source option, as its label depends on
+	// the language
+	Source   int          `json:"source"`
+	Params   scanParams   `json:"params"`
+	Filename string       `json:"filename"`
+	Filter   resultFilter `json:"filter"`
+}
+
+// profiles returns the saved profiles sorted by name
+func (g *GUI) profiles() []scanProfile {
+	var profiles []scanProfile
+	data := g.app.Preferences().String(profilesPref)
+	if data == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data), &profiles); err != nil {
+		slog.Warn("Cannot read saved profiles", "err", err)
+		return nil
+	}
+	return profiles
+}
+
+func (g *GUI) setProfiles(profiles []scanProfile) {
+	slices.SortFunc(profiles, func(a, b scanProfile) int { return strings.Compare(a.Name, b.Name) })
+	data, err := json.Marshal(profiles)
+	if err != nil {
+		slog.Warn("Cannot save profiles", "err", err)
+		return
+	}
+	g.app.Preferences().SetString(profilesPref, string(data))
+	names := make([]string, 0, len(profiles))
+	for _, profile := range profiles {
+		names = append(names, profile.Name)
+	}
+	g.profileSelect.SetOptions(names)
+}
+
+// buildProfileBar creates the dropdown recalling saved profiles and the
+// buttons saving and deleting them
+func (g *GUI) buildProfileBar() fyne.CanvasObject {
+	g.profileSelect = widget.NewSelect(nil, func(name string) {
+		for _, profile := range g.profiles() {
+			if profile.Name == name {
+				g.loadProfile(profile)
+				return
+			}
+		}
+	})
+	g.profileSelect.PlaceHolder = lang.X("placeholder.profile", "Saved setups")
+	g.setProfiles(g.profiles())
+
+	saveBtn := widget.NewButton(lang.X("btn.save_profile", "Save profile"), g.onSaveProfile)
+	deleteBtn := widget.NewButton(lang.X("btn.delete", "Delete"), func() {
+		name := g.profileSelect.Selected
+		if name == "" {
+			return
+		}
+		dialog.ShowConfirm(lang.X("dialog.delete_profile", "Delete Profile"),
+			lang.X("dialog.delete_profile_msg", "Delete profile \"{{.Name}}\"?", map[string]any{"Name": name}),
+			func(ok bool) {
+				if !ok {
+					return
+				}
+				g.setProfiles(slices.DeleteFunc(g.profiles(), func(p scanProfile) bool { return p.Name == name }))
+				g.profileSelect.ClearSelected()
+			}, g.window)
+	})
+	return container.NewBorder(nil, nil, widget.NewLabel(lang.X("settings.profile", "Profile:")),
+		container.NewHBox(saveBtn, deleteBtn), g.profileSelect)
+}
+
+// currentProfile returns the current settings and filters as an unnamed
+// profile
+func (g *GUI) currentProfile() (scanProfile, error) {
+	p, err := g.readParams(false)
+	if err != nil {
+		return scanProfile{}, err
+	}
+	profile := scanProfile{
+		Source:   slices.Index(g.sourceRadio.Options, p.Source),
+		Params:   p,
+		Filename: strings.TrimSpace(g.filenameEntry.Text),
+	}
+	g.resultsMu.Lock()
+	profile.Filter = g.filter
+	g.resultsMu.Unlock()
+	return profile, nil
+}
+
+// onSaveProfile saves the current settings and filters under a name,
+// replacing a profile of the same name
+func (g *GUI) onSaveProfile() {
+	profile, err := g.currentProfile()
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(g.profileSelect.Selected)
+	nameEntry.Validator = func(s string) error {
+		if strings.TrimSpace(s) == "" {
+			return errors.New(lang.X("error.profile_name", "Enter a profile name"))
+		}
+		return nil
+	}
+	dialog.ShowForm(lang.X("dialog.save_profile", "Save Profile"), lang.X("btn.save", "Save"),
+		lang.X("btn.cancel", "Cancel"),
+		[]*widget.FormItem{widget.NewFormItem(lang.X("profile.name", "Name:"), nameEntry)},
+		func(ok bool) {
+			if !ok {
+				return
+			}
+			profile.Name = strings.TrimSpace(nameEntry.Text)
+			profiles := slices.DeleteFunc(g.profiles(), func(p scanProfile) bool { return p.Name == profile.Name })
+			g.setProfiles(append(profiles, profile))
+			g.profileSelect.SetSelected(profile.Name)
+		}, g.window)
+}
+
+// loadProfile fills the settings fields and the filter bar from profile
+func (g *GUI) loadProfile(profile scanProfile) {
+	p := profile.Params
+	if profile.Source >= 0 && profile.Source < len(g.sourceRadio.Options) {
+		g.sourceRadio.SetSelected(g.sourceRadio.Options[profile.Source])
+	}
+	c := p.Config
+	for _, check := range []struct {
+		check *widget.Check
+		on    bool
+	}{
+		{g.ipv6Check, c.EnableIPv6},
+		{g.happyEyeballsCheck, c.HappyEyeballs},
+		{g.verboseCheck, c.Verbose},
+		{g.asnCheck, c.EnableASN},
+		{g.pqCheck, c.ProbePQ},
+		{g.httpCheck, c.ProbeHTTP},
+		{g.noSNICheck, c.NoSNI},
+		{g.dualCheck, c.DualProbe},
+		{g.tlsCheck, c.TLSDetails},
+		{g.cdnCheck, c.DetectCDN},
+		{g.skipCDNCheck, c.SkipCDN},
+		{g.honeypotCheck, c.DetectHoneypots},
+		{g.ocspCheck, c.CheckOCSP},
+		{g.h3Check, c.ProbeH3},
+		{g.resumptionCheck, c.ProbeResumption},
+		{g.hrrCheck, c.ProbeHRR},
+		{g.dnsMatchCheck, c.DNSMatch},
+		{g.cityCheck, c.GeoCity},
+		{g.adaptiveCheck, c.Adaptive},
+		{g.shuffleCheck, c.Shuffle},
+		{g.subdomainsCheck, len(c.Subdomains) > 0},
+		{g.precheckCheck, c.PreCheckThreads > 0},
+		{g.historyCheck, p.History},
+	} {
+		check.check.SetChecked(check.on)
+	}
+	g.excludeEntry.SetText(p.Exclude)
+	g.geoDBEntry.SetText(c.GeoDB)
+	if profile.Filename != "" {
+		g.filenameEntry.SetText(profile.Filename)
+	}
+	g.applyParams(p)
+
+	g.filterEntry.SetText(profile.Filter.Text)
+	g.feasibleFilter.SetChecked(profile.Filter.FeasibleOnly)
+	geo := profile.Filter.Geo
+	if geo == "" {
+		geo = g.geoFilter.Options[0]
+	} else if !slices.Contains(g.geoFilter.Options, geo) {
+		// Keep the country selected until results from it come in
+		g.geoFilter.Options = append(g.geoFilter.Options, geo)
+	}
+	g.geoFilter.SetSelected(geo)
+	g.statusText.Set(lang.X("status.profile_loaded", "Loaded profile: {{.Name}}", map[string]any{"Name": profile.Name}))
+}
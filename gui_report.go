@@ -0,0 +1,46 @@
+//go:build !nogui
+
+package main
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// showReport shows the summary of a finished scan with a button saving it
+// as Markdown or HTML
+func (g *GUI) showReport(report ScanReport) {
+	text := widget.NewLabel(report.Text())
+	text.TextStyle = fyne.TextStyle{Monospace: true}
+	text.Selectable = true
+
+	saveBtn := widget.NewButton(lang.X("btn.save_report", "Save report"), func() {
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, g.window)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+			if _, err := writer.Write([]byte(report.Render(writer.URI().Path()))); err != nil {
+				dialog.ShowError(err, g.window)
+			}
+		}, g.window)
+		fileDialog.SetFileName("report_" + report.Started.Format("2006-01-02_15-04") + ".md")
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".md", ".html"}))
+		fileDialog.Show()
+	})
+
+	content := container.NewBorder(nil, container.NewHBox(layout.NewSpacer(), saveBtn), nil, nil,
+		container.NewScroll(text))
+	d := dialog.NewCustom(lang.X("report.title", "Scan report"), lang.X("btn.close", "Close"), content, g.window)
+	d.Resize(fyne.NewSize(600, 500))
+	d.Show()
+}
@@ -0,0 +1,98 @@
+//go:build !nogui
+
+package main
+
+import (
+	neturl "net/url"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/widget"
+)
+
+// resultCell is a cell of the results table opening the menu of its row on
+// a right click. Left clicks go through to the table.
+type resultCell struct {
+	widget.Label
+	gui *GUI
+	row int
+}
+
+func newResultCell(g *GUI) *resultCell {
+	cell := &resultCell{gui: g}
+	cell.Text = "Cell"
+	cell.SizeName = sizeNameTableText
+	cell.ExtendBaseWidget(cell)
+	return cell
+}
+
+// TappedSecondary opens the row menu, the header row has none
+func (c *resultCell) TappedSecondary(ev *fyne.PointEvent) {
+	if c.row > 0 {
+		c.gui.showRowMenu(c.row, ev.AbsolutePosition)
+	}
+}
+
+// showRowMenu opens the menu of the result in row of the table at pos
+func (g *GUI) showRowMenu(row int, pos fyne.Position) {
+	g.resultsMu.Lock()
+	result, ok := g.viewResult(row)
+	g.resultsMu.Unlock()
+	if !ok {
+		return
+	}
+	copyItem := func(label, text string) *fyne.MenuItem {
+		item := fyne.NewMenuItem(label, func() { g.copyText(text) })
+		item.Disabled = text == ""
+		return item
+	}
+	csvRow := strings.TrimSuffix(csvLine(result, resultsConfig([]ScanResult{result})), "\n")
+	menu := fyne.NewMenu("",
+		copyItem(lang.X("menu.copy_ip", "Copy IP"), result.IP),
+		copyItem(lang.X("menu.copy_domain", "Copy domain"), result.Domain),
+		copyItem(lang.X("menu.copy_csv", "Copy row as CSV"), csvRow),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem(lang.X("menu.open_browser", "Open in browser"), func() {
+			if err := g.app.OpenURL(&neturl.URL{Scheme: "https", Host: xrayDest(result)}); err != nil {
+				dialog.ShowError(err, g.window)
+			}
+		}),
+		fyne.NewMenuItem(lang.X("menu.xray_config", "Generate Reality config"), func() {
+			g.selected = &result
+			g.xrayBtn.Enable()
+			g.onXrayConfig()
+		}),
+	)
+	widget.ShowPopUpMenuAtPosition(menu, g.window.Canvas(), pos)
+}
+
+// copyText puts text on the clipboard and tells so in the status bar for a
+// moment
+func (g *GUI) copyText(text string) {
+	g.window.Clipboard().SetContent(text)
+	g.flashStatus(lang.X("status.copied", "Copied: {{.Text}}", map[string]any{"Text": text}))
+}
+
+// copyRows puts count rows of text on the clipboard, telling how many
+// instead of showing them
+func (g *GUI) copyRows(text string, count int) {
+	g.window.Clipboard().SetContent(text)
+	g.flashStatus(lang.X("status.copied_rows", "Copied {{.Count}} rows", map[string]any{"Count": count}))
+}
+
+// flashStatus shows status in the status bar for a moment
+func (g *GUI) flashStatus(status string) {
+	oldStatus, _ := g.statusText.Get()
+	g.statusText.Set(status)
+	time.AfterFunc(2*time.Second, func() {
+		fyne.Do(func() {
+			// Keep statuses set in the meantime
+			if current, _ := g.statusText.Get(); current == status {
+				g.statusText.Set(oldStatus)
+			}
+		})
+	})
+}
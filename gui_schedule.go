@@ -0,0 +1,193 @@
+//go:build !nogui
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// schedulesPref is the preference key holding the schedules as JSON
+const schedulesPref = "schedules"
+
+// guiSchedule runs a saved profile on a cron expression while the app is
+// open, in the window or the tray
+type guiSchedule struct {
+	Profile string `json:"profile"`
+	Cron    string `json:"cron"`
+}
+
+// schedules returns the saved schedules
+func (g *GUI) schedules() []guiSchedule {
+	var schedules []guiSchedule
+	data := g.app.Preferences().String(schedulesPref)
+	if data == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(data), &schedules); err != nil {
+		slog.Warn("Cannot read saved schedules", "err", err)
+		return nil
+	}
+	return schedules
+}
+
+func (g *GUI) setSchedules(schedules []guiSchedule) {
+	data, err := json.Marshal(schedules)
+	if err != nil {
+		slog.Warn("Cannot save schedules", "err", err)
+		return
+	}
+	g.app.Preferences().SetString(schedulesPref, string(data))
+}
+
+// startScheduler runs the saved schedules until the app quits
+func (g *GUI) startScheduler() {
+	g.scheduler = NewScheduler(context.Background(), func(name string) {
+		fyne.Do(func() { g.runSchedule(name) })
+	})
+	for _, schedule := range g.schedules() {
+		if err := g.scheduler.Add(schedule.Profile, schedule.Cron); err != nil {
+			slog.Warn("Invalid schedule", "profile", schedule.Profile, "err", err)
+		}
+	}
+}
+
+// runSchedule scans the profile name, recording the run in the history
+// tagged with the name. A running scan is followed by it, unless another
+// run is already queued.
+func (g *GUI) runSchedule(name string) {
+	i := slices.IndexFunc(g.profiles(), func(p scanProfile) bool { return p.Name == name })
+	if i < 0 {
+		slog.Warn("Scheduled profile no longer exists", "profile", name)
+		return
+	}
+	profile := g.profiles()[i]
+	if g.isScanning {
+		if g.queued != nil {
+			g.appendLog("warn", lang.X("log.schedule_skipped", "Skipped scheduled run of {{.Name}}, another run is queued",
+				map[string]any{"Name": name}))
+			return
+		}
+		p := profile.Params
+		if profile.Source >= 0 && profile.Source < len(g.sourceRadio.Options) {
+			p.Source = g.sourceRadio.Options[profile.Source]
+		}
+		p.Verify = false
+		p.Schedule = name
+		g.queued = &p
+		g.updateRunning()
+		return
+	}
+	g.profileSelect.SetSelected(name)
+	p, err := g.readParams(false)
+	if err != nil {
+		g.appendLog("error", err.Error())
+		return
+	}
+	p.Schedule = name
+	g.launch(p)
+}
+
+// notifyScheduleChanges reports what a finished scheduled run found
+// differently from the last run of its schedule. Called from the scan.
+func (g *GUI) notifyScheduleChanges(name string, session *Session) {
+	diff, err := scheduleDiff(session.store, name, session)
+	if err != nil {
+		g.appendLog("error", fmt.Sprintf("Cannot compare scheduled scan with its last run: %v", err))
+		return
+	}
+	if diff == nil || diff.Empty() {
+		return
+	}
+	text := lang.X("notify.schedule_changes", "{{.Added}} newly feasible, {{.Removed}} disappeared, {{.Changed}} changed certificate",
+		map[string]any{"Added": len(diff.Added), "Removed": len(diff.Removed), "Changed": len(diff.Changed)})
+	g.appendLog("info", name+": "+text)
+	fyne.Do(func() {
+		g.app.SendNotification(fyne.NewNotification(
+			lang.X("notify.schedule", "Scheduled scan {{.Name}} changed", map[string]any{"Name": name}), text))
+	})
+}
+
+// onSchedules lists the schedules with their next runs, and adds and
+// removes them
+func (g *GUI) onSchedules() {
+	schedules := g.schedules()
+	nextRun := func(profile string) string {
+		for _, status := range g.scheduler.Status() {
+			if status.Name == profile && !status.Next.IsZero() {
+				return status.Next.Format(time.DateTime)
+			}
+		}
+		return "-"
+	}
+
+	var list *widget.List
+	list = widget.NewList(
+		func() int { return len(schedules) },
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, nil, widget.NewButtonWithIcon("", theme.DeleteIcon(), nil),
+				widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			row := item.(*fyne.Container)
+			s := schedules[id]
+			row.Objects[0].(*widget.Label).SetText(lang.X("schedule.row", "{{.Profile}}  {{.Cron}}  next: {{.Next}}",
+				map[string]any{"Profile": s.Profile, "Cron": s.Cron, "Next": nextRun(s.Profile)}))
+			row.Objects[1].(*widget.Button).OnTapped = func() {
+				g.scheduler.Remove(s.Profile)
+				schedules = slices.DeleteFunc(schedules, func(other guiSchedule) bool { return other.Profile == s.Profile })
+				g.setSchedules(schedules)
+				list.Refresh()
+			}
+		},
+	)
+
+	var names []string
+	for _, profile := range g.profiles() {
+		names = append(names, profile.Name)
+	}
+	profileSelect := widget.NewSelect(names, nil)
+	profileSelect.PlaceHolder = lang.X("placeholder.profile", "Saved setups")
+	cronEntry := widget.NewEntry()
+	cronEntry.SetPlaceHolder("0 3 * * *")
+	addBtn := widget.NewButton(lang.X("btn.add", "Add"), func() {
+		if profileSelect.Selected == "" {
+			dialog.ShowError(errors.New(lang.X("error.schedule_profile", "Pick a saved profile to schedule")), g.window)
+			return
+		}
+		schedule := guiSchedule{Profile: profileSelect.Selected, Cron: strings.TrimSpace(cronEntry.Text)}
+		if err := g.scheduler.Add(schedule.Profile, schedule.Cron); err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		schedules = append(slices.DeleteFunc(schedules, func(s guiSchedule) bool { return s.Profile == schedule.Profile }), schedule)
+		g.setSchedules(schedules)
+		cronEntry.SetText("")
+		list.Refresh()
+	})
+
+	help := widget.NewLabel(lang.X("schedule.help",
+		"Scans a saved profile while the app runs, also in the tray. Cron fields: minute hour day month weekday, "+
+			"e.g. \"0 3 * * *\" daily at 03:00, or @hourly, @daily, @every 6h. Runs are saved to the history "+
+			"and changes since the last run are notified."))
+	help.Wrapping = fyne.TextWrapWord
+	form := container.NewBorder(nil, nil, nil, addBtn,
+		container.NewGridWithColumns(2, profileSelect, cronEntry))
+	content := container.NewBorder(container.NewVBox(help, form), nil, nil, nil, list)
+	d := dialog.NewCustom(lang.X("dialog.schedules", "Schedules"), lang.X("btn.close", "Close"), content, g.window)
+	d.Resize(fyne.NewSize(560, 420))
+	d.Show()
+}
@@ -0,0 +1,186 @@
+//go:build !nogui
+
+package main
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// checkboxColumnWidth is the width of the checkbox column of the results
+// table
+const checkboxColumnWidth = 36
+
+// checkboxText is the checkbox shown in row of the table, the one of the
+// header is ticked when every shown row is. resultsMu must be held.
+func (g *GUI) checkboxText(row int) string {
+	on := len(g.view) > 0
+	if row == 0 {
+		for i := range g.view {
+			if result, _ := g.viewResult(i + 1); !g.checked[resultKey(result)] {
+				on = false
+				break
+			}
+		}
+	} else if result, ok := g.viewResult(row); ok {
+		on = g.checked[resultKey(result)]
+	}
+	if on {
+		return "☑"
+	}
+	return "☐"
+}
+
+// toggleChecked ticks or unticks the result in row of the table, the
+// header row ticks all shown results or unticks them when all are ticked
+func (g *GUI) toggleChecked(row int) {
+	g.resultsMu.Lock()
+	if g.checked == nil {
+		g.checked = make(map[string]bool)
+	}
+	if row == 0 {
+		on := g.checkboxText(0) != "☑"
+		for i := range g.view {
+			result, _ := g.viewResult(i + 1)
+			if on {
+				g.checked[resultKey(result)] = true
+			} else {
+				delete(g.checked, resultKey(result))
+			}
+		}
+	} else if result, ok := g.viewResult(row); ok {
+		key := resultKey(result)
+		if g.checked[key] {
+			delete(g.checked, key)
+		} else {
+			g.checked[key] = true
+		}
+	}
+	g.resultsMu.Unlock()
+	g.updateSelection()
+	g.resultsTable.Refresh()
+}
+
+// checkedResults returns the ticked results in table order, with the
+// feasibility policy applied like exportResults. resultsMu must be held.
+func (g *GUI) checkedResults() []ScanResult {
+	var results []ScanResult
+	for _, result := range g.exportResults() {
+		if g.checked[resultKey(result)] {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// updateSelection shows how many results are ticked on the selection
+// button, it must run on the UI goroutine
+func (g *GUI) updateSelection() {
+	// Ticks are only kept for results of the table, they are dropped with
+	// them in setResults
+	g.resultsMu.Lock()
+	count := len(g.checked)
+	g.resultsMu.Unlock()
+	g.selectionBtn.SetText(lang.X("select.count", "{{.Count}} selected", map[string]any{"Count": count}))
+	if count == 0 {
+		g.selectionBtn.Disable()
+	} else {
+		g.selectionBtn.Enable()
+	}
+}
+
+// showSelectionMenu opens the actions on the ticked results below the
+// selection button
+func (g *GUI) showSelectionMenu() {
+	g.resultsMu.Lock()
+	results := g.checkedResults()
+	g.resultsMu.Unlock()
+	if len(results) == 0 {
+		return
+	}
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem(lang.X("menu.copy_selected_csv", "Copy as CSV"), func() {
+			g.copyRows(resultsCSV(results), len(results))
+		}),
+		fyne.NewMenuItem(lang.X("menu.save_selected_csv", "Save as CSV..."), func() { g.saveCheckedCSV(results) }),
+		fyne.NewMenuItem(lang.X("menu.save_xray_bundle", "Save Xray configs..."), func() { g.saveXrayBundle(results) }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem(lang.X("menu.clear_selection", "Clear selection"), func() {
+			g.resultsMu.Lock()
+			g.checked = nil
+			g.resultsMu.Unlock()
+			g.updateSelection()
+			g.resultsTable.Refresh()
+		}),
+	)
+	pos := fyne.CurrentApp().Driver().AbsolutePositionForObject(g.selectionBtn)
+	widget.ShowPopUpMenuAtPosition(menu, g.window.Canvas(), pos.AddXY(0, g.selectionBtn.Size().Height))
+}
+
+// resultsCSV renders results as a CSV file with the columns they fill
+func resultsCSV(results []ScanResult) string {
+	config := resultsConfig(results)
+	var b strings.Builder
+	b.WriteString(csvHeader(config))
+	for _, result := range results {
+		b.WriteString(csvLine(result, config))
+	}
+	return b.String()
+}
+
+// saveCheckedCSV saves the ticked results to a CSV file, feasible or not
+func (g *GUI) saveCheckedCSV(results []ScanResult) {
+	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		if _, err := writer.Write([]byte(resultsCSV(results))); err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		dialog.ShowInformation(lang.X("dialog.saved", "Saved"),
+			lang.X("dialog.saved_selected_msg", "Saved {{.Count}} selected results", map[string]any{"Count": len(results)}), g.window)
+	}, g.window)
+	fileDialog.SetFileName(g.defaultFilename("_selected.csv"))
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".csv"}))
+	fileDialog.Show()
+}
+
+// saveXrayBundle saves a zip of Xray Reality configs, one per ticked
+// result
+func (g *GUI) saveXrayBundle(results []ScanResult) {
+	data, err := XrayBundle(results)
+	if err != nil {
+		dialog.ShowError(err, g.window)
+		return
+	}
+	fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		if _, err := writer.Write(data); err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		dialog.ShowInformation(lang.X("dialog.saved", "Saved"),
+			lang.X("dialog.saved_xray_bundle_msg", "Saved Xray configs for {{.Count}} dests", map[string]any{"Count": len(results)}), g.window)
+	}, g.window)
+	fileDialog.SetFileName(g.defaultFilename("_xray.zip"))
+	fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".zip"}))
+	fileDialog.Show()
+}
@@ -0,0 +1,122 @@
+//go:build !nogui
+
+package main
+
+import (
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+)
+
+// onShareLinks builds vless:// links for the selected result, or for all
+// feasible results when none is selected. The server parameters are kept
+// in the app preferences.
+func (g *GUI) onShareLinks() {
+	var results []ScanResult
+	if g.selected != nil {
+		results = []ScanResult{*g.selected}
+	} else {
+		g.resultsMu.Lock()
+		for _, result := range g.exportResults() {
+			if result.Feasible {
+				results = append(results, result)
+			}
+		}
+		g.resultsMu.Unlock()
+	}
+	if len(results) == 0 {
+		dialog.ShowInformation(lang.X("dialog.no_results", "No Results"),
+			lang.X("dialog.no_results_msg", "No results to save"), g.window)
+		return
+	}
+
+	prefs := g.app.Preferences()
+	uuidEntry := widget.NewEntry()
+	uuidEntry.SetText(prefs.String("share.uuid"))
+	serverEntry := widget.NewEntry()
+	serverEntry.SetText(prefs.String("share.server"))
+	portEntry := widget.NewEntry()
+	portEntry.SetText(strconv.Itoa(prefs.IntWithFallback("share.port", 443)))
+	keyEntry := widget.NewEntry()
+	keyEntry.SetText(prefs.String("share.public_key"))
+	sidEntry := widget.NewEntry()
+	sidEntry.SetText(prefs.String("share.short_id"))
+	base64Check := widget.NewCheck(lang.X("share.base64", "Base64 subscription"), nil)
+
+	linksEntry := widget.NewMultiLineEntry()
+	linksEntry.Wrapping = fyne.TextWrapBreak
+	linksEntry.SetMinRowsVisible(10)
+
+	params := func() (ShareParams, error) {
+		port, _ := strconv.Atoi(sanitizeNumericInput(portEntry.Text))
+		p := ShareParams{
+			UUID:      sanitizeInput(uuidEntry.Text),
+			Server:    sanitizeInput(serverEntry.Text),
+			Port:      port,
+			PublicKey: sanitizeInput(keyEntry.Text),
+			ShortID:   sanitizeInput(sidEntry.Text),
+		}
+		return p, p.Validate()
+	}
+	generate := func() {
+		p, err := params()
+		if err != nil {
+			dialog.ShowError(err, g.window)
+			return
+		}
+		prefs.SetString("share.uuid", p.UUID)
+		prefs.SetString("share.server", p.Server)
+		prefs.SetInt("share.port", p.Port)
+		prefs.SetString("share.public_key", p.PublicKey)
+		prefs.SetString("share.short_id", p.ShortID)
+		linksEntry.SetText(ShareSubscription(results, p, base64Check.Checked))
+	}
+
+	form := container.New(layout.NewFormLayout(),
+		widget.NewLabel(lang.X("share.uuid", "UUID:")), uuidEntry,
+		widget.NewLabel(lang.X("share.server", "Server:")), serverEntry,
+		widget.NewLabel(lang.X("share.port", "Server port:")), portEntry,
+		widget.NewLabel(lang.X("share.public_key", "Public key:")), keyEntry,
+		widget.NewLabel(lang.X("share.short_id", "Short ID:")), sidEntry,
+	)
+	generateBtn := widget.NewButton(lang.X("btn.generate", "Generate"), generate)
+	copyBtn := widget.NewButton(lang.X("btn.copy", "Copy"), func() {
+		g.window.Clipboard().SetContent(linksEntry.Text)
+	})
+	saveBtn := widget.NewButton(lang.X("btn.save", "Save"), func() {
+		fileDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, g.window)
+				return
+			}
+			if writer == nil {
+				return
+			}
+			defer writer.Close()
+			_, _ = writer.Write([]byte(linksEntry.Text))
+		}, g.window)
+		fileDialog.SetFileName(g.defaultFilename(".txt"))
+		fileDialog.SetFilter(storage.NewExtensionFileFilter([]string{".txt"}))
+		fileDialog.Show()
+	})
+
+	content := container.NewBorder(
+		container.NewVBox(form, base64Check),
+		container.NewHBox(layout.NewSpacer(), generateBtn, copyBtn, saveBtn),
+		nil, nil,
+		linksEntry,
+	)
+	d := dialog.NewCustom(lang.X("dialog.share_title", "Share links: {{.Count}} dests", map[string]any{"Count": len(results)}),
+		lang.X("btn.close", "Close"), content, g.window)
+	d.Resize(fyne.NewSize(700, 560))
+	d.Show()
+	if _, err := params(); err == nil {
+		generate()
+	}
+}
@@ -0,0 +1,131 @@
+//go:build !nogui
+
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Preference keys and values of the appearance settings
+const (
+	themePref         = "theme"
+	tableTextSizePref = "table_text_size"
+	themeSystem       = "system"
+	themeLight        = "light"
+	themeDark         = "dark"
+	minTableTextSize  = 9
+	maxTableTextSize  = 20
+	sizeNameTableText = fyne.ThemeSizeName("tableText")
+)
+
+// appTheme is the default theme in the chosen variant, following the
+// system when none is chosen, with its own text size for the results table
+type appTheme struct {
+	fyne.Theme
+	mode      string
+	tableText float32
+}
+
+func (t *appTheme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant) color.Color {
+	switch t.mode {
+	case themeLight:
+		variant = theme.VariantLight
+	case themeDark:
+		variant = theme.VariantDark
+	}
+	return t.Theme.Color(name, variant)
+}
+
+func (t *appTheme) Size(name fyne.ThemeSizeName) float32 {
+	if name == sizeNameTableText {
+		return t.tableText
+	}
+	return t.Theme.Size(name)
+}
+
+// applyAppearance sets the theme saved in the preferences
+func (g *GUI) applyAppearance() {
+	prefs := g.app.Preferences()
+	size := prefs.FloatWithFallback(tableTextSizePref, float64(theme.DefaultTheme().Size(theme.SizeNameText)))
+	g.app.Settings().SetTheme(&appTheme{
+		Theme:     theme.DefaultTheme(),
+		mode:      prefs.StringWithFallback(themePref, themeSystem),
+		tableText: float32(size),
+	})
+	if g.resultsTable != nil {
+		g.resultsTable.Refresh()
+	}
+}
+
+// showAppearance opens the theme and table text size settings, applied
+// and saved as they are changed
+func (g *GUI) showAppearance() {
+	prefs := g.app.Preferences()
+	modes := []string{themeSystem, themeLight, themeDark}
+	themeSelect := widget.NewSelect([]string{
+		lang.X("appearance.system", "System"),
+		lang.X("appearance.light", "Light"),
+		lang.X("appearance.dark", "Dark"),
+	}, nil)
+	for i, mode := range modes {
+		if mode == prefs.StringWithFallback(themePref, themeSystem) {
+			themeSelect.SetSelectedIndex(i)
+		}
+	}
+	themeSelect.OnChanged = func(string) {
+		prefs.SetString(themePref, modes[themeSelect.SelectedIndex()])
+		g.applyAppearance()
+	}
+
+	sizeLabel := widget.NewLabel("")
+	sizeSlider := widget.NewSlider(minTableTextSize, maxTableTextSize)
+	sizeSlider.SetValue(prefs.FloatWithFallback(tableTextSizePref, float64(theme.DefaultTheme().Size(theme.SizeNameText))))
+	sizeLabel.SetText(fmt.Sprintf("%.0f", sizeSlider.Value))
+	sizeSlider.OnChangeEnded = func(value float64) {
+		prefs.SetFloat(tableTextSizePref, value)
+		g.applyAppearance()
+	}
+	sizeSlider.OnChanged = func(value float64) {
+		sizeLabel.SetText(fmt.Sprintf("%.0f", value))
+	}
+
+	// The language is applied on closing, as switching rebuilds the window
+	languages := []string{lang.X("appearance.system", "System")}
+	for _, l := range uiLanguages {
+		languages = append(languages, l.name)
+	}
+	languageSelect := widget.NewSelect(languages, nil)
+	languageSelect.SetSelectedIndex(0)
+	for i, l := range uiLanguages {
+		if l.code == prefs.String(languagePref) {
+			languageSelect.SetSelectedIndex(i + 1)
+		}
+	}
+
+	form := widget.NewForm(
+		widget.NewFormItem(lang.X("settings.language", "Language:"), languageSelect),
+		widget.NewFormItem(lang.X("appearance.theme", "Theme:"), themeSelect),
+		widget.NewFormItem(lang.X("appearance.table_text", "Table text size:"),
+			container.NewBorder(nil, nil, nil, sizeLabel, sizeSlider)),
+	)
+	d := dialog.NewCustom(lang.X("dialog.appearance", "Appearance"), lang.X("btn.close", "Close"), form, g.window)
+	d.SetOnClosed(func() {
+		code := ""
+		if i := languageSelect.SelectedIndex(); i > 0 {
+			code = uiLanguages[i-1].code
+		}
+		if code != prefs.String(languagePref) {
+			g.onLanguage(code)
+		}
+	})
+	d.Resize(fyne.NewSize(400, 0))
+	d.Show()
+}
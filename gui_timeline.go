@@ -0,0 +1,186 @@
+//go:build !nogui
+
+package main
+
+import (
+	"image/color"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// timelineHeight is the height of the phase strip
+const timelineHeight = 22
+
+type timelineSpan struct {
+	phase ScanPhase
+	start time.Time
+	end   time.Time // zero while the phase is running
+}
+
+// Timeline is a strip visualizing the scan phases over time with markers
+// for notable events such as stops and error spikes
+type Timeline struct {
+	widget.BaseWidget
+
+	mu    sync.Mutex
+	spans []timelineSpan
+	marks []ScanEvent
+}
+
+func newTimeline() *Timeline {
+	t := &Timeline{}
+	t.ExtendBaseWidget(t)
+	return t
+}
+
+// Reset clears the timeline for a new scan
+func (t *Timeline) Reset() {
+	t.mu.Lock()
+	t.spans = nil
+	t.marks = nil
+	t.mu.Unlock()
+	t.Refresh()
+}
+
+// Add records an event from the scanner event log
+func (t *Timeline) Add(e ScanEvent) {
+	t.mu.Lock()
+	if e.Kind == EventPhase {
+		if n := len(t.spans); n > 0 && t.spans[n-1].end.IsZero() {
+			t.spans[n-1].end = e.Time
+		}
+		if e.Phase != PhaseDone {
+			t.spans = append(t.spans, timelineSpan{phase: e.Phase, start: e.Time})
+		}
+	} else {
+		t.marks = append(t.marks, e)
+	}
+	t.mu.Unlock()
+	t.Refresh()
+}
+
+func (t *Timeline) CreateRenderer() fyne.WidgetRenderer {
+	r := &timelineRenderer{timeline: t}
+	r.background = canvas.NewRectangle(theme.Color(theme.ColorNameInputBackground))
+	r.rebuild()
+	return r
+}
+
+type timelineRenderer struct {
+	timeline   *Timeline
+	background *canvas.Rectangle
+	objects    []fyne.CanvasObject
+}
+
+// phaseColor returns the fill color of a phase segment
+func phaseColor(phase ScanPhase) color.Color {
+	switch phase {
+	case PhaseInit:
+		return theme.Color(theme.ColorNameDisabled)
+	case PhaseGeoUpdate:
+		return color.NRGBA{R: 0x8e, G: 0x6c, B: 0xd8, A: 0xff}
+	case PhaseResolving:
+		return theme.Color(theme.ColorNameWarning)
+	case PhaseScanning:
+		return theme.Color(theme.ColorNamePrimary)
+	case PhasePaused:
+		return theme.Color(theme.ColorNamePlaceHolder)
+	case PhaseFinishing:
+		return theme.Color(theme.ColorNameSuccess)
+	default:
+		return theme.Color(theme.ColorNameForeground)
+	}
+}
+
+// rebuild recreates the canvas objects for the current spans and marks
+func (r *timelineRenderer) rebuild() {
+	t := r.timeline
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r.objects = []fyne.CanvasObject{r.background}
+	for _, span := range t.spans {
+		rect := canvas.NewRectangle(phaseColor(span.phase))
+		label := canvas.NewText(string(span.phase), theme.Color(theme.ColorNameBackground))
+		label.TextSize = theme.CaptionTextSize()
+		r.objects = append(r.objects, rect, label)
+	}
+	for _, mark := range t.marks {
+		c := theme.Color(theme.ColorNameError)
+		if mark.Kind == EventStopped {
+			c = theme.Color(theme.ColorNameForeground)
+		}
+		line := canvas.NewLine(c)
+		line.StrokeWidth = 2
+		r.objects = append(r.objects, line)
+	}
+}
+
+func (r *timelineRenderer) Layout(size fyne.Size) {
+	t := r.timeline
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r.background.Resize(size)
+	// Objects are out of date until the next Refresh
+	if len(t.spans) == 0 || len(r.objects) != 1+2*len(t.spans)+len(t.marks) {
+		return
+	}
+	start := t.spans[0].start
+	end := time.Now()
+	if last := t.spans[len(t.spans)-1]; !last.end.IsZero() {
+		end = last.end
+	}
+	total := end.Sub(start)
+	if total <= 0 {
+		total = time.Millisecond
+	}
+	pos := func(at time.Time) float32 {
+		return float32(at.Sub(start)) / float32(total) * size.Width
+	}
+
+	i := 1
+	for _, span := range t.spans {
+		spanEnd := span.end
+		if spanEnd.IsZero() {
+			spanEnd = end
+		}
+		x0, x1 := pos(span.start), pos(spanEnd)
+		rect := r.objects[i].(*canvas.Rectangle)
+		rect.Move(fyne.NewPos(x0, 0))
+		rect.Resize(fyne.NewSize(x1-x0, size.Height))
+		label := r.objects[i+1].(*canvas.Text)
+		// Only label segments wide enough to hold the text
+		label.Hidden = label.MinSize().Width > x1-x0
+		label.Move(fyne.NewPos(x0+2, (size.Height-label.MinSize().Height)/2))
+		i += 2
+	}
+	for _, mark := range t.marks {
+		x := pos(mark.Time)
+		line := r.objects[i].(*canvas.Line)
+		line.Position1 = fyne.NewPos(x, 0)
+		line.Position2 = fyne.NewPos(x, size.Height)
+		i++
+	}
+}
+
+func (r *timelineRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(100, timelineHeight)
+}
+
+func (r *timelineRenderer) Refresh() {
+	r.rebuild()
+	r.Layout(r.timeline.Size())
+	canvas.Refresh(r.timeline)
+}
+
+func (r *timelineRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *timelineRenderer) Destroy() {}
@@ -0,0 +1,175 @@
+//go:build !nogui
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/lang"
+)
+
+// closeToTrayPref is the preference key of closing the window to the tray
+const closeToTrayPref = "close_to_tray"
+
+// Notifications of feasible hosts found while the window is in the tray are
+// sent at most once per trayNotifyInterval, naming up to trayNotifyHosts hosts
+const (
+	trayNotifyInterval = 10 * time.Second
+	trayNotifyHosts    = 3
+)
+
+// trayState is the tray menu and the feasible hosts waiting to be notified.
+// It is only used from the UI goroutine.
+type trayState struct {
+	menu   *fyne.Menu
+	status *fyne.MenuItem
+	stop   *fyne.MenuItem
+	// hidden is set while the window is in the tray
+	hidden     bool
+	pending    []string
+	timer      *time.Timer
+	lastNotify time.Time
+}
+
+// setupTray adds the tray icon on desktops that have one, returning false
+// when there is none
+func (g *GUI) setupTray() bool {
+	desk, ok := g.app.(desktop.App)
+	if !ok {
+		return false
+	}
+	g.tray.status = fyne.NewMenuItem(lang.X("status.ready", "Ready to scan"), nil)
+	g.tray.status.Disabled = true
+	g.tray.stop = fyne.NewMenuItem(lang.X("tray.stop", "Stop scan"), g.onStop)
+	g.tray.stop.Disabled = true
+	quit := fyne.NewMenuItem(lang.X("menu.quit", "Quit"), g.quit)
+	quit.IsQuit = true
+	g.tray.menu = fyne.NewMenu(lang.X("app.title", "RealiTLScanner"),
+		fyne.NewMenuItem(lang.X("tray.show", "Show window"), g.showFromTray),
+		fyne.NewMenuItemSeparator(),
+		g.tray.status,
+		g.tray.stop,
+		fyne.NewMenuItemSeparator(),
+		quit,
+	)
+	desk.SetSystemTrayMenu(g.tray.menu)
+	desk.SetSystemTrayWindow(g.window)
+	// The tray icon also shows the window on a click, without the menu
+	g.app.Lifecycle().SetOnEnteredForeground(func() {
+		g.tray.hidden = false
+	})
+	return true
+}
+
+// trayMenuItems returns the View menu items of the tray
+func (g *GUI) trayMenuItems() []*fyne.MenuItem {
+	prefs := g.app.Preferences()
+	closeToTray := fyne.NewMenuItem(lang.X("menu.close_to_tray", "Close to tray"), nil)
+	closeToTray.Checked = prefs.Bool(closeToTrayPref)
+	closeToTray.Action = func() {
+		closeToTray.Checked = !closeToTray.Checked
+		prefs.SetBool(closeToTrayPref, closeToTray.Checked)
+		g.window.MainMenu().Refresh()
+	}
+	return []*fyne.MenuItem{
+		fyne.NewMenuItem(lang.X("menu.hide_to_tray", "Hide to tray"), g.hideToTray),
+		closeToTray,
+	}
+}
+
+// closeToTray reports whether closing the window keeps the app in the tray
+func (g *GUI) closeToTray() bool {
+	return g.tray.menu != nil && g.app.Preferences().Bool(closeToTrayPref)
+}
+
+// hideToTray hides the window, scans keep running and report their
+// feasible hosts through notifications
+func (g *GUI) hideToTray() {
+	g.tray.hidden = true
+	g.window.Hide()
+}
+
+// showFromTray brings the window back, dropping the hosts not notified yet
+// as they are in the table
+func (g *GUI) showFromTray() {
+	g.tray.hidden = false
+	g.tray.pending = nil
+	g.window.Show()
+	g.window.RequestFocus()
+}
+
+// quit closes the app, letting a running scan record its last results
+func (g *GUI) quit() {
+	scanner := g.scanner
+	if !g.isScanning || scanner == nil {
+		g.window.Close()
+		return
+	}
+	g.statusText.Set(lang.X("status.closing", "Stopping scan before closing..."))
+	go func() {
+		scanner.Shutdown(scanner.ShutdownTimeout())
+		fyne.Do(g.window.Close)
+	}()
+}
+
+// updateTray shows the status of the scan in the tray menu
+func (g *GUI) updateTray(status string) {
+	if g.tray.menu == nil {
+		return
+	}
+	g.tray.status.Label = status
+	g.tray.stop.Disabled = !g.isScanning
+	g.tray.menu.Refresh()
+}
+
+// notifyFeasible queues a notification of a feasible host found while the
+// window is in the tray
+func (g *GUI) notifyFeasible(result ScanResult) {
+	if !g.tray.hidden || !result.Feasible {
+		return
+	}
+	host := result.Domain
+	if host == "" {
+		host = result.IP
+	}
+	g.tray.pending = append(g.tray.pending, host)
+	if g.tray.timer == nil {
+		delay := max(0, time.Until(g.tray.lastNotify.Add(trayNotifyInterval)))
+		g.tray.timer = time.AfterFunc(delay, func() {
+			fyne.Do(g.flushNotifications)
+		})
+	}
+}
+
+// flushNotifications sends one notification for the feasible hosts queued
+// since the last one
+func (g *GUI) flushNotifications() {
+	if g.tray.timer != nil {
+		g.tray.timer.Stop()
+		g.tray.timer = nil
+	}
+	hosts := g.tray.pending
+	g.tray.pending = nil
+	if len(hosts) == 0 || !g.tray.hidden {
+		return
+	}
+	g.tray.lastNotify = time.Now()
+	content := strings.Join(hosts[:min(len(hosts), trayNotifyHosts)], ", ")
+	if len(hosts) > trayNotifyHosts {
+		content += " " + lang.X("notify.more", "and {{.Count}} more", map[string]any{"Count": len(hosts) - trayNotifyHosts})
+	}
+	g.app.SendNotification(fyne.NewNotification(
+		lang.X("notify.feasible", "Feasible hosts found: {{.Count}}", map[string]any{"Count": len(hosts)}), content))
+}
+
+// notifyCompleted reports the end of a scan that finished in the tray
+func (g *GUI) notifyCompleted(status string) {
+	if !g.tray.hidden {
+		return
+	}
+	g.flushNotifications()
+	g.app.SendNotification(fyne.NewNotification(lang.X("app.title", "RealiTLScanner"), status))
+}
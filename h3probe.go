@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// probeH3 reports whether the host completes a QUIC handshake for HTTP/3
+// on the UDP port of the scan. The handshake is not bound to the source
+// IPs and ports of the TCP connections.
+func (s *Scanner) probeH3(hostPort, sni string) bool {
+	timeout := time.Duration(s.Config.Timeout) * time.Second
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, hostPort, s.clientConfig(&tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h3"},
+		ServerName:         sni,
+	}), &quic.Config{HandshakeIdleTimeout: timeout})
+	if err != nil {
+		s.log(slog.LevelDebug, "QUIC handshake failed", "target", hostPort, "err", err)
+		return false
+	}
+	defer conn.CloseWithError(0, "")
+	return conn.ConnectionState().TLS.NegotiatedProtocol == "h3"
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// happyEyeballsDelay is how long a connection attempt of the race is given
+// before the next address is tried alongside it, as recommended by RFC 8305
+const happyEyeballsDelay = 250 * time.Millisecond
+
+// Address families of FamilyResult
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// Outcomes of an address family in a Happy Eyeballs race
+const (
+	// FamilyConnected is the family that connected first
+	FamilyConnected = "connected"
+	// FamilyFailed is a family all addresses of which failed to connect
+	FamilyFailed = "failed"
+	// FamilyLost is a family still connecting, or not tried yet, when the
+	// other one connected
+	FamilyLost = "lost"
+)
+
+// FamilyResult is how the addresses of one family of a dual-stack domain
+// did in the Happy Eyeballs race
+type FamilyResult struct {
+	Family string `json:"family"`
+	// IP is the last address of the family tried, the first one when
+	// none was
+	IP     string `json:"ip"`
+	Status string `json:"status"`
+	// ConnectMs is the TCP connect time of the family that connected
+	ConnectMs int `json:"connect_ms,omitempty"`
+	// Error is why the last address tried failed
+	Error string `json:"error,omitempty"`
+}
+
+// familyRace is the connection that won a race and how each family did
+type familyRace struct {
+	conn        net.Conn
+	connectTime time.Duration
+	family      string
+	families    []FamilyResult
+}
+
+// raceAttempt is the outcome of one connection attempt of a race
+type raceAttempt struct {
+	ip          net.IP
+	conn        net.Conn
+	connectTime time.Duration
+	err         error
+}
+
+// ipFamily is the address family of ip
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return FamilyIPv4
+	}
+	return FamilyIPv6
+}
+
+// dualStack reports whether ips have both IPv4 and IPv6 addresses
+func dualStack(ips []net.IP) bool {
+	var v4, v6 bool
+	for _, ip := range ips {
+		if ipFamily(ip) == FamilyIPv4 {
+			v4 = true
+		} else {
+			v6 = true
+		}
+	}
+	return v4 && v6
+}
+
+// raceOrder interleaves the addresses of both families, IPv6 first as
+// RFC 8305 prefers
+func raceOrder(ips []net.IP) []net.IP {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ipFamily(ip) == FamilyIPv4 {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	order := make([]net.IP, 0, len(ips))
+	for i := 0; i < max(len(v4), len(v6)); i++ {
+		if i < len(v6) {
+			order = append(order, v6[i])
+		}
+		if i < len(v4) {
+			order = append(order, v4[i])
+		}
+	}
+	return order
+}
+
+// raceFamilies connects to the addresses of a dual-stack domain Happy
+// Eyeballs style: a new address is tried every happyEyeballsDelay, or as
+// soon as the one before failed, and the domain is scanned once over the
+// first connection that succeeds, like a browser would. The others are
+// dropped. Addresses that are not admitted take no part in the race.
+func (s *Scanner) raceFamilies(host Host, ips []net.IP) {
+	var order []net.IP
+	for _, ip := range raceOrder(ips) {
+		host.IP = ip
+		if s.admitted(host) {
+			order = append(order, ip)
+		}
+	}
+	if len(order) == 0 {
+		return
+	}
+	port := s.port(host)
+	families := make(map[string]*FamilyResult)
+	for _, ip := range order {
+		if families[ipFamily(ip)] == nil {
+			families[ipFamily(ip)] = &FamilyResult{Family: ipFamily(ip), IP: ip.String(), Status: FamilyLost}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	done := make(chan raceAttempt, len(order))
+	next, pending := 0, 0
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	start := func() {
+		ip := order[next]
+		next++
+		pending++
+		family := families[ipFamily(ip)]
+		family.IP, family.Status, family.Error = ip.String(), FamilyLost, ""
+		go func() {
+			dialStart := time.Now()
+			conn, err := s.dial(ctx, net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+			done <- raceAttempt{ip: ip, conn: conn, connectTime: time.Since(dialStart), err: err}
+		}()
+		timer.Reset(happyEyeballsDelay)
+	}
+
+	var winner *raceAttempt
+	var lastErr error
+	for winner == nil && (pending > 0 || next < len(order)) {
+		if pending == 0 {
+			start()
+		}
+		select {
+		case attempt := <-done:
+			pending--
+			family := families[ipFamily(attempt.ip)]
+			if attempt.err == nil {
+				winner = &attempt
+				family.Status, family.ConnectMs = FamilyConnected, int(attempt.connectTime.Milliseconds())
+				break
+			}
+			s.log(slog.LevelDebug, "Cannot connect", "ip", attempt.ip, "origin", host.Origin, "err", attempt.err)
+			lastErr = attempt.err
+			if family.IP == attempt.ip.String() {
+				family.Status, family.Error = FamilyFailed, attempt.err.Error()
+			}
+			if next < len(order) {
+				start()
+			}
+		case <-timer.C:
+			if next < len(order) {
+				start()
+			}
+		}
+	}
+	// The attempts still connecting are canceled, late connections closed
+	cancel()
+	go func(pending int) {
+		for ; pending > 0; pending-- {
+			if attempt := <-done; attempt.conn != nil {
+				attempt.conn.Close()
+			}
+		}
+	}(pending)
+
+	if winner == nil {
+		if lastErr != nil {
+			s.log(slog.LevelDebug, "Cannot connect to any address", "origin", host.Origin, "err", lastErr)
+			s.recordAttempt(fmt.Errorf("cannot dial: %w", lastErr))
+		}
+		return
+	}
+	host.IP = winner.ip
+	if !s.markScanned(host, port) {
+		winner.conn.Close()
+		return
+	}
+	race := &familyRace{conn: winner.conn, connectTime: winner.connectTime, family: ipFamily(winner.ip)}
+	for _, name := range []string{FamilyIPv6, FamilyIPv4} {
+		if family := families[name]; family != nil {
+			race.families = append(race.families, *family)
+		}
+	}
+	s.log(slog.LevelDebug, "Happy Eyeballs race won", "ip", winner.ip, "origin", host.Origin,
+		"families", formatFamilies(race.families))
+	scanAdmitted(host, port, s, race)
+}
+
+// marshalProto encodes the FamilyResult message of api/scanner.proto
+func (f FamilyResult) marshalProto() protoBuffer {
+	var b protoBuffer
+	b.string(1, f.Family)
+	b.string(2, f.IP)
+	b.string(3, f.Status)
+	b.int(4, int64(f.ConnectMs))
+	b.string(5, f.Error)
+	return b
+}
+
+// formatFamilies renders the outcome of each family of a race, such as
+// "ipv6 2001:db8::1 failed; ipv4 192.0.2.1 connected 23ms"
+func formatFamilies(families []FamilyResult) string {
+	parts := make([]string, len(families))
+	for i, f := range families {
+		parts[i] = f.Family + " " + f.IP + " " + f.Status
+		if f.Status == FamilyConnected {
+			parts[i] += " " + strconv.Itoa(f.ConnectMs) + "ms"
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// parseFamilies reads back the families written by formatFamilies, the
+// errors of failed ones are not kept
+func parseFamilies(value string) []FamilyResult {
+	var families []FamilyResult
+	for _, part := range strings.Split(value, ";") {
+		fields := strings.Fields(part)
+		if len(fields) < 3 {
+			continue
+		}
+		f := FamilyResult{Family: fields[0], IP: fields[1], Status: fields[2]}
+		if len(fields) > 3 {
+			f.ConnectMs, _ = strconv.Atoi(strings.TrimSuffix(fields[3], "ms"))
+		}
+		families = append(families, f)
+	}
+	return families
+}
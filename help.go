@@ -0,0 +1,93 @@
+//go:build !nogui
+
+package main
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/lang"
+	"fyne.io/fyne/v2/widget"
+)
+
+// helpItem is a term and its explanation
+type helpItem struct {
+	Term string
+	Text string
+}
+
+// helpTopic is one page of the embedded help. Pages are kept as data
+// rather than prose so new columns and feasibility options only need a
+// new item here.
+type helpTopic struct {
+	Title string
+	Intro string
+	Items []helpItem
+}
+
+// markdown renders the topic for a RichText widget
+func (t helpTopic) markdown() string {
+	var b strings.Builder
+	if t.Intro != "" {
+		b.WriteString(t.Intro + "\n\n")
+	}
+	for _, item := range t.Items {
+		b.WriteString("- **" + item.Term + "**: " + item.Text + "\n")
+	}
+	return b.String()
+}
+
+// helpTopics returns the help pages in the current language
+func helpTopics() []helpTopic {
+	return []helpTopic{
+		{
+			Title: lang.X("help.feasible.title", "Feasible"),
+			Intro: lang.X("help.feasible.intro", "A host is feasible as a Reality dest when all of the following hold:"),
+			Items: []helpItem{
+				{"TLS 1.3", lang.X("help.feasible.tls13", "the server negotiates TLS 1.3, which Reality requires")},
+				{"h2", lang.X("help.feasible.h2", "the server selects HTTP/2 through ALPN, like the browsers Reality imitates")},
+				{lang.X("table.domain", "Domain"), lang.X("help.feasible.domain", "the certificate names a domain, used as the SNI of clients")},
+				{lang.X("table.issuer", "Issuer"), lang.X("help.feasible.issuer", "the certificate has an issuer organization")},
+				{lang.X("help.feasible.policy.term", "Feasibility..."), lang.X("help.feasible.policy", "changes these criteria: other ALPN protocols, TLS 1.2, required issuers, a minimum remaining certificate validity and a certificate matching the SNI")},
+				{lang.X("help.feasible.idle.term", "Idle test"), lang.X("help.feasible.idle", "when enabled, feasible connections are also held idle and the outcome is recorded, dests that drop idle connections are poor choices")},
+			},
+		},
+		{
+			Title: lang.X("help.columns.title", "Columns"),
+			Items: []helpItem{
+				{lang.X("table.ip", "IP"), lang.X("help.columns.ip", "address that was scanned")},
+				{lang.X("table.origin", "Origin"), lang.X("help.columns.origin", "source entry the address came from, such as a domain or a CIDR")},
+				{lang.X("table.domain", "Domain"), lang.X("help.columns.domain", "first name in the certificate")},
+				{lang.X("table.issuer", "Issuer"), lang.X("help.columns.issuer", "organization that issued the certificate")},
+				{lang.X("table.geo", "Geo"), lang.X("help.columns.geo", "country of the address, from GeoIP or the built-in RIR table")},
+				{lang.X("table.feasible", "Feasible"), lang.X("help.columns.feasible", "whether the host meets the feasibility criteria")},
+				{lang.X("table.connect_ms", "Connect ms"), lang.X("help.columns.connect_ms", "time to open the TCP connection, close to the network round trip")},
+				{lang.X("table.handshake_ms", "Handshake ms"), lang.X("help.columns.handshake_ms", "time of the TLS handshake after connecting")},
+			},
+		},
+		{
+			Title: lang.X("help.settings.title", "Recommended settings"),
+			Items: []helpItem{
+				{lang.X("help.settings.single.term", "Checking one site"), lang.X("help.settings.single", "enter the domain, keep the defaults")},
+				{lang.X("help.settings.neighbors.term", "Dests near your server"), lang.X("help.settings.neighbors", "enter the IP of your server, 5-10 threads and a 5 second timeout, stop once you have enough results")},
+				{lang.X("help.settings.large.term", "Large CIDR ranges"), lang.X("help.settings.large", "20-50 threads and a 3-5 second timeout, running a scan from a VPS may get it flagged")},
+				{lang.X("help.settings.unstable.term", "Unstable networks"), lang.X("help.settings.unstable", "fewer threads, a 10-15 second timeout and a 60 second idle test")},
+			},
+		},
+	}
+}
+
+// showHelp opens the help window with one tab per topic
+func (g *GUI) showHelp() {
+	tabs := container.NewAppTabs()
+	for _, topic := range helpTopics() {
+		text := widget.NewRichTextFromMarkdown(topic.markdown())
+		text.Wrapping = fyne.TextWrapWord
+		tabs.Append(container.NewTabItem(topic.Title, container.NewVScroll(text)))
+	}
+	d := dialog.NewCustom(lang.X("menu.help", "Help"), lang.X("btn.close", "Close"), tabs, g.window)
+	d.Resize(fyne.NewSize(640, 480))
+	d.Show()
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// latencyBuckets are the upper bounds in milliseconds of the buckets of a
+// latencyHistogram
+var latencyBuckets = [...]int64{50, 100, 200, 300, 500, 750, 1000, 2000, 5000}
+
+// reportSlowHosts is how many of the slowest feasible hosts a report lists
+const reportSlowHosts = 10
+
+// latencyHistogram counts durations in latencyBuckets, the last count
+// holds the ones above the last bound. It is guarded by the mutex of
+// ScanStats.
+type latencyHistogram struct {
+	counts [len(latencyBuckets) + 1]int64
+	sumMs  int64
+	total  int64
+}
+
+func (h *latencyHistogram) observe(ms int) {
+	i := sort.Search(len(latencyBuckets), func(i int) bool { return int64(ms) <= latencyBuckets[i] })
+	h.counts[i]++
+	h.sumMs += int64(ms)
+	h.total++
+}
+
+// LatencyBucket is the number of hosts with a duration up to UpToMs and
+// above the bound of the previous bucket, UpToMs is 0 for the last bucket
+// of the durations above all bounds
+type LatencyBucket struct {
+	UpToMs int64
+	Hosts  int64
+}
+
+// buckets returns the counts of the histogram, empty if it has none
+func (h *latencyHistogram) buckets() []LatencyBucket {
+	if h.total == 0 {
+		return nil
+	}
+	buckets := make([]LatencyBucket, len(h.counts))
+	for i, n := range h.counts {
+		buckets[i].Hosts = n
+		if i < len(latencyBuckets) {
+			buckets[i].UpToMs = latencyBuckets[i]
+		}
+	}
+	return buckets
+}
+
+// SlowHost is a feasible host with its timings, as listed by the slow host
+// report
+type SlowHost struct {
+	IP          string
+	Port        int
+	Domain      string
+	ConnectMs   int
+	HandshakeMs int
+}
+
+// LatencyMs is the time the host took to connect and complete the
+// handshake
+func (h SlowHost) LatencyMs() int {
+	return h.ConnectMs + h.HandshakeMs
+}
+
+// addSlowHost keeps result in hosts if it is among the reportSlowHosts
+// slowest, hosts is sorted from the slowest
+func addSlowHost(hosts []SlowHost, result ScanResult) []SlowHost {
+	host := SlowHost{IP: result.IP, Port: result.Port, Domain: result.Domain,
+		ConnectMs: result.ConnectMs, HandshakeMs: result.HandshakeMs}
+	i := sort.Search(len(hosts), func(i int) bool { return hosts[i].LatencyMs() < host.LatencyMs() })
+	if i >= reportSlowHosts {
+		return hosts
+	}
+	hosts = slices.Insert(hosts, i, host)
+	return hosts[:min(len(hosts), reportSlowHosts)]
+}
+
+// writeHistogram writes the histograms of all sources as a Prometheus
+// histogram in seconds
+func writeHistogram(w io.Writer, name, help string, sources []metricsSource, histogram func(st *ScanStats) latencyHistogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	for _, src := range sources {
+		h := histogram(src.stats)
+		cumulative := int64(0)
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			le := strconv.FormatFloat(float64(bound)/1000, 'f', -1, 64)
+			fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(src.labels, "le", le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(src.labels, "le", "+Inf"), h.total)
+		fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(src.labels),
+			strconv.FormatFloat(float64(h.sumMs)/1000, 'f', -1, 64))
+		fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(src.labels), h.total)
+	}
+}
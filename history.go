@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// runHistory implements the `history` command, which lists the sessions
+// recorded with -db or exports the results of one of them
+func runHistory(args []string) {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	db := fs.String("db", "results.db", "Database written by scans with -db")
+	session := fs.Int64("session", 0, "Session to export, 0 to list all sessions")
+	out := fs.String("out", "", "Output file for the exported results, default: stdout")
+	all := fs.Bool("all", false, "Export infeasible results as well")
+	_ = fs.Parse(args)
+
+	if _, err := os.Stat(*db); err != nil {
+		slog.Error("Error reading database", "path", *db, "err", err)
+		return
+	}
+	store, err := OpenStore(*db)
+	if err != nil {
+		slog.Error("Error opening database", "path", *db, "err", err)
+		return
+	}
+	defer store.Close()
+
+	if *session == 0 {
+		sessions, err := store.Sessions()
+		if err != nil {
+			slog.Error("Error listing sessions", "err", err)
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTARTED\tSTATUS\tSOURCE\tPORT\tTAG\tRESULTS\tFEASIBLE")
+		for _, s := range sessions {
+			status := "interrupted"
+			if !s.Finished.IsZero() {
+				status = "finished"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d\t%s\t%d\t%d\n", s.ID, s.Started.Format(time.DateTime),
+				status, s.Source, s.Port, s.Tag, s.Results, s.Feasible)
+		}
+		_ = w.Flush()
+		return
+	}
+
+	results, err := store.Results(*session, !*all)
+	if err != nil {
+		slog.Error("Error reading results", "session", *session, "err", err)
+		return
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			slog.Error("Error opening file", "path", *out)
+			return
+		}
+		defer f.Close()
+		w = f
+	}
+	config := resultsConfig(results)
+	_, _ = io.WriteString(w, csvHeader(config))
+	for _, result := range results {
+		_, _ = io.WriteString(w, csvLine(result, config))
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"log/slog"
+	"net"
+	"sync"
+)
+
+// Thresholds of the honeypot heuristics. Hosts are only flagged once a
+// pattern is established, the results that established it are reported
+// as they were.
+const (
+	// honeypotPorts is on how many ports one IP must serve the same
+	// self-signed certificate
+	honeypotPorts = 3
+	// honeypotHosts is on how many IPs of a network the same self-signed
+	// certificate must be served
+	honeypotHosts = 8
+	// honeypotInstantHosts is how many hosts of a network must have
+	// answered before their handshake times are judged, and
+	// honeypotInstantRatio which share of them must have been instant
+	honeypotInstantHosts = 16
+	honeypotInstantRatio = 0.9
+)
+
+// honeypotNetwork is what the detector knows of a /24 or /48 network
+type honeypotNetwork struct {
+	answered int
+	instant  int
+	// certs holds the IPs that served each self-signed certificate
+	certs   map[[32]byte]map[string]bool
+	flagged string
+}
+
+// honeypotDetector flags hosts that answer like honeypots and tarpits
+// rather than real servers: an IP serving the same self-signed certificate
+// on every port, a self-signed certificate repeated across a network, or a
+// whole network completing handshakes faster than its round trip.
+type honeypotDetector struct {
+	mu       sync.Mutex
+	networks map[string]*honeypotNetwork
+	// ports holds the ports each IP served a self-signed certificate on
+	ports   map[string]map[[32]byte]map[int]bool
+	flagged map[string]string
+}
+
+// newHoneypotDetector returns the detector of config, nil when disabled
+func newHoneypotDetector(config *ScanConfig) *honeypotDetector {
+	if !config.DetectHoneypots {
+		return nil
+	}
+	return &honeypotDetector{
+		networks: make(map[string]*honeypotNetwork),
+		ports:    make(map[string]map[[32]byte]map[int]bool),
+		flagged:  make(map[string]string),
+	}
+}
+
+// honeypotNetworkKey returns the /24 or /48 network of ip
+func honeypotNetworkKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String() + "/24"
+	}
+	return ip.Mask(net.CIDRMask(48, 128)).String() + "/48"
+}
+
+// selfSigned reports whether cert is signed by its own key. The signature
+// is checked directly, as CheckSignatureFrom wants a CA and self-signed
+// leaves rarely claim to be one.
+func selfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// instantHandshake reports whether a handshake took less than a quarter
+// of the TCP connect. A real server needs at least the round trip of the
+// connect to answer the ClientHello, something answering faster sits in
+// front of it.
+func instantHandshake(connectMs, handshakeMs int) bool {
+	return connectMs > 0 && handshakeMs*4 < connectMs
+}
+
+// check records a host that completed a handshake and returns why it
+// looks like a honeypot, "" when it does not. found reports whether the
+// host revealed the pattern rather than a host before it.
+func (d *honeypotDetector) check(ip net.IP, port int, cert *x509.Certificate, connectMs, handshakeMs int) (reason string, found bool) {
+	key := honeypotNetworkKey(ip)
+	addr := ip.String()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	network := d.networks[key]
+	if network == nil {
+		network = &honeypotNetwork{certs: make(map[[32]byte]map[string]bool)}
+		d.networks[key] = network
+	}
+	network.answered++
+	if instantHandshake(connectMs, handshakeMs) {
+		network.instant++
+	}
+	if network.flagged == "" && network.answered >= honeypotInstantHosts &&
+		float64(network.instant) >= honeypotInstantRatio*float64(network.answered) {
+		network.flagged = "instant handshakes across " + key
+		found = true
+	}
+
+	if cert != nil && selfSigned(cert) {
+		fingerprint := sha256.Sum256(cert.Raw)
+		hosts := network.certs[fingerprint]
+		if hosts == nil {
+			hosts = make(map[string]bool)
+			network.certs[fingerprint] = hosts
+		}
+		hosts[addr] = true
+		if network.flagged == "" && len(hosts) >= honeypotHosts {
+			network.flagged = "same self-signed certificate across " + key
+			found = true
+		}
+
+		certs := d.ports[addr]
+		if certs == nil {
+			certs = make(map[[32]byte]map[int]bool)
+			d.ports[addr] = certs
+		}
+		ports := certs[fingerprint]
+		if ports == nil {
+			ports = make(map[int]bool)
+			certs[fingerprint] = ports
+		}
+		ports[port] = true
+		if d.flagged[addr] == "" && len(ports) >= honeypotPorts {
+			d.flagged[addr] = "same self-signed certificate on every port"
+			found = true
+		}
+	}
+
+	if reason := d.flagged[addr]; reason != "" {
+		return reason, found
+	}
+	return network.flagged, found
+}
+
+// flagHoneypot marks result as a honeypot when the detector finds it looks
+// like one and reports whether it is still feasible
+func (s *Scanner) flagHoneypot(result *ScanResult, ip net.IP, cert *x509.Certificate) bool {
+	reason, found := s.honeypots.check(ip, result.Port, cert, result.ConnectMs, result.HandshakeMs)
+	if found {
+		s.log(slog.LevelInfo, "Flagging honeypots", "ip", result.IP, "port", result.Port, "reason", reason)
+	}
+	if reason != "" {
+		result.Honeypot = true
+		result.Feasible = false
+		result.Score = 0
+	}
+	return result.Feasible
+}
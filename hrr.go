@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// ScanResult.HRR of hosts that sent no HelloRetryRequest, or one that asks
+// for the key share of X25519 again, e.g. to send a cookie. Otherwise it is
+// the group asked for.
+const (
+	HRRNone  = "none"
+	HRRRetry = "retry"
+)
+
+// hrrGroups are the groups the HRR probe lists, like browsers do: the key
+// share is only sent for X25519 and a server preferring another group asks
+// for it with a HelloRetryRequest
+var hrrGroups = []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521}
+
+// helloRetryRandom is the ServerHello random of a HelloRetryRequest
+var helloRetryRandom = []byte{
+	0xCF, 0x21, 0xAD, 0x74, 0xE5, 0x9A, 0x61, 0x11, 0xBE, 0x1D, 0x8C, 0x02, 0x1E, 0x65, 0xB8, 0x91,
+	0xC2, 0xA2, 0x11, 0x16, 0x7A, 0xBB, 0x8C, 0x5E, 0x07, 0x9E, 0x09, 0xE2, 0xC8, 0xA8, 0x33, 0x9C,
+}
+
+// isHelloRetry reports whether the ServerHello message msg, starting with
+// its handshake header, is a HelloRetryRequest
+func isHelloRetry(msg []byte) bool {
+	return len(msg) >= 38 && bytes.Equal(msg[6:38], helloRetryRandom)
+}
+
+// helloRetryGroup returns the group a HelloRetryRequest asks for, from its
+// key_share extension, 0 when it has none
+func helloRetryGroup(msg []byte) tls.CurveID {
+	// Handshake header, legacy version and random
+	b := msg[38:]
+	if len(b) < 1 || len(b) < 1+int(b[0]) {
+		return 0
+	}
+	// Session ID, cipher suite and compression method, then the length
+	// of the extensions
+	b = b[1+int(b[0]):]
+	if len(b) < 5 {
+		return 0
+	}
+	size := int(binary.BigEndian.Uint16(b[3:]))
+	b = b[5:min(len(b), 5+size)]
+	for len(b) >= 4 {
+		ext, size := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		b = b[4:]
+		if len(b) < size {
+			return 0
+		}
+		if ext == 0x0033 && size == 2 {
+			return tls.CurveID(binary.BigEndian.Uint16(b))
+		}
+		b = b[size:]
+	}
+	return 0
+}
+
+// helloSniffer reads the first handshake message the server sends to tell
+// whether it is a HelloRetryRequest
+type helloSniffer struct {
+	net.Conn
+	buf  []byte
+	done bool
+	// hrr is set when the server sent a HelloRetryRequest for group
+	hrr   bool
+	group tls.CurveID
+}
+
+func (c *helloSniffer) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if !c.done && n > 0 {
+		c.buf = append(c.buf, b[:n]...)
+		c.sniff()
+	}
+	return n, err
+}
+
+// sniff looks at the first record once it is complete
+func (c *helloSniffer) sniff() {
+	if len(c.buf) < 5 {
+		return
+	}
+	size := 5 + int(binary.BigEndian.Uint16(c.buf[3:5]))
+	if len(c.buf) < size {
+		return
+	}
+	c.done = true
+	record := c.buf[:size]
+	c.buf = nil
+	if record[0] != 22 || len(record) < 6 || record[5] != 2 {
+		return
+	}
+	msg := record[5:]
+	if isHelloRetry(msg) {
+		c.hrr = true
+		c.group = helloRetryGroup(msg)
+	}
+}
+
+// probeHRR completes a TLS 1.3 handshake offering more groups than X25519
+// and returns the group the host asked for with a HelloRetryRequest,
+// HRRNone when it sent none, or "" when the handshake did not get that far
+func (s *Scanner) probeHRR(hostPort, sni string) string {
+	conn, err := s.dial(s.ctx, hostPort)
+	if err != nil {
+		s.log(slog.LevelDebug, "HRR probe failed", "target", hostPort, "err", err)
+		return ""
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(time.Duration(s.Config.Timeout) * time.Second)); err != nil {
+		return ""
+	}
+	sniffer := &helloSniffer{Conn: conn}
+	err = tls.Client(sniffer, s.clientConfig(&tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS13,
+		NextProtos:         s.Config.Feasibility.nextProtos(),
+		CurvePreferences:   hrrGroups,
+		ServerName:         sni,
+	})).Handshake()
+	switch {
+	case sniffer.hrr && sniffer.group != 0:
+		return sniffer.group.String()
+	case sniffer.hrr:
+		return HRRRetry
+	case !sniffer.done:
+		s.log(slog.LevelDebug, "HRR probe failed", "target", hostPort, "err", err)
+		return ""
+	}
+	return HRRNone
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// httpProbeBodyLimit is how much of the response body the HTTP probe reads
+const httpProbeBodyLimit = 64 << 10
+
+// httpProbeUserAgent makes the probe look like a browser visit, some sites
+// refuse unknown clients
+const httpProbeUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 " +
+	"(KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36"
+
+// httpProbeAuthority is the host name requested from a dest: the SNI it
+// was scanned with, otherwise a name from its certificate
+func httpProbeAuthority(sni string, result ScanResult) string {
+	if sni != "" {
+		return sni
+	}
+	if names := xrayServerNames(result); len(names) > 0 {
+		return names[0]
+	}
+	return result.IP
+}
+
+// probeHTTP sends GET / over HTTP/2 on an established connection and fills
+// the HTTP fields of result. A reset or timeout leaves HTTPStatus at 0.
+func (s *Scanner) probeHTTP(c *tls.Conn, sni string, result *ScanResult) {
+	timeout := time.Duration(s.Config.Timeout) * time.Second
+	if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return
+	}
+	cc, err := (&http2.Transport{}).NewClientConn(c)
+	if err != nil {
+		s.log(slog.LevelDebug, "HTTP/2 setup failed", "ip", result.IP, "err", err)
+		return
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+httpProbeAuthority(sni, *result)+"/", nil)
+	if err != nil {
+		return
+	}
+	req.Header.Set("User-Agent", httpProbeUserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,*/*;q=0.8")
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		s.log(slog.LevelDebug, "HTTP probe failed", "ip", result.IP, "err", err)
+		return
+	}
+	defer resp.Body.Close()
+	n, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, httpProbeBodyLimit))
+
+	result.HTTPStatus = resp.StatusCode
+	result.HTTPServer = resp.Header.Get("Server")
+	// A redirect or a page with a body is what a browser would be served
+	result.HTTPContent = resp.StatusCode >= 300 && resp.StatusCode < 400 ||
+		resp.StatusCode >= 200 && resp.StatusCode < 300 && n > 0
+}
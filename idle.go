@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// idleQueueSize limits how many connections are held open at once
+const idleQueueSize = 256
+
+// Idle test outcomes stored in ScanResult.Idle
+const (
+	IdleOK      = "ok"
+	IdleSkipped = "skipped"
+	IdleAborted = "aborted"
+)
+
+// IdleQueue holds established connections idle for a fixed period and
+// records whether the remote side or a middlebox drops them. Connections
+// are verified in the background so scanning workers are never blocked.
+type IdleQueue struct {
+	ctx      context.Context
+	duration time.Duration
+	slots    chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewIdleQueue creates a queue holding up to size connections for duration
+func NewIdleQueue(ctx context.Context, duration time.Duration, size int) *IdleQueue {
+	return &IdleQueue{
+		ctx:      ctx,
+		duration: duration,
+		slots:    make(chan struct{}, size),
+	}
+}
+
+// Add takes ownership of conn and calls done with the completed result once
+// the idle period is over. It returns false without touching conn when the
+// queue is full.
+func (q *IdleQueue) Add(conn *tls.Conn, result ScanResult, done func(ScanResult)) bool {
+	select {
+	case q.slots <- struct{}{}:
+	default:
+		return false
+	}
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		defer func() { <-q.slots }()
+		defer conn.Close()
+		result.Idle = q.hold(conn)
+		done(result)
+	}()
+	return true
+}
+
+// hold blocks reading from conn until the idle period expires or the
+// connection is closed by the other side
+func (q *IdleQueue) hold(conn *tls.Conn) string {
+	start := time.Now()
+	if err := conn.SetDeadline(start.Add(q.duration)); err != nil {
+		return IdleAborted
+	}
+	// Unblock the pending read when the scan is stopped
+	stop := context.AfterFunc(q.ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	buf := make([]byte, 1024)
+	for {
+		_, err := conn.Read(buf)
+		if err == nil {
+			// Unsolicited data such as a GOAWAY is not a drop by itself
+			continue
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			if q.ctx.Err() != nil {
+				return IdleAborted
+			}
+			return IdleOK
+		}
+		return fmt.Sprintf("dropped after %s", time.Since(start).Round(time.Second))
+	}
+}
+
+// Wait blocks until all held connections have been verified
+func (q *IdleQueue) Wait() {
+	q.wg.Wait()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// instanceGreeting is sent by the running GUI to prove it is a scanner
+// instance and not some other program that took over the port
+const instanceGreeting = "RealiTLScanner"
+
+// instanceDialTimeout bounds the handoff to a running instance
+const instanceDialTimeout = time.Second
+
+// instanceFile stores the port the running GUI instance listens on
+func instanceFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "RealiTLScanner", "instance.port"), nil
+}
+
+// Instance is the guard held by the primary GUI instance
+type Instance struct {
+	listener net.Listener
+	path     string
+}
+
+// handOff passes path (empty to just focus the window) to a running
+// instance. It returns false when no instance answers.
+func handOff(path string) bool {
+	file, err := instanceFile()
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), instanceDialTimeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(instanceDialTimeout))
+	greeting, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || strings.TrimSpace(greeting) != instanceGreeting {
+		return false
+	}
+	_, err = fmt.Fprintf(conn, "OPEN %s\n", path)
+	return err == nil
+}
+
+// AcquireInstance makes this process the primary GUI instance. If another
+// instance is running, path is handed over to it and nil is returned.
+// onOpen is called for every path received from later launches.
+func AcquireInstance(path string, onOpen func(path string)) (*Instance, error) {
+	if handOff(path) {
+		return nil, nil
+	}
+	file, err := instanceFile()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.WriteFile(file, []byte(strconv.Itoa(port)), 0644); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	inst := &Instance{listener: listener, path: file}
+	go inst.serve(onOpen)
+	return inst, nil
+}
+
+func (inst *Instance) serve(onOpen func(path string)) {
+	for {
+		conn, err := inst.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			slog.Debug("Instance accept failed", "err", err)
+			continue
+		}
+		go func() {
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(instanceDialTimeout))
+			if _, err := fmt.Fprintln(conn, instanceGreeting); err != nil {
+				return
+			}
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				return
+			}
+			if path, ok := strings.CutPrefix(strings.TrimRight(line, "\r\n"), "OPEN "); ok {
+				onOpen(path)
+			}
+		}()
+	}
+}
+
+// Release stops accepting handoffs and removes the port file
+func (inst *Instance) Release() {
+	inst.listener.Close()
+	_ = os.Remove(inst.path)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// rangeDash matches the dash of an IP range with the spaces around it
+var rangeDash = regexp.MustCompile(`\s*-\s*`)
+
+// ParseIPRanges parses a line listing dash separated IP ranges such as
+// 1.2.3.0-1.2.5.255, separated by commas, semicolons or spaces, into the
+// CIDR blocks covering them in order. Items may also be CIDRs or single
+// IPs, as published hosting ranges mix them. origins holds the item every
+// block comes from.
+func ParseIPRanges(line string) (blocks []netip.Prefix, origins []string, err error) {
+	items := strings.FieldsFunc(rangeDash.ReplaceAllString(line, "-"), func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t'
+	})
+	if len(items) == 0 {
+		return nil, nil, fmt.Errorf("no IP range in %q", line)
+	}
+	for _, item := range items {
+		itemBlocks, err := parseIPRangeItem(item)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, block := range itemBlocks {
+			blocks = append(blocks, block)
+			origins = append(origins, item)
+		}
+	}
+	return blocks, origins, nil
+}
+
+// parseIPRangeItem returns the CIDR blocks of a range, CIDR or IP
+func parseIPRangeItem(item string) ([]netip.Prefix, error) {
+	if first, last, ok := strings.Cut(item, "-"); ok {
+		from, err := netip.ParseAddr(strings.TrimSpace(first))
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range %q: %w", item, err)
+		}
+		to, err := netip.ParseAddr(strings.TrimSpace(last))
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range %q: %w", item, err)
+		}
+		from, to = from.Unmap(), to.Unmap()
+		switch {
+		case from.Is4() != to.Is4():
+			return nil, fmt.Errorf("invalid IP range %q, both ends must be IPv4 or IPv6", item)
+		case from.Compare(to) > 0:
+			return nil, fmt.Errorf("invalid IP range %q, the first IP is after the last", item)
+		}
+		return rangePrefixes(from, to), nil
+	}
+	if strings.Contains(item, "/") {
+		p, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", item, err)
+		}
+		return []netip.Prefix{p.Masked()}, nil
+	}
+	addr, err := netip.ParseAddr(item)
+	if err != nil {
+		return nil, fmt.Errorf("not an IP, IP range or CIDR: %q", item)
+	}
+	return []netip.Prefix{netip.PrefixFrom(addr, addr.BitLen())}, nil
+}
+
+// isIPRangeLine reports whether line is meant as a list of IP ranges
+// rather than a domain or another input format: it holds a dash or
+// separates several items, and starts with an IP
+func isIPRangeLine(line string) bool {
+	if !strings.ContainsAny(line, "-,; \t") {
+		return false
+	}
+	first, _, _ := strings.Cut(line, "-")
+	fields := strings.FieldsFunc(first, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '/'
+	})
+	if len(fields) == 0 {
+		return false
+	}
+	_, err := netip.ParseAddr(fields[0])
+	return err == nil
+}
+
+// rangePrefixes returns the fewest CIDR blocks covering from to to, in order
+func rangePrefixes(from, to netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for {
+		// The largest block starting at from that ends at to or before
+		bits := from.BitLen()
+		for bits > 0 {
+			wider := netip.PrefixFrom(from, bits-1).Masked()
+			if wider.Addr() != from || lastAddr(wider).Compare(to) > 0 {
+				break
+			}
+			bits--
+		}
+		block := netip.PrefixFrom(from, bits)
+		prefixes = append(prefixes, block)
+		last := lastAddr(block)
+		if last.Compare(to) >= 0 || !last.Next().IsValid() {
+			return prefixes
+		}
+		from = last.Next()
+	}
+}
+
+// lastAddr returns the last address of block
+func lastAddr(block netip.Prefix) netip.Addr {
+	b := block.Masked().Addr().AsSlice()
+	for i := block.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
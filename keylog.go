@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"os"
+)
+
+// setupKeyLog opens the key log file the secrets of every handshake are
+// appended to, in the NSS format of SSLKEYLOGFILE
+func (s *Scanner) setupKeyLog() {
+	if s.Config.KeyLogFile == "" {
+		return
+	}
+	// Anyone able to read the file can decrypt the traffic of the scan
+	f, err := os.OpenFile(s.Config.KeyLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		s.log(slog.LevelError, "Scanning without a key log", "err", err)
+		return
+	}
+	s.keyLog = f
+	s.log(slog.LevelWarn, "Writing the TLS secrets of the scan to the key log", "path", s.Config.KeyLogFile)
+}
+
+// closeKeyLog closes the key log file once no handshake is left
+func (s *Scanner) closeKeyLog() {
+	if s.keyLog == nil {
+		return
+	}
+	if err := s.keyLog.Close(); err != nil {
+		s.log(slog.LevelWarn, "Cannot close the key log", "err", err)
+	}
+}
+
+// clientConfig completes tlsCfg with what every handshake of the scan
+// shares: the client certificate and the key log
+func (s *Scanner) clientConfig(tlsCfg *tls.Config) *tls.Config {
+	if s.keyLog != nil {
+		tlsCfg.KeyLogWriter = s.keyLog
+	}
+	return s.clientAuth(tlsCfg)
+}
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	neturl "net/url"
 	"os"
-	"regexp"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 )
 
@@ -19,72 +25,637 @@ var thread int
 var out string
 var timeout int
 var verbose bool
+var logLevel string
+var logFile string
 var enableIPv6 bool
+var happyEyeballs bool
 var url string
 var gui bool
+var ct string
+var idleTest int
+var resume string
+var appendOut bool
+var enableASN bool
+var geoDB string
+var asnDB string
+var geoMirror string
+var geoProxy string
+var geoKey string
+var geoCity bool
+var cityDB string
+var geoProviders string
+var dbipDB string
+var ip2locationDB string
+var geoAPI string
+var geoUpdate int
+var probePQ bool
+var rateLimit float64
+var timing string
+var probeHTTP bool
+var manifestOut string
+var reportOut string
+var serverName string
+var noSNI bool
+var dualProbe bool
+var sniMatrix string
+var tlsDetails bool
+var detectCDN bool
+var skipCDN bool
+var detectHoneypots bool
+var checkOCSP bool
+var probeH3 bool
+var probeResumption bool
+var probeHRR bool
+var dnsMatch bool
+var speedTestKB int
+var retries int
+var preCheck int
+var preCheckTimeout int
+var adaptive bool
+var shuffle bool
+var subdomains string
+var subdomainList string
+var subdomainCT bool
+var dedupeBloom int
+var excludeFile string
+var excludeEntries string
+var configFile string
+var preset string
+var audit bool
+var countries string
+var maxPerCountry int
+var maxPerASN int
+var certsDir string
+var captureDir string
+var keyLogFile string
+var captureFormat string
+var outFormat string
+var resultTemplate string
+var ports string
+var noGUI bool
+var shodan string
+var censys string
+var tranco string
+var topList string
+var searchKey string
+var searchLimit int
+var tgToken string
+var tgChat string
+var tgEvery int
+var webhookURL string
+var webhookBatch int
+var webhookHeader string
+var pluginPath string
+var hookCommand string
+var tag string
+var xrayOut string
+var sourcePorts string
+var sourceIPs string
+var dnsServers string
+var dnsTimeout int
+var feasibleALPN string
+var feasibleTLS12 bool
+var feasibleIssuers string
+var feasibleExcludeIssuers string
+var feasibleDays int
+var feasibleSNI bool
+var reuseAddr bool
+var keepAlive int
+var fastOpen bool
+var bindDevice string
+var clientCert string
+var clientKey string
+var expand int
+var netCap int
+var serve string
+var metricsAddr string
+var progressEvery int
+var dbPath string
+var skipDays int
+var cachePath string
+var verifyCache bool
+var reverify string
+var serveToken string
+var schedulePath string
+var diffMode bool
 
 func main() {
 	_ = os.Unsetenv("ALL_PROXY")
 	_ = os.Unsetenv("HTTP_PROXY")
 	_ = os.Unsetenv("HTTPS_PROXY")
 	_ = os.Unsetenv("NO_PROXY")
-	flag.StringVar(&addr, "addr", "", "Specify an IP, IP CIDR or domain to scan")
+	if len(os.Args) > 1 && os.Args[1] == "pick" {
+		runPick(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "share" {
+		runShare(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		runHistory(os.Args[2:])
+		return
+	}
+	flag.StringVar(&addr, "addr", "", "Specify an IP, IP CIDR, IP range (1.2.3.0-1.2.5.255) or domain to scan")
 	flag.StringVar(&in, "in", "", "Specify a file that contains multiple "+
-		"IPs, IP CIDRs or domains to scan, divided by line break")
+		"IPs, IP CIDRs, IP ranges or domains to scan, divided by line break, or masscan -oJ/-oL or ZMap CSV output")
 	flag.IntVar(&port, "port", 443, "Specify a HTTPS port to check")
 	flag.IntVar(&thread, "thread", 2, "Count of concurrent tasks")
-	flag.StringVar(&out, "out", "out.csv", "Output file to store the result")
+	flag.BoolVar(&shuffle, "shuffle", false, "Scan the addresses of every CIDR in a pseudo-random order "+
+		"instead of from first to last, the same on every run so -resume still works")
+	flag.StringVar(&subdomains, "subdomains", "", "Also scan these comma separated subdomains of every domain "+
+		"of the source, e.g. www,cdn,origin, \"default\" for a built-in list of common ones")
+	flag.StringVar(&subdomainList, "subdomain-list", "", "Wordlist file of subdomains to scan under every domain, one per line")
+	flag.BoolVar(&subdomainCT, "subdomain-ct", false, "Also scan the subdomains of every domain of the source "+
+		"found in Certificate Transparency logs (crt.sh), one search per domain")
+	flag.BoolVar(&adaptive, "adaptive", false, "Start with a quarter of -thread and add or remove threads "+
+		"as the share of timeouts changes, up to -thread")
+	flag.StringVar(&out, "out", "out.csv", "Output file to store the result, may contain "+
+		"{date}, {time}, {tag}, {source}, {port} and {n} (first unused counter) placeholders, "+
+		"- for standard output (logs go to standard error)")
+	flag.StringVar(&outFormat, "format", "", "Output format: csv, jsonl (one JSON object per line with all fields), "+
+		"xlsx, table (aligned columns for a terminal) or sqlite (a session of a history database), "+
+		"default: from the extension of -out, csv otherwise")
+	flag.StringVar(&resultTemplate, "template", "", "Write every feasible result as a line rendered with this "+
+		"Go template instead, e.g. \"{{.IP}}:{{.Port}} {{.Domain}}\", fields as in jsonl, {{join .SANs \",\"}} for lists")
+	flag.BoolVar(&appendOut, "append", false, "Add the feasible results to those already in -out instead of "+
+		"overwriting it, skipping IPs and ports the file already has")
+	flag.StringVar(&ports, "ports", "", "Scan the source on each of these ports in turn, e.g. 443,8443,2053, "+
+		"one output file per port")
+	flag.StringVar(&tag, "tag", "", "Run tag used for the {tag} placeholder of -out")
 	flag.IntVar(&timeout, "timeout", 10, "Timeout for every check")
+	flag.IntVar(&retries, "retries", 0, "Retry hosts that time out or drop the connection this many times, "+
+		"with exponential backoff")
+	flag.IntVar(&preCheck, "precheck", 0, "Connect to every host with this many extra workers and a short timeout "+
+		"first, only hosts accepting the connection get the TLS handshake, 0 disables")
+	flag.IntVar(&preCheckTimeout, "precheck-timeout", defaultPreCheckTimeout, "Connect timeout of -precheck in milliseconds")
 	flag.BoolVar(&verbose, "v", false, "Verbose output")
+	flag.StringVar(&logLevel, "log-level", "", "Least severe messages to log: debug, info, warn or error, "+
+		"default info, or debug with -v")
+	flag.StringVar(&logFile, "log-file", "", "Also write the log to this file, moved to <file>.1 up to <file>.3 "+
+		"every 10 MB")
 	flag.BoolVar(&enableIPv6, "46", false, "Enable IPv6 in additional to IPv4")
-	flag.StringVar(&url, "url", "", "Crawl the domain list from a URL, "+
+	flag.BoolVar(&happyEyeballs, "happy-eyeballs", false, "With -46, race the IPv6 and IPv4 addresses of "+
+		"dual-stack domains and scan each once over the first to connect, reporting which family won")
+	flag.StringVar(&url, "url", "", "Scan the hosts linked or named on a web page, "+
 		"e.g. https://launchpad.net/ubuntu/+archivemirrors")
+	flag.StringVar(&ct, "ct", "", "Discover domains in Certificate Transparency logs (crt.sh) "+
+		"matching a domain or a pattern with % wildcards, e.g. example.com or %cdn%")
+	flag.StringVar(&tranco, "tranco", "", "Scan the domains of the Tranco top list within a window of ranks, "+
+		"e.g. 1k-100k, or the top ones like 10k. Popular domains make believable serverNames")
+	flag.StringVar(&topList, "top-list", "", "File or URL of a top list of rank,domain lines, plain or zipped, "+
+		"used by -tranco instead of the latest Tranco list, e.g. an Alexa top-1m.csv")
+	flag.StringVar(&shodan, "shodan", "", "Scan the IPs found by a Shodan search, "+
+		"e.g. \"ssl.version:tlsv1.3 ssl.alpn:h2 port:443 country:DE\"")
+	flag.StringVar(&censys, "censys", "", "Scan the IPs found by a Censys hosts search, "+
+		"e.g. \"services.tls.version_selected: TLSv1_3 and location.country_code: DE\"")
+	flag.StringVar(&searchKey, "search-key", "", "API key of -shodan, or ID:secret of -censys, "+
+		"default: $SHODAN_API_KEY, $CENSYS_API_ID and $CENSYS_API_SECRET")
+	flag.IntVar(&searchLimit, "search-limit", 1000, "Maximum number of hosts taken from a -shodan or -censys search, "+
+		"every page of 100 costs a query credit, 0 for no limit")
 	flag.BoolVar(&gui, "gui", false, "Launch GUI mode")
+	flag.BoolVar(&noGUI, "no-gui", false, "Never launch the GUI, for servers without a display. "+
+		"A file given as the only argument is scanned as with -in")
+	flag.IntVar(&idleTest, "idle", 0, "Hold feasible connections idle for this many seconds "+
+		"and record whether they get dropped, 0 to disable")
+	flag.BoolVar(&enableASN, "asn", false, "Look up the ASN of every host with GeoLite2-ASN")
+	flag.StringVar(&geoDB, "geo-db", "", "Country .mmdb database to use instead of the downloaded Country.mmdb")
+	flag.StringVar(&asnDB, "asn-db", "", "ASN .mmdb database to use instead of the downloaded ASN.mmdb")
+	flag.BoolVar(&geoCity, "city", false, "Record the city and coordinates of every host with GeoLite2-City")
+	flag.StringVar(&cityDB, "city-db", "", "City .mmdb database to use instead of the downloaded City.mmdb")
+	flag.StringVar(&geoMirror, "geo-mirror", "", "Base URL to download GeoLite2-Country.mmdb, GeoLite2-ASN.mmdb "+
+		"and GeoLite2-City.mmdb from instead of GitHub")
+	flag.StringVar(&geoProxy, "geo-proxy", "", "Proxy for the GeoIP downloads, e.g. socks5://127.0.0.1:1080")
+	flag.StringVar(&geoKey, "maxmind-key", "", "MaxMind license key to download GeoLite2 from MaxMind, "+
+		"default: $MAXMIND_LICENSE_KEY")
+	flag.StringVar(&geoProviders, "geo-providers", GeoProviderGeoLite2, "Comma separated country providers asked in turn "+
+		"until one knows the IP: geolite2, dbip, ip2location or online")
+	flag.StringVar(&dbipDB, "dbip-db", "", "DB-IP country .mmdb database to use instead of the downloaded "+dbipDBPath)
+	flag.StringVar(&ip2locationDB, "ip2location-db", "", "IP2Location LITE country database in MMDB format, "+
+		"needed by the ip2location provider")
+	flag.StringVar(&geoAPI, "geo-api", "", "Lookup URL of the online provider with {ip} for the IP, "+
+		"answering with the country code, default: "+defaultGeoAPI)
+	flag.IntVar(&geoUpdate, "geo-update", 0, "Check for new GeoIP databases every this many hours while scanning, "+
+		"0 to only check at start")
+	flag.BoolVar(&probeHTTP, "http", false, "Send an HTTP/2 GET / to feasible hosts and record the status code "+
+		"and Server header")
+	flag.StringVar(&serverName, "sni", "", "Send this SNI to every host instead of the scanned domain")
+	flag.BoolVar(&noSNI, "no-sni", false, "Send no SNI, not even to hosts given as domains")
+	flag.BoolVar(&tlsDetails, "tls-details", false, "Record the negotiated cipher suite and key exchange group")
+	flag.BoolVar(&detectCDN, "cdn", false, "Flag hosts of Cloudflare, Fastly, Akamai, CloudFront and G-Core in a CDN column")
+	flag.BoolVar(&skipCDN, "skip-cdn", false, "Report hosts of a CDN as not feasible")
+	flag.BoolVar(&detectHoneypots, "honeypots", false, "Report hosts that look like honeypots or tarpits as not "+
+		"feasible: the same self-signed certificate on every port or across a network, or instant handshakes "+
+		"across a whole /24")
+	flag.BoolVar(&checkOCSP, "ocsp", false, "Check the revocation status of the certificates of feasible hosts "+
+		"from their OCSP staple or responder, in the OCSP and OCSP_STAPLED columns")
+	flag.BoolVar(&probeH3, "h3", false, "Try a QUIC handshake for HTTP/3 with feasible hosts on the UDP port "+
+		"of the scan, in an H3 column")
+	flag.BoolVar(&probeHRR, "hrr", false, "Repeat the handshake with feasible hosts offering X25519, P-256, P-384 "+
+		"and P-521 with an X25519 key share, and record the group they ask for with a HelloRetryRequest")
+	flag.BoolVar(&dnsMatch, "dns-match", false, "Resolve the certificate domain of feasible hosts and record "+
+		"whether it points at the scanned IP, in a DNS_MATCH column. Dests their domain resolves to are the best")
+	flag.BoolVar(&probeResumption, "resumption", false, "Reconnect to feasible hosts with the session ticket they "+
+		"issued and record whether they resume the session, in a RESUMPTION column (none, ticket or resumed)")
+	flag.IntVar(&speedTestKB, "speedtest", 0, "Download up to this many KB of the page of feasible hosts over HTTP/2 "+
+		"and record the throughput in a SPEED_KBPS column, 0 disables")
+	flag.BoolVar(&dualProbe, "dual", false, "Repeat the handshake with feasible hosts with the other SNI choice "+
+		"and record whether the certificate differs")
+	flag.StringVar(&sniMatrix, "sni-matrix", "", "Repeat the handshake with every host once per SNI of this comma "+
+		"separated list and record which names get a valid certificate and which share one, e.g. a.com,www.a.com,b.com")
+	flag.StringVar(&excludeFile, "exclude-file", "", "Never scan hosts matching this list of IPs, CIDRs, "+
+		"AS numbers (AS13335) and country codes")
+	flag.StringVar(&excludeEntries, "exclude", "", "Comma separated IPs, CIDRs, AS numbers and country codes "+
+		"never to scan, in addition to -exclude-file")
+	flag.StringVar(&countries, "countries", "", "Only scan hosts in these comma separated country codes, "+
+		"e.g. NL,DE,FI, skipping the rest before connecting")
+	flag.IntVar(&maxPerCountry, "max-per-country", 0, "Stop reporting and scanning hosts of a country once it has "+
+		"this many feasible hosts, 0 for no cap. With -countries the scan ends when all of them are full")
+	flag.IntVar(&maxPerASN, "max-per-asn", 0, "Stop reporting and scanning hosts of an AS once it has this many "+
+		"feasible hosts, 0 for no cap")
+	flag.StringVar(&certsDir, "save-certs", "", "Save the certificate chain of every host that completes a handshake "+
+		"to this directory as <ip>_<port>.pem")
+	flag.StringVar(&captureDir, "capture", "", "Debug option saving the raw bytes of every TLS handshake, ClientHello "+
+		"and ServerHello included, to this directory as one file per target")
+	flag.StringVar(&captureFormat, "capture-format", CaptureHex, "Format of -capture files: hex for an annotated "+
+		"hex dump of every TLS record, or pcap to open in Wireshark")
+	flag.StringVar(&keyLogFile, "key-log", "", "Debug option appending the TLS secrets "+
+		"of every handshake to this file, for Wireshark to decrypt traffic of the scan captured alongside, "+
+		"e.g. -key-log \"$SSLKEYLOGFILE\"")
+	flag.IntVar(&dedupeBloom, "bloom", 0, "Remember scanned IPs in a bloom filter sized for this many hosts "+
+		"instead of an exact set, for huge ranges, 0 to disable")
+	flag.BoolVar(&probePQ, "pq", false, "Check whether feasible hosts accept the X25519MLKEM768 post-quantum key share")
+	flag.StringVar(&xrayOut, "xray-out", "", "Write an Xray VLESS-Reality config for the first feasible result to this file")
+	flag.StringVar(&sourcePorts, "source-ports", "", "Local port range to pick source ports from at random, "+
+		"e.g. 40000-49999, to keep several scanner instances apart")
+	flag.StringVar(&dnsServers, "dns", "", "Comma separated DNS servers (IP or IP:port) and DNS-over-HTTPS URLs "+
+		"to resolve domains with, tried in turn, e.g. 1.1.1.1,https://1.1.1.1/dns-query, default: the system resolver")
+	flag.IntVar(&dnsTimeout, "dns-timeout", defaultDNSTimeout, "Timeout of a DNS lookup in seconds")
+	flag.StringVar(&feasibleALPN, "feasible-alpn", defaultALPN, "Comma separated ALPN protocols a feasible host may select, "+
+		"e.g. h2,http/1.1")
+	flag.BoolVar(&feasibleTLS12, "feasible-tls12", false, "Also report hosts that only negotiate TLS 1.2 as feasible")
+	flag.StringVar(&feasibleIssuers, "feasible-issuers", "", "Only report hosts as feasible whose certificate issuer "+
+		"contains one of these comma separated names, e.g. \"Let's Encrypt,DigiCert\"")
+	flag.StringVar(&feasibleExcludeIssuers, "feasible-exclude-issuers", "", "Never report hosts as feasible whose "+
+		"certificate issuer contains one of these comma separated names, e.g. Cloudflare")
+	flag.IntVar(&feasibleDays, "feasible-min-days", 0, "Only report hosts as feasible whose certificate is valid "+
+		"for at least this many more days, 0 to not check")
+	flag.BoolVar(&feasibleSNI, "feasible-sni", false, "Only report hosts as feasible whose certificate is valid for the SNI sent")
+	flag.StringVar(&sourceIPs, "source-ips", "", "Comma separated local IPs or interface names to bind "+
+		"connections to in turn, to spread them over several egress IPs")
+	flag.IntVar(&expand, "expand", 0, "Also scan the network of this prefix length around every feasible host, "+
+		"e.g. 24 for its /24, 0 to disable")
+	flag.IntVar(&netCap, "net-cap", 0, "Maximum number of IPs of one /16 scanned at the same time, "+
+		"so mixed inputs are covered evenly, domains are not limited, 0 for no limit")
+	flag.StringVar(&timing, "timing", "", "Timing profile: paranoid, slow or normal wait a random time before every "+
+		"connection and cap connections to each /24, fast (the default) does not")
+	flag.Float64Var(&rateLimit, "rate", 0, "Maximum number of new connections per second across all threads, "+
+		"0 for no limit")
+	flag.BoolVar(&reuseAddr, "reuseaddr", false, "Set SO_REUSEADDR on outgoing sockets")
+	flag.IntVar(&keepAlive, "keepalive", 0, "TCP keepalive period in seconds, 0 for the default of 15 and -1 to turn "+
+		"keepalives off")
+	flag.BoolVar(&fastOpen, "tfo", false, "Send the ClientHello with the SYN using TCP Fast Open where the host "+
+		"gave a cookie before (Linux only, connect times then read as 0)")
+	flag.StringVar(&bindDevice, "bind-device", "", "Bind outgoing sockets to this network interface, e.g. ppp0 or wg0, "+
+		"regardless of the routing table (Linux only, needs CAP_NET_RAW)")
+	flag.StringVar(&clientCert, "client-cert", "", "PEM client certificate presented to hosts asking for one, "+
+		"to scan servers of one's own behind mutual TLS")
+	flag.StringVar(&clientKey, "client-key", "", "PEM private key of -client-cert, default: read from the certificate file")
+	flag.StringVar(&serve, "serve", "", "Serve the HTTP API, gRPC API and web dashboard on this address, "+
+		"e.g. 127.0.0.1:8080, instead of scanning")
+	flag.StringVar(&serveToken, "serve-token", "", "Bearer token required by the HTTP and gRPC APIs")
+	flag.StringVar(&schedulePath, "schedule", "", "JSON file of named scans -serve runs on cron expressions, "+
+		"recorded in -db with changes since the last run sent to -tg-chat")
+	flag.StringVar(&metricsAddr, "metrics", "", "Serve Prometheus metrics on this address at /metrics, "+
+		"e.g. 127.0.0.1:9090")
+	flag.IntVar(&progressEvery, "progress", 0, "Log the hosts per second, elapsed time and success ratio "+
+		"every this many seconds, 0 to turn off")
+	flag.StringVar(&dbPath, "db", "", "SQLite database to record the scan session and all results in")
+	flag.IntVar(&skipDays, "skip-days", 0, "Skip IPs the -db has scanned within this many days")
+	flag.StringVar(&cachePath, "cache", "", "File caching the feasible hosts of all scans, "+
+		"default: dests.json in the user config directory, \"off\" to disable")
+	flag.BoolVar(&diffMode, "diff", false, "Compare two results files given as arguments, the old one first, and report "+
+		"the hosts that became feasible, disappeared or changed certificate or issuer, as text or with -format jsonl")
+	flag.BoolVar(&verifyCache, "verify", false, "Quickly re-check the cached feasible hosts instead of scanning a source")
+	flag.StringVar(&reverify, "reverify", "", "Re-check the feasible hosts of this results file instead of scanning "+
+		"a source, and print which are still feasible")
+	flag.StringVar(&reportOut, "report", "", "File to write a summary of the scan to (totals, countries, top issuers, latency, "+
+		"handshake times and slowest feasible hosts), HTML for .html, Markdown otherwise, with the placeholders of -out")
+	flag.StringVar(&manifestOut, "manifest", "", "File to describe the run in (config, source and output checksums, "+
+		"GeoIP versions), default: next to the output file as <name>.manifest.json, \"off\" to disable")
+	flag.StringVar(&tgToken, "tg-token", "", "Telegram bot token to send feasible hosts with, "+
+		"default: $TELEGRAM_BOT_TOKEN")
+	flag.StringVar(&tgChat, "tg-chat", "", "Telegram chat ID to send feasible hosts to")
+	flag.IntVar(&tgEvery, "tg-every", 0, "Send a summary every this many minutes instead of a message per feasible host")
+	flag.StringVar(&webhookURL, "webhook", "", "URL to POST every feasible host to as JSON while scanning, "+
+		"failed posts are tried again")
+	flag.IntVar(&webhookBatch, "webhook-batch", 1, "Post feasible hosts to -webhook in JSON arrays of up to this "+
+		"many, at least every 5 seconds, 1 posts every host on its own as an object")
+	flag.StringVar(&webhookHeader, "webhook-header", "", "Header sent with every post to -webhook, "+
+		"e.g. \"Authorization: Bearer TOKEN\"")
+	flag.StringVar(&pluginPath, "plugin", "", "Go plugin (.so) whose OnResult function filters or changes every "+
+		"result, see the README")
+	flag.StringVar(&hookCommand, "hook", "", "Command run for every result with it as JSON on stdin: exit status 1 "+
+		"drops the result, JSON printed replaces it")
+	flag.StringVar(&resume, "resume", "", "State file to periodically save the scan position to "+
+		"and continue an interrupted scan from")
+	flag.StringVar(&configFile, "config", "", "YAML or TOML file setting any of these options by name, "+
+		"e.g. \"thread: 20\", options given on the command line take precedence")
+	flag.StringVar(&preset, "preset", "", "Set up the options of a task, those given on the command line or in "+
+		"-config take precedence: dest hunts for lasting Reality dests, audit checks your own servers")
+	flag.BoolVar(&audit, "audit", false, "Check the hosts as your own Reality servers and warn when one reveals "+
+		"its real certificate or SNI routing instead of passing for its dest, these are also written out")
 	flag.Parse()
+	if err := loadEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if configFile != "" {
+		if err := loadConfigFile(configFile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	if preset != "" {
+		if err := applyPreset(preset); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+
+	if gui && noGUI {
+		fmt.Fprintln(os.Stderr, "`gui` and `no-gui` cannot be used together")
+		os.Exit(2)
+	}
 
-	// If no parameters at all - launch GUI
-	if !gui && addr == "" && in == "" && url == "" && flag.NFlag() == 0 {
-		runGUI()
+	// If no parameters at all - launch GUI, unless there is no display to
+	// show it on
+	headless := noGUI || !hasDisplay()
+	if !gui && !headless && addr == "" && in == "" && url == "" && ct == "" && !verifyCache && flag.NFlag() == 0 {
+		runGUI(flag.Arg(0))
 		return
 	}
 
 	if gui {
-		runGUI()
+		if !hasDisplay() {
+			fmt.Fprintln(os.Stderr, "No display to show the GUI on, set DISPLAY or run without `gui`")
+			os.Exit(2)
+		}
+		runGUI(flag.Arg(0))
 		return
 	}
 
+	if headless && addr == "" && in == "" && url == "" && ct == "" && shodan == "" && censys == "" && tranco == "" &&
+		flag.NArg() == 1 {
+		in = flag.Arg(0)
+	}
+	setupLogging()
+	if geoKey == "" {
+		geoKey = os.Getenv("MAXMIND_LICENSE_KEY")
+	}
+	if diffMode {
+		runDiff(flag.Args())
+		return
+	}
+	if serve != "" {
+		runServer(serve, serveToken)
+		return
+	}
+	if ports != "" {
+		runPorts()
+		return
+	}
 	runCLI()
 }
 
-func runCLI() {
+// runPorts runs the CLI scan once for every port of `ports`
+func runPorts() {
+	list, err := ParsePortList(ports)
+	if err != nil {
+		slog.Error("Invalid port list", "err", err)
+		return
+	}
+	if resume != "" && len(list) > 1 {
+		slog.Error("`resume` cannot be used with several `ports`")
+		return
+	}
+	// Every port gets its own output and manifest
+	outTemplate := out
+	if len(list) > 1 && out != "" && !strings.Contains(out, "{port}") {
+		ext := filepath.Ext(out)
+		outTemplate = strings.TrimSuffix(out, ext) + "_{port}" + ext
+	}
+	manifestTemplate := manifestOut
+	for _, p := range list {
+		port = p
+		out = outTemplate
+		manifestOut = strings.ReplaceAll(manifestTemplate, "{port}", strconv.Itoa(p))
+		if interrupted.Load() {
+			break
+		}
+		slog.Info("Scanning port", "port", port)
+		runCLI()
+	}
+}
+
+func setupLogging() {
+	// Keep the results written to standard output apart
+	logOut := os.Stdout
+	if out == "-" {
+		logOut = os.Stderr
+	}
+	level := slog.LevelInfo
 	if verbose {
-		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slog.LevelDebug,
-		})))
-	} else {
-		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-			Level: slog.LevelInfo,
-		})))
+		level = slog.LevelDebug
+	}
+	if logLevel != "" {
+		var err error
+		if level, err = ParseLogLevel(logLevel); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	handler := newLogHandler(logOut, level)
+	if logFile != "" {
+		file, err := OpenRotatingFile(logFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot open log file: %v\n", err)
+			os.Exit(2)
+		}
+		handler = teeHandler{handler, newLogHandler(file, level)}
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+func runCLI() {
+	var cache *DestCache
+	if cachePath != "off" {
+		path := cachePath
+		if path == "" {
+			var err error
+			if path, err = defaultDestCachePath(); err != nil {
+				slog.Warn("Cannot locate dest cache", "err", err)
+			}
+		}
+		if path != "" {
+			var err error
+			if cache, err = LoadDestCache(path); err != nil {
+				slog.Warn("Cannot load dest cache", "path", path, "err", err)
+			}
+		}
+	}
+	if verifyCache {
+		runVerify(cache)
+		return
+	}
+	if reverify != "" {
+		runReverify(reverify, cache)
+		return
 	}
-	if !ExistOnlyOne([]string{addr, in, url}) {
-		slog.Error("You must specify and only specify one of `addr`, `in`, or `url`")
+	if !ExistOnlyOne([]string{addr, in, url, ct, shodan, censys, tranco}) {
+		slog.Error("You must specify and only specify one of `addr`, `in`, `url`, `ct`, `shodan`, `censys` or `tranco`")
 		flag.PrintDefaults()
 		return
 	}
+	config, err := scanConfigFromFlags()
+	if err != nil {
+		slog.Error("Invalid scan parameters", "err", err)
+		return
+	}
+	format, tmpl, err := cliOutputFormat()
+	if err != nil {
+		slog.Error("Invalid output format", "err", err)
+		return
+	}
+	var ranks RankWindow
+	if tranco != "" {
+		if ranks, err = ParseRankWindow(tranco); err != nil {
+			slog.Error("Invalid `tranco` ranks", "err", err)
+			return
+		}
+	}
+	if skipDays > 0 && dbPath == "" {
+		slog.Error("`skip-days` needs a `db` to look up scanned hosts in")
+		return
+	}
+	provider, searchQuery := "shodan", shodan
+	if censys != "" {
+		provider, searchQuery = "censys", censys
+	}
+	var search HostSearch
+	if searchQuery != "" {
+		if search, err = newHostSearch(provider, searchKey); err != nil {
+			slog.Error("Cannot search "+provider, "err", err)
+			return
+		}
+	}
+	exclude, err := loadExclude(config)
+	if err != nil {
+		slog.Error("Error reading exclusion list", "path", excludeFile, "err", err)
+		return
+	}
+	if certsDir != "" {
+		if err := os.MkdirAll(certsDir, 0755); err != nil {
+			slog.Error("Error creating certificate directory", "path", certsDir, "err", err)
+			return
+		}
+	}
+	if captureDir != "" {
+		if err := os.MkdirAll(captureDir, 0755); err != nil {
+			slog.Error("Error creating capture directory", "path", captureDir, "err", err)
+			return
+		}
+	}
+	var source string
+	switch {
+	case addr != "":
+		source = "addr:" + addr
+	case in != "":
+		source = "in:" + in
+	case ct != "":
+		source = "ct:" + ct
+	case search != nil:
+		source = provider + ":" + searchQuery
+	case tranco != "":
+		source = "tranco:" + ranks.String()
+	default:
+		source = "url:" + url
+	}
+	var checkpoint *Checkpoint
+	skip := 0
+	if resume != "" {
+		var err error
+		checkpoint, err = LoadCheckpoint(resume, source, port)
+		if err != nil {
+			slog.Error("Error loading checkpoint", "path", resume, "err", err)
+			return
+		}
+		skip = checkpoint.Offset()
+		if skip > 0 {
+			slog.Info("Resuming scan", "skip", skip)
+		}
+	}
+	if format == FormatXLSX && skip > 0 && !appendOut {
+		slog.Error("An xlsx output cannot be appended to when resuming, use csv, jsonl or `append`")
+		return
+	}
+	label := sourceLabel(addr+in+url+ct, in != "")
+	if search != nil {
+		label = provider
+	} else if tranco != "" {
+		label = "tranco_" + ranks.String()
+	}
 	outWriter := io.Discard
-	if out != "" {
-		f, err := os.OpenFile(out, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	var outFile *os.File
+	if out == "-" {
+		outWriter = os.Stdout
+	} else if out != "" {
+		if checkpoint != nil && checkpoint.Output() != "" {
+			// {n}, {date} and {time} would name another file now
+			out = checkpoint.Output()
+		} else {
+			out = ExpandFilename(out, FilenameVars{
+				Tag:    tag,
+				Source: label,
+				Port:   port,
+			})
+		}
+		if checkpoint != nil {
+			checkpoint.SetOutput(out)
+		}
+		slog.Info("Writing results", "path", out, "format", format)
+	}
+	// A SQLite output is opened as a database by its writer
+	if out != "" && out != "-" && format != FormatSQLite {
+		// Keep the results of the interrupted run when resuming
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		switch {
+		case appendOut:
+			flags = os.O_CREATE | os.O_RDWR
+		case skip > 0:
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		f, err := os.OpenFile(out, flags, 0644)
 		if err != nil {
 			slog.Error("Error opening file", "path", out)
 			return
 		}
 		defer f.Close()
-		_, _ = f.WriteString("IP,ORIGIN,CERT_DOMAIN,CERT_ISSUER,GEO_CODE\n")
-		outWriter = f
+		outFile = f
+		if format != FormatXLSX {
+			outWriter = f
+		}
 	}
 	var hostChan <-chan Host
+	// sourceSum identifies the targets of a file or a fetched list
+	var sourceSum string
+	// total is the number of hosts in the source, 0 when it is not known
+	// before the scan
+	total := 0
 	if addr != "" {
-		hostChan = IterateAddr(addr, enableIPv6)
+		// A domain is looked up like those of the source, through -dns
+		hostChan = IterateAddrFrom(context.Background(), configResolver(config), addr, enableIPv6, shuffle, skip)
+		total = CountAddrHosts(addr, enableIPv6)
 	} else if in != "" {
 		f, err := os.Open(in)
 		if err != nil {
@@ -92,51 +663,706 @@ func runCLI() {
 			return
 		}
 		defer f.Close()
-		hostChan = Iterate(f, enableIPv6)
+		sourceSum, _, _ = sha256File(in)
+		hostChan = IterateFrom(f, enableIPv6, shuffle, skip)
+	} else if ct != "" {
+		slog.Info("Searching Certificate Transparency logs...", "query", ctQuery(ct))
+		domains, err := FetchCTDomains(context.Background(), ct)
+		if err != nil {
+			slog.Error("Error searching CT logs", "err", err)
+			return
+		}
+		slog.Info("Found domains", "count", len(domains))
+		sourceSum = sha256Lines(domains)
+		total = len(domains)
+		hostChan = IterateFrom(strings.NewReader(strings.Join(domains, "\n")), enableIPv6, shuffle, skip)
+	} else if tranco != "" {
+		list := topList
+		if list == "" {
+			list = trancoListURL
+		}
+		slog.Info("Fetching top list...", "list", list, "ranks", ranks.String())
+		domains, err := FetchTopList(context.Background(), list, ranks)
+		if err != nil {
+			slog.Error("Error fetching top list", "err", err)
+			return
+		}
+		slog.Info("Found domains", "count", len(domains))
+		sourceSum = sha256Lines(rankedLines(domains))
+		total = len(domains)
+		hostChan = IterateRanked(domains, skip)
+	} else if search != nil {
+		slog.Info("Searching "+provider, "query", searchQuery, "limit", searchLimit)
+		hostChan = IterateSearch(context.Background(), search, searchQuery, searchLimit, enableIPv6, skip)
 	} else {
 		slog.Info("Fetching url...")
-		resp, err := http.Get(url)
+		domains, err := FetchURLDomains(context.Background(), url)
 		if err != nil {
 			slog.Error("Error fetching url", "err", err)
 			return
 		}
-		defer resp.Body.Close()
-		v, err := io.ReadAll(resp.Body)
+		slog.Info("Parsed domains", "count", len(domains))
+		sourceSum = sha256Lines(domains)
+		total = len(domains)
+		hostChan = IterateFrom(strings.NewReader(strings.Join(domains, "\n")), enableIPv6, shuffle, skip)
+	}
+	output := &resultOutput{format: format, config: config, tmpl: tmpl}
+	if outFile != nil && appendOut {
+		if err := output.appendTo(outFile, port); err != nil {
+			slog.Error("Error reading results to append to", "path", out, "err", err)
+			return
+		}
+	}
+	if err := output.open(outWriter, outFile, out, source, port, tag); err != nil {
+		slog.Error("Error opening output", "path", out, "err", err)
+		return
+	}
+	var manifest *Manifest
+	var xrayWritten bool
+	defer func() {
+		if err := output.Close(); err != nil {
+			slog.Error("Error writing results", "path", out, "err", err)
+		}
+		if skipped := output.Skipped(); skipped > 0 {
+			slog.Info("Skipped results already in the output", "path", out, "count", skipped)
+		}
+		if manifest != nil {
+			writeManifest(manifest, xrayWritten)
+		}
+	}()
+	var xrayOnce sync.Once
+	scanner := NewScanner(config, &ScanCallbacks{
+		OnResult: func(result ScanResult) {
+			if certsDir != "" && len(result.Chain) > 0 {
+				if err := saveCertChain(certsDir, result); err != nil {
+					slog.Warn("Cannot save certificate chain", "ip", result.IP, "err", err)
+				}
+			}
+			// An audit also reports the servers that give themselves away
+			if result.Feasible || len(result.Reveals) > 0 {
+				output.Add(result)
+			}
+			if result.Feasible && xrayOut != "" {
+				xrayOnce.Do(func() {
+					writeXrayConfig(xrayOut, result)
+					xrayWritten = true
+				})
+			}
+		},
+		OnEvent: func(event ScanEvent) {
+			if event.Kind == EventErrorSpike {
+				slog.Warn("Error spike", "phase", event.Phase, "detail", event.Message)
+			}
+		},
+	})
+	if checkpoint != nil {
+		scanner.Checkpoint = checkpoint
+		checkpoint.Start()
+	}
+	if dbPath != "" {
+		store, err := OpenStore(dbPath)
 		if err != nil {
-			slog.Error("Error reading body", "err", err)
+			slog.Error("Error opening database", "path", dbPath, "err", err)
 			return
 		}
-		arr := regexp.MustCompile("(http|https)://(.*?)[/\"<>\\s]+").FindAllStringSubmatch(string(v), -1)
-		var domains []string
-		for _, m := range arr {
-			domains = append(domains, m[2])
+		defer store.Close()
+		scanner.Session, err = store.StartSession(source, port, tag)
+		if err != nil {
+			slog.Error("Error recording session", "path", dbPath, "err", err)
+			return
 		}
-		domains = RemoveDuplicateStr(domains)
-		slog.Info("Parsed domains", "count", len(domains))
-		hostChan = Iterate(strings.NewReader(strings.Join(domains, "\n")), enableIPv6)
+		slog.Info("Recording session", "path", dbPath, "session", scanner.Session.ID)
 	}
-	outCh := OutWriter(outWriter)
-	defer close(outCh)
-	geo := NewGeo()
-	config := &ScanConfig{
-		Port:       port,
-		Thread:     thread,
-		Timeout:    timeout,
-		EnableIPv6: enableIPv6,
-		Verbose:    verbose,
-	}
-	var wg sync.WaitGroup
-	wg.Add(thread)
-	for i := 0; i < thread; i++ {
-		go func() {
-			for ip := range hostChan {
-				ScanTLS(ip, outCh, geo, config)
-			}
-			wg.Done()
-		}()
+	scanner.Cache = cache
+	scanner.Exclude = exclude
+	scanner.Total = total
+	if tgChat != "" {
+		sender, err := telegramSender()
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		scanner.Notifier = NewNotifier(sender, time.Duration(tgEvery)*time.Minute)
+	}
+	if webhookURL != "" {
+		webhook, err := newWebhookFromFlags()
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		scanner.Webhook = webhook
+	}
+	if pluginPath != "" {
+		processor, err := OpenPluginProcessor(pluginPath)
+		if err != nil {
+			slog.Error("Error loading plugin", "path", pluginPath, "err", err)
+			return
+		}
+		scanner.Processors = append(scanner.Processors, processor)
+	}
+	if hookCommand != "" {
+		processor, err := NewCommandProcessor(hookCommand)
+		if err != nil {
+			slog.Error("Error setting up hook", "command", hookCommand, "err", err)
+			return
+		}
+		scanner.Processors = append(scanner.Processors, processor)
+	}
+	if metricsAddr != "" {
+		serveMetrics(metricsAddr, scanner)
 	}
 	t := time.Now()
 	slog.Info("Started all scanning threads", "time", t)
-	wg.Wait()
+	stopSignals := stopOnSignal(scanner)
+	defer stopSignals()
+	stopProgress := logProgress(scanner, progressEvery)
+	scanner.Run(hostChan)
+	stopProgress()
+	if checkpoint != nil {
+		if err := checkpoint.Close(scanner.Context().Err() == nil); err != nil {
+			slog.Warn("Failed to save checkpoint", "err", err)
+		}
+	}
 	slog.Info("Scanning completed", "time", time.Now(), "elapsed", time.Since(t).String())
+	if config.Audit {
+		slog.Info("Audit completed", "servers", scanner.Stats.Results.Load(), "revealing", scanner.Stats.Revealing.Load())
+	}
+	writeReport(scanner, source, label, t)
+	if manifestPath(manifestOut, out) != "" {
+		manifest = &Manifest{
+			Tool:     toolInfo(),
+			Args:     os.Args[1:],
+			Started:  t,
+			Finished: time.Now(),
+			Complete: scanner.Context().Err() == nil,
+			Source:   ManifestSource{Spec: source, SHA256: sourceSum},
+			Config:   *config,
+			GeoIP:    scanner.Geo.Databases(),
+			Hosts:    scanner.Stats.Hosts.Load(),
+			Results:  scanner.Stats.Results.Load(),
+			Feasible: scanner.Stats.Feasible.Load(),
+		}
+	}
+}
+
+// writeManifest adds the checksums of the output files to the manifest of
+// a finished run and saves it
+func writeManifest(manifest *Manifest, xrayWritten bool) {
+	outputs := []string{out}
+	if xrayWritten {
+		outputs = append(outputs, xrayOut)
+	}
+	for _, path := range outputs {
+		if path == "" {
+			continue
+		}
+		if err := manifest.AddOutput(path); err != nil {
+			slog.Warn("Cannot hash output file", "path", path, "err", err)
+		}
+	}
+	path := manifestPath(manifestOut, out)
+	if err := manifest.Write(path); err != nil {
+		slog.Error("Error writing manifest", "path", path, "err", err)
+		return
+	}
+	slog.Info("Wrote manifest", "path", path)
+}
+
+// runVerify re-checks the cached feasible hosts and prints the ones that
+// are still feasible
+func runVerify(cache *DestCache) {
+	if cache == nil {
+		slog.Error("The dest cache is not available")
+		return
+	}
+	hosts := cache.Hosts(port)
+	if len(hosts) == 0 {
+		slog.Error("No cached dests to verify, run a scan first", "port", port)
+		return
+	}
+	start := time.Now()
+	slog.Info("Verifying cached dests", "count", len(hosts))
+	scanner, feasible := recheckHosts(hosts, cache, "verify")
+	if scanner == nil {
+		return
+	}
+	// Dests a stopped run did not get to are kept
+	if scanner.Context().Err() == nil {
+		cache.Expire(port, start)
+	}
+	if err := cache.Save(); err != nil {
+		slog.Warn("Cannot save dest cache", "err", err)
+	}
+	slog.Info("Verification completed", "feasible", len(feasible), "checked", len(hosts),
+		"elapsed", time.Since(start).String())
+}
+
+// runReverify re-checks the feasible hosts of the results file at path and
+// prints which are still feasible, the `out` file getting their new results
+func runReverify(path string, cache *DestCache) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("Error reading file", "path", path, "err", err)
+		return
+	}
+	// CSV files without a PORT column have their results taken to be on
+	// `port`
+	old, err := readResultsFile(path, data, port)
+	if err != nil {
+		slog.Error("Error parsing results", "path", path, "err", err)
+		return
+	}
+	hosts := ReverifyHosts(old)
+	if len(hosts) == 0 {
+		slog.Error("No feasible results to re-verify", "path", path)
+		return
+	}
+	start := time.Now()
+	slog.Info("Re-verifying results", "path", path, "count", len(hosts))
+	scanner, feasible := recheckHosts(hosts, cache, "reverify")
+	if scanner == nil {
+		return
+	}
+	slog.Info("Re-verification completed", "feasible", len(feasible), "checked", len(hosts),
+		"elapsed", time.Since(start).String())
+	// Results written to stdout are kept apart from the summary
+	summary := os.Stdout
+	if out == "-" {
+		summary = os.Stderr
+	}
+	fmt.Fprint(summary, DiffResults(old, feasible).Text())
+}
+
+// recheckHosts scans hosts found before, writing the feasible results to
+// the `out` file when it is given, and returns the scanner and the feasible
+// results. The scanner is nil when the scan could not start.
+func recheckHosts(hosts []Host, cache *DestCache, source string) (*Scanner, []ScanResult) {
+	config, err := scanConfigFromFlags()
+	if err != nil {
+		slog.Error("Invalid scan parameters", "err", err)
+		return nil, nil
+	}
+	// Hosts found before are only re-checked, not explored further
+	config.Thread = max(thread, min(len(hosts), 32))
+	config.IdleTest = 0
+	config.ExpandPrefix = 0
+	config.NetworkCap = 0
+	config.SkipScannedDays = 0
+	config.DedupeBloom = 0
+	config.SaveCerts = false
+	config.CaptureDir = ""
+	// The hosts keep the ports of the results they come from
+	config.PortColumn = true
+	format, tmpl, err := cliOutputFormat()
+	if err != nil {
+		slog.Error("Invalid output format", "err", err)
+		return nil, nil
+	}
+	exclude, err := loadExclude(config)
+	if err != nil {
+		slog.Error("Error reading exclusion list", "path", excludeFile, "err", err)
+		return nil, nil
+	}
+	// Only write a file when asked to, the default one likely holds a scan
+	outWriter := io.Discard
+	var outFile *os.File
+	outPath := ""
+	if out == "-" {
+		outWriter = os.Stdout
+		outPath = out
+	} else if out != "" && isFlagSet("out") {
+		outPath = ExpandFilename(out, FilenameVars{Tag: tag, Source: source, Port: port})
+	}
+	if outPath != "" && outPath != "-" && format != FormatSQLite {
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if appendOut {
+			flags = os.O_CREATE | os.O_RDWR
+		}
+		f, err := os.OpenFile(outPath, flags, 0644)
+		if err != nil {
+			slog.Error("Error opening file", "path", outPath)
+			return nil, nil
+		}
+		defer f.Close()
+		outFile = f
+		if format != FormatXLSX {
+			outWriter = f
+		}
+	}
+	output := &resultOutput{format: format, config: config, tmpl: tmpl}
+	if outFile != nil && appendOut {
+		if err := output.appendTo(outFile, port); err != nil {
+			slog.Error("Error reading results to append to", "path", outPath, "err", err)
+			return nil, nil
+		}
+	}
+	if err := output.open(outWriter, outFile, outPath, source, port, tag); err != nil {
+		slog.Error("Error opening output", "path", outPath, "err", err)
+		return nil, nil
+	}
+	defer func() {
+		if err := output.Close(); err != nil {
+			slog.Error("Error writing results", "path", outPath, "err", err)
+		}
+		if skipped := output.Skipped(); skipped > 0 {
+			slog.Info("Skipped results already in the output", "path", outPath, "count", skipped)
+		}
+	}()
+	var mu sync.Mutex
+	var feasible []ScanResult
+	scanner := NewScanner(config, &ScanCallbacks{
+		OnResult: func(result ScanResult) {
+			if result.Feasible {
+				mu.Lock()
+				feasible = append(feasible, result)
+				mu.Unlock()
+				output.Add(result)
+			}
+		},
+	})
+	scanner.Cache = cache
+	scanner.Exclude = exclude
+	start := time.Now()
+	scanner.Total = len(hosts)
+	stopSignals := stopOnSignal(scanner)
+	defer stopSignals()
+	stopProgress := logProgress(scanner, progressEvery)
+	scanner.Run(hostsChan(hosts))
+	stopProgress()
+	writeReport(scanner, source, source, start)
+	return scanner, feasible
+}
+
+// telegramSender returns the sender of `tg-chat`, the token taken from
+// TELEGRAM_BOT_TOKEN if `tg-token` is not given
+func telegramSender() (*TelegramSender, error) {
+	if tgToken == "" {
+		tgToken = os.Getenv("TELEGRAM_BOT_TOKEN")
+	}
+	if tgToken == "" {
+		return nil, errors.New("`tg-chat` needs a bot token from `tg-token` or TELEGRAM_BOT_TOKEN")
+	}
+	return &TelegramSender{Token: tgToken, ChatID: tgChat}, nil
+}
+
+// newWebhookFromFlags returns the webhook of `webhook`
+func newWebhookFromFlags() (*Webhook, error) {
+	u, err := neturl.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL %q, must be an http or https URL", webhookURL)
+	}
+	header, err := ParseWebhookHeader(webhookHeader)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebhook(webhookURL, header, webhookBatch), nil
+}
+
+// logProgress logs the progress of scanner every so many seconds until the
+// returned function is called, not at all when every is 0
+func logProgress(scanner *Scanner, every int) func() {
+	if every <= 0 {
+		return func() {}
+	}
+	ticker := time.NewTicker(time.Duration(every) * time.Second)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+			p := scanner.Progress()
+			args := []any{
+				"hosts", p.Hosts,
+				"rate", fmt.Sprintf("%.1f/s", p.Rate),
+				"elapsed", p.Elapsed.Round(time.Second).String(),
+				"success", fmt.Sprintf("%.1f%%", p.SuccessRatio()*100),
+				"feasible", p.Feasible,
+			}
+			if p.Total > 0 {
+				args = append(args, "done", fmt.Sprintf("%d/%d", p.Done, p.Total))
+				if left := p.Left(); left > 0 {
+					args = append(args, "left", left.Round(time.Second).String())
+				}
+			}
+			slog.Info("Progress", args...)
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// writeReport writes the summary of the finished scan to the `report` file
+func writeReport(scanner *Scanner, source, label string, started time.Time) {
+	if reportOut == "" {
+		return
+	}
+	path := ExpandFilename(reportOut, FilenameVars{Tag: tag, Source: label, Port: port})
+	if err := scanner.Stats.Report(source, started).WriteFile(path); err != nil {
+		slog.Error("Error writing report", "path", path, "err", err)
+		return
+	}
+	slog.Info("Wrote report", "path", path)
+}
+
+// cliOutputFormat returns the output format of the command line and the
+// parsed template of a template output
+func cliOutputFormat() (string, *template.Template, error) {
+	format, err := outputFormat(outFormat, out)
+	if err != nil {
+		return "", nil, err
+	}
+	var tmpl *template.Template
+	if resultTemplate != "" {
+		switch {
+		case outFormat != "":
+			return "", nil, errors.New("`format` and `template` cannot be used together")
+		case appendOut:
+			return "", nil, errors.New("`append` cannot read back the results of a `template` output")
+		}
+		if tmpl, err = parseOutputTemplate(resultTemplate); err != nil {
+			return "", nil, fmt.Errorf("invalid template: %w", err)
+		}
+		format = FormatTemplate
+	}
+	if out == "-" && (format == FormatXLSX || format == FormatSQLite || appendOut) {
+		return "", nil, errors.New("standard output takes csv, jsonl, table or `template` results and cannot be appended to")
+	}
+	if format == FormatTable && appendOut {
+		return "", nil, errors.New("`append` cannot read back the results of a table output")
+	}
+	return format, tmpl, nil
+}
+
+// scanConfigFromFlags builds the scan configuration from the command line
+func scanConfigFromFlags() (*ScanConfig, error) {
+	portMin, portMax, err := ParsePortRange(sourcePorts)
+	if err != nil {
+		return nil, err
+	}
+	sourceAddrs, err := ParseSourceAddrs(sourceIPs)
+	if err != nil {
+		return nil, err
+	}
+	allowCountries, err := ParseCountries(countries)
+	if err != nil {
+		return nil, err
+	}
+	dns, err := ParseDNSServers(dnsServers)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParseTimingProfile(timing); err != nil {
+		return nil, err
+	}
+	sniList, err := ParseSNIList(sniMatrix)
+	if err != nil {
+		return nil, err
+	}
+	alpn, err := ParseALPN(feasibleALPN)
+	if err != nil {
+		return nil, err
+	}
+	words := ParseSubdomains(subdomains)
+	if subdomainList != "" {
+		list, err := ReadSubdomains(subdomainList)
+		if err != nil {
+			return nil, err
+		}
+		words = RemoveDuplicateStr(append(words, list...))
+	}
+	if err := ValidateSubdomains(words); err != nil {
+		return nil, err
+	}
+	feasibility := FeasibilityPolicy{ALPN: alpn, AllowTLS12: feasibleTLS12, Issuers: ParseIssuers(feasibleIssuers),
+		ExcludeIssuers: ParseIssuers(feasibleExcludeIssuers), MinValidDays: feasibleDays, MatchSNI: feasibleSNI}
+	if err := feasibility.Validate(); err != nil {
+		return nil, err
+	}
+	if _, err := geoTransport(geoProxy); err != nil {
+		return nil, err
+	}
+	providers, err := ParseGeoProviders(geoProviders)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case port < 1 || port > 65535:
+		return nil, fmt.Errorf("invalid port %d", port)
+	case thread < 1:
+		return nil, fmt.Errorf("invalid thread count %d", thread)
+	case timeout < 1:
+		return nil, fmt.Errorf("invalid timeout %d", timeout)
+	case retries < 0:
+		return nil, fmt.Errorf("invalid retry count %d", retries)
+	case speedTestKB < 0:
+		return nil, fmt.Errorf("invalid speed test size %d", speedTestKB)
+	case maxPerCountry < 0 || maxPerASN < 0:
+		return nil, errors.New("invalid `max-per-country` or `max-per-asn`")
+	case dnsTimeout < 1:
+		return nil, fmt.Errorf("invalid DNS timeout %d", dnsTimeout)
+	case preCheck < 0 || preCheckTimeout < 1:
+		return nil, errors.New("invalid `precheck` threads or timeout")
+	case expand != 0 && (expand < 16 || expand > 32):
+		return nil, fmt.Errorf("invalid expand prefix %d, must be between 16 and 32", expand)
+	case serverName != "" && noSNI:
+		return nil, errors.New("`sni` and `no-sni` cannot be used together")
+	case happyEyeballs && !enableIPv6:
+		return nil, errors.New("`happy-eyeballs` needs `46`")
+	case captureFormat != CaptureHex && captureFormat != CapturePcap:
+		return nil, fmt.Errorf("invalid capture format %q, must be hex or pcap", captureFormat)
+	}
+	config := &ScanConfig{
+		Port:            port,
+		Thread:          thread,
+		Timeout:         timeout,
+		EnableIPv6:      enableIPv6,
+		HappyEyeballs:   happyEyeballs,
+		Verbose:         verbose,
+		IdleTest:        idleTest,
+		EnableASN:       enableASN,
+		SourcePortMin:   portMin,
+		SourcePortMax:   portMax,
+		ReuseAddr:       reuseAddr,
+		KeepAlive:       keepAlive,
+		FastOpen:        fastOpen,
+		BindDevice:      bindDevice,
+		ExpandPrefix:    expand,
+		NetworkCap:      netCap,
+		SkipScannedDays: skipDays,
+		ProbePQ:         probePQ,
+		RateLimit:       rateLimit,
+		Timing:          timing,
+		ProbeHTTP:       probeHTTP,
+		ServerName:      serverName,
+		NoSNI:           noSNI,
+		DualProbe:       dualProbe,
+		SNIMatrix:       sniList,
+		DedupeBloom:     dedupeBloom,
+		SaveCerts:       certsDir != "",
+		CaptureDir:      captureDir,
+		KeyLogFile:      keyLogFile,
+		CaptureFormat:   captureFormat,
+		SourceAddrs:     sourceAddrs,
+		TLSDetails:      tlsDetails,
+		ClientCert:      clientCert,
+		ClientKey:       clientKey,
+		GeoDB:           geoDB,
+		ASNDB:           asnDB,
+		GeoMirror:       geoMirror,
+		GeoProxy:        geoProxy,
+		GeoLicenseKey:   geoKey,
+		GeoCity:         geoCity,
+		CityDB:          cityDB,
+		GeoProviders:    providers,
+		DBIPDB:          dbipDB,
+		IP2LocationDB:   ip2locationDB,
+		GeoAPI:          geoAPI,
+		GeoUpdateHours:  geoUpdate,
+		DetectCDN:       detectCDN,
+		SkipCDN:         skipCDN,
+		DetectHoneypots: detectHoneypots,
+		Audit:           audit,
+		CheckOCSP:       checkOCSP,
+		ProbeH3:         probeH3,
+		ProbeResumption: probeResumption,
+		ProbeHRR:        probeHRR,
+		DNSMatch:        dnsMatch,
+		SpeedTestKB:     speedTestKB,
+		PreCheckThreads: preCheck,
+		PreCheckTimeout: preCheckTimeout,
+		AllowCountries:  allowCountries,
+		MaxPerCountry:   maxPerCountry,
+		MaxPerASN:       maxPerASN,
+		DNSServers:      dns,
+		DNSTimeout:      dnsTimeout,
+		Feasibility:     feasibility,
+		Retries:         retries,
+		Adaptive:        adaptive,
+		Shuffle:         shuffle,
+		Subdomains:      words,
+		SubdomainCT:     subdomainCT,
+		TopList:         tranco != "",
+		PortColumn:      in != "",
+	}
+	if err := ValidateSocketOptions(config); err != nil {
+		return nil, err
+	}
+	if _, err := config.loadClientCert(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// loadExclude reads the list given with `exclude-file` and `exclude`, if
+// any, and turns on ASN lookup when the list has AS numbers
+func loadExclude(config *ScanConfig) (*ExcludeList, error) {
+	if excludeFile == "" && excludeEntries == "" {
+		return nil, nil
+	}
+	var data []byte
+	if excludeFile != "" {
+		var err error
+		if data, err = os.ReadFile(excludeFile); err != nil {
+			return nil, err
+		}
+	}
+	exclude, err := ParseExcludeList(strings.NewReader(string(data) + "\n" + excludeEntries))
+	if err != nil {
+		return nil, err
+	}
+	if exclude.NeedsASN() && !config.EnableASN {
+		slog.Info("Enabling ASN lookup to match AS numbers of the exclusion list")
+		config.EnableASN = true
+	}
+	slog.Info("Loaded exclusion list", "path", excludeFile, "entries", exclude.Len())
+	return exclude, nil
+}
+
+// isFlagSet reports whether a flag was given on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// serveMetrics exposes the stats of scanner on address in the background
+func serveMetrics(address string, scanner *Scanner) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", metricsHandler(func() []metricsSource {
+		return []metricsSource{{stats: &scanner.Stats}}
+	}))
+	go func() {
+		if err := http.ListenAndServe(address, mux); err != nil {
+			slog.Error("Metrics server stopped", "err", err)
+		}
+	}()
+	slog.Info("Serving metrics", "addr", address)
+}
+
+// writeXrayConfig saves an Xray Reality config for result with new keys
+func writeXrayConfig(path string, result ScanResult) {
+	keys, err := NewXrayKeys()
+	if err != nil {
+		slog.Error("Error generating Reality keys", "err", err)
+		return
+	}
+	data, err := XrayConfig(result, keys)
+	if err != nil {
+		slog.Error("Error building Xray config", "err", err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		slog.Error("Error writing Xray config", "path", path, "err", err)
+		return
+	}
+	slog.Info("Wrote Xray config", "path", path, "dest", xrayDest(result), "public-key", keys.PublicKey)
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// Manifest describes a CLI run so that results shared between researchers
+// can be reproduced and checked
+type Manifest struct {
+	Tool     ManifestTool `json:"tool"`
+	Args     []string     `json:"args"`
+	Started  time.Time    `json:"started"`
+	Finished time.Time    `json:"finished"`
+	// Complete is false if the scan was stopped before the source ran out
+	Complete bool           `json:"complete"`
+	Source   ManifestSource `json:"source"`
+	Config   ScanConfig     `json:"config"`
+	GeoIP    []GeoDBInfo    `json:"geoip"`
+	Hosts    int64          `json:"hosts"`
+	Results  int64          `json:"results"`
+	Feasible int64          `json:"feasible"`
+	Outputs  []ManifestFile `json:"outputs"`
+}
+
+// ManifestTool identifies the scanner build
+type ManifestTool struct {
+	Version  string `json:"version"`
+	Revision string `json:"revision,omitempty"`
+	Go       string `json:"go"`
+}
+
+// ManifestSource is the scanned source, with a hash of the targets read
+// from a file or fetched from the network
+type ManifestSource struct {
+	Spec   string `json:"spec"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// ManifestFile is a file written by the run
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// toolInfo reads the version of the scanner from its build information
+func toolInfo() ManifestTool {
+	tool := ManifestTool{Version: "(devel)"}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return tool
+	}
+	tool.Version = info.Main.Version
+	tool.Go = info.GoVersion
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			tool.Revision = setting.Value
+		}
+	}
+	return tool
+}
+
+// manifestPath returns where the manifest of a run writing out goes:
+// next to the output file unless set explicitly, "" if disabled
+func manifestPath(manifest, out string) string {
+	switch {
+	case manifest == "off":
+		return ""
+	case manifest != "":
+		return manifest
+	case out == "" || out == "-":
+		return ""
+	}
+	return strings.TrimSuffix(out, filepath.Ext(out)) + ".manifest.json"
+}
+
+// sha256File hashes the file at path
+func sha256File(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// sha256Lines hashes a fetched target list as it would be stored in a file
+func sha256Lines(lines []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n") + "\n"))
+	return hex.EncodeToString(sum[:])
+}
+
+// AddOutput records the checksum of a file written by the run
+func (m *Manifest) AddOutput(path string) error {
+	sum, size, err := sha256File(path)
+	if err != nil {
+		return err
+	}
+	m.Outputs = append(m.Outputs, ManifestFile{Path: path, Size: size, SHA256: sum})
+	return nil
+}
+
+// Write saves the manifest as JSON
+func (m *Manifest) Write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// maxmindDownloadURL serves the GeoLite2 databases straight from MaxMind
+// to holders of a license key, as tar.gz archives
+const maxmindDownloadURL = "https://download.maxmind.com/app/geoip_download"
+
+// maxmindURL returns the download URL of a GeoLite2 edition such as
+// GeoLite2-Country
+func maxmindURL(edition, key string) string {
+	params := neturl.Values{}
+	params.Set("edition_id", edition)
+	params.Set("license_key", key)
+	params.Set("suffix", "tar.gz")
+	return maxmindDownloadURL + "?" + params.Encode()
+}
+
+// isMaxMindURL reports whether url is a MaxMind archive download
+func isMaxMindURL(url string) bool {
+	return strings.HasPrefix(url, maxmindDownloadURL)
+}
+
+// redactURL hides the license key of a MaxMind URL, for logs
+func redactURL(url string) string {
+	u, err := neturl.Parse(url)
+	if err != nil || !u.Query().Has("license_key") {
+		return url
+	}
+	params := u.Query()
+	params.Set("license_key", "REDACTED")
+	u.RawQuery = params.Encode()
+	return u.String()
+}
+
+// redactError drops the URL, which may hold the license key, from a
+// request error
+func redactError(err error) error {
+	var urlErr *neturl.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// mmdbFromArchive returns the .mmdb file in a tar.gz archive from MaxMind
+// and its size
+func mmdbFromArchive(r io.Reader) (io.Reader, int64, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil, 0, errors.New("no database in archive")
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && path.Ext(header.Name) == ".mmdb" {
+			return tr, header.Size, nil
+		}
+	}
+}
+
+// lastModified is the Last-Modified time of a response, zero if missing
+func lastModified(resp *http.Response) time.Time {
+	t, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return t
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ScanStats are running totals of a scan, safe for concurrent use
+type ScanStats struct {
+	// Hosts counts hosts taken off the queue and finished
+	Hosts atomic.Int64
+	// Duplicates counts hosts skipped because their IP was already scanned
+	// in the session, e.g. a domain resolving into a scanned range
+	Duplicates atomic.Int64
+	// Excluded counts hosts skipped because they match the exclusion list
+	Excluded atomic.Int64
+	// OtherCountries counts hosts skipped because they are outside the
+	// allowed countries
+	OtherCountries atomic.Int64
+	// Capped counts hosts skipped, and feasible hosts dropped, because
+	// their country or AS number already had enough feasible hosts
+	Capped atomic.Int64
+	// Unreachable counts hosts dropped by the TCP pre-check
+	Unreachable atomic.Int64
+	// Attempts and Failures count TLS connection attempts
+	Attempts atomic.Int64
+	Failures atomic.Int64
+	// Results counts hosts that completed a handshake, Feasible the ones
+	// that met the criteria
+	Results  atomic.Int64
+	Feasible atomic.Int64
+	// Revealing counts hosts an audit found giving themselves away
+	Revealing atomic.Int64
+	// OpenConns is the number of connections currently open, including
+	// the ones held by the idle test
+	OpenConns atomic.Int64
+	// Concurrency is the number of workers allowed to scan, changing
+	// during adaptive scans
+	Concurrency atomic.Int64
+
+	mu sync.Mutex
+	// countries counts feasible hosts and responsive all results per
+	// country code, issuers feasible hosts per certificate issuer
+	countries  map[string]int64
+	responsive map[string]int64
+	issuers    map[string]int64
+	// connectMs and handshakeMs add up the timings of all results, with
+	// their distribution in connects and handshakes
+	connectMs   int64
+	handshakeMs int64
+	connects    latencyHistogram
+	handshakes  latencyHistogram
+	// slowest are the feasible hosts that took longest, the slowest first
+	slowest []SlowHost
+}
+
+func (st *ScanStats) addResult(result ScanResult) {
+	st.Results.Add(1)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.countries == nil {
+		st.countries = make(map[string]int64)
+		st.responsive = make(map[string]int64)
+		st.issuers = make(map[string]int64)
+	}
+	st.responsive[result.GeoCode]++
+	st.connectMs += int64(result.ConnectMs)
+	st.handshakeMs += int64(result.HandshakeMs)
+	st.connects.observe(result.ConnectMs)
+	st.handshakes.observe(result.HandshakeMs)
+	if !result.Feasible {
+		return
+	}
+	st.Feasible.Add(1)
+	st.slowest = addSlowHost(st.slowest, result)
+	st.countries[result.GeoCode]++
+	if result.Issuer != "" {
+		st.issuers[result.Issuer]++
+	}
+}
+
+// Countries returns the number of feasible hosts per country code
+func (st *ScanStats) Countries() map[string]int64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	countries := make(map[string]int64, len(st.countries))
+	for code, n := range st.countries {
+		countries[code] = n
+	}
+	return countries
+}
+
+// histograms returns the distribution of the connect and handshake times
+// of all results
+func (st *ScanStats) histograms() (connects, handshakes latencyHistogram) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.connects, st.handshakes
+}
+
+// SlowHosts returns the feasible hosts that took longest to connect and
+// complete the handshake, the slowest first
+func (st *ScanStats) SlowHosts() []SlowHost {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return slices.Clone(st.slowest)
+}
+
+// countedConn keeps ScanStats.OpenConns up to date
+type countedConn struct {
+	net.Conn
+	open *atomic.Int64
+	once sync.Once
+}
+
+func newCountedConn(conn net.Conn, open *atomic.Int64) net.Conn {
+	open.Add(1)
+	return &countedConn{Conn: conn, open: open}
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+// metricsSource is the stats of one scan with its Prometheus labels
+type metricsSource struct {
+	labels map[string]string
+	stats  *ScanStats
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders labels in the Prometheus text format, extra is
+// added last
+func formatLabels(labels map[string]string, extra ...string) string {
+	var pairs []string
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		pairs = append(pairs, k+`="`+labelEscaper.Replace(labels[k])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// writeMetrics writes the stats of all sources in the Prometheus text
+// exposition format
+func writeMetrics(w io.Writer, sources []metricsSource) {
+	metric := func(name, kind, help string, value func(src metricsSource) int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+		for _, src := range sources {
+			fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(src.labels), value(src))
+		}
+	}
+	metric("realitlscanner_hosts_total", "counter", "Hosts scanned.",
+		func(src metricsSource) int64 { return src.stats.Hosts.Load() })
+	metric("realitlscanner_duplicate_hosts_total", "counter", "Hosts skipped as already scanned in the session.",
+		func(src metricsSource) int64 { return src.stats.Duplicates.Load() })
+	metric("realitlscanner_excluded_hosts_total", "counter", "Hosts skipped by the exclusion list.",
+		func(src metricsSource) int64 { return src.stats.Excluded.Load() })
+	metric("realitlscanner_other_country_hosts_total", "counter", "Hosts skipped as outside the allowed countries.",
+		func(src metricsSource) int64 { return src.stats.OtherCountries.Load() })
+	metric("realitlscanner_capped_hosts_total", "counter", "Hosts skipped or dropped as their country or AS had enough feasible hosts.",
+		func(src metricsSource) int64 { return src.stats.Capped.Load() })
+	metric("realitlscanner_unreachable_hosts_total", "counter", "Hosts dropped by the TCP pre-check.",
+		func(src metricsSource) int64 { return src.stats.Unreachable.Load() })
+	metric("realitlscanner_connection_attempts_total", "counter", "TLS connection attempts.",
+		func(src metricsSource) int64 { return src.stats.Attempts.Load() })
+	metric("realitlscanner_connection_failures_total", "counter", "Failed TLS connection attempts.",
+		func(src metricsSource) int64 { return src.stats.Failures.Load() })
+	metric("realitlscanner_open_connections", "gauge", "Connections currently open.",
+		func(src metricsSource) int64 { return src.stats.OpenConns.Load() })
+	metric("realitlscanner_concurrency", "gauge", "Workers allowed to scan at the same time.",
+		func(src metricsSource) int64 { return src.stats.Concurrency.Load() })
+	metric("realitlscanner_results_total", "counter", "Hosts that completed a TLS handshake.",
+		func(src metricsSource) int64 { return src.stats.Results.Load() })
+	metric("realitlscanner_feasible_total", "counter", "Feasible hosts.",
+		func(src metricsSource) int64 { return src.stats.Feasible.Load() })
+
+	name := "realitlscanner_feasible_by_country_total"
+	fmt.Fprintf(w, "# HELP %s Feasible hosts per country.\n# TYPE %s counter\n", name, name)
+	for _, src := range sources {
+		countries := src.stats.Countries()
+		codes := make([]string, 0, len(countries))
+		for code := range countries {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(src.labels, "country", code), countries[code])
+		}
+	}
+
+	writeHistogram(w, "realitlscanner_connect_duration_seconds", "TCP connect times of the hosts that completed a handshake.",
+		sources, func(st *ScanStats) latencyHistogram { connects, _ := st.histograms(); return connects })
+	writeHistogram(w, "realitlscanner_handshake_duration_seconds", "TLS handshake times of the hosts that completed one.",
+		sources, func(st *ScanStats) latencyHistogram { _, handshakes := st.histograms(); return handshakes })
+
+	name = "realitlscanner_slow_host_latency_milliseconds"
+	fmt.Fprintf(w, "# HELP %s Connect and handshake time of the slowest feasible hosts.\n# TYPE %s gauge\n", name, name)
+	for _, src := range sources {
+		for _, host := range src.stats.SlowHosts() {
+			fmt.Fprintf(w, "%s%s %d\n", name, formatLabels(src.labels, "ip", host.IP, "port", strconv.Itoa(host.Port),
+				"domain", host.Domain), host.LatencyMs())
+		}
+	}
+}
+
+// metricsHandler serves the stats returned by sources on every scrape
+func metricsHandler(sources func() []metricsSource) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, sources())
+	}
+}
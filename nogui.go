@@ -0,0 +1,15 @@
+//go:build nogui
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// runGUI stands in for the GUI in builds with the nogui tag, which need
+// neither cgo nor OpenGL, e.g. for the Docker image
+func runGUI(string) {
+	fmt.Fprintln(os.Stderr, "This build has no GUI, give a scan on the command line or through SCANNER_ variables, see -h")
+	os.Exit(2)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// notifyQueueSize is how many messages may wait to be sent before new
+	// ones are dropped
+	notifyQueueSize = 64
+	// notifyInterval paces messages, Telegram allows about one per second
+	// in a chat
+	notifyInterval = time.Second
+	// notifySummaryMax is how many dests a summary lists
+	notifySummaryMax = 20
+)
+
+// Sender delivers a text message to the user
+type Sender interface {
+	Send(ctx context.Context, text string) error
+}
+
+// TelegramSender sends messages to a chat through the Telegram Bot API
+type TelegramSender struct {
+	Token  string
+	ChatID string
+	Client *http.Client
+}
+
+// Send posts text to the chat
+func (t *TelegramSender) Send(ctx context.Context, text string) error {
+	form := neturl.Values{}
+	form.Set("chat_id", t.ChatID)
+	form.Set("text", text)
+	form.Set("disable_web_page_preview", "true")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://api.telegram.org/bot"+t.Token+"/sendMessage", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	client := t.Client
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL holds the token, keep it out of logs
+		return fmt.Errorf("failed to reach Telegram: %w", errors.Unwrap(err))
+	}
+	defer resp.Body.Close()
+	var answer struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return fmt.Errorf("unexpected Telegram response: %s", resp.Status)
+	}
+	if !answer.OK {
+		return fmt.Errorf("telegram: %s", answer.Description)
+	}
+	return nil
+}
+
+// Notifier pushes feasible results of a scan to a Sender, one message per
+// result or a summary every interval. Messages are sent in the background
+// so workers never wait for the network.
+type Notifier struct {
+	sender   Sender
+	every    time.Duration
+	messages chan string
+	done     chan struct{}
+
+	mu      sync.Mutex
+	pending []ScanResult
+	stop    chan struct{}
+	closed  bool
+}
+
+// NewNotifier starts a notifier sending a message per result, or a
+// summary every interval if it is not zero
+func NewNotifier(sender Sender, every time.Duration) *Notifier {
+	n := &Notifier{
+		sender:   sender,
+		every:    every,
+		messages: make(chan string, notifyQueueSize),
+		done:     make(chan struct{}),
+		stop:     make(chan struct{}),
+	}
+	go n.send()
+	if every > 0 {
+		go n.summarize()
+	}
+	return n
+}
+
+// resultLine describes a feasible result in one line
+func resultLine(result ScanResult) string {
+	line := fmt.Sprintf("%s (%s)", result.Domain, result.IP)
+	if result.GeoCode != "" {
+		line = result.GeoCode + " " + line
+	}
+	for _, extra := range []string{result.Issuer, result.ASOrg} {
+		if extra != "" {
+			line += ", " + extra
+		}
+	}
+	return line + fmt.Sprintf(", %d ms", result.ConnectMs+result.HandshakeMs)
+}
+
+// Add reports a feasible result
+func (n *Notifier) Add(result ScanResult) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	if n.every == 0 {
+		n.queue("Feasible: " + resultLine(result))
+		return
+	}
+	n.pending = append(n.pending, result)
+}
+
+// queue hands a message to the sender, dropping it if the queue is full
+func (n *Notifier) queue(text string) {
+	select {
+	case n.messages <- text:
+	default:
+		slog.Warn("Notification queue full, dropping message")
+	}
+}
+
+// flush queues a summary of the pending results. The caller holds n.mu.
+func (n *Notifier) flush() {
+	if len(n.pending) == 0 {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d new feasible dests:", len(n.pending))
+	for i, result := range n.pending {
+		if i == notifySummaryMax {
+			fmt.Fprintf(&b, "\n…and %d more", len(n.pending)-i)
+			break
+		}
+		b.WriteString("\n" + resultLine(result))
+	}
+	n.pending = nil
+	n.queue(b.String())
+}
+
+// summarize sends the pending results every interval
+func (n *Notifier) summarize() {
+	ticker := time.NewTicker(n.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.mu.Lock()
+			n.flush()
+			n.mu.Unlock()
+		case <-n.stop:
+			return
+		}
+	}
+}
+
+// send delivers the queued messages one at a time
+func (n *Notifier) send() {
+	defer close(n.done)
+	for text := range n.messages {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		if err := n.sender.Send(ctx, text); err != nil {
+			slog.Warn("Failed to send notification", "err", err)
+		}
+		cancel()
+		time.Sleep(notifyInterval)
+	}
+}
+
+// Close sends what is pending and a final message, then waits for the
+// messages to go out
+func (n *Notifier) Close(final string) {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return
+	}
+	n.closed = true
+	close(n.stop)
+	n.flush()
+	n.queue(final)
+	n.mu.Unlock()
+	close(n.messages)
+	<-n.done
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSP revocation statuses of ScanResult.OCSP
+const (
+	OCSPGood    = "good"
+	OCSPRevoked = "revoked"
+	OCSPUnknown = "unknown"
+	// OCSPNone means the host stapled nothing and the certificate names
+	// no responder to ask
+	OCSPNone = "none"
+	// OCSPError means the staple or the answer of the responder was
+	// invalid, or the responder did not answer
+	OCSPError = "error"
+)
+
+// ocspResponseLimit caps the size of a responder answer
+const ocspResponseLimit = 64 << 10
+
+// checkOCSP fills the OCSP fields of result from the response stapled by
+// the host, or asks the responder of the certificate if there is none
+func (s *Scanner) checkOCSP(state tls.ConnectionState, result *ScanResult) {
+	leaf := state.PeerCertificates[0]
+	var issuer *x509.Certificate
+	if len(state.PeerCertificates) > 1 {
+		issuer = state.PeerCertificates[1]
+	}
+	raw := state.OCSPResponse
+	result.OCSPStapled = len(raw) > 0
+	if !result.OCSPStapled {
+		if len(leaf.OCSPServer) == 0 || issuer == nil {
+			result.OCSP = OCSPNone
+			return
+		}
+		var err error
+		if raw, err = s.queryOCSP(leaf, issuer); err != nil {
+			s.log(slog.LevelDebug, "OCSP query failed", "ip", result.IP, "responder", leaf.OCSPServer[0], "err", err)
+			result.OCSP = OCSPError
+			return
+		}
+	}
+	// Without the issuer the signature of the response cannot be checked
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		s.log(slog.LevelDebug, "Invalid OCSP response", "ip", result.IP, "stapled", result.OCSPStapled, "err", err)
+		result.OCSP = OCSPError
+		return
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		result.OCSP = OCSPGood
+	case ocsp.Revoked:
+		result.OCSP = OCSPRevoked
+	default:
+		result.OCSP = OCSPUnknown
+	}
+}
+
+// queryOCSP asks the first responder of leaf for its status
+func (s *Scanner) queryOCSP(leaf, issuer *x509.Certificate) ([]byte, error) {
+	body, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, time.Duration(s.Config.Timeout)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, leaf.OCSPServer[0], bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, ocspResponseLimit))
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Output formats of the CLI
+const (
+	FormatCSV      = "csv"
+	FormatJSONL    = "jsonl"
+	FormatXLSX     = "xlsx"
+	FormatTable    = "table"
+	FormatSQLite   = "sqlite"
+	FormatTemplate = "template"
+)
+
+// outputFormat returns format if set, otherwise the format matching the
+// extension of path, CSV for other extensions
+func outputFormat(format, path string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".json", ".jsonl", ".ndjson":
+			return FormatJSONL, nil
+		case ".xlsx":
+			return FormatXLSX, nil
+		case ".db", ".sqlite", ".sqlite3":
+			return FormatSQLite, nil
+		}
+		return FormatCSV, nil
+	}
+	switch format = strings.ToLower(format); format {
+	case FormatCSV, FormatJSONL, FormatXLSX, FormatTable, FormatSQLite:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown output format %q, use csv, jsonl, xlsx, table or sqlite", format)
+}
+
+// parseOutputTemplate parses the template of a template output, such as
+// "{{.IP}}:{{.Port}} {{.Domain}}". Its fields are those of ScanResult and
+// join concatenates a list, e.g. {{join .SANs ","}}.
+func parseOutputTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("output").Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown fields only fail when the template is executed
+	if err := tmpl.Execute(io.Discard, ScanResult{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// resultKey identifies the host of a result when merging results
+func resultKey(result ScanResult) string {
+	return net.JoinHostPort(result.IP, strconv.Itoa(result.Port))
+}
+
+// readResults parses the feasible results of an output file in format.
+// Results without a port, as in CSV files without a PORT column, are
+// taken to be on port.
+func readResults(data []byte, format string, port int) ([]ScanResult, error) {
+	var results []ScanResult
+	var err error
+	switch format {
+	case FormatJSONL:
+		// Also take a JSON array of results, as served by the API
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+			if err := json.Unmarshal(trimmed, &results); err != nil {
+				return nil, fmt.Errorf("invalid results: %w", err)
+			}
+			break
+		}
+		s := bufio.NewScanner(bytes.NewReader(data))
+		s.Buffer(nil, 1<<20)
+		for s.Scan() {
+			if line := bytes.TrimSpace(s.Bytes()); len(line) > 0 {
+				var result ScanResult
+				if err := json.Unmarshal(line, &result); err != nil {
+					return nil, fmt.Errorf("invalid result: %w", err)
+				}
+				results = append(results, result)
+			}
+		}
+		err = s.Err()
+	case FormatXLSX:
+		results, err = readExcel(bytes.NewReader(data))
+	default:
+		results, err = ReadResultsCSV(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if results[i].Port == 0 {
+			results[i].Port = port
+		}
+	}
+	return results, nil
+}
+
+// mergeResults returns the feasible results of existing followed by those
+// of results whose IP:port is not among them, and how many were added
+func mergeResults(existing, results []ScanResult) ([]ScanResult, int) {
+	seen := make(map[string]bool, len(existing)+len(results))
+	merged := make([]ScanResult, 0, len(existing)+len(results))
+	for _, result := range existing {
+		seen[resultKey(result)] = true
+		merged = append(merged, result)
+	}
+	added := 0
+	for _, result := range results {
+		if key := resultKey(result); result.Feasible && !seen[key] {
+			seen[key] = true
+			merged = append(merged, result)
+			added++
+		}
+	}
+	return merged, added
+}
+
+// mergeCSVConfig returns config with the optional CSV columns of both
+// config and other
+func mergeCSVConfig(config, other *ScanConfig) *ScanConfig {
+	merged := *config
+	if other.IdleTest > 0 && merged.IdleTest == 0 {
+		merged.IdleTest = other.IdleTest
+	}
+	merged.EnableASN = merged.EnableASN || other.EnableASN
+	merged.ProbePQ = merged.ProbePQ || other.ProbePQ
+	merged.ProbeHTTP = merged.ProbeHTTP || other.ProbeHTTP
+	merged.DualProbe = merged.DualProbe || other.DualProbe
+	merged.TLSDetails = merged.TLSDetails || other.TLSDetails
+	merged.DetectCDN = merged.DetectCDN || other.DetectCDN
+	merged.CheckOCSP = merged.CheckOCSP || other.CheckOCSP
+	merged.ProbeH3 = merged.ProbeH3 || other.ProbeH3
+	merged.ProbeResumption = merged.ProbeResumption || other.ProbeResumption
+	merged.SpeedTestKB = max(merged.SpeedTestKB, other.SpeedTestKB)
+	merged.ProbeHRR = merged.ProbeHRR || other.ProbeHRR
+	merged.Audit = merged.Audit || other.Audit
+	merged.TopList = merged.TopList || other.TopList
+	merged.HappyEyeballs = merged.HappyEyeballs || other.HappyEyeballs
+	merged.DNSMatch = merged.DNSMatch || other.DNSMatch
+	merged.PortColumn = merged.PortColumn || other.PortColumn
+	if len(merged.SNIMatrix) == 0 {
+		merged.SNIMatrix = other.SNIMatrix
+	}
+	return &merged
+}
+
+// resultOutput writes the feasible results of a CLI scan with the
+// ResultWriter of its format, skipping those an appended file already has
+type resultOutput struct {
+	format string
+	config *ScanConfig
+	// tmpl renders the lines of a template output
+	tmpl   *template.Template
+	writer ResultWriter
+
+	mu sync.Mutex
+	// existing holds the results read back from an appended Excel
+	// workbook, which is written again as a whole
+	existing []ScanResult
+	// seen holds the IP:port of the written results when appending
+	seen map[string]bool
+	// skipped counts the results the appended file already had
+	skipped int
+}
+
+// appendTo makes the output add to the results already in f, which is
+// opened for reading and writing. Results whose IP:port the file has are
+// skipped. Text outputs are written after the end of the file, a CSV file
+// with other columns than the scan is rewritten with the columns of both.
+// An Excel workbook is read back and written again on Close.
+func (o *resultOutput) appendTo(f *os.File, port int) error {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	o.seen = make(map[string]bool)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	existing, err := readResults(data, o.format, port)
+	if err != nil {
+		return err
+	}
+	for _, result := range existing {
+		o.seen[resultKey(result)] = true
+	}
+	switch o.format {
+	case FormatXLSX:
+		o.existing = existing
+		return nil
+	case FormatCSV:
+		header, _, _ := strings.Cut(string(data), "\n")
+		config := mergeCSVConfig(o.config, resultsConfig(existing))
+		o.config = config
+		if strings.TrimSpace(header) != strings.TrimSpace(csvHeader(config)) {
+			var b strings.Builder
+			b.WriteString(csvHeader(config))
+			for _, result := range existing {
+				b.WriteString(csvLine(result, config))
+			}
+			if err := f.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := f.WriteAt([]byte(b.String()), 0); err != nil {
+				return err
+			}
+			_, err = f.Seek(0, io.SeekEnd)
+			return err
+		}
+	}
+	// Lines are appended after a last line without a newline
+	if data[len(data)-1] != '\n' {
+		_, err = f.WriteString("\n")
+	}
+	return err
+}
+
+// open starts the writer of the output at path, - for standard output and
+// "" for none. Text formats go to w, an Excel workbook to f and a SQLite
+// database is opened at path with the results as a session of source.
+// Text outputs starting empty get the header of their format.
+func (o *resultOutput) open(w io.Writer, f *os.File, path, source string, port int, tag string) error {
+	header := true
+	if f != nil {
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		header = info.Size() == 0
+	}
+	switch {
+	case path == "":
+		o.writer = nopWriter{}
+		return nil
+	case path == "-" && (o.format == FormatXLSX || o.format == FormatSQLite):
+		return errors.New("standard output takes text formats only")
+	}
+	switch o.format {
+	case FormatJSONL:
+		o.writer = NewJSONLWriter(w)
+	case FormatTemplate:
+		o.writer = NewTemplateWriter(w, o.tmpl)
+	case FormatTable:
+		o.writer = NewTableWriter(w, header)
+	case FormatXLSX:
+		o.writer = NewExcelWriter(f, o.existing)
+	case FormatSQLite:
+		writer, err := NewSQLiteWriter(path, source, port, tag)
+		if err != nil {
+			return err
+		}
+		o.writer = writer
+	default:
+		o.writer = NewCSVWriter(w, o.config, header)
+	}
+	return nil
+}
+
+// Skipped returns how many results were not written as the appended file
+// already had them
+func (o *resultOutput) Skipped() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.skipped
+}
+
+// Add writes a feasible result, unless the appended file already has it
+func (o *resultOutput) Add(result ScanResult) {
+	if o.seen != nil {
+		o.mu.Lock()
+		key := resultKey(result)
+		dup := o.seen[key]
+		if dup {
+			o.skipped++
+		}
+		o.seen[key] = true
+		o.mu.Unlock()
+		if dup {
+			return
+		}
+	}
+	if err := o.writer.Write(result); err != nil {
+		slog.Warn("Error writing result", "ip", result.IP, "err", err)
+	}
+}
+
+// Close writes out what the writer buffered and finishes the output
+func (o *resultOutput) Close() error {
+	if o.writer == nil {
+		return nil
+	}
+	return o.writer.Close()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// runPick implements the `pick` command, which turns a results file into
+// a short list of diverse dests
+func runPick(args []string) {
+	fs := flag.NewFlagSet("pick", flag.ExitOnError)
+	in := fs.String("in", "out.csv", "Results file produced by a scan")
+	out := fs.String("out", "", "Output file for the shortlist, default: stdout")
+	count := fs.Int("n", 5, "Number of dests to pick")
+	uniqueASN := fs.Bool("unique-asn", false, "Never pick two dests from the same ASN (needs a scan with -asn)")
+	uniquePrefix := fs.Int("unique-prefix", 0, "Never pick two dests from the same IPv4 /N, e.g. 16, 0 to disable")
+	minCountries := fs.Int("min-countries", 0, "Minimum number of distinct countries")
+	countryWeight := fs.Float64("country-weight", 0, "Score bonus per distinct country, in milliseconds of latency or certificate score points")
+	by := fs.String("by", "latency", "Rank dests by latency or by certificate score")
+	_ = fs.Parse(args)
+
+	f, err := os.Open(*in)
+	if err != nil {
+		slog.Error("Error reading file", "path", *in)
+		return
+	}
+	defer f.Close()
+	results, err := ReadResultsCSV(f)
+	if err != nil {
+		slog.Error("Error parsing results", "path", *in, "err", err)
+		return
+	}
+
+	score := LatencyScore
+	switch *by {
+	case "latency":
+	case "score":
+		score = CertScore
+	default:
+		slog.Error("Unknown ranking, use latency or score", "by", *by)
+		return
+	}
+
+	picked, err := Shortlist(results, score, ShortlistConstraints{
+		Count:         *count,
+		UniqueASN:     *uniqueASN,
+		UniquePrefix:  *uniquePrefix,
+		MinCountries:  *minCountries,
+		CountryWeight: *countryWeight,
+	})
+	if err != nil {
+		slog.Error("Cannot build shortlist", "candidates", len(results), "err", err)
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		of, err := os.Create(*out)
+		if err != nil {
+			slog.Error("Error opening file", "path", *out)
+			return
+		}
+		defer of.Close()
+		w = of
+	}
+	// Keep the optional columns the scan had
+	config := resultsConfig(results)
+	_, _ = io.WriteString(w, csvHeader(config))
+	for _, result := range picked {
+		_, _ = io.WriteString(w, csvLine(result, config))
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// portScanParser reads the output of port scanners given as input, so that
+// a fast sweep done with masscan or ZMap is only checked for TLS here:
+//
+//   - masscan -oJ, one JSON record per line
+//   - masscan -oL, "open tcp 443 1.2.3.4 1700000000"
+//   - ZMap CSV with a header naming the saddr and sport fields, or lines of
+//     IP and port without one
+//
+// ZMap output of only IPs is a plain list of IPs and needs no parsing.
+// Hits with port 0 are scanned on the port of the scan.
+type portScanParser struct {
+	// saddr and sport are the columns of a CSV header, -1 until one is read
+	saddr, sport int
+}
+
+func newPortScanParser() *portScanParser {
+	return &portScanParser{saddr: -1, sport: -1}
+}
+
+// masscanRecord is a line of masscan -oJ output
+type masscanRecord struct {
+	IP    string `json:"ip"`
+	Ports []struct {
+		Port   int    `json:"port"`
+		Proto  string `json:"proto"`
+		Status string `json:"status"`
+	} `json:"ports"`
+}
+
+// parse returns the open TCP ports a line of port scanner output lists, ok
+// is false for lines of other inputs
+func (p *portScanParser) parse(line string) (hits []netip.AddrPort, ok bool) {
+	switch {
+	case line == "[" || line == "]" || strings.HasPrefix(line, "#"):
+		// Brackets around masscan -oJ records and comments of -oL
+		return nil, true
+	case strings.HasPrefix(line, "{"):
+		var record masscanRecord
+		// Records are separated by commas, older versions put one after
+		// the last record too
+		if err := json.Unmarshal([]byte(strings.TrimSuffix(line, ",")), &record); err != nil || record.IP == "" {
+			// Such as the {finished: 1} line of some versions
+			return nil, true
+		}
+		addr, err := netip.ParseAddr(record.IP)
+		if err != nil {
+			return nil, true
+		}
+		for _, port := range record.Ports {
+			if (port.Proto == "" || port.Proto == "tcp") && (port.Status == "" || port.Status == "open") {
+				hits = appendPortHit(hits, addr, port.Port)
+			}
+		}
+		return hits, true
+	}
+	if fields := strings.Fields(line); len(fields) >= 4 && fields[0] == "open" {
+		if fields[1] != "tcp" {
+			return nil, true
+		}
+		addr, err := netip.ParseAddr(fields[3])
+		port, perr := strconv.Atoi(fields[2])
+		if err != nil || perr != nil {
+			return nil, false
+		}
+		return appendPortHit(nil, addr, port), true
+	}
+	if !strings.Contains(line, ",") && line != "saddr" {
+		return nil, false
+	}
+	fields := strings.Split(line, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	if saddr := slices.Index(fields, "saddr"); saddr >= 0 {
+		p.saddr, p.sport = saddr, slices.Index(fields, "sport")
+		return nil, true
+	}
+	ipField, portField := 0, 1
+	if p.saddr >= 0 {
+		ipField, portField = p.saddr, p.sport
+	}
+	if ipField >= len(fields) || portField >= len(fields) {
+		return nil, false
+	}
+	addr, err := netip.ParseAddr(fields[ipField])
+	if err != nil {
+		return nil, false
+	}
+	if portField < 0 {
+		// A header without the port, the hosts answered on the scanned one
+		return []netip.AddrPort{netip.AddrPortFrom(addr.Unmap(), 0)}, true
+	}
+	port, err := strconv.Atoi(fields[portField])
+	if err != nil {
+		return nil, false
+	}
+	return appendPortHit(nil, addr, port), true
+}
+
+// appendPortHit adds the address and port to hits if the port is valid
+func appendPortHit(hits []netip.AddrPort, addr netip.Addr, port int) []netip.AddrPort {
+	if port < 1 || port > 65535 {
+		return hits
+	}
+	return append(hits, netip.AddrPortFrom(addr.Unmap(), uint16(port)))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of the TCP pre-check
+const (
+	// preCheckFactor is how many pre-check workers the GUI runs per TLS
+	// worker
+	preCheckFactor = 4
+	// defaultPreCheckTimeout is the connect timeout in milliseconds
+	defaultPreCheckTimeout = 500
+)
+
+// preCheck connects to every host of hostChan with Config.PreCheckThreads
+// workers and a short timeout and passes on the hosts that accept the
+// connection, so the slower TLS workers do not wait on dead addresses.
+// Domains, and hosts the TLS stage skips without connecting, are passed on
+// unchecked.
+func (s *Scanner) preCheck(hostChan <-chan Host) <-chan Host {
+	out := make(chan Host)
+	timeout := time.Duration(s.Config.PreCheckTimeout) * time.Millisecond
+	if timeout <= 0 {
+		timeout = defaultPreCheckTimeout * time.Millisecond
+	}
+	var wg sync.WaitGroup
+	wg.Add(s.Config.PreCheckThreads)
+	for i := 0; i < s.Config.PreCheckThreads; i++ {
+		go func() {
+			defer wg.Done()
+			for host := range hostChan {
+				s.waitPaused()
+				if s.ctx.Err() != nil {
+					return
+				}
+				if !s.preCheckSkips(host) && !s.reachable(host, timeout) {
+					if s.ctx.Err() != nil {
+						// Cut short by Stop, not known to be unreachable
+						return
+					}
+					s.Stats.Unreachable.Add(1)
+					s.finishHost(host)
+					continue
+				}
+				select {
+				case out <- host:
+				case <-s.ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// preCheckSkips reports whether host goes to the TLS stage unchecked:
+// domains are resolved there, excluded, recently scanned and hosts outside
+// the allowed countries are never connected to
+func (s *Scanner) preCheckSkips(host Host) bool {
+	if host.IP == nil || s.skip[host.IP.String()] {
+		return true
+	}
+	if !s.countryAllowed(host.IP) {
+		return true
+	}
+	return s.Exclude != nil && s.Exclude.Match(host.IP, s.Geo) != ""
+}
+
+// reachable reports whether host accepts a TCP connection on the port of
+// the scan within timeout, which does not count the time the connection
+// is held back by pacing
+func (s *Scanner) reachable(host Host, timeout time.Duration) bool {
+	address := net.JoinHostPort(host.IP.String(), strconv.Itoa(s.port(host)))
+	if err := s.pace(s.ctx, address); err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	conn, err := s.dialNow(ctx, address)
+	if err != nil {
+		s.log(slog.LevelDebug, "Host unreachable", "ip", host.IP, "err", err)
+		return false
+	}
+	conn.Close()
+	return true
+}
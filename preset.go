@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Presets set up the options of a common task at once
+const (
+	// PresetDest hunts for Reality dests that stay usable: a public
+	// certificate valid for the SNI for at least a month, outside CDNs and
+	// honeypots, with the probes that rank them
+	PresetDest = "dest"
+	// PresetAudit scans one's own servers on the usual Reality ports and
+	// warns when they reveal their real certificate or SNI routing
+	// instead of passing for their dest
+	PresetAudit = "audit"
+)
+
+// presets holds the options of every preset by flag name
+var presets = map[string]map[string]string{
+	PresetDest: {
+		"feasible-sni":      "true",
+		"feasible-min-days": "30",
+		"skip-cdn":          "true",
+		"honeypots":         "true",
+		"http":              "true",
+		"ocsp":              "true",
+		"h3":                "true",
+		"timing":            TimingNormal,
+		"out":               "dests_{source}_{date}.csv",
+	},
+	PresetAudit: {
+		"audit":       "true",
+		"dual":        "true",
+		"tls-details": "true",
+		"ports":       "443,8443,2053,2083,2087,2096",
+		"thread":      "4",
+		"out":         "audit_{source}_{date}.jsonl",
+	},
+}
+
+// presetNames lists the presets for messages
+func presetNames() string {
+	return strings.Join(slices.Sorted(maps.Keys(presets)), ", ")
+}
+
+// applyPreset sets the options of the preset name. Options given on the
+// command line or in a config file keep their value.
+func applyPreset(name string) error {
+	options, ok := presets[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return fmt.Errorf("unknown preset %q, must be one of %s", name, presetNames())
+	}
+	for _, option := range slices.Sorted(maps.Keys(options)) {
+		if isFlagSet(option) {
+			continue
+		}
+		if err := flag.Set(option, options[option]); err != nil {
+			return fmt.Errorf("preset %s, option %q: %w", name, option, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"plugin"
+	"strings"
+	"time"
+)
+
+// Processor handles every result before it is reported, to filter results
+// or add to them. It may change the result and is called from all the
+// workers at once.
+type Processor interface {
+	// OnResult returns ErrDropResult to drop the result, other errors are
+	// logged and the result is kept
+	OnResult(result *ScanResult) error
+}
+
+// ErrDropResult is returned by a Processor for results not to report
+var ErrDropResult = errors.New("result dropped")
+
+// hookTimeout is how long a hook command may take for one result
+const hookTimeout = 10 * time.Second
+
+// CommandProcessor runs a command for every result, with the result as
+// JSON on its standard input. The command keeps the result by exiting with
+// status 0, replacing it with the JSON it prints if any, and drops it by
+// exiting with status 1, like grep -q does when nothing matches.
+type CommandProcessor struct {
+	Args []string
+}
+
+// NewCommandProcessor returns a processor running command, a program and
+// its arguments separated by spaces
+func NewCommandProcessor(command string) (*CommandProcessor, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty hook command")
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		return nil, err
+	}
+	return &CommandProcessor{Args: args}, nil
+}
+
+func (p *CommandProcessor) OnResult(result *ScanResult) error {
+	input, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Args[0], p.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(append(input, '\n'))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return ErrDropResult
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return replaceResult(result, output)
+}
+
+// replaceResult replaces result with the JSON a processor returned, blank
+// output keeps it as it is
+func replaceResult(result *ScanResult, output []byte) error {
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil
+	}
+	var changed ScanResult
+	if err := json.Unmarshal(output, &changed); err != nil {
+		return fmt.Errorf("invalid result: %w", err)
+	}
+	*result = changed
+	return nil
+}
+
+// PluginProcessor calls the OnResult function of a Go plugin. Plugins cannot
+// import the scanner, so the function takes and returns results as JSON:
+//
+//	func OnResult(result []byte) (changed []byte, keep bool, err error)
+//
+// A nil changed keeps the result as it is.
+type PluginProcessor struct {
+	onResult func([]byte) ([]byte, bool, error)
+}
+
+// OpenPluginProcessor loads the plugin at path, built with
+// go build -buildmode=plugin. Plugins are only supported on Linux and macOS.
+func OpenPluginProcessor(path string) (*PluginProcessor, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	symbol, err := p.Lookup("OnResult")
+	if err != nil {
+		return nil, err
+	}
+	onResult, ok := symbol.(func([]byte) ([]byte, bool, error))
+	if !ok {
+		return nil, fmt.Errorf("OnResult of %s is a %T, not a func([]byte) ([]byte, bool, error)", path, symbol)
+	}
+	return &PluginProcessor{onResult: onResult}, nil
+}
+
+func (p *PluginProcessor) OnResult(result *ScanResult) error {
+	input, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	output, keep, err := p.onResult(input)
+	if err != nil {
+		return err
+	}
+	if !keep {
+		return ErrDropResult
+	}
+	return replaceResult(result, output)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateWindow is how far back the current rate of a scan looks, long enough
+// to smooth out slow hosts but short enough to follow the adaptive limit
+const rateWindow = 10 * time.Second
+
+// ScanProgress is how far and how fast a scan got, as shown in the status
+// bar of the GUI and logged periodically by the CLI
+type ScanProgress struct {
+	Elapsed time.Duration
+	// Hosts counts every host finished, including extra ones such as the
+	// networks around feasible hosts. Done counts the hosts of the source,
+	// Total is their number, 0 if unknown.
+	Hosts int64
+	Done  int64
+	Total int
+	// Rate is the hosts finished per second over the last rateWindow
+	Rate     float64
+	Results  int64
+	Feasible int64
+}
+
+// SuccessRatio is the share of the finished hosts that completed a
+// handshake
+func (p ScanProgress) SuccessRatio() float64 {
+	if p.Hosts == 0 {
+		return 0
+	}
+	return float64(p.Results) / float64(p.Hosts)
+}
+
+// Left estimates the time until the source is done at the rate so far, 0
+// when the total is unknown or nothing is done yet
+func (p ScanProgress) Left() time.Duration {
+	if p.Total <= 0 || p.Done == 0 || p.Done >= int64(p.Total) {
+		return 0
+	}
+	return time.Duration(float64(p.Elapsed) * float64(int64(p.Total)-p.Done) / float64(p.Done))
+}
+
+// rateSample is the number of hosts finished at a time
+type rateSample struct {
+	at    time.Time
+	hosts int64
+}
+
+// rateMeter follows the rate of finished hosts from samples taken whenever
+// the progress is asked for
+type rateMeter struct {
+	mu      sync.Mutex
+	samples []rateSample
+}
+
+// rate adds a sample and returns the hosts per second since the oldest
+// sample within rateWindow, or the last one before it when asked rarely
+func (m *rateMeter) rate(now time.Time, hosts int64) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples = append(m.samples, rateSample{now, hosts})
+	for len(m.samples) > 2 && now.Sub(m.samples[1].at) >= rateWindow {
+		m.samples = m.samples[1:]
+	}
+	first := m.samples[0]
+	elapsed := now.Sub(first.at)
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(hosts-first.hosts) / elapsed.Seconds()
+}
+
+// reset starts the meter over at now
+func (m *rateMeter) reset(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.samples = []rateSample{{at: now}}
+}
+
+// Progress returns how far and how fast the scan got so far
+func (s *Scanner) Progress() ScanProgress {
+	now := time.Now()
+	hosts := s.Stats.Hosts.Load()
+	p := ScanProgress{
+		Hosts:    hosts,
+		Done:     s.progress.Load(),
+		Total:    s.Total,
+		Rate:     s.rate.rate(now, hosts),
+		Results:  s.Stats.Results.Load(),
+		Feasible: s.Stats.Feasible.Load(),
+	}
+	if started := s.started.Load(); started != nil {
+		p.Elapsed = now.Sub(*started)
+	}
+	return p
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Protocol buffer wire types used by the gRPC API
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errProtoTruncated = errors.New("truncated protobuf message")
+
+// protoBuffer encodes a protocol buffer message. Like proto3, fields holding
+// the zero value are left out.
+type protoBuffer []byte
+
+func (b *protoBuffer) tag(num, wire int) {
+	*b = binary.AppendUvarint(*b, uint64(num)<<3|uint64(wire))
+}
+
+func (b *protoBuffer) uint(num int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.tag(num, wireVarint)
+	*b = binary.AppendUvarint(*b, v)
+}
+
+func (b *protoBuffer) int(num int, v int64) {
+	b.uint(num, uint64(v))
+}
+
+func (b *protoBuffer) bool(num int, v bool) {
+	if v {
+		b.uint(num, 1)
+	}
+}
+
+func (b *protoBuffer) double(num int, v float64) {
+	if v == 0 {
+		return
+	}
+	b.tag(num, wireFixed64)
+	*b = binary.LittleEndian.AppendUint64(*b, math.Float64bits(v))
+}
+
+func (b *protoBuffer) string(num int, s string) {
+	if s == "" {
+		return
+	}
+	b.tag(num, wireBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(s)))
+	*b = append(*b, s...)
+}
+
+func (b *protoBuffer) strings(num int, list []string) {
+	for _, s := range list {
+		b.tag(num, wireBytes)
+		*b = binary.AppendUvarint(*b, uint64(len(s)))
+		*b = append(*b, s...)
+	}
+}
+
+func (b *protoBuffer) message(num int, m protoBuffer) {
+	b.tag(num, wireBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(m)))
+	*b = append(*b, m...)
+}
+
+// protoField is a decoded field, v holds varints and fixed numbers and data
+// length delimited values
+type protoField struct {
+	num  int
+	wire int
+	v    uint64
+	data []byte
+}
+
+func (f protoField) int() int        { return int(int64(f.v)) }
+func (f protoField) bool() bool      { return f.v != 0 }
+func (f protoField) double() float64 { return math.Float64frombits(f.v) }
+func (f protoField) string() string  { return string(f.data) }
+
+// decodeProto calls fn for every field of a protocol buffer message, in
+// the order they were encoded
+func decodeProto(b []byte, fn func(f protoField) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		b = b[n:]
+		f := protoField{num: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.v, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errProtoTruncated
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return errProtoTruncated
+			}
+			f.v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case wireFixed32:
+			if len(b) < 4 {
+				return errProtoTruncated
+			}
+			f.v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return errProtoTruncated
+			}
+			f.data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return errors.New("unsupported protobuf wire type")
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
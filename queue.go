@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+)
+
+// expansion is a network around a feasible host that is being scanned
+type expansion struct {
+	prefix netip.Prefix
+	next   netip.Addr
+	// hit is the feasible host itself, which is not scanned again
+	hit netip.Addr
+}
+
+// hostDeferMax bounds the hosts held back because their network is at
+// its in-flight cap, the source is not read further while it is reached
+const hostDeferMax = 4096
+
+// hostQueue hands hosts to the workers. Besides the source channel it
+// holds networks added while scanning, which are served first. It is
+// drained once the source is exhausted, no networks are left and no
+// worker is scanning a host that could still add one.
+//
+// With a network cap, no more than cap hosts of one IPv4 /16 (IPv6 /48)
+// are scanned at the same time. Hosts over the cap are held back and
+// scanned once a slot frees up, so other inputs are not starved. Domains
+// are not capped, their network is only known once they are resolved.
+type hostQueue struct {
+	source <-chan Host
+	netCap int
+
+	mu         sync.Mutex
+	sourceDone bool
+	active     int
+	inflight   map[netip.Prefix]int
+	deferred   []Host
+	expansions []*expansion
+	expanded   map[netip.Prefix]bool
+	// wake is closed and replaced whenever the queue changes
+	wake chan struct{}
+}
+
+func newHostQueue(source <-chan Host, netCap int) *hostQueue {
+	return &hostQueue{
+		source:   source,
+		netCap:   netCap,
+		inflight: make(map[netip.Prefix]int),
+		expanded: make(map[netip.Prefix]bool),
+		wake:     make(chan struct{}),
+	}
+}
+
+// hostNetwork returns the network an in-flight cap applies to, an invalid
+// prefix for domains that are not resolved yet
+func hostNetwork(ip net.IP) netip.Prefix {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Prefix{}
+	}
+	addr = addr.Unmap()
+	bits := 16
+	if addr.Is6() {
+		bits = 48
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix
+}
+
+// broadcast wakes up all waiting workers, q.mu must be held
+func (q *hostQueue) broadcast() {
+	close(q.wake)
+	q.wake = make(chan struct{})
+}
+
+// fits reports whether the network of ip is below its cap, q.mu must be
+// held
+func (q *hostQueue) fits(ip net.IP) bool {
+	if q.netCap <= 0 {
+		return true
+	}
+	network := hostNetwork(ip)
+	return !network.IsValid() || q.inflight[network] < q.netCap
+}
+
+// start counts host as in flight, q.mu must be held
+func (q *hostQueue) start(host Host) {
+	q.active++
+	if network := hostNetwork(host.IP); q.netCap > 0 && network.IsValid() {
+		q.inflight[network]++
+	}
+}
+
+// popExpansion returns the next host of the oldest network below its cap,
+// q.mu must be held
+func (q *hostQueue) popExpansion() (Host, bool) {
+	for i := 0; i < len(q.expansions); {
+		e := q.expansions[i]
+		if e.next == e.hit {
+			e.next = e.next.Next()
+		}
+		if !e.next.IsValid() || !e.prefix.Contains(e.next) {
+			q.expansions = append(q.expansions[:i], q.expansions[i+1:]...)
+			continue
+		}
+		// A network at its cap does not hold back the ones after it
+		if !q.fits(net.IP(e.next.AsSlice())) {
+			i++
+			continue
+		}
+		addr := e.next
+		e.next = addr.Next()
+		return Host{
+			IP:     net.IP(addr.AsSlice()),
+			Origin: e.prefix.String(),
+			Type:   HostTypeIP,
+			Index:  -1,
+		}, true
+	}
+	return Host{}, false
+}
+
+// popDeferred returns the oldest held back host whose network has a free
+// slot, q.mu must be held
+func (q *hostQueue) popDeferred() (Host, bool) {
+	for i, host := range q.deferred {
+		if q.fits(host.IP) {
+			q.deferred = append(q.deferred[:i], q.deferred[i+1:]...)
+			return host, true
+		}
+	}
+	return Host{}, false
+}
+
+// Next returns the next host to scan, or false when the queue is drained
+// or ctx is done. Every host returned must be released with Done.
+func (q *hostQueue) Next(ctx context.Context) (Host, bool) {
+	for {
+		if ctx.Err() != nil {
+			return Host{}, false
+		}
+		q.mu.Lock()
+		host, ok := q.popDeferred()
+		if !ok {
+			host, ok = q.popExpansion()
+		}
+		if ok {
+			q.start(host)
+			q.mu.Unlock()
+			return host, true
+		}
+		if q.sourceDone && q.active == 0 && len(q.deferred) == 0 {
+			q.mu.Unlock()
+			return Host{}, false
+		}
+		wake := q.wake
+		source := q.source
+		if q.sourceDone || len(q.deferred) >= hostDeferMax {
+			// A nil channel never delivers, only wait for changes
+			source = nil
+		}
+		q.mu.Unlock()
+
+		select {
+		case host, ok := <-source:
+			q.mu.Lock()
+			if !ok {
+				q.sourceDone = true
+				q.broadcast()
+				q.mu.Unlock()
+				continue
+			}
+			if !q.fits(host.IP) {
+				q.deferred = append(q.deferred, host)
+				q.mu.Unlock()
+				continue
+			}
+			q.start(host)
+			q.mu.Unlock()
+			return host, true
+		case <-wake:
+		case <-ctx.Done():
+			return Host{}, false
+		}
+	}
+}
+
+// Done marks a host returned by Next as scanned
+func (q *hostQueue) Done(host Host) {
+	q.mu.Lock()
+	q.active--
+	if network := hostNetwork(host.IP); q.netCap > 0 && network.IsValid() {
+		if q.inflight[network]--; q.inflight[network] <= 0 {
+			delete(q.inflight, network)
+		}
+	}
+	q.broadcast()
+	q.mu.Unlock()
+}
+
+// Expand adds the network of ip with the given IPv4 prefix length to the
+// queue, unless it has been added before. IPv6 networks get the same
+// number of addresses.
+func (q *hostQueue) Expand(ip net.IP, bits int) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		bits += 96
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.expanded[prefix] {
+		return
+	}
+	q.expanded[prefix] = true
+	q.expansions = append(q.expansions, &expansion{prefix: prefix, next: prefix.Addr(), hit: addr})
+	q.broadcast()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by all workers of a scan that paces
+// new connections independently of the thread count
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens added per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter allowing rate connections per second
+// with up to burst of them at once
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a connection may be opened or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// Take the token now and wait until it has been earned, so waiting
+	// workers are served in order
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Hand the token back to the workers still waiting
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Full reports whether the bucket has refilled by now, so dropping the
+// limiter loses nothing
+func (l *RateLimiter) Full(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.tokens+now.Sub(l.last).Seconds()*l.rate >= l.burst
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"fyne.io/fyne/v2/lang"
+)
+
+// reportTopIssuers is how many issuers a report lists
+const reportTopIssuers = 10
+
+// ScanReport summarizes a finished scan
+type ScanReport struct {
+	Source  string
+	Started time.Time
+	Elapsed time.Duration
+	// Scanned counts the hosts taken off the queue, Responsive the ones
+	// that completed a handshake and Feasible the ones that met the criteria
+	Scanned    int64
+	Responsive int64
+	Feasible   int64
+	// Countries are sorted by responsive hosts, Issuers by feasible hosts
+	Countries []CountryCount
+	Issuers   []IssuerCount
+	// AvgConnectMs and AvgHandshakeMs are the mean timings of the
+	// responsive hosts
+	AvgConnectMs   float64
+	AvgHandshakeMs float64
+	// HandshakeTimes is the distribution of the handshake times of the
+	// responsive hosts
+	HandshakeTimes []LatencyBucket
+	// SlowHosts are the feasible hosts that took longest, the slowest
+	// first, candidates to drop for a laggy connection
+	SlowHosts []SlowHost
+}
+
+// CountryCount is the number of responsive and feasible hosts in a country
+type CountryCount struct {
+	Code       string
+	Responsive int64
+	Feasible   int64
+}
+
+// IssuerCount is the number of feasible hosts with certificates of an
+// issuer
+type IssuerCount struct {
+	Issuer   string
+	Feasible int64
+}
+
+// Report summarizes the scan so far, which started at started
+func (st *ScanStats) Report(source string, started time.Time) ScanReport {
+	r := ScanReport{
+		Source:     source,
+		Started:    started,
+		Elapsed:    time.Since(started).Truncate(time.Second),
+		Scanned:    st.Hosts.Load(),
+		Responsive: st.Results.Load(),
+		Feasible:   st.Feasible.Load(),
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for code, n := range st.responsive {
+		r.Countries = append(r.Countries, CountryCount{Code: code, Responsive: n, Feasible: st.countries[code]})
+	}
+	sort.Slice(r.Countries, func(i, j int) bool {
+		a, b := r.Countries[i], r.Countries[j]
+		if a.Responsive != b.Responsive {
+			return a.Responsive > b.Responsive
+		}
+		return a.Code < b.Code
+	})
+	for issuer, n := range st.issuers {
+		r.Issuers = append(r.Issuers, IssuerCount{Issuer: issuer, Feasible: n})
+	}
+	sort.Slice(r.Issuers, func(i, j int) bool {
+		a, b := r.Issuers[i], r.Issuers[j]
+		if a.Feasible != b.Feasible {
+			return a.Feasible > b.Feasible
+		}
+		return a.Issuer < b.Issuer
+	})
+	r.Issuers = r.Issuers[:min(len(r.Issuers), reportTopIssuers)]
+	if r.Responsive > 0 {
+		r.AvgConnectMs = float64(st.connectMs) / float64(r.Responsive)
+		r.AvgHandshakeMs = float64(st.handshakeMs) / float64(r.Responsive)
+	}
+	r.HandshakeTimes = st.handshakes.buckets()
+	r.SlowHosts = slices.Clone(st.slowest)
+	return r
+}
+
+// reportTable is a titled table of a report
+type reportTable struct {
+	title   string
+	headers []string
+	rows    [][]string
+}
+
+// facts returns the labeled totals of the report
+func (r ScanReport) facts() [][2]string {
+	percent := func(n, of int64) string {
+		if of == 0 {
+			return strconv.FormatInt(n, 10)
+		}
+		return fmt.Sprintf("%d (%.1f%%)", n, float64(n)*100/float64(of))
+	}
+	return [][2]string{
+		{lang.X("report.source", "Source"), r.Source},
+		{lang.X("report.started", "Started"), r.Started.Format(time.DateTime)},
+		{lang.X("report.elapsed", "Elapsed"), r.Elapsed.String()},
+		{lang.X("report.scanned", "Scanned"), strconv.FormatInt(r.Scanned, 10)},
+		{lang.X("report.responsive", "Responsive"), percent(r.Responsive, r.Scanned)},
+		{lang.X("report.feasible", "Feasible"), percent(r.Feasible, r.Responsive)},
+		{lang.X("report.latency", "Average latency"), lang.X("report.latency_value",
+			"connect {{.Connect}} ms, handshake {{.Handshake}} ms", map[string]any{
+				"Connect":   strconv.FormatFloat(r.AvgConnectMs, 'f', 0, 64),
+				"Handshake": strconv.FormatFloat(r.AvgHandshakeMs, 'f', 0, 64),
+			})},
+	}
+}
+
+// tables returns the per-country, issuer, handshake time and slow host
+// breakdowns of the report
+func (r ScanReport) tables() []reportTable {
+	countries := reportTable{
+		title: lang.X("report.countries", "Countries"),
+		headers: []string{lang.X("report.country", "Country"), lang.X("report.responsive", "Responsive"),
+			lang.X("report.feasible", "Feasible")},
+	}
+	for _, c := range r.Countries {
+		countries.rows = append(countries.rows, []string{c.Code, strconv.FormatInt(c.Responsive, 10),
+			strconv.FormatInt(c.Feasible, 10)})
+	}
+	issuers := reportTable{
+		title:   lang.X("report.issuers", "Top issuers"),
+		headers: []string{lang.X("report.issuer", "Issuer"), lang.X("report.feasible", "Feasible")},
+	}
+	for _, i := range r.Issuers {
+		issuers.rows = append(issuers.rows, []string{i.Issuer, strconv.FormatInt(i.Feasible, 10)})
+	}
+	handshakes := reportTable{
+		title:   lang.X("report.handshake_times", "Handshake times"),
+		headers: []string{lang.X("report.handshake", "Handshake"), lang.X("report.responsive", "Responsive")},
+	}
+	for i, bucket := range r.HandshakeTimes {
+		label := lang.X("report.up_to_ms", "up to {{.Ms}} ms", map[string]any{"Ms": bucket.UpToMs})
+		if bucket.UpToMs == 0 {
+			label = lang.X("report.over_ms", "over {{.Ms}} ms", map[string]any{"Ms": r.HandshakeTimes[i-1].UpToMs})
+		}
+		handshakes.rows = append(handshakes.rows, []string{label, strconv.FormatInt(bucket.Hosts, 10)})
+	}
+	slow := reportTable{
+		title: lang.X("report.slow_hosts", "Slowest feasible hosts"),
+		headers: []string{lang.X("report.host", "Host"), lang.X("report.domain", "Domain"),
+			lang.X("report.connect_ms", "Connect ms"), lang.X("report.handshake_ms", "Handshake ms")},
+	}
+	for _, h := range r.SlowHosts {
+		slow.rows = append(slow.rows, []string{net.JoinHostPort(h.IP, strconv.Itoa(h.Port)), h.Domain,
+			strconv.Itoa(h.ConnectMs), strconv.Itoa(h.HandshakeMs)})
+	}
+	return []reportTable{countries, issuers, handshakes, slow}
+}
+
+// Markdown renders the report as a Markdown document
+func (r ScanReport) Markdown() string {
+	var b strings.Builder
+	b.WriteString("# " + lang.X("report.title", "Scan report") + "\n\n")
+	for _, fact := range r.facts() {
+		fmt.Fprintf(&b, "- **%s:** %s\n", fact[0], markdownEscaper.Replace(fact[1]))
+	}
+	for _, table := range r.tables() {
+		if len(table.rows) == 0 {
+			continue
+		}
+		b.WriteString("\n## " + table.title + "\n\n")
+		b.WriteString("| " + strings.Join(table.headers, " | ") + " |\n|")
+		for i := range table.headers {
+			if i == 0 {
+				b.WriteString(" --- |")
+			} else {
+				b.WriteString(" ---: |")
+			}
+		}
+		b.WriteString("\n")
+		for _, row := range table.rows {
+			cells := make([]string, len(row))
+			for i, cell := range row {
+				cells[i] = markdownEscaper.Replace(cell)
+			}
+			b.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+		}
+	}
+	return b.String()
+}
+
+// markdownEscaper keeps issuer names and sources from breaking tables and
+// emphasis
+var markdownEscaper = strings.NewReplacer("|", `\|`, "*", `\*`, "_", `\_`, "`", "\\`")
+
+// HTML renders the report as a standalone HTML page
+func (r ScanReport) HTML() string {
+	var b strings.Builder
+	title := html.EscapeString(lang.X("report.title", "Scan report"))
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>" + title + "</title>\n" +
+		"<style>body{font-family:sans-serif;margin:2em}table{border-collapse:collapse}" +
+		"th,td{border:1px solid #ccc;padding:4px 8px}td+td{text-align:right}</style>\n</head>\n<body>\n")
+	b.WriteString("<h1>" + title + "</h1>\n<ul>\n")
+	for _, fact := range r.facts() {
+		fmt.Fprintf(&b, "<li><b>%s:</b> %s</li>\n", html.EscapeString(fact[0]), html.EscapeString(fact[1]))
+	}
+	b.WriteString("</ul>\n")
+	for _, table := range r.tables() {
+		if len(table.rows) == 0 {
+			continue
+		}
+		b.WriteString("<h2>" + html.EscapeString(table.title) + "</h2>\n<table>\n<tr>")
+		for _, header := range table.headers {
+			b.WriteString("<th>" + html.EscapeString(header) + "</th>")
+		}
+		b.WriteString("</tr>\n")
+		for _, row := range table.rows {
+			b.WriteString("<tr>")
+			for _, cell := range row {
+				b.WriteString("<td>" + html.EscapeString(cell) + "</td>")
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</table>\n")
+	}
+	b.WriteString("</body>\n</html>\n")
+	return b.String()
+}
+
+// Render returns the report as HTML for paths ending in .html or .htm,
+// as Markdown otherwise
+func (r ScanReport) Render(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		return r.HTML()
+	}
+	return r.Markdown()
+}
+
+// WriteFile writes the report to path in the format of its extension
+func (r ScanReport) WriteFile(path string) error {
+	return os.WriteFile(path, []byte(r.Render(path)), 0644)
+}
+
+// Text renders the report as plain text with aligned columns
+func (r ScanReport) Text() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	for _, fact := range r.facts() {
+		fmt.Fprintf(w, "%s:\t%s\n", fact[0], fact[1])
+	}
+	w.Flush()
+	for _, table := range r.tables() {
+		if len(table.rows) == 0 {
+			continue
+		}
+		b.WriteString("\n" + table.title + "\n")
+		w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+		for _, row := range append([][]string{table.headers}, table.rows...) {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+	}
+	return b.String()
+}
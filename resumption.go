@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"time"
+)
+
+// Resumption behaviors recorded in ScanResult.Resumption
+const (
+	// ResumptionNone is a host that issued no session ticket
+	ResumptionNone = "none"
+	// ResumptionTicket is a host that issued a ticket but did a full
+	// handshake when it was presented
+	ResumptionTicket = "ticket"
+	// ResumptionResumed is a host that resumed the session of its ticket
+	ResumptionResumed = "resumed"
+)
+
+// ticketWait is how long the probe waits after the handshake for TLS 1.3
+// session tickets, which servers send right after it
+const ticketWait = time.Second
+
+// ticketCache is the session cache of one probe, recording whether the host
+// issued a ticket
+type ticketCache struct {
+	tls.ClientSessionCache
+	issued bool
+}
+
+func (c *ticketCache) Put(sessionKey string, cs *tls.ClientSessionState) {
+	if cs != nil {
+		c.issued = true
+	}
+	c.ClientSessionCache.Put(sessionKey, cs)
+}
+
+// probeResumption completes a handshake to get a session ticket and a second
+// one presenting it, returning the behavior of the host
+func (s *Scanner) probeResumption(hostPort, sni string) string {
+	cache := &ticketCache{ClientSessionCache: tls.NewLRUClientSessionCache(1)}
+	tlsCfg := &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         s.Config.Feasibility.nextProtos(),
+		CurvePreferences:   []tls.CurveID{tls.X25519},
+		ServerName:         sni,
+		ClientSessionCache: cache,
+	}
+	c, err := s.probeConn(hostPort, tlsCfg)
+	if err != nil {
+		s.log(slog.LevelDebug, "Resumption probe failed", "target", hostPort, "err", err)
+		return ""
+	}
+	// TLS 1.3 tickets follow the handshake and are only taken in by a read,
+	// which then times out as the client sent no request
+	if c.ConnectionState().Version == tls.VersionTLS13 {
+		_ = c.SetReadDeadline(time.Now().Add(min(ticketWait, time.Duration(s.Config.Timeout)*time.Second)))
+		_, _ = c.Read(make([]byte, 1))
+	}
+	c.Close()
+	if !cache.issued {
+		return ResumptionNone
+	}
+	c, err = s.probeConn(hostPort, tlsCfg)
+	if err != nil {
+		s.log(slog.LevelDebug, "Resumed handshake failed", "target", hostPort, "err", err)
+		return ResumptionTicket
+	}
+	defer c.Close()
+	if c.ConnectionState().DidResume {
+		return ResumptionResumed
+	}
+	return ResumptionTicket
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Delays between the attempts to reach a host, doubled after every retry
+const (
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 8 * time.Second
+)
+
+// transientError reports whether a failed connection attempt may succeed
+// when repeated: timeouts and connections dropped midway. Closed ports and
+// TLS alerts are answers of the host and are not retried.
+func transientError(err error) bool {
+	switch {
+	case err == nil, errors.Is(err, context.Canceled), errors.Is(err, syscall.ECONNREFUSED):
+		return false
+	case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryDelay is the wait before attempt number attempt+1, with jitter so
+// hosts failing together are not retried together
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << min(attempt-1, 4)
+	delay = min(delay, retryMaxDelay)
+	return delay/2 + rand.N(delay)
+}
+
+// backoff waits before the next attempt and reports whether the scan is
+// still running
+func (s *Scanner) backoff(attempt int) bool {
+	timer := time.NewTimer(retryDelay(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
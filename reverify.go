@@ -0,0 +1,28 @@
+package main
+
+// ReverifyHosts returns the hosts of the feasible results of an earlier
+// scan, each on its own port, to check which of them are still feasible.
+// Candidate lists go stale within weeks as sites move or change
+// certificates.
+func ReverifyHosts(results []ScanResult) []Host {
+	var hosts []Host
+	seen := make(map[string]bool)
+	for _, result := range results {
+		key := resultKey(result)
+		if !result.Feasible || seen[key] {
+			continue
+		}
+		seen[key] = true
+		origin := result.Origin
+		if origin == "" {
+			origin = result.IP
+		}
+		host := knownHost(result.IP, origin, len(hosts))
+		if host.IP == nil {
+			continue
+		}
+		host.Port = result.Port
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
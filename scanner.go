@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bytes"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log/slog"
 	"net"
@@ -10,175 +12,466 @@ import (
 	"time"
 )
 
-func ScanTLS(host Host, out chan<- string, geo *Geo, config *ScanConfig) {
-	if host.IP == nil {
-		ip, err := LookupIP(host.Origin, config.EnableIPv6)
-		if err != nil {
-			slog.Debug("Failed to get IP from the origin", "origin", host.Origin, "err", err)
+// ScanTLS connects to the host, performs a TLS handshake and reports the
+// result through the scanner callbacks. Every address a domain resolves
+// to is scanned in turn, keeping the domain as the origin, unless its
+// IPv6 and IPv4 addresses race with Happy Eyeballs.
+func ScanTLS(host Host, s *Scanner) {
+	if host.IP != nil {
+		scanHost(host, s)
+		return
+	}
+	ips, err := s.resolver.LookupIPs(s.ctx, host.Origin, s.Config.EnableIPv6)
+	if err != nil {
+		s.log(slog.LevelDebug, "Failed to get IP from the origin", "origin", host.Origin, "err", err)
+		return
+	}
+	if s.Config.HappyEyeballs && dualStack(ips) {
+		s.raceFamilies(host, ips)
+		return
+	}
+	for _, ip := range ips {
+		if s.ctx.Err() != nil {
 			return
 		}
 		host.IP = ip
+		scanHost(host, s)
 	}
-	hostPort := net.JoinHostPort(host.IP.String(), strconv.Itoa(config.Port))
-	conn, err := net.DialTimeout("tcp", hostPort, time.Duration(config.Timeout)*time.Second)
-	if err != nil {
-		slog.Debug("Cannot dial", "target", hostPort)
+}
+
+// scanHost scans the IP of host
+func scanHost(host Host, s *Scanner) {
+	if !s.admitted(host) {
 		return
 	}
-	defer conn.Close()
-	err = conn.SetDeadline(time.Now().Add(time.Duration(config.Timeout) * time.Second))
-	if err != nil {
-		slog.Error("Error setting deadline", "err", err)
+	port := s.port(host)
+	if !s.markScanned(host, port) {
 		return
 	}
+	scanAdmitted(host, port, s, nil)
+}
+
+// admitted reports whether the IP of host passes the exclusion list, the
+// country filter and caps and was not scanned recently
+func (s *Scanner) admitted(host Host) bool {
+	if s.Exclude != nil {
+		if entry := s.Exclude.Match(host.IP, s.Geo); entry != "" {
+			s.log(slog.LevelDebug, "Skipping excluded host", "ip", host.IP, "origin", host.Origin, "entry", entry)
+			s.Stats.Excluded.Add(1)
+			return false
+		}
+	}
+	if !s.countryAllowed(host.IP) {
+		s.log(slog.LevelDebug, "Skipping host outside the allowed countries", "ip", host.IP, "origin", host.Origin)
+		s.Stats.OtherCountries.Add(1)
+		return false
+	}
+	if s.capReached(host.IP) {
+		s.log(slog.LevelDebug, "Skipping host of a country or AS with enough feasible hosts", "ip", host.IP, "origin", host.Origin)
+		s.Stats.Capped.Add(1)
+		return false
+	}
+	if s.skip[host.IP.String()] {
+		s.log(slog.LevelDebug, "Skipping recently scanned host", "ip", host.IP)
+		return false
+	}
+	return true
+}
+
+// markScanned records the IP and port of host as scanned, false if they
+// were already scanned earlier in the session
+func (s *Scanner) markScanned(host Host, port int) bool {
+	if s.seen != nil && !s.seen.Add(host.IP, port) {
+		s.log(slog.LevelDebug, "Skipping host scanned earlier in the session", "ip", host.IP, "origin", host.Origin)
+		s.Stats.Duplicates.Add(1)
+		return false
+	}
+	if s.Session != nil {
+		if err := s.Session.MarkScanned(host.IP, port); err != nil {
+			s.log(slog.LevelWarn, "Cannot store scanned host", "ip", host.IP, "err", err)
+		}
+	}
+	return true
+}
+
+// scanAdmitted scans host once admitted and marked as scanned. race is the
+// Happy Eyeballs race host won with its connection, nil to dial it.
+func scanAdmitted(host Host, port int, s *Scanner, race *familyRace) {
+	hostPort := net.JoinHostPort(host.IP.String(), strconv.Itoa(port))
+	sni := s.serverName(host)
 	tlsCfg := &tls.Config{
 		InsecureSkipVerify: true,
-		NextProtos:         []string{"h2", "http/1.1"},
+		NextProtos:         s.Config.Feasibility.nextProtos(),
 		CurvePreferences:   []tls.CurveID{tls.X25519},
+		ServerName:         sni,
 	}
-	if host.Type == HostTypeDomain {
-		tlsCfg.ServerName = host.Origin
+	var c *tls.Conn
+	var connectTime, handshakeTime time.Duration
+	var err error
+	attempts := 0
+	for {
+		attempts++
+		if race != nil && attempts == 1 {
+			connectTime = race.connectTime
+			c, handshakeTime, err = s.handshake(race.conn, tlsCfg)
+		} else {
+			c, connectTime, handshakeTime, err = s.connect(hostPort, tlsCfg)
+		}
+		if err == nil || attempts > s.Config.Retries || !transientError(err) {
+			break
+		}
+		s.log(slog.LevelDebug, "Retrying host", "target", hostPort, "attempt", attempts, "err", err)
+		if !s.backoff(attempts) {
+			break
+		}
 	}
-	c := tls.Client(conn, tlsCfg)
-	err = c.Handshake()
 	if err != nil {
-		slog.Debug("TLS handshake failed", "target", hostPort)
+		s.log(slog.LevelDebug, "Cannot connect", "target", hostPort, "attempts", attempts, "err", err)
+		s.recordAttempt(err)
 		return
 	}
+	s.recordAttempt(nil)
+	// The connection may be handed over to the idle queue, which closes it
+	keep := false
+	defer func() {
+		if !keep {
+			c.NetConn().Close()
+		}
+	}()
 	state := c.ConnectionState()
 	alpn := state.NegotiatedProtocol
-	
-	// Extract domain from certificate
-	// Prefer DNSNames (Subject Alternative Names) over CommonName
-	cert := state.PeerCertificates[0]
-	domain := ""
-	if len(cert.DNSNames) > 0 {
-		// Use first DNS name from SANs
-		domain = cert.DNSNames[0]
-	} else if cert.Subject.CommonName != "" {
-		// Fallback to CommonName if no SANs
-		domain = cert.Subject.CommonName
+
+	// Safely access certificate data
+	if len(state.PeerCertificates) == 0 {
+		s.log(slog.LevelDebug, "No peer certificates", "target", hostPort)
+		return
 	}
-	
+
+	cert := state.PeerCertificates[0]
+	domain := certDomain(cert)
+
 	issuers := strings.Join(cert.Issuer.Organization, " | ")
-	log := slog.Info
-	feasible := true
-	geoCode := geo.GetGeo(host.IP)
-	if state.Version != tls.VersionTLS13 || alpn != "h2" || len(domain) == 0 || len(issuers) == 0 {
-		// not feasible
-		log = slog.Debug
-		feasible = false
-	} else {
-		out <- strings.Join([]string{host.IP.String(), host.Origin, domain, "\"" + issuers + "\"", geoCode}, ",") +
-			"\n"
-	}
-	log("Connected to target", "feasible", feasible, "ip", host.IP.String(),
+	geoCode := s.Geo.GetGeo(host.IP)
+	asn, asOrg := s.Geo.GetASN(host.IP)
+	tlsVersion := tls.VersionName(state.Version)
+
+	feasible := s.Config.Feasibility.Feasible(state, domain, issuers, sni, time.Now())
+
+	result := ScanResult{
+		IP:          host.IP.String(),
+		Port:        port,
+		Origin:      host.Origin,
+		Rank:        host.Rank,
+		Domain:      domain,
+		Issuer:      issuers,
+		GeoCode:     geoCode,
+		Feasible:    feasible,
+		TLSVersion:  tlsVersion,
+		ALPN:        alpn,
+		ASN:         asn,
+		ASOrg:       asOrg,
+		SANs:        cert.DNSNames,
+		ConnectMs:   int(connectTime.Milliseconds()),
+		HandshakeMs: int(handshakeTime.Milliseconds()),
+	}
+	if race != nil {
+		result.Family, result.Families = race.family, race.families
+	}
+	if lat, lon, city, ok := s.Geo.GetLocation(host.IP); ok {
+		result.Latitude, result.Longitude, result.City = lat, lon, city
+	}
+
+	if feasible {
+		origin := ""
+		if host.Type == HostTypeDomain {
+			origin = host.Origin
+		}
+		result.Score = certScore(cert, origin, time.Now())
+	}
+
+	if s.Config.DetectCDN || s.Config.SkipCDN {
+		feasible = s.flagCDN(&result, DetectCDN(host.IP, asn, cert, ""))
+	}
+
+	if s.honeypots != nil {
+		feasible = s.flagHoneypot(&result, host.IP, cert)
+	}
+
+	// The QUIC handshake runs alongside the probes over TCP
+	var h3Done chan bool
+	if feasible && s.Config.ProbeH3 {
+		h3Done = make(chan bool, 1)
+		go func() { h3Done <- s.probeH3(hostPort, sni) }()
+	}
+
+	if s.Config.TLSDetails {
+		result.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+		result.KeyExchange = keyExchange(state)
+	}
+
+	if s.Config.SaveCerts {
+		result.Chain = chainPEM(state.PeerCertificates)
+	}
+
+	if feasible && s.Config.CheckOCSP {
+		s.checkOCSP(state, &result)
+		if result.OCSP == OCSPRevoked {
+			result.Score = max(0, result.Score-scoreRevoked)
+		}
+	}
+
+	if feasible && s.Config.ProbePQ {
+		result.Curve = tls.X25519.String()
+		if s.probePQ(hostPort, sni) {
+			result.Curve = tls.X25519MLKEM768.String()
+		}
+	}
+
+	if feasible && s.Config.ProbeHTTP {
+		if s.idle == nil {
+			s.probeHTTP(c, sni, &result)
+		} else if pc, err := s.probeConn(hostPort, &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h2"},
+			CurvePreferences:   []tls.CurveID{tls.X25519},
+			ServerName:         sni,
+		}); err == nil {
+			// The idle test needs the established connection untouched
+			s.probeHTTP(pc, sni, &result)
+		}
+		if result.CDN == "" && (s.Config.DetectCDN || s.Config.SkipCDN) {
+			feasible = s.flagCDN(&result, DetectCDN(nil, 0, nil, result.HTTPServer))
+		}
+	}
+
+	if feasible && s.Config.DualProbe {
+		s.probeDual(hostPort, sni, cert, &result)
+	}
+
+	if feasible && s.Config.ProbeResumption {
+		result.Resumption = s.probeResumption(hostPort, sni)
+	}
+
+	if feasible && s.Config.ProbeHRR {
+		result.HRR = s.probeHRR(hostPort, sni)
+	}
+
+	if feasible && s.Config.DNSMatch {
+		result.DNSMatch = s.checkDNSMatch(host.IP, result)
+	}
+
+	if feasible && s.Config.SpeedTestKB > 0 {
+		result.SpeedKBps = s.probeSpeed(hostPort, sni, result)
+	}
+
+	// Hosts that are not feasible with the SNI sent may be with another one
+	if len(s.Config.SNIMatrix) > 0 {
+		result.SNIs = s.probeSNIMatrix(hostPort)
+	}
+
+	if h3Done != nil {
+		result.H3 = <-h3Done
+	}
+
+	if s.Config.Audit {
+		s.audit(&result, host.IP, cert)
+	}
+
+	level := slog.LevelInfo
+	if !feasible {
+		level = slog.LevelDebug
+	}
+	s.log(level, "Connected to target", "feasible", feasible, "ip", result.IP,
 		"origin", host.Origin,
-		"tls", tls.VersionName(state.Version), "alpn", alpn, "cert-domain", domain, "cert-issuer", issuers,
-		"geo", geoCode)
-}
+		"tls", tlsVersion, "alpn", alpn, "cert-domain", domain, "cert-issuer", issuers,
+		"geo", geoCode, "asn", asn, "curve", result.Curve,
+		"http-status", result.HTTPStatus, "http-server", result.HTTPServer,
+		"dual-domain", result.DualDomain, "cert-differs", result.CertDiffers, "dual-error", result.DualError, "sni-certs", formatSNICerts(result.SNIs),
+		"score", result.Score,
+		"cipher", result.CipherSuite, "cdn", result.CDN, "honeypot", result.Honeypot, "ocsp", result.OCSP, "h3", result.H3, "resumption", result.Resumption,
+		"hrr", result.HRR, "speed-kbps", result.SpeedKBps, "family", result.Family, "dns-match", result.DNSMatch,
+		"connect-ms", result.ConnectMs, "handshake-ms", result.HandshakeMs, "attempts", attempts)
 
-func ScanTLSWithCallbacks(host Host, scanner *Scanner) {
-	if host.IP == nil {
-		ip, err := LookupIP(host.Origin, scanner.Config.EnableIPv6)
-		if err != nil {
-			if scanner.Callbacks != nil && scanner.Callbacks.OnLog != nil {
-				scanner.Callbacks.OnLog("debug", "Failed to get IP from "+host.Origin)
-			}
+	if feasible && s.Config.ExpandPrefix > 0 && s.queue != nil {
+		s.queue.Expand(host.IP, s.Config.ExpandPrefix)
+	}
+
+	// Feasible hosts are held idle before being reported when the idle test
+	// is enabled
+	if feasible && s.idle != nil {
+		if s.idle.Add(c, result, s.emit) {
+			keep = true
 			return
 		}
-		host.IP = ip
+		result.Idle = IdleSkipped
 	}
+	s.emit(result)
+}
 
-	hostPort := net.JoinHostPort(host.IP.String(), strconv.Itoa(scanner.Config.Port))
-	conn, err := net.DialTimeout("tcp", hostPort, time.Duration(scanner.Config.Timeout)*time.Second)
+// connect dials hostPort and completes the TLS handshake, returning the
+// connection and how long each step took
+func (s *Scanner) connect(hostPort string, tlsCfg *tls.Config) (*tls.Conn, time.Duration, time.Duration, error) {
+	dialStart := time.Now()
+	conn, err := s.dial(s.ctx, hostPort)
 	if err != nil {
-		if scanner.Callbacks != nil && scanner.Callbacks.OnLog != nil && scanner.Config.Verbose {
-			scanner.Callbacks.OnLog("debug", "Cannot dial "+hostPort)
-		}
-		return
+		return nil, 0, 0, fmt.Errorf("cannot dial: %w", err)
 	}
-	defer conn.Close()
-
-	err = conn.SetDeadline(time.Now().Add(time.Duration(scanner.Config.Timeout) * time.Second))
+	connectTime := time.Since(dialStart)
+	c, handshakeTime, err := s.handshake(conn, tlsCfg)
 	if err != nil {
-		return
+		return nil, 0, 0, err
 	}
+	return c, connectTime, handshakeTime, nil
+}
 
-	tlsCfg := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos:         []string{"h2", "http/1.1"},
-		CurvePreferences:   []tls.CurveID{tls.X25519},
+// handshake completes the TLS handshake over conn, closing it on failure
+func (s *Scanner) handshake(conn net.Conn, tlsCfg *tls.Config) (*tls.Conn, time.Duration, error) {
+	err := conn.SetDeadline(time.Now().Add(time.Duration(s.Config.Timeout) * time.Second))
+	if err != nil {
+		conn.Close()
+		return nil, 0, fmt.Errorf("cannot set deadline: %w", err)
 	}
-	if host.Type == HostTypeDomain {
-		tlsCfg.ServerName = host.Origin
+	var capture *captureConn
+	if s.Config.CaptureDir != "" {
+		capture = newCaptureConn(conn)
+		conn = capture
 	}
-
-	c := tls.Client(conn, tlsCfg)
+	c := tls.Client(conn, s.clientConfig(tlsCfg))
+	handshakeStart := time.Now()
 	err = c.Handshake()
+	handshakeTime := time.Since(handshakeStart)
+	if capture != nil {
+		s.saveCapture(capture, tlsCfg.ServerName, err)
+	}
 	if err != nil {
-		if scanner.Callbacks != nil && scanner.Callbacks.OnLog != nil && scanner.Config.Verbose {
-			scanner.Callbacks.OnLog("debug", "TLS handshake failed for "+hostPort)
-		}
-		return
+		conn.Close()
+		return nil, 0, fmt.Errorf("TLS handshake failed: %w", err)
 	}
+	return c, handshakeTime, nil
+}
 
-	state := c.ConnectionState()
-	alpn := state.NegotiatedProtocol
-	
-	// Safely access certificate data
-	if len(state.PeerCertificates) == 0 {
-		if scanner.Callbacks != nil && scanner.Callbacks.OnLog != nil && scanner.Config.Verbose {
-			scanner.Callbacks.OnLog("debug", "No peer certificates for "+hostPort)
-		}
-		return
+// flagCDN records the CDN provider of result and reports whether it is
+// still feasible
+func (s *Scanner) flagCDN(result *ScanResult, provider string) bool {
+	result.CDN = provider
+	if provider != "" && s.Config.SkipCDN {
+		// CDN edges serve countless sites and make poor dests
+		result.Feasible = false
+		result.Score = 0
 	}
-	
-	// Extract domain from certificate
-	// Prefer DNSNames (Subject Alternative Names) over CommonName
-	cert := state.PeerCertificates[0]
-	domain := ""
+	return result.Feasible
+}
+
+// keyExchange names the key exchange group of a handshake. X25519 is the
+// only group offered, so it is used by every TLS 1.3 and ECDHE handshake.
+func keyExchange(state tls.ConnectionState) string {
+	if state.Version == tls.VersionTLS13 || strings.HasPrefix(tls.CipherSuiteName(state.CipherSuite), "TLS_ECDHE_") {
+		return tls.X25519.String()
+	}
+	return "RSA"
+}
+
+// certDomain extracts the domain of a certificate, preferring DNSNames
+// (Subject Alternative Names) over CommonName
+func certDomain(cert *x509.Certificate) string {
 	if len(cert.DNSNames) > 0 {
 		// Use first DNS name from SANs
-		domain = cert.DNSNames[0]
-	} else if cert.Subject.CommonName != "" {
-		// Fallback to CommonName if no SANs
-		domain = cert.Subject.CommonName
+		return cert.DNSNames[0]
 	}
-	
-	issuers := strings.Join(cert.Issuer.Organization, " | ")
-	geoCode := scanner.Geo.GetGeo(host.IP)
-	tlsVersion := tls.VersionName(state.Version)
+	// Fallback to CommonName if no SANs
+	return cert.Subject.CommonName
+}
 
-	feasible := state.Version == tls.VersionTLS13 && alpn == "h2" && len(domain) > 0 && len(issuers) > 0
+// port is the port host is scanned on
+func (s *Scanner) port(host Host) int {
+	if host.Port != 0 {
+		return host.Port
+	}
+	return s.Config.Port
+}
 
-	result := ScanResult{
-		IP:         host.IP.String(),
-		Origin:     host.Origin,
-		Domain:     domain,
-		Issuer:     issuers,
-		GeoCode:    geoCode,
-		Feasible:   feasible,
-		TLSVersion: tlsVersion,
-		ALPN:       alpn,
-	}
-
-	if scanner.Callbacks != nil && scanner.Callbacks.OnResult != nil {
-		scanner.Callbacks.OnResult(result)
-	}
-	
-	// Log connection details
-	if scanner.Callbacks != nil && scanner.Callbacks.OnLog != nil {
-		logLevel := "info"
-		if !feasible && !scanner.Config.Verbose {
-			return // Skip logging non-feasible in non-verbose mode
-		}
-		if !feasible {
-			logLevel = "debug"
+// serverName is the SNI sent to host: the configured override, otherwise
+// the domain the host was found by, none for IPs
+func (s *Scanner) serverName(host Host) string {
+	switch {
+	case s.Config.NoSNI:
+		return ""
+	case s.Config.ServerName != "":
+		return s.Config.ServerName
+	case host.Type == HostTypeDomain:
+		return host.Origin
+	}
+	return ""
+}
+
+// probeConn opens another connection to the host for a follow-up probe
+// and completes the TLS handshake with tlsCfg
+func (s *Scanner) probeConn(hostPort string, tlsCfg *tls.Config) (*tls.Conn, error) {
+	conn, err := s.dial(s.ctx, hostPort)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Now().Add(time.Duration(s.Config.Timeout) * time.Second)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c := tls.Client(conn, s.clientConfig(tlsCfg))
+	if err := c.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// probePQ reports whether the host completes a TLS 1.3 handshake when the
+// hybrid X25519MLKEM768 key share is the only group offered, as sent first
+// by recent Chrome fingerprints
+func (s *Scanner) probePQ(hostPort, sni string) bool {
+	c, err := s.probeConn(hostPort, &tls.Config{
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS13,
+		NextProtos:         []string{"h2", "http/1.1"},
+		CurvePreferences:   []tls.CurveID{tls.X25519MLKEM768},
+		ServerName:         sni,
+	})
+	if err != nil {
+		s.log(slog.LevelDebug, "PQ key share rejected", "target", hostPort, "err", err)
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// probeDual repeats the handshake with the other SNI choice: none if one was
+// sent, otherwise the domain of the certificate. A different certificate
+// reveals SNI based routing or a default virtual host. A failed probe only
+// sets DualError, a timeout says nothing about the certificate.
+func (s *Scanner) probeDual(hostPort, sni string, cert *x509.Certificate, result *ScanResult) {
+	other := ""
+	if sni == "" {
+		names := xrayServerNames(*result)
+		if len(names) == 0 {
+			return
 		}
-		
-		logMsg := fmt.Sprintf("Connected: %s | %s | TLS:%s ALPN:%s | Domain:%s | Issuer:%s | Geo:%s | Feasible:%v",
-			host.IP.String(), host.Origin, tlsVersion, alpn, domain, issuers, geoCode, feasible)
-		scanner.Callbacks.OnLog(logLevel, logMsg)
+		other = names[0]
+	}
+	c, err := s.probeConn(hostPort, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+		CurvePreferences:   []tls.CurveID{tls.X25519},
+		ServerName:         other,
+	})
+	if err != nil {
+		s.log(slog.LevelDebug, "Dual SNI probe failed", "target", hostPort, "sni", other, "err", err)
+		result.DualError = err.Error()
+		return
+	}
+	defer c.Close()
+	certs := c.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		result.DualError = "no certificate"
+		return
 	}
+	result.DualDomain = certDomain(certs[0])
+	result.CertDiffers = !bytes.Equal(certs[0].Raw, cert.Raw)
 }
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cronField is the range of one field of a cron expression
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = [5]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	// 7 is Sunday as well as 0
+	{"day of week", 0, 7},
+}
+
+// cronAliases are the shorthands cron accepts for common schedules
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// CronSchedule is a parsed cron expression: the five standard fields
+// "minute hour day-of-month month day-of-week" with lists, ranges and
+// steps, the @daily style aliases, or "@every <duration>"
+type CronSchedule struct {
+	// fields holds a bit per allowed value of each field
+	fields [5]uint64
+	// dom and dow tell whether the days were restricted, a day then
+	// matches if either field does like in cron
+	dom, dow bool
+	// every is the interval of "@every", fields are unused then
+	every time.Duration
+}
+
+// ParseCron parses a cron expression
+func ParseCron(expr string) (*CronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || every < time.Minute {
+			return nil, fmt.Errorf("invalid interval %q, must be a duration of at least 1m", rest)
+		}
+		return &CronSchedule{every: every}, nil
+	}
+	if alias, ok := cronAliases[strings.ToLower(expr)]; ok {
+		expr = alias
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q, must have 5 fields", expr)
+	}
+	c := &CronSchedule{}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+		c.fields[i] = bits
+	}
+	// Sunday is matched as 0
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1
+	}
+	c.dom = parts[2] != "*"
+	c.dow = parts[4] != "*"
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never runs", expr)
+	}
+	return c, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges and
+// steps such as "1,15-20,*/5" into a bit per allowed value
+func parseCronField(part string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		spec, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepText, field.name)
+			}
+		}
+		low, high := field.min, field.max
+		if spec != "*" {
+			lowText, highText, isRange := strings.Cut(spec, "-")
+			var err error
+			if low, err = strconv.Atoi(lowText); err != nil {
+				return 0, fmt.Errorf("invalid value %q in %s field", spec, field.name)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highText); err != nil {
+					return 0, fmt.Errorf("invalid value %q in %s field", spec, field.name)
+				}
+			} else if hasStep {
+				// "5/15" runs from 5 to the end of the field
+				high = field.max
+			}
+		}
+		if low < field.min || high > field.max || low > high {
+			return 0, fmt.Errorf("%s field %q out of range %d-%d", field.name, item, field.min, field.max)
+		}
+		for v := low; v <= high; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// has reports whether value is allowed in field i
+func (c *CronSchedule) has(i, value int) bool {
+	return c.fields[i]&(1<<value) != 0
+}
+
+// dayMatches reports whether the day of t is scheduled
+func (c *CronSchedule) dayMatches(t time.Time) bool {
+	dom := c.has(2, t.Day())
+	dow := c.has(4, int(t.Weekday()))
+	if c.dom && c.dow {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// cronSearchYears bounds the search for the next run, which only fails
+// for impossible dates such as February 30
+const cronSearchYears = 5
+
+// Next returns the first scheduled time after t, the zero time if there
+// is none
+func (c *CronSchedule) Next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.Add(c.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronSearchYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.has(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.has(1, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.has(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ScheduledScan is a named scan the server runs on a cron expression
+type ScheduledScan struct {
+	Name string      `json:"name"`
+	Cron string      `json:"cron"`
+	Scan ScanRequest `json:"scan"`
+}
+
+// LoadSchedules reads the scheduled scans of the server from a JSON file
+// holding a list of them
+func LoadSchedules(path string) ([]ScheduledScan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var schedules []ScheduledScan
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return nil, err
+	}
+	for i, schedule := range schedules {
+		switch {
+		case strings.TrimSpace(schedule.Name) == "":
+			return nil, fmt.Errorf("schedule %d has no name", i+1)
+		case slices.ContainsFunc(schedules[:i], func(s ScheduledScan) bool { return s.Name == schedule.Name }):
+			return nil, fmt.Errorf("schedule %q is defined twice", schedule.Name)
+		}
+		if _, err := ParseCron(schedule.Cron); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", schedule.Name, err)
+		}
+	}
+	return schedules, nil
+}
+
+// ScheduleStatus describes a schedule in API responses
+type ScheduleStatus struct {
+	Name string    `json:"name"`
+	Cron string    `json:"cron"`
+	Next time.Time `json:"next"`
+	// Last is when the schedule last ran, zero if it has not yet
+	Last    time.Time `json:"last,omitzero"`
+	Running bool      `json:"running"`
+}
+
+// scheduleEntry is a schedule of a Scheduler
+type scheduleEntry struct {
+	name   string
+	expr   string
+	cron   *CronSchedule
+	cancel context.CancelFunc
+	// The fields below are guarded by Scheduler.mu
+	next    time.Time
+	last    time.Time
+	running bool
+}
+
+// Scheduler runs named jobs on cron expressions. A job still running when
+// it is due again is skipped rather than started twice.
+type Scheduler struct {
+	run func(name string)
+
+	mu      sync.Mutex
+	ctx     context.Context
+	entries []*scheduleEntry
+}
+
+// NewScheduler creates a scheduler calling run with the name of every job
+// that is due, until ctx is done. run returns when the job finished.
+func NewScheduler(ctx context.Context, run func(name string)) *Scheduler {
+	return &Scheduler{ctx: ctx, run: run}
+}
+
+// Add schedules the job name on the cron expression expr, replacing a job
+// of the same name
+func (s *Scheduler) Add(name, expr string) error {
+	cron, err := ParseCron(expr)
+	if err != nil {
+		return err
+	}
+	s.Remove(name)
+	ctx, cancel := context.WithCancel(s.ctx)
+	entry := &scheduleEntry{name: name, expr: expr, cron: cron, cancel: cancel, next: cron.Next(time.Now())}
+	s.mu.Lock()
+	s.entries = append(s.entries, entry)
+	s.mu.Unlock()
+	go s.loop(ctx, entry)
+	return nil
+}
+
+// Remove unschedules the job name, a run in progress goes on
+func (s *Scheduler) Remove(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = slices.DeleteFunc(s.entries, func(e *scheduleEntry) bool {
+		if e.name == name {
+			e.cancel()
+			return true
+		}
+		return false
+	})
+}
+
+// Status lists the jobs in the order they were added
+func (s *Scheduler) Status() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]ScheduleStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, ScheduleStatus{Name: e.name, Cron: e.expr, Next: e.next, Last: e.last, Running: e.running})
+	}
+	return list
+}
+
+// loop waits for the runs of entry until ctx is done
+func (s *Scheduler) loop(ctx context.Context, entry *scheduleEntry) {
+	for {
+		s.mu.Lock()
+		next := entry.next
+		s.mu.Unlock()
+		if next.IsZero() {
+			slog.Warn("Schedule never runs", "name", entry.name, "cron", entry.expr)
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		s.mu.Lock()
+		busy := entry.running
+		if !busy {
+			entry.running = true
+			entry.last = time.Now()
+		}
+		entry.next = entry.cron.Next(time.Now())
+		s.mu.Unlock()
+		if busy {
+			slog.Warn("Skipping scheduled run, the last one is still running", "name", entry.name)
+			continue
+		}
+		go func() {
+			s.run(entry.name)
+			s.mu.Lock()
+			entry.running = false
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// scheduleDiff compares the feasible results of a scheduled run recorded
+// in session with those of the previous finished run of the schedule
+func scheduleDiff(store *Store, name string, session *Session) (*ResultsDiff, error) {
+	previous, ok, err := store.PreviousSession(name, session.ID)
+	if err != nil || !ok {
+		return nil, err
+	}
+	old, err := store.Results(previous, true)
+	if err != nil {
+		return nil, err
+	}
+	current, err := store.Results(session.ID, true)
+	if err != nil {
+		return nil, err
+	}
+	return DiffResults(old, current), nil
+}
+
+// scheduleMessage describes the changes of a scheduled run in a short
+// notification
+func scheduleMessage(name string, diff *ResultsDiff) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Scheduled scan %q: %d newly feasible, %d disappeared, %d changed certificate",
+		name, len(diff.Added), len(diff.Removed), len(diff.Changed))
+	lines := 0
+	add := func(prefix string, result ScanResult) bool {
+		if lines == notifySummaryMax {
+			b.WriteString("\n…")
+			return false
+		}
+		lines++
+		b.WriteString("\n" + prefix + " " + resultLine(result))
+		return true
+	}
+	for _, result := range diff.Added {
+		if !add("+", result) {
+			return b.String()
+		}
+	}
+	for _, result := range diff.Removed {
+		if !add("-", result) {
+			return b.String()
+		}
+	}
+	for _, change := range diff.Changed {
+		if !add("~", change.New) {
+			return b.String()
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"strings"
+	"time"
+)
+
+// Weights of the certificate score. A feasible dest starts at scoreBase
+// and the score is kept within 0 to 100.
+const (
+	scoreBase = 50
+	// scoreWildcard is taken off wildcard certificates, which are shared by
+	// many hosts and look less like a single real site
+	scoreWildcard = 10
+	// scoreCDN is taken off certificates issued by a CDN, whose edges are
+	// watched and blocked as a whole
+	scoreCDN = 20
+	// scoreExpired is taken off certificates out of their validity period
+	scoreExpired = 40
+	// scoreShortLived is taken off certificates valid for under
+	// shortLivedDays, mostly automated ones
+	scoreShortLived = 5
+	// scoreSelfSigned is taken off certificates no CA issued
+	scoreSelfSigned = 30
+	// scoreMismatch is taken off when a scanned domain is not covered by
+	// the certificate it serves
+	scoreMismatch = 15
+	// scoreRevoked is taken off certificates their CA revoked, a dest
+	// serving one is likely a stale copy
+	scoreRevoked = 40
+	// scoreLongLived is added for certificates valid for over
+	// longLivedDays, which are bought rather than automated
+	scoreLongLived = 10
+	// scoreOV and scoreEV are added for organization and extended
+	// validation, whose owner was checked by the CA
+	scoreOV = 10
+	scoreEV = 20
+
+	shortLivedDays = 100
+	longLivedDays  = 200
+)
+
+// Certificate policies of the CA/Browser Forum baseline requirements
+var (
+	policyEV = asn1.ObjectIdentifier{2, 23, 140, 1, 1}
+	policyOV = asn1.ObjectIdentifier{2, 23, 140, 1, 2, 2}
+)
+
+// cdnIssuers are substrings of the issuer organizations of CDNs
+var cdnIssuers = []string{"cloudflare", "amazon", "akamai", "fastly"}
+
+// certScore rates how well the certificate of a feasible dest passes for
+// a real site. origin is the scanned domain, "" when an IP was scanned.
+func certScore(cert *x509.Certificate, origin string, now time.Time) float64 {
+	score := float64(scoreBase)
+	if strings.HasPrefix(certDomain(cert), "*.") {
+		score -= scoreWildcard
+	}
+	issuer := strings.ToLower(strings.Join(cert.Issuer.Organization, " "))
+	for _, cdn := range cdnIssuers {
+		if strings.Contains(issuer, cdn) {
+			score -= scoreCDN
+			break
+		}
+	}
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		score -= scoreExpired
+	}
+	validity := cert.NotAfter.Sub(cert.NotBefore)
+	switch {
+	case validity < shortLivedDays*24*time.Hour:
+		score -= scoreShortLived
+	case validity > longLivedDays*24*time.Hour:
+		score += scoreLongLived
+	}
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil {
+		score -= scoreSelfSigned
+	}
+	if origin != "" && cert.VerifyHostname(origin) != nil {
+		score -= scoreMismatch
+	}
+	score += validationScore(cert)
+	return min(100, max(0, score))
+}
+
+// validationScore is the bonus for the validation level of cert
+func validationScore(cert *x509.Certificate) float64 {
+	ov := false
+	for _, policy := range cert.PolicyIdentifiers {
+		if policy.Equal(policyEV) {
+			return scoreEV
+		}
+		if policy.Equal(policyOV) {
+			ov = true
+		}
+	}
+	if ov {
+		return scoreOV
+	}
+	return 0
+}
+
+// CertScore prefers dests with the highest certificate score
+func CertScore(result ScanResult) float64 {
+	return result.Score
+}
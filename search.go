@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	shodanSearchURL = "https://api.shodan.io/shodan/host/search"
+	censysSearchURL = "https://search.censys.io/api/v2/hosts/search"
+	// searchTimeout bounds the request for one page of search results
+	searchTimeout = time.Minute
+	// censysPageSize is the largest page Censys serves
+	censysPageSize = 100
+)
+
+// HostSearch is an internet scan database searched for hosts to scan, so
+// that only hosts it already saw with TLS 1.3 or HTTP/2 are dialed
+type HostSearch interface {
+	// Page returns the IPs of one page of results for query and the token
+	// of the next page, "" after the last one. The first page has token "".
+	Page(ctx context.Context, query, token string) ([]string, string, error)
+}
+
+// ShodanSearch searches Shodan with an API key. Every page of 100 results
+// costs a query credit.
+type ShodanSearch struct {
+	Key string
+}
+
+func (s *ShodanSearch) Page(ctx context.Context, query, token string) ([]string, string, error) {
+	page := 1
+	if token != "" {
+		page, _ = strconv.Atoi(token)
+	}
+	params := neturl.Values{}
+	params.Set("key", s.Key)
+	params.Set("query", query)
+	params.Set("minify", "true")
+	params.Set("page", strconv.Itoa(page))
+	var answer struct {
+		Matches []struct {
+			IP string `json:"ip_str"`
+		} `json:"matches"`
+		Total int    `json:"total"`
+		Error string `json:"error"`
+	}
+	if err := searchGet(ctx, shodanSearchURL+"?"+params.Encode(), nil, &answer); err != nil {
+		return nil, "", fmt.Errorf("shodan: %w", err)
+	}
+	if answer.Error != "" {
+		return nil, "", fmt.Errorf("shodan: %s", answer.Error)
+	}
+	ips := make([]string, 0, len(answer.Matches))
+	for _, match := range answer.Matches {
+		ips = append(ips, match.IP)
+	}
+	next := ""
+	if len(answer.Matches) > 0 && page*100 < answer.Total {
+		next = strconv.Itoa(page + 1)
+	}
+	return ips, next, nil
+}
+
+// CensysSearch searches Censys hosts with an API ID and secret
+type CensysSearch struct {
+	ID     string
+	Secret string
+}
+
+func (c *CensysSearch) Page(ctx context.Context, query, token string) ([]string, string, error) {
+	params := neturl.Values{}
+	params.Set("q", query)
+	params.Set("per_page", strconv.Itoa(censysPageSize))
+	if token != "" {
+		params.Set("cursor", token)
+	}
+	var answer struct {
+		Error  string `json:"error"`
+		Result struct {
+			Hits []struct {
+				IP string `json:"ip"`
+			} `json:"hits"`
+			Links struct {
+				Next string `json:"next"`
+			} `json:"links"`
+		} `json:"result"`
+	}
+	auth := func(req *http.Request) { req.SetBasicAuth(c.ID, c.Secret) }
+	if err := searchGet(ctx, censysSearchURL+"?"+params.Encode(), auth, &answer); err != nil {
+		return nil, "", fmt.Errorf("censys: %w", err)
+	}
+	if answer.Error != "" {
+		return nil, "", fmt.Errorf("censys: %s", answer.Error)
+	}
+	ips := make([]string, 0, len(answer.Result.Hits))
+	for _, hit := range answer.Result.Hits {
+		ips = append(ips, hit.IP)
+	}
+	return ips, answer.Result.Links.Next, nil
+}
+
+// searchGet fetches a page of search results into answer. Error responses
+// are decoded too, as both services explain errors in the body.
+func searchGet(ctx context.Context, url string, prepare func(*http.Request), answer any) error {
+	ctx, cancel := context.WithTimeout(ctx, searchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if prepare != nil {
+		prepare(req)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL may hold the API key, keep it out of logs
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to search: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read search results: %w", err)
+	}
+	if err := json.Unmarshal(body, answer); err != nil || resp.StatusCode >= 500 {
+		return fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// IterateSearch streams the IPs found by search into a host channel,
+// fetching the next page only once the hosts of the current one are taken.
+// At most limit hosts are returned if it is above 0, the first skip are
+// left out.
+func IterateSearch(ctx context.Context, search HostSearch, query string, limit int, enableIPv6 bool, skip int) <-chan Host {
+	hostChan := make(chan Host)
+	go func() {
+		defer close(hostChan)
+		index := 0
+		token := ""
+		for {
+			ips, next, err := search.Page(ctx, query, token)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("Search failed", "err", err)
+				}
+				return
+			}
+			for _, s := range ips {
+				if limit > 0 && index >= limit {
+					return
+				}
+				ip := net.ParseIP(s)
+				if ip == nil || (ip.To4() == nil && !enableIPv6) {
+					continue
+				}
+				if index >= skip {
+					select {
+					case hostChan <- Host{IP: ip, Origin: s, Type: HostTypeIP, Index: index}:
+					case <-ctx.Done():
+						return
+					}
+				}
+				index++
+			}
+			if next == "" || len(ips) == 0 {
+				return
+			}
+			token = next
+		}
+	}()
+	return hostChan
+}
+
+// newHostSearch returns the search for provider "shodan" or "censys" with
+// key, which is "ID:secret" for Censys. An empty key is read from
+// SHODAN_API_KEY or CENSYS_API_ID and CENSYS_API_SECRET.
+func newHostSearch(provider, key string) (HostSearch, error) {
+	switch provider {
+	case "shodan":
+		if key == "" {
+			key = os.Getenv("SHODAN_API_KEY")
+		}
+		if key == "" {
+			return nil, errors.New("a Shodan API key is needed")
+		}
+		return &ShodanSearch{Key: key}, nil
+	case "censys":
+		id, secret, _ := strings.Cut(key, ":")
+		if key == "" {
+			id, secret = os.Getenv("CENSYS_API_ID"), os.Getenv("CENSYS_API_SECRET")
+		}
+		if id == "" || secret == "" {
+			return nil, errors.New("a Censys API ID and secret are needed")
+		}
+		return &CensysSearch{ID: id, Secret: secret}, nil
+	}
+	return nil, fmt.Errorf("unknown search provider %q", provider)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math"
+	"net"
+	"net/netip"
+	"sync"
+)
+
+// bloomFalsePositive is the rate of new hosts a bloom seenSet mistakes for
+// scanned ones when it holds the number of hosts it was sized for
+const bloomFalsePositive = 0.001
+
+// seenSet records the IP:port pairs scanned in a session, so that hosts
+// reached through several inputs (a domain resolving into a scanned CIDR,
+// overlapping ranges, expanded networks) are only scanned once
+type seenSet interface {
+	// Add records ip:port and reports whether it had not been seen yet
+	Add(ip net.IP, port int) bool
+}
+
+// newSeenSet returns an exact set, or a bloom filter sized for expected
+// hosts if it is not zero. The bloom filter uses a fixed amount of memory
+// but skips a few hosts it has not seen.
+func newSeenSet(expected int) seenSet {
+	if expected > 0 {
+		return newBloomSet(expected, bloomFalsePositive)
+	}
+	return &exactSet{seen: make(map[netip.AddrPort]struct{})}
+}
+
+// seenKey normalizes ip so IPv4 addresses in IPv6 form match
+func seenKey(ip net.IP, port int) (netip.AddrPort, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.AddrPort{}, false
+	}
+	return netip.AddrPortFrom(addr.Unmap(), uint16(port)), true
+}
+
+// exactSet is a seenSet holding every pair in a map
+type exactSet struct {
+	mu   sync.Mutex
+	seen map[netip.AddrPort]struct{}
+}
+
+func (e *exactSet) Add(ip net.IP, port int) bool {
+	key, ok := seenKey(ip, port)
+	if !ok {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.seen[key]; ok {
+		return false
+	}
+	e.seen[key] = struct{}{}
+	return true
+}
+
+// bloomSet is a seenSet backed by a bloom filter
+type bloomSet struct {
+	mu    sync.Mutex
+	bits  []uint64
+	m     uint64 // number of bits
+	k     int    // number of hashes
+	seeds [2]maphash.Seed
+}
+
+// newBloomSet sizes a filter for n entries at false positive rate p
+func newBloomSet(n int, p float64) *bloomSet {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = max(64, (m+63)/64*64)
+	k := max(1, int(math.Round(float64(m)/float64(n)*math.Ln2)))
+	return &bloomSet{
+		bits:  make([]uint64, m/64),
+		m:     m,
+		k:     k,
+		seeds: [2]maphash.Seed{maphash.MakeSeed(), maphash.MakeSeed()},
+	}
+}
+
+func (b *bloomSet) Add(ip net.IP, port int) bool {
+	key, ok := seenKey(ip, port)
+	if !ok {
+		return true
+	}
+	var buf [18]byte
+	addr := key.Addr().As16()
+	copy(buf[:], addr[:])
+	binary.BigEndian.PutUint16(buf[16:], key.Port())
+	// Double hashing derives the k bit positions from two hashes
+	h1 := maphash.Bytes(b.seeds[0], buf[:])
+	h2 := maphash.Bytes(b.seeds[1], buf[:]) | 1
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	added := false
+	for i := 0; i < b.k; i++ {
+		bit := (h1 + uint64(i)*h2) % b.m
+		mask := uint64(1) << (bit % 64)
+		if b.bits[bit/64]&mask == 0 {
+			b.bits[bit/64] |= mask
+			added = true
+		}
+	}
+	return added
+}
@@ -0,0 +1,812 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed web/index.html
+var dashboardHTML []byte
+
+// Scan job states reported by the API
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobStopped = "stopped"
+	JobFailed  = "failed"
+)
+
+// ScanRequest is the body of POST /scans. Exactly one of Addr, Targets,
+// URL, CT, Shodan or Censys selects the source, the other fields default
+// like the CLI.
+type ScanRequest struct {
+	Addr    string   `json:"addr"`
+	Targets []string `json:"targets"`
+	URL     string   `json:"url"`
+	CT      string   `json:"ct"`
+	Port    int      `json:"port"`
+	Thread  int      `json:"thread"`
+	Timeout int      `json:"timeout"`
+	IPv6    bool     `json:"ipv6"`
+	Idle    int      `json:"idle"`
+	ASN     bool     `json:"asn"`
+	Expand  int      `json:"expand"`
+	NetCap  int      `json:"net_cap"`
+	PQ      bool     `json:"pq"`
+	Rate    float64  `json:"rate"`
+	HTTP    bool     `json:"http"`
+	SNI     string   `json:"sni"`
+	NoSNI   bool     `json:"no_sni"`
+	Dual    bool     `json:"dual"`
+	Bloom   int      `json:"bloom"`
+	// Certs embeds the certificate chain in the results
+	Certs bool `json:"certs"`
+	// Exclude lists IPs, CIDRs, AS numbers and country codes not to scan
+	Exclude []string `json:"exclude"`
+	// Shodan and Censys are search queries, the API keys are read from the
+	// environment of the server
+	Shodan string `json:"shodan"`
+	Censys string `json:"censys"`
+	// SearchLimit caps the hosts taken from a search, 1000 by default
+	SearchLimit int `json:"search_limit"`
+	// TLSDetails records the cipher suite and key exchange group
+	TLSDetails bool `json:"tls_details"`
+	// CDN flags hosts of a CDN, SkipCDN reports them as not feasible
+	CDN     bool `json:"cdn"`
+	SkipCDN bool `json:"skip_cdn"`
+	// Honeypots reports hosts that look like honeypots as not feasible
+	Honeypots bool `json:"honeypots"`
+	// Retries repeats hosts that time out or drop the connection
+	Retries int `json:"retries"`
+	// Adaptive adjusts the threads to the share of timeouts, up to Thread
+	Adaptive bool `json:"adaptive"`
+	// OCSP checks the revocation status of certificates
+	OCSP bool `json:"ocsp"`
+	// Shuffle scans the addresses of CIDRs in a pseudo-random order
+	Shuffle bool `json:"shuffle"`
+	// Subdomains are prefixes also scanned under every domain, "default"
+	// for the built-in list, SubdomainCT adds the subdomains found in
+	// Certificate Transparency logs
+	Subdomains  []string `json:"subdomains"`
+	SubdomainCT bool     `json:"subdomain_ct"`
+	// H3 tries a QUIC handshake for HTTP/3 with feasible hosts
+	H3 bool `json:"h3"`
+	// PreCheck is the number of workers connecting to hosts before the
+	// TLS stage, PreCheckTimeout their timeout in milliseconds, 500 by
+	// default
+	PreCheck        int `json:"precheck"`
+	PreCheckTimeout int `json:"precheck_timeout"`
+	// Countries are the country codes hosts are scanned in, all when empty
+	Countries []string `json:"countries"`
+	// MaxPerCountry and MaxPerASN cap the feasible hosts per country and
+	// AS number, 0 for no cap
+	MaxPerCountry int `json:"max_per_country"`
+	MaxPerASN     int `json:"max_per_asn"`
+	// DNS are DNS servers and DNS-over-HTTPS URLs resolving domains
+	// instead of the system resolver, DNSTimeout the lookup timeout in
+	// seconds
+	DNS        []string `json:"dns"`
+	DNSTimeout int      `json:"dns_timeout"`
+	// FeasibleALPN, FeasibleTLS12, FeasibleIssuers,
+	// FeasibleExcludeIssuers, FeasibleMinDays and FeasibleSNI replace the
+	// default feasibility rule, see FeasibilityPolicy
+	FeasibleALPN           []string `json:"feasible_alpn"`
+	FeasibleTLS12          bool     `json:"feasible_tls12"`
+	FeasibleIssuers        []string `json:"feasible_issuers"`
+	FeasibleExcludeIssuers []string `json:"feasible_exclude_issuers"`
+	FeasibleMinDays        int      `json:"feasible_min_days"`
+	FeasibleSNI            bool     `json:"feasible_sni"`
+	// Timing is the timing profile: paranoid, slow, normal or fast
+	Timing string `json:"timing"`
+	// SNIMatrix are candidate SNIs the handshake is repeated with for
+	// every host
+	SNIMatrix []string `json:"sni_matrix"`
+	// Resumption checks whether feasible hosts resume TLS sessions
+	Resumption bool `json:"resumption"`
+	// HRR records the group feasible hosts ask for with a HelloRetryRequest
+	HRR bool `json:"hrr"`
+	// HappyEyeballs races the addresses of dual-stack domains, with IPv6
+	HappyEyeballs bool `json:"happy_eyeballs"`
+	// DNSMatch checks whether the certificate domain of feasible hosts
+	// resolves to them
+	DNSMatch bool `json:"dns_match"`
+	// SpeedTest downloads this many KB from feasible hosts to measure
+	// their throughput
+	SpeedTest int `json:"speedtest_kb"`
+}
+
+// ScanJobStatus describes a scan job in API responses
+type ScanJobStatus struct {
+	ID      string    `json:"id"`
+	Source  string    `json:"source"`
+	State   string    `json:"state"`
+	Phase   ScanPhase `json:"phase"`
+	Error   string    `json:"error,omitempty"`
+	Created time.Time `json:"created"`
+	// Schedule names the schedule that started the job
+	Schedule string `json:"schedule,omitempty"`
+	Answered int    `json:"answered"` // hosts that completed a TLS handshake
+	Feasible int    `json:"feasible"`
+}
+
+// Retention of finished jobs, whose results would otherwise pile up in a
+// long running server
+const (
+	// jobRetention is how long a finished job and its results are kept
+	jobRetention = 24 * time.Hour
+	// maxFinishedJobs is how many finished jobs are kept at most
+	maxFinishedJobs = 100
+)
+
+// scanJob is one scan started through the API. Feasible results are kept
+// in memory so clients can stream them from the start at any time, until
+// the job is pruned after it finished.
+type scanJob struct {
+	id       string
+	source   string
+	created  time.Time
+	schedule string
+	scanner  *Scanner
+	// hub passes the results and state changes to WebSocket clients
+	hub *wsHub
+
+	mu       sync.Mutex
+	state    string
+	err      string
+	answered int
+	results  []ScanResult
+	// ended is when the job finished
+	ended time.Time
+	// changed is closed and replaced whenever the job is updated
+	changed chan struct{}
+}
+
+func (j *scanJob) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+func (j *scanJob) addResult(result ScanResult) {
+	j.mu.Lock()
+	j.answered++
+	if result.Feasible {
+		j.results = append(j.results, result)
+	}
+	j.notify()
+	j.mu.Unlock()
+	j.hub.publish(wsEvent{Type: wsEventResult, Scan: j.id, Result: &result})
+}
+
+func (j *scanJob) finish(state, err string) {
+	j.mu.Lock()
+	j.state = state
+	j.err = err
+	if j.finished() {
+		j.ended = time.Now()
+	}
+	j.notify()
+	j.mu.Unlock()
+	j.publishStatus()
+}
+
+// publishStatus sends the status of the job to the WebSocket clients
+func (j *scanJob) publishStatus() {
+	status := j.status()
+	j.hub.publish(wsEvent{Type: wsEventStatus, Scan: j.id, Status: &status})
+}
+
+func (j *scanJob) finished() bool {
+	return j.state == JobDone || j.state == JobStopped || j.state == JobFailed
+}
+
+// wait blocks until the job finishes
+func (j *scanJob) wait() {
+	for {
+		j.mu.Lock()
+		done := j.finished()
+		changed := j.changed
+		j.mu.Unlock()
+		if done {
+			return
+		}
+		<-changed
+	}
+}
+
+// stream passes the feasible results of the job to send in batches, from
+// the first one on. With follow it waits for new results until the job
+// finishes, the context is done or send fails.
+func (j *scanJob) stream(ctx context.Context, follow bool, send func(batch []ScanResult) error) error {
+	sent := 0
+	for {
+		j.mu.Lock()
+		batch := j.results[sent:]
+		done := j.finished()
+		changed := j.changed
+		j.mu.Unlock()
+
+		if err := send(batch); err != nil {
+			return err
+		}
+		sent += len(batch)
+		if done || !follow {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (j *scanJob) status() ScanJobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return ScanJobStatus{
+		ID:       j.id,
+		Source:   j.source,
+		State:    j.state,
+		Phase:    j.scanner.Phase(),
+		Error:    j.err,
+		Created:  j.created,
+		Schedule: j.schedule,
+		Answered: j.answered,
+		Feasible: len(j.results),
+	}
+}
+
+// Server exposes the scanner over HTTP for headless machines
+type Server struct {
+	Geo     *Geo
+	Token   string
+	Verbose bool
+
+	// Store records the runs of the schedules and Sender reports what
+	// changed between them, either may be nil
+	Store  *Store
+	Sender Sender
+
+	// hub passes the events of all jobs to the clients of /ws
+	hub wsHub
+	// scheduler runs the scans of schedules by name
+	scheduler *Scheduler
+	schedules map[string]ScanRequest
+
+	mu   sync.Mutex
+	jobs map[string]*scanJob
+	// order keeps job IDs in creation order for listing
+	order []string
+}
+
+// NewServer creates a Server whose scans share geo
+func NewServer(geo *Geo, token string, verbose bool) *Server {
+	return &Server{
+		Geo:     geo,
+		Token:   token,
+		Verbose: verbose,
+		jobs:    make(map[string]*scanJob),
+	}
+}
+
+// Handler returns the HTTP handler serving the dashboard, the API and the
+// gRPC API
+func (srv *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(dashboardHTML)
+	})
+	mux.HandleFunc("GET /scans", srv.auth(srv.handleList))
+	mux.HandleFunc("POST /scans", srv.auth(srv.handleStart))
+	mux.HandleFunc("GET /scans/{id}", srv.auth(srv.handleStatus))
+	mux.HandleFunc("GET /scans/{id}/results", srv.auth(srv.handleResults))
+	mux.HandleFunc("DELETE /scans/{id}", srv.auth(srv.handleStop))
+	mux.HandleFunc("GET /schedules", srv.auth(srv.handleSchedules))
+	mux.HandleFunc("GET /metrics", srv.auth(metricsHandler(srv.metricsSources)))
+	mux.HandleFunc("GET /ws", srv.handleWS)
+	// The gRPC API of api/scanner.proto
+	mux.HandleFunc("POST /realitlscanner.Scanner/StartScan", srv.grpc(srv.grpcStartScan))
+	mux.HandleFunc("POST /realitlscanner.Scanner/StreamResults", srv.grpc(srv.grpcStreamResults))
+	mux.HandleFunc("POST /realitlscanner.Scanner/CancelScan", srv.grpc(srv.grpcCancelScan))
+	return mux
+}
+
+// auth rejects requests without the bearer token when one is configured
+func (srv *Server) auth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if srv.Token != "" && r.Header.Get("Authorization") != "Bearer "+srv.Token {
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+func (srv *Server) job(r *http.Request) *scanJob {
+	return srv.jobByID(r.PathValue("id"))
+}
+
+func (srv *Server) jobByID(id string) *scanJob {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.jobs[id]
+}
+
+func (srv *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	srv.mu.Lock()
+	jobs := make([]*scanJob, 0, len(srv.order))
+	for _, id := range srv.order {
+		jobs = append(jobs, srv.jobs[id])
+	}
+	srv.mu.Unlock()
+	list := make([]ScanJobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, job.status())
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// metricsSources labels the stats of every running job with its ID,
+// finished ones are left out so the label sets do not grow with every run
+func (srv *Server) metricsSources() []metricsSource {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	sources := make([]metricsSource, 0, len(srv.order))
+	for _, id := range srv.order {
+		job := srv.jobs[id]
+		job.mu.Lock()
+		done := job.finished()
+		job.mu.Unlock()
+		if done {
+			continue
+		}
+		sources = append(sources, metricsSource{
+			labels: map[string]string{"scan": id},
+			stats:  &srv.jobs[id].scanner.Stats,
+		})
+	}
+	return sources
+}
+
+func (srv *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	job := srv.job(r)
+	if job == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job.status())
+}
+
+func (srv *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	job := srv.job(r)
+	if job == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+	job.scanner.Stop()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestError is a scan request the server cannot run as given
+type requestError string
+
+func (e requestError) Error() string { return string(e) }
+
+func (srv *Server) handleStart(w http.ResponseWriter, r *http.Request) {
+	var req ScanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	job, err := srv.start(req, "")
+	var reqErr requestError
+	switch {
+	case errors.As(err, &reqErr):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusCreated, job.status())
+	}
+}
+
+// start validates req and starts scanning it in the background. A job of
+// a schedule is recorded in the Store tagged with its name.
+func (srv *Server) start(req ScanRequest, schedule string) (*scanJob, error) {
+	if !ExistOnlyOne([]string{req.Addr, strings.Join(req.Targets, ""), req.URL, req.CT, req.Shodan, req.Censys}) {
+		return nil, requestError("specify exactly one of addr, targets, url, ct, shodan or censys")
+	}
+	if req.SearchLimit == 0 {
+		req.SearchLimit = 1000
+	}
+	if req.Port == 0 {
+		req.Port = 443
+	}
+	if req.Thread == 0 {
+		req.Thread = 2
+	}
+	if req.Timeout == 0 {
+		req.Timeout = 10
+	}
+	if req.Port < 1 || req.Port > 65535 || req.Thread < 1 || req.Timeout < 1 || req.Idle < 0 || req.NetCap < 0 || req.Rate < 0 || req.Bloom < 0 || req.SearchLimit < 0 || req.Retries < 0 || req.PreCheck < 0 || req.PreCheckTimeout < 0 || req.DNSTimeout < 0 || req.SpeedTest < 0 || req.MaxPerCountry < 0 || req.MaxPerASN < 0 || (req.SNI != "" && req.NoSNI) ||
+		(req.Expand != 0 && (req.Expand < 16 || req.Expand > 32)) {
+		return nil, requestError("invalid scan parameters")
+	}
+	allowCountries, err := ParseCountries(strings.Join(req.Countries, ","))
+	if err != nil {
+		return nil, requestError("invalid countries: " + err.Error())
+	}
+	dns, err := ParseDNSServers(strings.Join(req.DNS, ","))
+	if err != nil {
+		return nil, requestError(err.Error())
+	}
+	feasibility := FeasibilityPolicy{ALPN: req.FeasibleALPN, AllowTLS12: req.FeasibleTLS12,
+		Issuers: req.FeasibleIssuers, ExcludeIssuers: req.FeasibleExcludeIssuers, MinValidDays: req.FeasibleMinDays, MatchSNI: req.FeasibleSNI}
+	if err := feasibility.Validate(); err != nil {
+		return nil, requestError(err.Error())
+	}
+	if _, err := ParseTimingProfile(req.Timing); err != nil {
+		return nil, requestError(err.Error())
+	}
+	sniList, err := ParseSNIList(strings.Join(req.SNIMatrix, ","))
+	if err != nil {
+		return nil, requestError(err.Error())
+	}
+	words := ParseSubdomains(strings.Join(req.Subdomains, ","))
+	if err := ValidateSubdomains(words); err != nil {
+		return nil, requestError(err.Error())
+	}
+	config := &ScanConfig{
+		Port:            req.Port,
+		Thread:          req.Thread,
+		Timeout:         req.Timeout,
+		EnableIPv6:      req.IPv6,
+		HappyEyeballs:   req.IPv6 && req.HappyEyeballs,
+		Verbose:         srv.Verbose,
+		IdleTest:        req.Idle,
+		ExpandPrefix:    req.Expand,
+		NetworkCap:      req.NetCap,
+		ProbePQ:         req.PQ,
+		RateLimit:       req.Rate,
+		ProbeHTTP:       req.HTTP,
+		ServerName:      req.SNI,
+		NoSNI:           req.NoSNI,
+		DualProbe:       req.Dual,
+		SNIMatrix:       sniList,
+		DedupeBloom:     req.Bloom,
+		SaveCerts:       req.Certs,
+		TLSDetails:      req.TLSDetails,
+		DetectCDN:       req.CDN,
+		SkipCDN:         req.SkipCDN,
+		DetectHoneypots: req.Honeypots,
+		Retries:         req.Retries,
+		Adaptive:        req.Adaptive,
+		CheckOCSP:       req.OCSP,
+		Shuffle:         req.Shuffle,
+		Subdomains:      words,
+		SubdomainCT:     req.SubdomainCT,
+		ProbeH3:         req.H3,
+		ProbeResumption: req.Resumption,
+		ProbeHRR:        req.HRR,
+		DNSMatch:        req.DNSMatch,
+		SpeedTestKB:     req.SpeedTest,
+		PreCheckThreads: req.PreCheck,
+		PreCheckTimeout: req.PreCheckTimeout,
+		AllowCountries:  allowCountries,
+		MaxPerCountry:   req.MaxPerCountry,
+		MaxPerASN:       req.MaxPerASN,
+		DNSServers:      dns,
+		DNSTimeout:      req.DNSTimeout,
+		Feasibility:     feasibility,
+		Timing:          req.Timing,
+		// ASN lookups need the database the server was started with
+		EnableASN: req.ASN && srv.Geo.hasASN(),
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	var search HostSearch
+	if req.Shodan != "" || req.Censys != "" {
+		provider := "shodan"
+		if req.Censys != "" {
+			provider = "censys"
+		}
+		var err error
+		if search, err = newHostSearch(provider, ""); err != nil {
+			return nil, requestError(err.Error())
+		}
+	}
+	var exclude *ExcludeList
+	if len(req.Exclude) > 0 {
+		var err error
+		exclude, err = ParseExcludeList(strings.NewReader(strings.Join(req.Exclude, "\n")))
+		if err != nil {
+			return nil, requestError("invalid exclusion list: " + err.Error())
+		}
+		if exclude.NeedsASN() && !srv.Geo.hasASN() {
+			return nil, requestError("excluding AS numbers needs the server to run with -asn")
+		}
+	}
+
+	job := &scanJob{
+		id:       hex.EncodeToString(id),
+		created:  time.Now(),
+		schedule: schedule,
+		state:    JobPending,
+		hub:      &srv.hub,
+		changed:  make(chan struct{}),
+	}
+	switch {
+	case req.Addr != "":
+		job.source = "addr:" + req.Addr
+	case len(req.Targets) > 0:
+		job.source = "targets:" + strings.Join(req.Targets, ",")
+	case req.URL != "":
+		job.source = "url:" + req.URL
+	case req.Shodan != "":
+		job.source = "shodan:" + req.Shodan
+	case req.Censys != "":
+		job.source = "censys:" + req.Censys
+	default:
+		job.source = "ct:" + req.CT
+	}
+	job.scanner = newScanner(config, &ScanCallbacks{OnResult: job.addResult}, srv.Geo)
+	job.scanner.Exclude = exclude
+	if schedule != "" && srv.Store != nil {
+		session, err := srv.Store.StartSession(job.source, req.Port, schedule)
+		if err != nil {
+			return nil, err
+		}
+		job.scanner.Session = session
+	}
+
+	srv.mu.Lock()
+	srv.prune(time.Now())
+	srv.jobs[job.id] = job
+	srv.order = append(srv.order, job.id)
+	srv.mu.Unlock()
+	job.publishStatus()
+
+	go srv.run(job, req, search)
+	slog.Info("Scan started", "id", job.id, "source", job.source)
+	return job, nil
+}
+
+// prune drops the finished jobs that ended more than jobRetention ago or
+// are older than the latest maxFinishedJobs finished ones, srv.mu must be
+// held
+func (srv *Server) prune(now time.Time) {
+	keep := make([]bool, len(srv.order))
+	finished := 0
+	for i := len(srv.order) - 1; i >= 0; i-- {
+		job := srv.jobs[srv.order[i]]
+		job.mu.Lock()
+		done, ended := job.finished(), job.ended
+		job.mu.Unlock()
+		if !done {
+			keep[i] = true
+			continue
+		}
+		if now.Sub(ended) < jobRetention {
+			finished++
+			keep[i] = finished <= maxFinishedJobs
+		}
+	}
+	order := srv.order[:0]
+	for i, id := range srv.order {
+		if keep[i] {
+			order = append(order, id)
+		} else {
+			delete(srv.jobs, id)
+		}
+	}
+	srv.order = order
+}
+
+// run resolves the source of a job and scans it
+func (srv *Server) run(job *scanJob, req ScanRequest, search HostSearch) {
+	s := job.scanner
+	ctx := s.Context()
+	var hostChan <-chan Host
+	switch {
+	case req.Addr != "":
+		hostChan = IterateAddr(ctx, s.resolver, req.Addr, req.IPv6, req.Shuffle)
+	case len(req.Targets) > 0:
+		hostChan = Iterate(strings.NewReader(strings.Join(req.Targets, "\n")), req.IPv6, req.Shuffle)
+	case search != nil:
+		hostChan = IterateSearch(ctx, search, req.Shodan+req.Censys, req.SearchLimit, req.IPv6, 0)
+	default:
+		s.SetPhase(PhaseResolving)
+		var domains []string
+		var err error
+		if req.URL != "" {
+			domains, err = FetchURLDomains(ctx, req.URL)
+		} else {
+			domains, err = FetchCTDomains(ctx, req.CT)
+		}
+		if err != nil {
+			if errors.Is(ctx.Err(), context.Canceled) {
+				job.finish(JobStopped, "")
+			} else {
+				job.finish(JobFailed, err.Error())
+			}
+			slog.Warn("Scan failed", "id", job.id, "err", err)
+			return
+		}
+		hostChan = Iterate(strings.NewReader(strings.Join(domains, "\n")), req.IPv6, req.Shuffle)
+	}
+	job.finish(JobRunning, "")
+	s.Run(hostChan)
+	if ctx.Err() != nil {
+		job.finish(JobStopped, "")
+	} else {
+		job.finish(JobDone, "")
+	}
+	slog.Info("Scan finished", "id", job.id, "answered", job.status().Answered)
+}
+
+// Schedule runs the scans of schedules on their cron expressions until
+// ctx is done
+func (srv *Server) Schedule(ctx context.Context, schedules []ScheduledScan) error {
+	srv.schedules = make(map[string]ScanRequest, len(schedules))
+	srv.scheduler = NewScheduler(ctx, srv.runScheduled)
+	for _, schedule := range schedules {
+		srv.schedules[schedule.Name] = schedule.Scan
+		if err := srv.scheduler.Add(schedule.Name, schedule.Cron); err != nil {
+			return fmt.Errorf("schedule %q: %w", schedule.Name, err)
+		}
+	}
+	return nil
+}
+
+// runScheduled scans the schedule name and reports the changes since its
+// last run
+func (srv *Server) runScheduled(name string) {
+	job, err := srv.start(srv.schedules[name], name)
+	if err != nil {
+		slog.Warn("Scheduled scan failed to start", "schedule", name, "err", err)
+		return
+	}
+	slog.Info("Scheduled scan started", "schedule", name, "id", job.id)
+	job.wait()
+	session := job.scanner.Session
+	if session == nil || job.status().State != JobDone {
+		return
+	}
+	diff, err := scheduleDiff(srv.Store, name, session)
+	if err != nil {
+		slog.Warn("Cannot compare scheduled scan with its last run", "schedule", name, "err", err)
+		return
+	}
+	if diff == nil || diff.Empty() {
+		return
+	}
+	slog.Info("Scheduled scan changed since its last run", "schedule", name, "added", len(diff.Added),
+		"removed", len(diff.Removed), "changed", len(diff.Changed))
+	if srv.Sender == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Sender.Send(ctx, scheduleMessage(name, diff)); err != nil {
+		slog.Warn("Failed to send notification", "err", err)
+	}
+}
+
+// handleSchedules lists the schedules with their next and last runs
+func (srv *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	list := []ScheduleStatus{}
+	if srv.scheduler != nil {
+		list = srv.scheduler.Status()
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleResults streams the feasible results of a job as NDJSON, one
+// result per line. It follows the scan until it finishes unless
+// follow=false is given.
+func (srv *Server) handleResults(w http.ResponseWriter, r *http.Request) {
+	job := srv.job(r)
+	if job == nil {
+		writeError(w, http.StatusNotFound, "scan not found")
+		return
+	}
+	follow := r.URL.Query().Get("follow") != "false"
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	_ = job.stream(r.Context(), follow, func(batch []ScanResult) error {
+		for _, result := range batch {
+			if err := enc.Encode(result); err != nil {
+				return err
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+}
+
+// runServer starts the HTTP API on address and blocks
+func runServer(address, token string) {
+	providers, err := ParseGeoProviders(geoProviders)
+	if err != nil {
+		slog.Error("Invalid geo providers", "err", err)
+		return
+	}
+	geo := NewGeo(enableASN, GeoOptions{CountryPath: geoDB, ASNPath: asnDB, Mirror: geoMirror, Proxy: geoProxy,
+		LicenseKey: geoKey, City: geoCity, CityPath: cityDB, Providers: providers, DBIPPath: dbipDB,
+		IP2LocationPath: ip2locationDB, APIURL: geoAPI})
+	if geoUpdate > 0 {
+		// Scans share the databases of the server, which are kept fresh
+		// for all of them
+		go geo.AutoUpdate(context.Background(), time.Duration(geoUpdate)*time.Hour)
+	}
+	srv := NewServer(geo, token, verbose)
+	if schedulePath != "" {
+		schedules, err := LoadSchedules(schedulePath)
+		if err != nil {
+			slog.Error("Error reading schedules", "path", schedulePath, "err", err)
+			return
+		}
+		if dbPath != "" {
+			if srv.Store, err = OpenStore(dbPath); err != nil {
+				slog.Error("Error opening database", "path", dbPath, "err", err)
+				return
+			}
+			defer srv.Store.Close()
+		} else {
+			slog.Warn("Scheduled runs are not recorded without `db`, changes between them cannot be reported")
+		}
+		if tgChat != "" {
+			if srv.Sender, err = telegramSender(); err != nil {
+				slog.Error(err.Error())
+				return
+			}
+		}
+		if err := srv.Schedule(context.Background(), schedules); err != nil {
+			slog.Error("Error scheduling scans", "err", err)
+			return
+		}
+		for _, status := range srv.scheduler.Status() {
+			slog.Info("Scheduled scan", "schedule", status.Name, "cron", status.Cron, "next", status.Next)
+		}
+	}
+	if token == "" && !strings.HasPrefix(address, "127.0.0.1:") && !strings.HasPrefix(address, "localhost:") {
+		slog.Warn("Serving without a token, anyone who can reach the address can start scans", "addr", address)
+	}
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	// gRPC clients connect with HTTP/2 over plain TCP
+	protocols.SetUnencryptedHTTP2(true)
+	server := &http.Server{Addr: address, Handler: srv.Handler(), Protocols: &protocols}
+	slog.Info("Serving API, gRPC API and dashboard", "addr", address)
+	if err := server.ListenAndServe(); err != nil {
+		slog.Error("Server stopped", "err", err)
+	}
+}
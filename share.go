@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"net"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ShareParams are the parts of a share link that belong to the user's own
+// Reality server rather than to the scanned dest
+type ShareParams struct {
+	UUID        string
+	Server      string
+	Port        int
+	PublicKey   string
+	ShortID     string
+	Fingerprint string
+}
+
+// Validate reports the first missing parameter
+func (p ShareParams) Validate() error {
+	switch {
+	case p.UUID == "":
+		return errors.New("missing UUID")
+	case p.Server == "":
+		return errors.New("missing server address")
+	case p.PublicKey == "":
+		return errors.New("missing public key")
+	case p.Port < 1 || p.Port > 65535:
+		return errors.New("invalid server port")
+	}
+	return nil
+}
+
+// ShareLink builds a vless:// link as imported by v2rayN, NekoBox and
+// similar clients, with the result as the Reality SNI
+func ShareLink(result ScanResult, p ShareParams) string {
+	fp := p.Fingerprint
+	if fp == "" {
+		fp = xrayFingerprint
+	}
+	sni := ""
+	if names := xrayServerNames(result); len(names) > 0 {
+		sni = names[0]
+	} else if net.ParseIP(result.Origin) == nil && ValidateDomainName(result.Origin) {
+		// A wildcard certificate still serves the domain it was found by
+		sni = result.Origin
+	}
+	query := neturl.Values{}
+	query.Set("encryption", "none")
+	query.Set("flow", "xtls-rprx-vision")
+	query.Set("security", "reality")
+	query.Set("sni", sni)
+	query.Set("fp", fp)
+	query.Set("pbk", p.PublicKey)
+	query.Set("sid", p.ShortID)
+	query.Set("type", "tcp")
+	u := neturl.URL{
+		Scheme:   "vless",
+		User:     neturl.User(p.UUID),
+		Host:     net.JoinHostPort(p.Server, strconv.Itoa(p.Port)),
+		RawQuery: query.Encode(),
+		Fragment: shareName(result),
+	}
+	return u.String()
+}
+
+// shareName labels a link in the client with the dest and its country
+func shareName(result ScanResult) string {
+	name := result.Domain
+	if name == "" || strings.HasPrefix(name, "*") {
+		name = result.IP
+	}
+	if result.GeoCode != "" && result.GeoCode != "N/A" {
+		name = result.GeoCode + " " + name
+	}
+	return name
+}
+
+// ShareSubscription returns one link per result, base64 encoded as a
+// subscription if encode is set
+func ShareSubscription(results []ScanResult, p ShareParams, encode bool) string {
+	var b strings.Builder
+	for _, result := range results {
+		b.WriteString(ShareLink(result, p))
+		b.WriteString("\n")
+	}
+	if encode {
+		return base64.StdEncoding.EncodeToString([]byte(b.String()))
+	}
+	return b.String()
+}
+
+// runShare implements the `share` command, which turns a results file into
+// share links for client apps
+func runShare(args []string) {
+	fs := flag.NewFlagSet("share", flag.ExitOnError)
+	in := fs.String("in", "out.csv", "Results file produced by a scan or by pick")
+	out := fs.String("out", "", "Output file for the links, default: stdout")
+	uuid := fs.String("uuid", "", "UUID of the client on your server")
+	server := fs.String("server", "", "Address of your Reality server")
+	serverPort := fs.Int("port", 443, "Port of your Reality server")
+	publicKey := fs.String("pbk", "", "Reality public key of your server")
+	shortID := fs.String("sid", "", "Reality short ID")
+	fingerprint := fs.String("fp", xrayFingerprint, "uTLS fingerprint")
+	encode := fs.Bool("base64", false, "Encode the list as a base64 subscription")
+	_ = fs.Parse(args)
+
+	params := ShareParams{
+		UUID:        *uuid,
+		Server:      *server,
+		Port:        *serverPort,
+		PublicKey:   *publicKey,
+		ShortID:     *shortID,
+		Fingerprint: *fingerprint,
+	}
+	if err := params.Validate(); err != nil {
+		slog.Error("Invalid share parameters", "err", err)
+		fs.PrintDefaults()
+		return
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		slog.Error("Error reading file", "path", *in)
+		return
+	}
+	defer f.Close()
+	results, err := ReadResultsCSV(f)
+	if err != nil {
+		slog.Error("Error parsing results", "path", *in, "err", err)
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		of, err := os.Create(*out)
+		if err != nil {
+			slog.Error("Error opening file", "path", *out)
+			return
+		}
+		defer of.Close()
+		w = of
+	}
+	_, _ = io.WriteString(w, ShareSubscription(results, params, *encode))
+}
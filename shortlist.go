@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// shortlistMaxNodes bounds the search so huge result sets stay fast; the
+// best selection found so far is returned when it is exhausted
+const shortlistMaxNodes = 200000
+
+// ShortlistConstraints describe how diverse a dest shortlist must be
+type ShortlistConstraints struct {
+	// Count is the number of dests to pick
+	Count int
+	// UniqueASN forbids two dests from the same autonomous system
+	UniqueASN bool
+	// UniquePrefix forbids two dests within the same IPv4 /UniquePrefix
+	// (IPv6 uses the same number of leading bits times four), 0 disables
+	UniquePrefix int
+	// MinCountries is the minimum number of distinct countries
+	MinCountries int
+	// CountryWeight is added to the score for every distinct country, so
+	// more diverse selections win over slightly better scored ones
+	CountryWeight float64
+}
+
+// ErrShortlistInfeasible is returned when no selection satisfies the
+// constraints
+var ErrShortlistInfeasible = errors.New("no selection satisfies the constraints")
+
+type shortlistCandidate struct {
+	result  ScanResult
+	score   float64
+	prefix  netip.Prefix
+	country string
+}
+
+// LatencyScore prefers dests with the lowest connect and handshake time
+func LatencyScore(result ScanResult) float64 {
+	return -float64(result.ConnectMs + result.HandshakeMs)
+}
+
+// Shortlist picks the feasible results with the highest total score that
+// satisfy the constraints, using a branch and bound search
+func Shortlist(results []ScanResult, score func(ScanResult) float64, c ShortlistConstraints) ([]ScanResult, error) {
+	if c.Count <= 0 {
+		return nil, fmt.Errorf("invalid count: %d", c.Count)
+	}
+	var candidates []shortlistCandidate
+	for _, result := range results {
+		if !result.Feasible {
+			continue
+		}
+		cand := shortlistCandidate{result: result, score: score(result), country: result.GeoCode}
+		if c.UniquePrefix > 0 {
+			addr, err := netip.ParseAddr(result.IP)
+			if err != nil {
+				continue
+			}
+			bits := c.UniquePrefix
+			if addr.Is6() && !addr.Is4In6() {
+				bits = min(bits*4, 128)
+			}
+			cand.prefix, _ = addr.Unmap().Prefix(bits)
+		}
+		candidates = append(candidates, cand)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+
+	s := &shortlistSearch{
+		constraints: c,
+		candidates:  candidates,
+		asns:        make(map[uint]bool),
+		prefixes:    make(map[netip.Prefix]bool),
+		countries:   make(map[string]int),
+	}
+	s.search(0, 0)
+	if s.best == nil {
+		return nil, ErrShortlistInfeasible
+	}
+	picked := make([]ScanResult, len(s.best))
+	for i, idx := range s.best {
+		picked[i] = candidates[idx].result
+	}
+	return picked, nil
+}
+
+type shortlistSearch struct {
+	constraints ShortlistConstraints
+	candidates  []shortlistCandidate
+
+	chosen    []int
+	asns      map[uint]bool
+	prefixes  map[netip.Prefix]bool
+	countries map[string]int
+
+	best      []int
+	bestScore float64
+	nodes     int
+}
+
+// objective is the weighted score of the current selection
+func (s *shortlistSearch) objective(sum float64) float64 {
+	return sum + s.constraints.CountryWeight*float64(len(s.countries))
+}
+
+func (s *shortlistSearch) search(start int, sum float64) {
+	c := s.constraints
+	s.nodes++
+	if len(s.chosen) == c.Count {
+		if len(s.countries) >= c.MinCountries && (s.best == nil || s.objective(sum) > s.bestScore) {
+			s.best = append([]int(nil), s.chosen...)
+			s.bestScore = s.objective(sum)
+		}
+		return
+	}
+	remaining := c.Count - len(s.chosen)
+	if len(s.candidates)-start < remaining || s.nodes > shortlistMaxNodes {
+		return
+	}
+	// Not enough picks left to reach the country minimum
+	if len(s.countries)+remaining < c.MinCountries {
+		return
+	}
+	// Candidates are sorted, so the next ones bound the reachable score
+	if s.best != nil {
+		bound := sum
+		for i := start; i < start+remaining; i++ {
+			bound += s.candidates[i].score
+		}
+		bound += c.CountryWeight * float64(len(s.countries)+remaining)
+		if bound <= s.bestScore {
+			return
+		}
+	}
+	for i := start; i < len(s.candidates); i++ {
+		cand := s.candidates[i]
+		if c.UniqueASN && cand.result.ASN != 0 && s.asns[cand.result.ASN] {
+			continue
+		}
+		if c.UniquePrefix > 0 && s.prefixes[cand.prefix] {
+			continue
+		}
+		s.chosen = append(s.chosen, i)
+		s.asns[cand.result.ASN] = true
+		s.prefixes[cand.prefix] = true
+		s.countries[cand.country]++
+
+		s.search(i+1, sum+cand.score)
+
+		s.chosen = s.chosen[:len(s.chosen)-1]
+		delete(s.asns, cand.result.ASN)
+		delete(s.prefixes, cand.prefix)
+		if s.countries[cand.country]--; s.countries[cand.country] == 0 {
+			delete(s.countries, cand.country)
+		}
+		if s.nodes > shortlistMaxNodes {
+			return
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"net/netip"
+)
+
+// shuffleMaxBits caps the host bits a CIDR block is shuffled over, larger
+// IPv6 blocks are shuffled within their first 2^62 addresses
+const shuffleMaxBits = 62
+
+// cidrPermutation visits the offsets of the addresses of a CIDR block in a
+// pseudo-random order. It steps a linear congruential generator modulo the
+// block size, which has a full period with an odd increment and a
+// multiplier of 1 mod 4, and scrambles its output with a bijection to hide
+// the regular low bits of the generator. The parameters are derived from
+// the block, so the order is the same on every run and a resumed scan
+// continues it.
+type cidrPermutation struct {
+	bits  int
+	mask  uint64
+	a, c  uint64
+	mul   uint64
+	state uint64
+}
+
+func newCIDRPermutation(p netip.Prefix) *cidrPermutation {
+	bits := min(p.Addr().BitLen()-p.Bits(), shuffleMaxBits)
+	h := fnv.New128a()
+	h.Write([]byte(p.Masked().String()))
+	sum := h.Sum(nil)
+	seed := binary.BigEndian.Uint64(sum[:8])
+	seed2 := binary.BigEndian.Uint64(sum[8:])
+	mask := uint64(1)<<bits - 1
+	return &cidrPermutation{
+		bits:  bits,
+		mask:  mask,
+		a:     seed&^3 | 1,
+		c:     seed2 | 1,
+		mul:   (seed>>32 ^ seed2<<32) | 1,
+		state: (seed ^ seed2) & mask,
+	}
+}
+
+// Len returns how many addresses the permutation visits
+func (p *cidrPermutation) Len() uint64 {
+	return p.mask + 1
+}
+
+// Skip jumps over the next n offsets in O(log n) steps
+func (p *cidrPermutation) Skip(n uint64) {
+	// Compose the generator with itself by squaring, arithmetic modulo
+	// 2^64 is also correct modulo the block size
+	accMul, accAdd := uint64(1), uint64(0)
+	curMul, curAdd := p.a, p.c
+	for ; n > 0; n >>= 1 {
+		if n&1 == 1 {
+			accMul *= curMul
+			accAdd = accAdd*curMul + curAdd
+		}
+		curAdd *= curMul + 1
+		curMul *= curMul
+	}
+	p.state = (accMul*p.state + accAdd) & p.mask
+}
+
+// Next returns the offset of the next address in the block
+func (p *cidrPermutation) Next() uint64 {
+	x := p.state
+	p.state = (p.a*p.state + p.c) & p.mask
+	// Right xorshifts and odd multipliers are bijections modulo 2^bits
+	shift := (p.bits + 1) / 2
+	x ^= x >> shift
+	x = x * p.mul & p.mask
+	x ^= x >> shift
+	return x
+}
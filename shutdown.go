@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// shutdownGrace is added to the scan timeout for the results of the last
+// handshakes to be handed over after a stop
+const shutdownGrace = 5 * time.Second
+
+// interrupted is set once the CLI got SIGINT or SIGTERM, so that runs
+// queued after the current one are skipped
+var interrupted atomic.Bool
+
+// stopOnSignal shuts scanner down on SIGINT or SIGTERM: the handshakes in
+// progress finish, then Run returns and its results, output and checkpoint
+// are written as after a complete scan. Another signal, or a shutdown
+// taking longer than the timeout of the scan, quits at once. The returned
+// function stops listening.
+func stopOnSignal(scanner *Scanner) func() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+		case <-done:
+			return
+		}
+		interrupted.Store(true)
+		timeout := scanner.ShutdownTimeout()
+		slog.Warn("Stopping, finishing the handshakes in progress, interrupt again to quit at once",
+			"max_wait", timeout.String())
+		finished := make(chan bool, 1)
+		go func() { finished <- scanner.Shutdown(timeout) }()
+		for {
+			select {
+			case ok := <-finished:
+				if !ok {
+					slog.Error("Handshakes still in progress, quitting without writing the remaining results")
+					os.Exit(1)
+				}
+			case <-signals:
+				slog.Error("Interrupted again, quitting without writing the remaining results")
+				os.Exit(130)
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
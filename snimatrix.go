@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SNIProbe is what a host served to one SNI of the SNI matrix
+type SNIProbe struct {
+	SNI string `json:"sni"`
+	// Domain is the domain of the certificate, empty when the handshake
+	// failed
+	Domain string `json:"domain,omitempty"`
+	// Valid is whether the certificate chains to a trusted root and is
+	// valid for the SNI
+	Valid bool `json:"valid"`
+	// Cert tells the certificates apart, a prefix of their SHA-256
+	Cert string `json:"cert,omitempty"`
+}
+
+// ParseSNIList parses comma or space separated candidate SNIs
+func ParseSNIList(value string) ([]string, error) {
+	var names []string
+	for _, name := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n' || r == '\r'
+	}) {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		if !ValidateDomainName(name) {
+			return nil, fmt.Errorf("invalid SNI %q", name)
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// probeSNIMatrix repeats the handshake with the host once for every SNI of
+// the matrix and records the certificate it served to each
+func (s *Scanner) probeSNIMatrix(hostPort string) []SNIProbe {
+	probes := make([]SNIProbe, 0, len(s.Config.SNIMatrix))
+	for _, sni := range s.Config.SNIMatrix {
+		if s.ctx.Err() != nil {
+			break
+		}
+		probe := SNIProbe{SNI: sni}
+		c, err := s.probeConn(hostPort, &tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         s.Config.Feasibility.nextProtos(),
+			CurvePreferences:   []tls.CurveID{tls.X25519},
+			ServerName:         sni,
+		})
+		if err != nil {
+			s.log(slog.LevelDebug, "SNI matrix handshake failed", "target", hostPort, "sni", sni, "err", err)
+			probes = append(probes, probe)
+			continue
+		}
+		certs := c.ConnectionState().PeerCertificates
+		c.Close()
+		if len(certs) > 0 {
+			sum := sha256.Sum256(certs[0].Raw)
+			probe.Domain = certDomain(certs[0])
+			probe.Cert = hex.EncodeToString(sum[:8])
+			probe.Valid = verifyChain(certs, sni, time.Now())
+		}
+		probes = append(probes, probe)
+	}
+	return probes
+}
+
+// verifyChain reports whether the certificates sent by a host chain to a
+// root trusted by the system and the leaf is valid for name
+func verifyChain(certs []*x509.Certificate, name string, now time.Time) bool {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       name,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	return err == nil
+}
+
+// sniCertGroups groups the SNIs served a valid certificate by certificate,
+// in the order of the matrix
+func sniCertGroups(probes []SNIProbe) [][]string {
+	var groups [][]string
+	var certs []string
+	for _, probe := range probes {
+		if !probe.Valid {
+			continue
+		}
+		if i := slices.Index(certs, probe.Cert); i >= 0 {
+			groups[i] = append(groups[i], probe.SNI)
+			continue
+		}
+		certs = append(certs, probe.Cert)
+		groups = append(groups, []string{probe.SNI})
+	}
+	return groups
+}
+
+// ValidSNIs returns the SNIs of the matrix the host served a valid
+// certificate for
+func (r ScanResult) ValidSNIs() []string {
+	var names []string
+	for _, probe := range r.SNIs {
+		if probe.Valid {
+			names = append(names, probe.SNI)
+		}
+	}
+	return names
+}
+
+// formatSNICerts renders the SNIs served a valid certificate, those sharing
+// a certificate joined by +, e.g. "a.com+www.a.com b.com"
+func formatSNICerts(probes []SNIProbe) string {
+	groups := sniCertGroups(probes)
+	parts := make([]string, len(groups))
+	for i, group := range groups {
+		parts[i] = strings.Join(group, "+")
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseSNICerts reads back the SNIs written by formatSNICerts as valid
+// probes, numbering the certificates as the real ones are not known
+func parseSNICerts(value string) []SNIProbe {
+	var probes []SNIProbe
+	for i, group := range strings.Fields(value) {
+		for _, sni := range strings.Split(group, "+") {
+			probes = append(probes, SNIProbe{SNI: sni, Valid: true, Cert: fmt.Sprint(i)})
+		}
+	}
+	return probes
+}
+
+// sniMatrixNames returns the SNIs of probes
+func sniMatrixNames(probes []SNIProbe) []string {
+	names := make([]string, len(probes))
+	for i, probe := range probes {
+		names[i] = probe.SNI
+	}
+	return names
+}
+
+// marshalProto encodes the SNIProbe message of api/scanner.proto
+func (p SNIProbe) marshalProto() protoBuffer {
+	var b protoBuffer
+	b.string(1, p.SNI)
+	b.string(2, p.Domain)
+	b.bool(3, p.Valid)
+	b.string(4, p.Cert)
+	return b
+}
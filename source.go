@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// urlMaxPage caps the size of a crawled page
+const urlMaxPage = 20 << 20
+
+// urlHostnameRegexp matches hostnames written out in the text of a page
+var urlHostnameRegexp = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}\b`)
+
+// urlFileExtensions are endings of file names mentioned in pages, which look
+// like hostnames
+var urlFileExtensions = map[string]bool{
+	"html": true, "htm": true, "php": true, "asp": true, "aspx": true, "js": true, "css": true, "json": true,
+	"xml": true, "txt": true, "md": true, "png": true, "jpg": true, "jpeg": true, "gif": true, "svg": true,
+	"ico": true, "webp": true, "pdf": true, "zip": true, "gz": true, "tar": true, "xz": true, "bz2": true,
+	"iso": true, "exe": true, "deb": true, "rpm": true, "sh": true, "py": true, "go": true,
+}
+
+// FetchURLDomains downloads a page and returns the unique hosts of the
+// links (href and src attributes) and the hostnames in its text, in the
+// order they appear
+func FetchURLDomains(ctx context.Context, url string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch url: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	domains, err := pageDomains(io.LimitReader(resp.Body, urlMaxPage))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	return domains, nil
+}
+
+// pageDomains extracts the hosts of absolute links and the hostnames in the
+// text of an HTML page. Plain text pages are searched for hostnames only.
+func pageDomains(r io.Reader) ([]string, error) {
+	var domains []string
+	add := func(host string) {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		if host != "" && ValidateDomainName(host) {
+			domains = append(domains, host)
+		}
+	}
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return nil, z.Err()
+			}
+			return RemoveDuplicateStr(domains), nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			for {
+				key, value, more := z.TagAttr()
+				if k := string(key); k == "href" || k == "src" {
+					// Relative links stay on the crawled site
+					u, err := neturl.Parse(strings.TrimSpace(string(value)))
+					if err == nil && u.Host != "" && (u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https") {
+						add(u.Hostname())
+					}
+				}
+				if !more {
+					break
+				}
+			}
+		case html.TextToken:
+			for _, host := range urlHostnameRegexp.FindAllString(string(z.Text()), -1) {
+				if !urlFileExtensions[strings.ToLower(host[strings.LastIndex(host, ".")+1:])] {
+					add(host)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// speedTestMinBytes is the least a download must bring for its throughput
+// to be recorded, smaller pages finish before the connection speeds up
+const speedTestMinBytes = 16 << 10
+
+// probeSpeed downloads up to Config.SpeedTestKB KB of the page of the host
+// over HTTP/2 on a new connection and returns the throughput in KB/s, 0 when
+// the download failed or was too short to tell
+func (s *Scanner) probeSpeed(hostPort, sni string, result ScanResult) int {
+	c, err := s.probeConn(hostPort, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2"},
+		CurvePreferences:   []tls.CurveID{tls.X25519},
+		ServerName:         sni,
+	})
+	if err != nil {
+		s.log(slog.LevelDebug, "Speed test handshake failed", "target", hostPort, "err", err)
+		return 0
+	}
+	defer c.Close()
+	timeout := time.Duration(s.Config.Timeout) * time.Second
+	if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0
+	}
+	cc, err := (&http2.Transport{}).NewClientConn(c)
+	if err != nil {
+		s.log(slog.LevelDebug, "HTTP/2 setup failed", "target", hostPort, "err", err)
+		return 0
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+httpProbeAuthority(sni, result)+"/", nil)
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("User-Agent", httpProbeUserAgent)
+	req.Header.Set("Accept", "*/*")
+	resp, err := cc.RoundTrip(req)
+	if err != nil {
+		s.log(slog.LevelDebug, "Speed test request failed", "target", hostPort, "err", err)
+		return 0
+	}
+	defer resp.Body.Close()
+	// The clock starts with the response, leaving out the round trip of
+	// the request
+	start := time.Now()
+	n, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, int64(s.Config.SpeedTestKB)<<10))
+	elapsed := time.Since(start)
+	if n < min(speedTestMinBytes, int64(s.Config.SpeedTestKB)<<10) || elapsed <= 0 {
+		s.log(slog.LevelDebug, "Speed test download too short", "target", hostPort, "bytes", n)
+		return 0
+	}
+	return max(1, int(float64(n)/1024/elapsed.Seconds()))
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// storeSchema creates the tables of a results database
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS sessions (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	source   TEXT NOT NULL,
+	port     INTEGER NOT NULL,
+	tag      TEXT NOT NULL DEFAULT '',
+	started  INTEGER NOT NULL,
+	finished INTEGER
+);
+CREATE TABLE IF NOT EXISTS results (
+	session_id   INTEGER NOT NULL REFERENCES sessions(id),
+	ip           TEXT NOT NULL,
+	port         INTEGER NOT NULL,
+	origin       TEXT NOT NULL,
+	domain       TEXT NOT NULL,
+	issuer       TEXT NOT NULL,
+	geo_code     TEXT NOT NULL,
+	feasible     INTEGER NOT NULL,
+	tls_version  TEXT NOT NULL,
+	alpn         TEXT NOT NULL,
+	idle         TEXT NOT NULL,
+	asn          INTEGER NOT NULL,
+	as_org       TEXT NOT NULL,
+	sans         TEXT NOT NULL,
+	connect_ms   INTEGER NOT NULL,
+	handshake_ms INTEGER NOT NULL,
+	scanned      INTEGER NOT NULL,
+	curve        TEXT NOT NULL DEFAULT '',
+	http_status  INTEGER NOT NULL DEFAULT 0,
+	http_server  TEXT NOT NULL DEFAULT '',
+	http_content INTEGER NOT NULL DEFAULT 0,
+	dual_domain  TEXT NOT NULL DEFAULT '',
+	cert_differs INTEGER NOT NULL DEFAULT 0,
+	score        REAL NOT NULL DEFAULT 0,
+	cipher_suite TEXT NOT NULL DEFAULT '',
+	key_exchange TEXT NOT NULL DEFAULT '',
+	cdn          TEXT NOT NULL DEFAULT '',
+	ocsp         TEXT NOT NULL DEFAULT '',
+	ocsp_stapled INTEGER NOT NULL DEFAULT 0,
+	h3           INTEGER NOT NULL DEFAULT 0,
+	sni_matrix   TEXT NOT NULL DEFAULT '',
+	resumption   TEXT NOT NULL DEFAULT '',
+	speed_kbps   INTEGER NOT NULL DEFAULT 0,
+	hrr          TEXT NOT NULL DEFAULT '',
+	honeypot     INTEGER NOT NULL DEFAULT 0,
+	rank         INTEGER NOT NULL DEFAULT 0,
+	family       TEXT NOT NULL DEFAULT '',
+	families     TEXT NOT NULL DEFAULT '',
+	dns_match    TEXT NOT NULL DEFAULT '',
+	dual_error   TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (session_id, ip, port)
+);
+CREATE TABLE IF NOT EXISTS scanned (
+	ip   TEXT NOT NULL,
+	port INTEGER NOT NULL,
+	last INTEGER NOT NULL,
+	PRIMARY KEY (ip, port)
+);
+`
+
+// storeMigrations add the columns introduced after the first schema to
+// existing databases
+var storeMigrations = []string{
+	"ALTER TABLE results ADD COLUMN curve TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN http_status INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE results ADD COLUMN http_server TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN http_content INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE results ADD COLUMN dual_domain TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN cert_differs INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE results ADD COLUMN score REAL NOT NULL DEFAULT 0",
+	"ALTER TABLE results ADD COLUMN cipher_suite TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN key_exchange TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN cdn TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN ocsp TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN ocsp_stapled INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE results ADD COLUMN h3 INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE results ADD COLUMN sni_matrix TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN resumption TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN speed_kbps INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE results ADD COLUMN hrr TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN honeypot INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE results ADD COLUMN rank INTEGER NOT NULL DEFAULT 0",
+	"ALTER TABLE results ADD COLUMN family TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN families TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN dns_match TEXT NOT NULL DEFAULT ''",
+	"ALTER TABLE results ADD COLUMN dual_error TEXT NOT NULL DEFAULT ''",
+}
+
+// Store keeps scan sessions and their results in a SQLite database
+type Store struct {
+	db *sql.DB
+}
+
+// SessionInfo describes a scan recorded in a Store
+type SessionInfo struct {
+	ID       int64
+	Source   string
+	Port     int
+	Tag      string
+	Started  time.Time
+	Finished time.Time // zero if the scan was interrupted
+	Results  int
+	Feasible int
+}
+
+// OpenStore opens or creates the database at path
+func OpenStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, workers take turns on one connection
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA journal_mode=WAL; PRAGMA busy_timeout=5000;" + storeSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	for _, m := range storeMigrations {
+		// New databases already have the column
+		if _, err := db.Exec(m); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the database
+func (st *Store) Close() error {
+	return st.db.Close()
+}
+
+// Session records one scan in a Store
+type Session struct {
+	store *Store
+	ID    int64
+}
+
+// StartSession records a new scan
+func (st *Store) StartSession(source string, port int, tag string) (*Session, error) {
+	res, err := st.db.Exec("INSERT INTO sessions (source, port, tag, started) VALUES (?, ?, ?, ?)",
+		source, port, tag, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return &Session{store: st, ID: id}, nil
+}
+
+// Finish marks the scan as completed
+func (ss *Session) Finish() error {
+	_, err := ss.store.db.Exec("UPDATE sessions SET finished = ? WHERE id = ?", time.Now().Unix(), ss.ID)
+	return err
+}
+
+// AddResult stores a result of the scan. A host reported twice in one
+// session keeps the latest result.
+func (ss *Session) AddResult(result ScanResult) error {
+	feasible := 0
+	if result.Feasible {
+		feasible = 1
+	}
+	// The SNI matrix is kept as JSON
+	sniMatrix := ""
+	if len(result.SNIs) > 0 {
+		data, _ := json.Marshal(result.SNIs)
+		sniMatrix = string(data)
+	}
+	families := ""
+	if len(result.Families) > 0 {
+		data, _ := json.Marshal(result.Families)
+		families = string(data)
+	}
+	_, err := ss.store.db.Exec(`INSERT OR REPLACE INTO results (session_id, ip, port, origin, domain, issuer,
+		geo_code, feasible, tls_version, alpn, idle, asn, as_org, sans, connect_ms, handshake_ms, scanned, curve,
+		http_status, http_server, http_content, dual_domain, cert_differs, score,
+		cipher_suite, key_exchange, cdn, ocsp, ocsp_stapled, h3, sni_matrix, resumption, speed_kbps, hrr,
+		honeypot, rank, family, families, dns_match, dual_error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ss.ID, result.IP, result.Port, result.Origin, result.Domain, result.Issuer,
+		result.GeoCode, feasible, result.TLSVersion, result.ALPN, result.Idle, result.ASN, result.ASOrg,
+		strings.Join(result.SANs, " "), result.ConnectMs, result.HandshakeMs, time.Now().Unix(), result.Curve,
+		result.HTTPStatus, result.HTTPServer, result.HTTPContent, result.DualDomain, result.CertDiffers,
+		result.Score, result.CipherSuite, result.KeyExchange, result.CDN, result.OCSP, result.OCSPStapled, result.H3,
+		sniMatrix, result.Resumption, result.SpeedKBps, result.HRR, result.Honeypot, result.Rank,
+		result.Family, families, result.DNSMatch, result.DualError)
+	return err
+}
+
+// MarkScanned records that ip was scanned on port, whether it answered
+// or not
+func (ss *Session) MarkScanned(ip net.IP, port int) error {
+	_, err := ss.store.db.Exec(`INSERT INTO scanned (ip, port, last) VALUES (?, ?, ?)
+		ON CONFLICT (ip, port) DO UPDATE SET last = excluded.last`,
+		ip.String(), port, time.Now().Unix())
+	return err
+}
+
+// ScannedSince returns the IPs scanned on port since t
+func (st *Store) ScannedSince(port int, t time.Time) (map[string]bool, error) {
+	rows, err := st.db.Query("SELECT ip FROM scanned WHERE port = ? AND last >= ?", port, t.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ips := make(map[string]bool)
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		ips[ip] = true
+	}
+	return ips, rows.Err()
+}
+
+// Sessions lists the recorded scans, newest first
+func (st *Store) Sessions() ([]SessionInfo, error) {
+	rows, err := st.db.Query(`SELECT s.id, s.source, s.port, s.tag, s.started, COALESCE(s.finished, 0),
+		COUNT(r.ip), COALESCE(SUM(r.feasible), 0)
+		FROM sessions s LEFT JOIN results r ON r.session_id = s.id
+		GROUP BY s.id ORDER BY s.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []SessionInfo
+	for rows.Next() {
+		var s SessionInfo
+		var started, finished int64
+		if err := rows.Scan(&s.ID, &s.Source, &s.Port, &s.Tag, &started, &finished, &s.Results, &s.Feasible); err != nil {
+			return nil, err
+		}
+		s.Started = time.Unix(started, 0)
+		if finished > 0 {
+			s.Finished = time.Unix(finished, 0)
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// PreviousSession returns the latest finished session tagged tag before
+// the session before, ok is false if there is none
+func (st *Store) PreviousSession(tag string, before int64) (id int64, ok bool, err error) {
+	err = st.db.QueryRow(`SELECT id FROM sessions WHERE tag = ? AND id < ? AND finished IS NOT NULL
+		ORDER BY id DESC LIMIT 1`, tag, before).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return id, err == nil, err
+}
+
+// Results returns the results of a session, feasible ones only if
+// feasibleOnly is set
+func (st *Store) Results(session int64, feasibleOnly bool) ([]ScanResult, error) {
+	query := `SELECT ip, port, origin, domain, issuer, geo_code, feasible, tls_version, alpn, idle,
+		asn, as_org, sans, connect_ms, handshake_ms, curve, http_status, http_server, http_content,
+		dual_domain, cert_differs, score, cipher_suite, key_exchange, cdn, ocsp, ocsp_stapled, h3,
+		sni_matrix, resumption, speed_kbps, hrr, honeypot, rank, family, families, dns_match, dual_error FROM results WHERE session_id = ?`
+	if feasibleOnly {
+		query += " AND feasible = 1"
+	}
+	rows, err := st.db.Query(query+" ORDER BY scanned", session)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []ScanResult
+	for rows.Next() {
+		var r ScanResult
+		var sans, sniMatrix, families string
+		if err := rows.Scan(&r.IP, &r.Port, &r.Origin, &r.Domain, &r.Issuer, &r.GeoCode, &r.Feasible,
+			&r.TLSVersion, &r.ALPN, &r.Idle, &r.ASN, &r.ASOrg, &sans, &r.ConnectMs, &r.HandshakeMs, &r.Curve,
+			&r.HTTPStatus, &r.HTTPServer, &r.HTTPContent, &r.DualDomain, &r.CertDiffers,
+			&r.Score, &r.CipherSuite, &r.KeyExchange, &r.CDN, &r.OCSP, &r.OCSPStapled, &r.H3,
+			&sniMatrix, &r.Resumption, &r.SpeedKBps, &r.HRR, &r.Honeypot, &r.Rank,
+			&r.Family, &families, &r.DNSMatch, &r.DualError); err != nil {
+			return nil, err
+		}
+		r.SANs = strings.Fields(sans)
+		if sniMatrix != "" {
+			_ = json.Unmarshal([]byte(sniMatrix), &r.SNIs)
+		}
+		if families != "" {
+			_ = json.Unmarshal([]byte(families), &r.Families)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// DefaultSubdomains are the prefixes tried under every domain when the
+// subdomains are enumerated without a wordlist of their own. Apex domains
+// often sit behind a CDN while these point at the origin.
+var DefaultSubdomains = []string{
+	"www", "mail", "cdn", "api", "static", "img", "media", "assets", "app",
+	"m", "blog", "shop", "store", "dev", "test", "stage", "origin", "direct",
+	"web", "portal", "login", "auth", "admin", "vpn", "git", "docs", "status",
+}
+
+// ParseSubdomains turns a comma separated list of prefixes into a wordlist,
+// "default" standing for DefaultSubdomains
+func ParseSubdomains(list string) []string {
+	var words []string
+	for _, word := range strings.Split(list, ",") {
+		word = strings.ToLower(strings.TrimSpace(word))
+		switch {
+		case word == "":
+		case word == "default":
+			words = append(words, DefaultSubdomains...)
+		default:
+			words = append(words, word)
+		}
+	}
+	return RemoveDuplicateStr(words)
+}
+
+// ReadSubdomains reads a wordlist of prefixes, one per line. Blank lines
+// and lines starting with # are skipped.
+func ReadSubdomains(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return RemoveDuplicateStr(words), nil
+}
+
+// ValidateSubdomains checks that every prefix can be put in front of a
+// domain
+func ValidateSubdomains(words []string) error {
+	for _, word := range words {
+		if word == "" || strings.HasPrefix(word, ".") || strings.HasSuffix(word, ".") ||
+			strings.Contains(word, "..") || !ValidateDomainName(word) {
+			return fmt.Errorf("invalid subdomain %q", word)
+		}
+	}
+	return nil
+}
+
+// expandSubdomains passes on the hosts of hostChan, following every domain
+// with the subdomains of Config.Subdomains and, with Config.SubdomainCT,
+// those found in Certificate Transparency logs. Subdomains are extra hosts
+// like the networks around feasible hosts: they are not part of the total
+// or of a checkpoint, and each one is only scanned once. Subdomains that
+// are also in the source are not enumerated again.
+func (s *Scanner) expandSubdomains(hostChan <-chan Host) <-chan Host {
+	out := make(chan Host)
+	go func() {
+		defer close(out)
+		seen := make(map[string]bool)
+		send := func(host Host) bool {
+			select {
+			case out <- host:
+				return true
+			case <-s.ctx.Done():
+				return false
+			}
+		}
+		for host := range hostChan {
+			// A domain of the source is scanned again for its checkpoint,
+			// but its subdomains only once
+			domain := strings.ToLower(host.Origin)
+			expand := host.Type == HostTypeDomain && !seen[domain]
+			if expand {
+				seen[domain] = true
+			}
+			if !send(host) {
+				return
+			}
+			if !expand {
+				continue
+			}
+			for _, name := range s.subdomainsOf(domain) {
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				if !send(Host{Origin: name, Type: HostTypeDomain, Port: host.Port, Index: -1}) {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// subdomainsOf returns the subdomains of domain to scan
+func (s *Scanner) subdomainsOf(domain string) []string {
+	var names []string
+	for _, word := range s.Config.Subdomains {
+		names = append(names, word+"."+domain)
+	}
+	if s.Config.SubdomainCT && s.ctx.Err() == nil {
+		found, err := FetchCTDomains(s.ctx, domain)
+		if err != nil {
+			s.log(slog.LevelWarn, "Cannot search CT logs for subdomains", "domain", domain, "err", err)
+		}
+		count := 0
+		for _, name := range found {
+			if strings.HasSuffix(name, "."+domain) {
+				names = append(names, name)
+				count++
+			}
+		}
+		s.log(slog.LevelDebug, "Found subdomains in CT logs", "domain", domain, "count", count)
+	}
+	return names
+}
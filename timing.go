@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Timing profiles, from the most cautious to the default
+const (
+	TimingParanoid = "paranoid"
+	TimingSlow     = "slow"
+	TimingNormal   = "normal"
+	TimingFast     = "fast"
+)
+
+// timingProfiles lists the profiles in the order they are offered
+var timingProfiles = []string{TimingParanoid, TimingSlow, TimingNormal, TimingFast}
+
+// subnetLimiterMax is how many /24 networks are tracked before the ones
+// that have been quiet long enough are dropped
+const subnetLimiterMax = 4096
+
+// timingParams is how a profile paces connections: a random delay between
+// delayMin and delayMax before each one, and at most subnetRate per second
+// to one /24 (IPv6 /64), 0 for no cap
+type timingParams struct {
+	delayMin, delayMax time.Duration
+	subnetRate         float64
+}
+
+// timingProfileParams returns the pacing of a profile, fast and the empty
+// profile do not pace connections
+func timingProfileParams(profile string) timingParams {
+	switch profile {
+	case TimingParanoid:
+		return timingParams{delayMin: 5 * time.Second, delayMax: 15 * time.Second, subnetRate: 1.0 / 30}
+	case TimingSlow:
+		return timingParams{delayMin: 500 * time.Millisecond, delayMax: 2 * time.Second, subnetRate: 1}
+	case TimingNormal:
+		return timingParams{delayMax: 200 * time.Millisecond, subnetRate: 10}
+	}
+	return timingParams{}
+}
+
+// ParseTimingProfile checks a timing profile name, "" is the default fast
+// profile
+func ParseTimingProfile(value string) (string, error) {
+	switch value {
+	case "", TimingParanoid, TimingSlow, TimingNormal, TimingFast:
+		return value, nil
+	}
+	return "", fmt.Errorf("unknown timing profile %q, must be paranoid, slow, normal or fast", value)
+}
+
+// pacer delays the connections of a scan following its timing profile
+type pacer struct {
+	params timingParams
+	mu     sync.Mutex
+	// subnets holds a limiter per /24 (IPv6 /64) connected to
+	subnets map[netip.Prefix]*RateLimiter
+}
+
+// newPacer returns the pacer of profile, nil when it does not pace
+func newPacer(profile string) *pacer {
+	params := timingProfileParams(profile)
+	if params.delayMax == 0 && params.subnetRate == 0 {
+		return nil
+	}
+	return &pacer{params: params, subnets: make(map[netip.Prefix]*RateLimiter)}
+}
+
+// Wait sleeps a random delay and until the network of address may be
+// connected to again, or until ctx is done
+func (p *pacer) Wait(ctx context.Context, address string) error {
+	if p.params.delayMax > 0 {
+		delay := p.params.delayMin + rand.N(p.params.delayMax-p.params.delayMin+1)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+	if p.params.subnetRate == 0 {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return nil
+	}
+	bits := 24
+	if !addr.Unmap().Is4() {
+		bits = 64
+	}
+	prefix, _ := addr.Unmap().Prefix(bits)
+	return p.subnet(prefix).Wait(ctx)
+}
+
+// subnet returns the limiter of prefix, creating it on first use
+func (p *pacer) subnet(prefix netip.Prefix) *RateLimiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if limiter, ok := p.subnets[prefix]; ok {
+		return limiter
+	}
+	if len(p.subnets) >= subnetLimiterMax {
+		now := time.Now()
+		for key, limiter := range p.subnets {
+			if limiter.Full(now) {
+				delete(p.subnets, key)
+			}
+		}
+	}
+	limiter := NewRateLimiter(p.params.subnetRate, 1)
+	p.subnets[prefix] = limiter
+	return limiter
+}
@@ -0,0 +1,148 @@
+// Command rirgen regenerates the embedded RIR country table used as a GeoIP
+// fallback. It downloads the delegation statistics of all five RIRs and
+// writes a gzip-compressed list of "first last country" lines.
+//
+// Run it through `go generate` from the repository root.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sources = []string{
+	"https://ftp.arin.net/pub/stats/arin/delegated-arin-extended-latest",
+	"https://ftp.ripe.net/pub/stats/ripencc/delegated-ripencc-extended-latest",
+	"https://ftp.apnic.net/stats/apnic/delegated-apnic-extended-latest",
+	"https://ftp.lacnic.net/pub/stats/lacnic/delegated-lacnic-extended-latest",
+	"https://ftp.afrinic.net/pub/stats/afrinic/delegated-afrinic-extended-latest",
+}
+
+type entry struct {
+	first   netip.Addr
+	last    netip.Addr
+	country string
+}
+
+func main() {
+	out := flag.String("out", "rir_country.txt.gz", "Output file")
+	flag.Parse()
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	var entries []entry
+	for _, src := range sources {
+		log.Println("Fetching", src)
+		got, err := fetch(client, src)
+		if err != nil {
+			log.Fatalf("%s: %v", src, err)
+		}
+		entries = append(entries, got...)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].first.Less(entries[j].first)
+	})
+	entries = merge(entries)
+	if len(entries) == 0 {
+		log.Fatal("No ranges in the delegation statistics")
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	w := bufio.NewWriter(zw)
+	fmt.Fprintf(w, "# generated by tools/rirgen on %s\n", time.Now().UTC().Format(time.DateOnly))
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s %s %s\n", e.first, e.last, e.country)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Wrote", len(entries), "ranges to", *out)
+}
+
+// fetch parses one delegated-extended file, see
+// https://www.apnic.net/about-apnic/corporate-documents/documents/resource-guidelines/rir-statistics-exchange-format/
+func fetch(client *http.Client, url string) ([]entry, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	var entries []entry
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "|")
+		if len(fields) < 7 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		cc, typ, start, value, status := fields[1], fields[2], fields[3], fields[4], fields[6]
+		if len(cc) != 2 || (status != "allocated" && status != "assigned") {
+			continue
+		}
+		first, err := netip.ParseAddr(start)
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || n == 0 {
+			continue
+		}
+		var last netip.Addr
+		switch typ {
+		case "ipv4":
+			last = addOffset(first, new(big.Int).SetUint64(n-1))
+		case "ipv6":
+			if n > 128 {
+				continue
+			}
+			last = netip.PrefixFrom(first, int(n)).Masked().Addr()
+			last = addOffset(last, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(128-n)), big.NewInt(1)))
+		default:
+			continue
+		}
+		entries = append(entries, entry{first: first, last: last, country: strings.ToUpper(cc)})
+	}
+	return entries, scanner.Err()
+}
+
+func addOffset(addr netip.Addr, offset *big.Int) netip.Addr {
+	b := addr.AsSlice()
+	v := new(big.Int).SetBytes(b)
+	v.Add(v, offset)
+	out := v.FillBytes(make([]byte, len(b)))
+	res, _ := netip.AddrFromSlice(out)
+	return res
+}
+
+// merge joins adjacent ranges of the same country to shrink the table
+func merge(entries []entry) []entry {
+	var out []entry
+	for _, e := range entries {
+		if n := len(out); n > 0 && out[n-1].country == e.country && out[n-1].last.Next() == e.first {
+			out[n-1].last = e.last
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
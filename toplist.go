@@ -0,0 +1,201 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trancoListURL is the latest Tranco list of the top million domains, a
+// zipped CSV of rank,domain lines
+const trancoListURL = "https://tranco-list.eu/top-1m.csv.zip"
+
+// topListMaxSize caps the size of a downloaded top list
+const topListMaxSize = 100 << 20
+
+// topListTimeout bounds the download of a top list
+const topListTimeout = 5 * time.Minute
+
+// RankWindow is a range of ranks of a top list, both ends included
+type RankWindow struct {
+	From int
+	To   int
+}
+
+func (w RankWindow) String() string {
+	return strconv.Itoa(w.From) + "-" + strconv.Itoa(w.To)
+}
+
+// ParseRankWindow parses a window of ranks such as 1k-100k or 1000-100000.
+// A single rank like 10k is the top ten thousand. k and m multiply by a
+// thousand and a million.
+func ParseRankWindow(s string) (RankWindow, error) {
+	first, last, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		first, last = "1", first
+	}
+	from, err := parseRank(first)
+	if err != nil {
+		return RankWindow{}, fmt.Errorf("invalid rank window %q: %w", s, err)
+	}
+	to, err := parseRank(last)
+	if err != nil {
+		return RankWindow{}, fmt.Errorf("invalid rank window %q: %w", s, err)
+	}
+	if from > to {
+		return RankWindow{}, fmt.Errorf("invalid rank window %q, the first rank is after the last", s)
+	}
+	return RankWindow{From: from, To: to}, nil
+}
+
+// parseRank parses a rank of at least 1 with an optional k or m suffix
+func parseRank(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(s, "k"):
+		multiplier, s = 1000, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		multiplier, s = 1000000, strings.TrimSuffix(s, "m")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 1 {
+		return 0, errors.New("ranks start at 1")
+	}
+	return n * multiplier, nil
+}
+
+// RankedDomain is a domain of a top list and its rank there
+type RankedDomain struct {
+	Rank   int
+	Domain string
+}
+
+// FetchTopList downloads the top list at list, the Tranco list when empty,
+// and returns its domains within window in rank order. list may also be
+// the path of a list saved before. Lists are rank,domain lines like the
+// ones of Tranco and Alexa, plain or zipped.
+func FetchTopList(ctx context.Context, list string, window RankWindow) ([]RankedDomain, error) {
+	if list == "" {
+		list = trancoListURL
+	}
+	var data []byte
+	var err error
+	if strings.HasPrefix(list, "http://") || strings.HasPrefix(list, "https://") {
+		data, err = downloadTopList(ctx, list)
+	} else {
+		data, err = os.ReadFile(list)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readTopList(data, window)
+}
+
+// downloadTopList downloads the list at url
+func downloadTopList(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, topListTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download top list: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, topListMaxSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download top list: %w", err)
+	}
+	return data, nil
+}
+
+// readTopList returns the domains of a top list within window. A zipped
+// list is read from its first file.
+func readTopList(data []byte, window RankWindow) ([]RankedDomain, error) {
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open top list archive: %w", err)
+		}
+		if len(archive.File) == 0 {
+			return nil, errors.New("empty top list archive")
+		}
+		f, err := archive.File[0].Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open top list archive: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var domains []RankedDomain
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rankText, domain, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ",")
+		if !ok {
+			continue
+		}
+		// Skips a header line
+		rank, err := strconv.Atoi(rankText)
+		if err != nil || rank < window.From {
+			continue
+		}
+		if rank > window.To {
+			break
+		}
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if ValidateDomainName(domain) {
+			domains = append(domains, RankedDomain{Rank: rank, Domain: domain})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read top list: %w", err)
+	}
+	return domains, nil
+}
+
+// IterateRanked streams the hosts of domains with their rank, skipping the
+// first skip ones
+func IterateRanked(domains []RankedDomain, skip int) <-chan Host {
+	hostChan := make(chan Host)
+	go func() {
+		defer close(hostChan)
+		for i := skip; i < len(domains); i++ {
+			hostChan <- Host{
+				Origin: domains[i].Domain,
+				Type:   HostTypeDomain,
+				Rank:   domains[i].Rank,
+				Index:  i,
+			}
+		}
+	}()
+	return hostChan
+}
+
+// rankedLines returns the domains one per line, for the checksum of the
+// source
+func rankedLines(domains []RankedDomain) []string {
+	lines := make([]string, len(domains))
+	for i, d := range domains {
+		lines[i] = strconv.Itoa(d.Rank) + "," + d.Domain
+	}
+	return lines
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
@@ -11,6 +13,7 @@ import (
 	"net"
 	"net/netip"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -27,26 +30,112 @@ type Host struct {
 	IP     net.IP
 	Origin string
 	Type   HostType
+	// Port replaces the port of the scan for this host, 0 if it does not
+	Port int
+	// Index is the position of the host in the input, used for checkpoints
+	Index int
+	// Rank is the rank of the domain in a top list, 0 for other sources
+	Rank int
 }
 
-func Iterate(reader io.Reader, enableIPv6 bool) <-chan Host {
+// Iterate streams the hosts of the lines of reader. With shuffle the
+// addresses of each CIDR block come in a pseudo-random order.
+func Iterate(reader io.Reader, enableIPv6, shuffle bool) <-chan Host {
+	return IterateFrom(reader, enableIPv6, shuffle, 0)
+}
+
+// IterateFrom works like Iterate but skips the first skip hosts of the input
+func IterateFrom(reader io.Reader, enableIPv6, shuffle bool, skip int) <-chan Host {
 	scanner := bufio.NewScanner(reader)
 	hostChan := make(chan Host)
 	go func() {
 		defer close(hostChan)
+		index := 0
+		emit := func(host Host) {
+			if index >= skip {
+				host.Index = index
+				hostChan <- host
+			}
+			index++
+		}
+		// emitBlock emits the addresses of the CIDR block p
+		emitBlock := func(p netip.Prefix, origin string) {
+			p = p.Masked()
+			addr := p.Addr()
+			// Seek over the part of the block that is already scanned
+			start := 0
+			if index < skip {
+				bits := addr.BitLen() - p.Bits()
+				if bits < 62 && index+1<<bits <= skip {
+					index += 1 << bits
+					return
+				}
+				start = skip - index
+				index = skip
+			}
+			if shuffle {
+				perm := newCIDRPermutation(p)
+				perm.Skip(uint64(start))
+				for n := uint64(start); n < perm.Len(); n++ {
+					ip := net.ParseIP(AddrAdd(p.Addr(), int(perm.Next())).String())
+					if ip != nil {
+						emit(Host{
+							IP:     ip,
+							Origin: origin,
+							Type:   HostTypeCIDR,
+						})
+					}
+				}
+				return
+			}
+			if start > 0 {
+				addr = AddrAdd(addr, start)
+			}
+			for p.Contains(addr) {
+				ip := net.ParseIP(addr.String())
+				if ip != nil {
+					emit(Host{
+						IP:     ip,
+						Origin: origin,
+						Type:   HostTypeCIDR,
+					})
+				}
+				addr = addr.Next()
+			}
+		}
+		portScan := newPortScanParser()
 		for scanner.Scan() {
 			line := strings.TrimSpace(scanner.Text())
 			if line == "" {
 				continue
 			}
+			if hits, ok := portScan.parse(line); ok {
+				// Output of masscan or ZMap, the origin keeps the port
+				// for outputs without a port column
+				for _, hit := range hits {
+					if hit.Addr().Is4() || enableIPv6 {
+						origin := hit.String()
+						if hit.Port() == 0 {
+							origin = hit.Addr().String()
+						}
+						emit(Host{
+							IP:     net.IP(hit.Addr().AsSlice()),
+							Origin: origin,
+							Type:   HostTypeIP,
+							Port:   int(hit.Port()),
+						})
+					}
+				}
+				continue
+			}
 			ip := net.ParseIP(line)
 			if ip != nil && (ip.To4() != nil || enableIPv6) {
 				// ip address
-				hostChan <- Host{
+				emit(Host{
 					IP:     ip,
 					Origin: line,
 					Type:   HostTypeIP,
-				}
+				})
 				continue
 			}
 			_, _, err := net.ParseCIDR(line)
@@ -59,34 +148,34 @@ func Iterate(reader io.Reader, enableIPv6 bool) <-chan Host {
 				if !p.Addr().Is4() && !enableIPv6 {
 					continue
 				}
-				p = p.Masked()
-				addr := p.Addr()
-				for {
-					if !p.Contains(addr) {
-						break
-					}
-					ip = net.ParseIP(addr.String())
-					if ip != nil {
-						hostChan <- Host{
-							IP:     ip,
-							Origin: line,
-							Type:   HostTypeCIDR,
-						}
+				emitBlock(p, line)
+				continue
+			}
+			if isIPRangeLine(line) {
+				// ip ranges like 1.2.3.0-1.2.5.255, scanned as the CIDR
+				// blocks covering them
+				blocks, origins, err := ParseIPRanges(line)
+				if err != nil {
+					slog.Warn("Invalid IP range", "line", line, "err", err)
+					continue
+				}
+				for i, block := range blocks {
+					if block.Addr().Is4() || enableIPv6 {
+						emitBlock(block, origins[i])
 					}
-					addr = addr.Next()
 				}
 				continue
 			}
 			if ValidateDomainName(line) {
 				// domain
-				hostChan <- Host{
+				emit(Host{
 					IP:     nil,
 					Origin: line,
 					Type:   HostTypeDomain,
-				}
+				})
 				continue
 			}
-			slog.Warn("Not a valid IP, IP CIDR or domain", "line", line)
+			slog.Warn("Not a valid IP, IP CIDR, IP range or domain", "line", line)
 		}
 		if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
 			slog.Error("Read file error", "err", err)
@@ -94,6 +183,85 @@ func Iterate(reader io.Reader, enableIPv6 bool) <-chan Host {
 	}()
 	return hostChan
 }
+
+// CountHosts returns how many hosts Iterate yields for the input, for
+// progress reporting. Large IPv6 blocks saturate at math.MaxInt.
+func CountHosts(reader io.Reader, enableIPv6 bool) (int, error) {
+	scanner := bufio.NewScanner(reader)
+	total := 0
+	portScan := newPortScanParser()
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if hits, ok := portScan.parse(line); ok {
+			for _, hit := range hits {
+				if hit.Addr().Is4() || enableIPv6 {
+					total = addSaturated(total, 1)
+				}
+			}
+			continue
+		}
+		if ip := net.ParseIP(line); ip != nil {
+			if ip.To4() != nil || enableIPv6 {
+				total = addSaturated(total, 1)
+			}
+			continue
+		}
+		if p, err := netip.ParsePrefix(line); err == nil {
+			if !p.Addr().Is4() && !enableIPv6 {
+				continue
+			}
+			total = addSaturated(total, blockSize(p))
+			continue
+		}
+		if isIPRangeLine(line) {
+			blocks, _, err := ParseIPRanges(line)
+			if err != nil {
+				continue
+			}
+			for _, block := range blocks {
+				if block.Addr().Is4() || enableIPv6 {
+					total = addSaturated(total, blockSize(block))
+				}
+			}
+			continue
+		}
+		if ValidateDomainName(line) {
+			total = addSaturated(total, 1)
+		}
+	}
+	return total, scanner.Err()
+}
+
+// blockSize returns the number of addresses of the CIDR block p,
+// saturating at math.MaxInt
+func blockSize(p netip.Prefix) int {
+	bits := p.Addr().BitLen() - p.Bits()
+	if bits >= 62 {
+		return math.MaxInt
+	}
+	return 1 << bits
+}
+
+// CountAddrHosts returns how many hosts IterateAddr yields for addr, 0
+// for the endless scan around a single IP or domain
+func CountAddrHosts(addr string, enableIPv6 bool) int {
+	if _, _, err := net.ParseCIDR(addr); err != nil && !isIPRangeLine(addr) {
+		return 0
+	}
+	total, _ := CountHosts(strings.NewReader(addr), enableIPv6)
+	return total
+}
+
+func addSaturated(a, b int) int {
+	if a > math.MaxInt-b {
+		return math.MaxInt
+	}
+	return a + b
+}
+
 func ValidateDomainName(domain string) bool {
 	r := regexp.MustCompile(`(?m)^[A-Za-z0-9\-.]+$`)
 	return r.MatchString(domain)
@@ -111,67 +279,67 @@ func ExistOnlyOne(arr []string) bool {
 	}
 	return exist
 }
-func IterateAddr(addr string, enableIPv6 bool) <-chan Host {
+func IterateAddr(ctx context.Context, resolver *Resolver, addr string, enableIPv6, shuffle bool) <-chan Host {
+	return IterateAddrFrom(ctx, resolver, addr, enableIPv6, shuffle, 0)
+}
+
+// IterateAddrFrom works like IterateAddr but skips the first skip hosts.
+// shuffle applies to CIDRs and IP ranges, the hosts around a single IP
+// always alternate. A domain is looked up with resolver and the hosts
+// around every address it resolves to are scanned in turn.
+func IterateAddrFrom(ctx context.Context, resolver *Resolver, addr string, enableIPv6, shuffle bool, skip int) <-chan Host {
 	hostChan := make(chan Host)
 	_, _, err := net.ParseCIDR(addr)
-	if err == nil {
-		// is CIDR
-		return Iterate(strings.NewReader(addr), enableIPv6)
+	if err == nil || isIPRangeLine(addr) {
+		// is CIDR or IP ranges
+		return IterateFrom(strings.NewReader(addr), enableIPv6, shuffle, skip)
 	}
-	ip := net.ParseIP(addr)
-	if ip == nil {
-		ip, err = LookupIP(addr, enableIPv6)
+	ips := []net.IP{net.ParseIP(addr)}
+	if ips[0] == nil {
+		ips, err = resolver.LookupIPs(ctx, addr, enableIPv6)
 		if err != nil {
 			close(hostChan)
-			slog.Error("Not a valid IP, IP CIDR or domain", "addr", addr)
+			slog.Error("Not a valid IP, IP CIDR, IP range or domain", "addr", addr, "err", err)
 			return hostChan
 		}
 	}
 	go func() {
-		slog.Info("Enable infinite mode", "init", ip.String())
-		lowIP := ip
-		highIP := ip
-		hostChan <- Host{
-			IP:     ip,
-			Origin: addr,
-			Type:   HostTypeIP,
-		}
-		for i := 0; i < math.MaxInt; i++ {
-			if i%2 == 0 {
-				lowIP = NextIP(lowIP, false)
-				hostChan <- Host{
-					IP:     lowIP,
-					Origin: lowIP.String(),
-					Type:   HostTypeIP,
-				}
-			} else {
-				highIP = NextIP(highIP, true)
-				hostChan <- Host{
-					IP:     highIP,
-					Origin: highIP.String(),
-					Type:   HostTypeIP,
-				}
+		slog.Info("Enable infinite mode", "init", ips)
+		// Host i is step i/n around IP i%n of the n IPs. Step 2k-1 is k
+		// addresses below the IP and step 2k is k addresses above it.
+		n := len(ips)
+		lowIPs := make([]net.IP, n)
+		highIPs := make([]net.IP, n)
+		for j, ip := range ips {
+			steps := 0
+			if skip > j {
+				steps = (skip - j + n - 1) / n
 			}
+			lowIPs[j] = OffsetIP(ip, -int64(steps/2))
+			highIPs[j] = OffsetIP(ip, int64((steps-1)/2))
+			if steps == 0 {
+				highIPs[j] = ip
+			}
+		}
+		for i := skip; i < math.MaxInt; i++ {
+			j, step := i%n, i/n
+			var host Host
+			switch {
+			case step == 0:
+				host = Host{IP: ips[j], Origin: addr, Type: HostTypeIP}
+			case step%2 == 1:
+				lowIPs[j] = NextIP(lowIPs[j], false)
+				host = Host{IP: lowIPs[j], Origin: lowIPs[j].String(), Type: HostTypeIP}
+			default:
+				highIPs[j] = NextIP(highIPs[j], true)
+				host = Host{IP: highIPs[j], Origin: highIPs[j].String(), Type: HostTypeIP}
+			}
+			host.Index = i
+			hostChan <- host
 		}
 	}()
 	return hostChan
 }
-func LookupIP(addr string, enableIPv6 bool) (net.IP, error) {
-	ips, err := net.LookupIP(addr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to lookup: %w", err)
-	}
-	var arr []net.IP
-	for _, ip := range ips {
-		if ip.To4() != nil || enableIPv6 {
-			arr = append(arr, ip)
-		}
-	}
-	if len(arr) == 0 {
-		return nil, errors.New("no IP found")
-	}
-	return arr[0], nil
-}
 func RemoveDuplicateStr(strSlice []string) []string {
 	allKeys := make(map[string]bool)
 	var list []string
@@ -183,15 +351,6 @@ func RemoveDuplicateStr(strSlice []string) []string {
 	}
 	return list
 }
-func OutWriter(writer io.Writer) chan<- string {
-	ch := make(chan string)
-	go func() {
-		for s := range ch {
-			_, _ = io.WriteString(writer, s)
-		}
-	}()
-	return ch
-}
 func NextIP(ip net.IP, increment bool) net.IP {
 	// Convert to big.Int and increment
 	ipb := big.NewInt(0).SetBytes(ip)
@@ -206,3 +365,294 @@ func NextIP(ip net.IP, increment bool) net.IP {
 	b = append(make([]byte, len(ip)-len(b)), b...)
 	return b
 }
+
+// OffsetIP returns ip moved by delta addresses
+func OffsetIP(ip net.IP, delta int64) net.IP {
+	ipb := big.NewInt(0).SetBytes(ip)
+	ipb.Add(ipb, big.NewInt(delta))
+	b := ipb.Bytes()
+	b = append(make([]byte, len(ip)-len(b)), b...)
+	return b
+}
+
+// AddrAdd returns addr moved forward by n addresses
+func AddrAdd(addr netip.Addr, n int) netip.Addr {
+	b := addr.AsSlice()
+	v := big.NewInt(0).SetBytes(b)
+	v.Add(v, big.NewInt(int64(n)))
+	res, _ := netip.AddrFromSlice(v.FillBytes(make([]byte, len(b))))
+	return res
+}
+
+// resultsConfig returns a config with the optional CSV columns the
+// results have values for
+func resultsConfig(results []ScanResult) *ScanConfig {
+	config := &ScanConfig{}
+	for _, result := range results {
+		if result.ASN != 0 {
+			config.EnableASN = true
+		}
+		if result.Idle != "" {
+			config.IdleTest = 1
+		}
+		if result.Curve != "" {
+			config.ProbePQ = true
+		}
+		if result.HTTPStatus != 0 || result.HTTPServer != "" {
+			config.ProbeHTTP = true
+		}
+		if result.DualDomain != "" || result.CertDiffers || result.DualError != "" {
+			config.DualProbe = true
+		}
+		if result.CipherSuite != "" {
+			config.TLSDetails = true
+		}
+		if result.CDN != "" {
+			config.DetectCDN = true
+		}
+		if result.OCSP != "" {
+			config.CheckOCSP = true
+		}
+		if result.H3 {
+			config.ProbeH3 = true
+		}
+		if result.Resumption != "" {
+			config.ProbeResumption = true
+		}
+		if result.SpeedKBps > 0 {
+			config.SpeedTestKB = 1
+		}
+		if result.HRR != "" {
+			config.ProbeHRR = true
+		}
+		if len(result.Reveals) > 0 {
+			config.Audit = true
+		}
+		if result.Rank > 0 {
+			config.TopList = true
+		}
+		if result.Family != "" {
+			config.HappyEyeballs = true
+		}
+		if result.DNSMatch != "" {
+			config.DNSMatch = true
+		}
+		// Readers take results without a port to be on the default one
+		if result.Port != 0 && result.Port != 443 {
+			config.PortColumn = true
+		}
+		if len(result.SNIs) > 0 && len(config.SNIMatrix) == 0 {
+			config.SNIMatrix = sniMatrixNames(result.SNIs)
+		}
+	}
+	return config
+}
+
+func csvHeader(config *ScanConfig) string {
+	header := "IP,ORIGIN,CERT_DOMAIN,CERT_ISSUER,GEO_CODE,CONNECT_MS,HANDSHAKE_MS,SCORE"
+	if config.IdleTest > 0 {
+		header += ",IDLE"
+	}
+	if config.EnableASN {
+		header += ",ASN,AS_ORG"
+	}
+	if config.ProbePQ {
+		header += ",CURVE"
+	}
+	if config.ProbeHTTP {
+		header += ",HTTP_STATUS,HTTP_SERVER,HTTP_CONTENT"
+	}
+	if config.DualProbe {
+		header += ",DUAL_DOMAIN,CERT_DIFFERS,DUAL_ERROR"
+	}
+	if config.TLSDetails {
+		header += ",CIPHER_SUITE,KEY_EXCHANGE"
+	}
+	if config.DetectCDN {
+		header += ",CDN"
+	}
+	if config.CheckOCSP {
+		header += ",OCSP,OCSP_STAPLED"
+	}
+	if config.ProbeH3 {
+		header += ",H3"
+	}
+	if len(config.SNIMatrix) > 0 {
+		header += ",SNI_CERTS"
+	}
+	if config.ProbeResumption {
+		header += ",RESUMPTION"
+	}
+	if config.SpeedTestKB > 0 {
+		header += ",SPEED_KBPS"
+	}
+	if config.ProbeHRR {
+		header += ",HRR"
+	}
+	if config.Audit {
+		header += ",REVEALS"
+	}
+	if config.TopList {
+		header += ",RANK"
+	}
+	if config.HappyEyeballs {
+		header += ",FAMILY,FAMILIES"
+	}
+	if config.DNSMatch {
+		header += ",DNS_MATCH"
+	}
+	if config.PortColumn {
+		header += ",PORT"
+	}
+	return header + "\n"
+}
+
+// csvLine renders result as a CSV line with the columns of config
+func csvLine(result ScanResult, config *ScanConfig) string {
+	fields := []string{result.IP, result.Origin, result.Domain, result.Issuer, result.GeoCode,
+		strconv.Itoa(result.ConnectMs), strconv.Itoa(result.HandshakeMs), strconv.FormatFloat(result.Score, 'f', -1, 64)}
+	if config.IdleTest > 0 {
+		fields = append(fields, result.Idle)
+	}
+	if config.EnableASN {
+		fields = append(fields, strconv.FormatUint(uint64(result.ASN), 10), result.ASOrg)
+	}
+	if config.ProbePQ {
+		fields = append(fields, result.Curve)
+	}
+	if config.ProbeHTTP {
+		fields = append(fields, strconv.Itoa(result.HTTPStatus), result.HTTPServer,
+			strconv.FormatBool(result.HTTPContent))
+	}
+	if config.DualProbe {
+		fields = append(fields, result.DualDomain, strconv.FormatBool(result.CertDiffers), result.DualError)
+	}
+	if config.TLSDetails {
+		fields = append(fields, result.CipherSuite, result.KeyExchange)
+	}
+	if config.DetectCDN {
+		fields = append(fields, result.CDN)
+	}
+	if config.CheckOCSP {
+		fields = append(fields, result.OCSP, strconv.FormatBool(result.OCSPStapled))
+	}
+	if config.ProbeH3 {
+		fields = append(fields, strconv.FormatBool(result.H3))
+	}
+	if len(config.SNIMatrix) > 0 {
+		fields = append(fields, formatSNICerts(result.SNIs))
+	}
+	if config.ProbeResumption {
+		fields = append(fields, result.Resumption)
+	}
+	if config.SpeedTestKB > 0 {
+		fields = append(fields, strconv.Itoa(result.SpeedKBps))
+	}
+	if config.ProbeHRR {
+		fields = append(fields, result.HRR)
+	}
+	if config.Audit {
+		fields = append(fields, strings.Join(result.Reveals, "; "))
+	}
+	if config.TopList {
+		fields = append(fields, strconv.Itoa(result.Rank))
+	}
+	if config.HappyEyeballs {
+		fields = append(fields, result.Family, formatFamilies(result.Families))
+	}
+	if config.DNSMatch {
+		fields = append(fields, result.DNSMatch)
+	}
+	if config.PortColumn {
+		fields = append(fields, strconv.Itoa(result.Port))
+	}
+	return csvRecord(fields)
+}
+
+// csvRecord joins fields into a CSV line, quoting those that hold commas,
+// quotes or line breaks
+func csvRecord(fields []string) string {
+	var b strings.Builder
+	w := csv.NewWriter(&b)
+	_ = w.Write(fields)
+	w.Flush()
+	return b.String()
+}
+
+// ReadResultsCSV parses a results file written by csvLine. Only feasible
+// results are saved, so every row is marked feasible.
+func ReadResultsCSV(reader io.Reader) ([]ScanResult, error) {
+	r := csv.NewReader(reader)
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["IP"]; !ok {
+		return nil, errors.New("missing IP column")
+	}
+	var results []ScanResult
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+		result := ScanResult{
+			IP:       field("IP"),
+			Origin:   field("ORIGIN"),
+			Domain:   field("CERT_DOMAIN"),
+			Issuer:   field("CERT_ISSUER"),
+			GeoCode:  field("GEO_CODE"),
+			Feasible: true,
+			Idle:     field("IDLE"),
+			ASOrg:    field("AS_ORG"),
+			Curve:    field("CURVE"),
+		}
+		result.ConnectMs, _ = strconv.Atoi(field("CONNECT_MS"))
+		result.HandshakeMs, _ = strconv.Atoi(field("HANDSHAKE_MS"))
+		result.Port, _ = strconv.Atoi(field("PORT"))
+		result.Score, _ = strconv.ParseFloat(field("SCORE"), 64)
+		if asn, err := strconv.ParseUint(field("ASN"), 10, 32); err == nil {
+			result.ASN = uint(asn)
+		}
+		result.HTTPStatus, _ = strconv.Atoi(field("HTTP_STATUS"))
+		result.HTTPServer = field("HTTP_SERVER")
+		result.HTTPContent, _ = strconv.ParseBool(field("HTTP_CONTENT"))
+		result.DualDomain = field("DUAL_DOMAIN")
+		result.CertDiffers, _ = strconv.ParseBool(field("CERT_DIFFERS"))
+		result.DualError = field("DUAL_ERROR")
+		result.CipherSuite = field("CIPHER_SUITE")
+		result.KeyExchange = field("KEY_EXCHANGE")
+		result.CDN = field("CDN")
+		result.OCSP = field("OCSP")
+		result.OCSPStapled, _ = strconv.ParseBool(field("OCSP_STAPLED"))
+		result.H3, _ = strconv.ParseBool(field("H3"))
+		result.SNIs = parseSNICerts(field("SNI_CERTS"))
+		result.Resumption = field("RESUMPTION")
+		result.SpeedKBps, _ = strconv.Atoi(field("SPEED_KBPS"))
+		result.Rank, _ = strconv.Atoi(field("RANK"))
+		result.Family = field("FAMILY")
+		result.Families = parseFamilies(field("FAMILIES"))
+		result.DNSMatch = field("DNS_MATCH")
+		result.HRR = field("HRR")
+		if reveals := field("REVEALS"); reveals != "" {
+			result.Reveals = strings.Split(reveals, "; ")
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// webhookQueueSize is how many results may wait to be posted before
+	// new ones are dropped
+	webhookQueueSize = 1024
+	// webhookFlushInterval posts a batch that has not filled up after
+	// this long, so that results of slow scans arrive in time
+	webhookFlushInterval = 5 * time.Second
+	// webhookRetries is how many times a failed post is tried again,
+	// waiting 1, 2, 4... seconds in between
+	webhookRetries = 3
+	webhookTimeout = 15 * time.Second
+)
+
+// webhookStatusError is a post the endpoint answered with a status
+// outside 2xx
+type webhookStatusError struct {
+	code int
+}
+
+func (e webhookStatusError) Error() string {
+	return fmt.Sprintf("bad status code: %d", e.code)
+}
+
+// retryable reports whether a post failing with err may succeed later:
+// network errors, timeouts, rate limiting and server errors
+func (e webhookStatusError) retryable() bool {
+	return e.code == http.StatusRequestTimeout || e.code == http.StatusTooManyRequests || e.code >= 500
+}
+
+// ParseWebhookHeader parses a "Name: value" header sent with every post,
+// e.g. to authenticate with the collector
+func ParseWebhookHeader(text string) (http.Header, error) {
+	header := http.Header{}
+	if strings.TrimSpace(text) == "" {
+		return header, nil
+	}
+	name, value, ok := strings.Cut(text, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" || strings.ContainsAny(name, " \t") {
+		return nil, fmt.Errorf("invalid webhook header %q, must be \"Name: value\"", text)
+	}
+	header.Set(name, strings.TrimSpace(value))
+	return header, nil
+}
+
+// Webhook posts feasible results as JSON to a URL as they are found, for
+// automation tools such as n8n or Zapier and self-hosted collectors. With
+// a batch size of 1 every result is posted as an object, larger batches
+// are posted as arrays once full or after webhookFlushInterval. Posts
+// run in the background so workers never wait for the network.
+type Webhook struct {
+	url     string
+	header  http.Header
+	batch   int
+	client  *http.Client
+	results chan ScanResult
+	done    chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewWebhook starts posting to url in batches of batch results
+func NewWebhook(url string, header http.Header, batch int) *Webhook {
+	w := &Webhook{
+		url:     url,
+		header:  header,
+		batch:   max(batch, 1),
+		client:  &http.Client{Timeout: webhookTimeout},
+		results: make(chan ScanResult, webhookQueueSize),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Add queues a feasible result, dropping it if the queue is full
+func (w *Webhook) Add(result ScanResult) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	select {
+	case w.results <- result:
+	default:
+		slog.Warn("Webhook queue full, dropping result", "ip", result.IP)
+	}
+}
+
+// run collects the queued results into batches and posts them
+func (w *Webhook) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(webhookFlushInterval)
+	defer ticker.Stop()
+	var pending []ScanResult
+	for {
+		select {
+		case result, ok := <-w.results:
+			if !ok {
+				w.deliver(pending)
+				return
+			}
+			pending = append(pending, result)
+			if len(pending) < w.batch {
+				continue
+			}
+		case <-ticker.C:
+		}
+		w.deliver(pending)
+		pending = nil
+	}
+}
+
+// deliver posts results, trying again while the failure may pass
+func (w *Webhook) deliver(results []ScanResult) {
+	if len(results) == 0 {
+		return
+	}
+	var body []byte
+	var err error
+	if w.batch == 1 {
+		body, err = json.Marshal(results[0])
+	} else {
+		body, err = json.Marshal(results)
+	}
+	if err != nil {
+		slog.Warn("Cannot encode results for the webhook", "err", err)
+		return
+	}
+	for attempt := 0; ; attempt++ {
+		err = w.post(body)
+		if err == nil {
+			return
+		}
+		var status webhookStatusError
+		if attempt == webhookRetries || errors.As(err, &status) && !status.retryable() {
+			slog.Warn("Failed to post results to webhook", "results", len(results), "attempts", attempt+1, "err", err)
+			return
+		}
+		time.Sleep(time.Second << attempt)
+	}
+}
+
+func (w *Webhook) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range w.header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return webhookStatusError{resp.StatusCode}
+	}
+	return nil
+}
+
+// Close posts the queued results and waits for them to go out
+func (w *Webhook) Close() {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return
+	}
+	w.closed = true
+	close(w.results)
+	w.mu.Unlock()
+	<-w.done
+}
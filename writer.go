@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// outputFlushInterval is how often text outputs write out the results
+// they buffered, so that a killed scan loses little and tail -f keeps up
+const outputFlushInterval = time.Second
+
+// ResultWriter writes the feasible results of a CLI scan in one format.
+// Writers own their buffering and escaping, and are safe for concurrent
+// use. The file under a writer is closed by the caller after Close.
+type ResultWriter interface {
+	// Write adds a result to the output
+	Write(result ScanResult) error
+	// Flush writes out the buffered results
+	Flush() error
+	// Close flushes and finishes the output
+	Close() error
+}
+
+// nopWriter drops the results of a scan without output
+type nopWriter struct{}
+
+func (nopWriter) Write(ScanResult) error { return nil }
+func (nopWriter) Flush() error           { return nil }
+func (nopWriter) Close() error           { return nil }
+
+// lineWriter writes one line of text per result, buffered and flushed
+// every outputFlushInterval
+type lineWriter struct {
+	line func(ScanResult) (string, error)
+
+	mu   sync.Mutex
+	buf  *bufio.Writer
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newLineWriter writes the lines rendered by line to w, after header
+func newLineWriter(w io.Writer, header string, line func(ScanResult) (string, error)) *lineWriter {
+	lw := &lineWriter{
+		line: line,
+		buf:  bufio.NewWriter(w),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	lw.buf.WriteString(header)
+	go lw.flushEvery(outputFlushInterval)
+	return lw
+}
+
+func (lw *lineWriter) Write(result ScanResult) error {
+	line, err := lw.line(result)
+	if err != nil {
+		return err
+	}
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	_, err = lw.buf.WriteString(line)
+	return err
+}
+
+func (lw *lineWriter) Flush() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.buf.Flush()
+}
+
+// flushEvery flushes the buffer every interval until Close
+func (lw *lineWriter) flushEvery(interval time.Duration) {
+	defer close(lw.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := lw.Flush(); err != nil {
+				slog.Warn("Error writing results", "err", err)
+			}
+		case <-lw.stop:
+			return
+		}
+	}
+}
+
+func (lw *lineWriter) Close() error {
+	close(lw.stop)
+	<-lw.done
+	return lw.Flush()
+}
+
+// NewCSVWriter writes results as CSV with the columns of config. Fields
+// holding commas, quotes or line breaks are quoted.
+func NewCSVWriter(w io.Writer, config *ScanConfig, header bool) ResultWriter {
+	head := ""
+	if header {
+		head = csvHeader(config)
+	}
+	return newLineWriter(w, head, func(result ScanResult) (string, error) {
+		return csvLine(result, config), nil
+	})
+}
+
+// NewJSONLWriter writes results as JSON lines with all their fields
+func NewJSONLWriter(w io.Writer) ResultWriter {
+	return newLineWriter(w, "", func(result ScanResult) (string, error) {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return "", err
+		}
+		return string(data) + "\n", nil
+	})
+}
+
+// NewTemplateWriter writes every result as a line rendered with tmpl
+func NewTemplateWriter(w io.Writer, tmpl *template.Template) ResultWriter {
+	return newLineWriter(w, "", func(result ScanResult) (string, error) {
+		var b strings.Builder
+		if err := tmpl.Execute(&b, result); err != nil {
+			return "", err
+		}
+		if !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+	})
+}
+
+// Column widths of the table output, longer values are cut
+const (
+	tableDomainWidth = 40
+	tableIssuerWidth = 30
+)
+
+// tableRow lays out the columns of a table line
+func tableRow(ip, port, domain, issuer, geo, latency, score string) string {
+	return fmt.Sprintf("%-15s %5s  %-*s  %-*s  %-3s %7s %6s\n", ip, port,
+		tableDomainWidth, cutText(domain, tableDomainWidth), tableIssuerWidth, cutText(issuer, tableIssuerWidth),
+		geo, latency, score)
+}
+
+// cutText shortens text to width characters, marking the cut with …
+func cutText(text string, width int) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+// NewTableWriter writes results as an aligned table to read in a terminal
+func NewTableWriter(w io.Writer, header bool) ResultWriter {
+	head := ""
+	if header {
+		head = tableRow("IP", "PORT", "DOMAIN", "ISSUER", "GEO", "MS", "SCORE")
+	}
+	return newLineWriter(w, head, func(r ScanResult) (string, error) {
+		return tableRow(r.IP, strconv.Itoa(r.Port), r.Domain, r.Issuer, r.GeoCode,
+			strconv.Itoa(r.ConnectMs+r.HandshakeMs), strconv.FormatFloat(r.Score, 'f', -1, 64)), nil
+	})
+}
+
+// excelWriter keeps the results until Close, as a workbook can only be
+// written as a whole
+type excelWriter struct {
+	f *os.File
+	// rewrite replaces the content of f, the workbook read back when
+	// appending
+	rewrite bool
+
+	mu      sync.Mutex
+	results []ScanResult
+}
+
+// NewExcelWriter writes results as an Excel workbook to f, after existing
+// ones read back from f when appending
+func NewExcelWriter(f *os.File, existing []ScanResult) ResultWriter {
+	return &excelWriter{f: f, rewrite: existing != nil, results: existing}
+}
+
+func (w *excelWriter) Write(result ScanResult) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.results = append(w.results, result)
+	return nil
+}
+
+func (w *excelWriter) Flush() error {
+	return nil
+}
+
+func (w *excelWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.rewrite {
+		if err := w.f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := w.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return writeExcel(w.f, w.results)
+}
+
+// sqliteWriter records the results as a session of a history database
+type sqliteWriter struct {
+	store   *Store
+	session *Session
+}
+
+// NewSQLiteWriter adds a session of source on port to the history database
+// at path and writes the results to it
+func NewSQLiteWriter(path, source string, port int, tag string) (ResultWriter, error) {
+	store, err := OpenStore(path)
+	if err != nil {
+		return nil, err
+	}
+	session, err := store.StartSession(source, port, tag)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return &sqliteWriter{store: store, session: session}, nil
+}
+
+func (w *sqliteWriter) Write(result ScanResult) error {
+	return w.session.AddResult(result)
+}
+
+func (w *sqliteWriter) Flush() error {
+	return nil
+}
+
+func (w *sqliteWriter) Close() error {
+	err := w.session.Finish()
+	if closeErr := w.store.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
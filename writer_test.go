@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// testResults are feasible results with values that need escaping
+func testResults() []ScanResult {
+	return []ScanResult{
+		{
+			IP: "192.0.2.1", Port: 443, Origin: "example.com", Domain: "example.com",
+			Issuer: `Let's Encrypt, "R11"`, GeoCode: "US", Feasible: true,
+			ConnectMs: 12, HandshakeMs: 34, Score: 87.5, ASN: 64496, ASOrg: "Example, Inc.\nSecond line",
+		},
+		{
+			IP: "2001:db8::1", Port: 443, Origin: "2001:db8::/64", Domain: "*.example.org",
+			Issuer: "DigiCert\r\nGlobal", GeoCode: "DE", Feasible: true,
+			ConnectMs: 5, HandshakeMs: 6, Score: 42, ASN: 64497, ASOrg: `"Quoted" Org`,
+		},
+	}
+}
+
+func TestCSVWriterQuoting(t *testing.T) {
+	var buf bytes.Buffer
+	config := &ScanConfig{EnableASN: true}
+	w := NewCSVWriter(&buf, config, true)
+	for _, result := range testResults() {
+		if err := w.Write(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadResultsCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testResults()
+	if len(got) != len(want) {
+		t.Fatalf("read %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		// The port is only written with PortColumn
+		want[i].Port = 0
+		// encoding/csv reads \r\n inside quoted fields as \n
+		want[i].Issuer = strings.ReplaceAll(want[i].Issuer, "\r\n", "\n")
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("result %d:\ngot  %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCSVWriterPortColumn(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf, &ScanConfig{PortColumn: true}, true)
+	want := testResults()
+	want[1].Port = 8443
+	for _, result := range want {
+		if err := w.Write(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadResultsCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Port != want[i].Port {
+			t.Errorf("result %d: got port %d, want %d", i, got[i].Port, want[i].Port)
+		}
+	}
+	if !resultsConfig(want).PortColumn {
+		t.Error("no PORT column for results on other ports")
+	}
+}
+
+func TestCSVWriterNoHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf, &ScanConfig{}, false)
+	if err := w.Write(testResults()[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasPrefix(buf.String(), "IP,") {
+		t.Errorf("header written when appending: %q", buf.String())
+	}
+}
+
+func TestJSONLWriterRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewJSONLWriter(&buf)
+	want := testResults()
+	want[0].Families = []FamilyResult{{Family: FamilyIPv4, IP: "192.0.2.1", Status: FamilyConnected, ConnectMs: 12}}
+	want[1].Reveals = []string{"server header"}
+	for _, result := range want {
+		if err := w.Write(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []ScanResult
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var result ScanResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("line %d: %v", len(got)+1, err)
+		}
+		got = append(got, result)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestTableWriterTruncation(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewTableWriter(&buf, true)
+	result := testResults()[0]
+	result.Domain = strings.Repeat("sub.", 20) + "example.com"
+	result.Issuer = strings.Repeat("Very Long Issuer Name ", 5)
+	if err := w.Write(result); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want header and one row: %q", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[0], "IP ") {
+		t.Errorf("bad header: %q", lines[0])
+	}
+	if utf8.RuneCountInString(lines[0]) != utf8.RuneCountInString(lines[1]) {
+		t.Errorf("row is not aligned with the header:\n%s\n%s", lines[0], lines[1])
+	}
+	domain := cutText(result.Domain, tableDomainWidth)
+	if utf8.RuneCountInString(domain) != tableDomainWidth || !strings.HasSuffix(domain, "…") {
+		t.Errorf("domain not cut to %d characters: %q", tableDomainWidth, domain)
+	}
+	if !strings.Contains(lines[1], domain) || !strings.Contains(lines[1], cutText(result.Issuer, tableIssuerWidth)) {
+		t.Errorf("row misses the cut domain or issuer: %q", lines[1])
+	}
+	if got := cutText("short", tableDomainWidth); got != "short" {
+		t.Errorf("short text cut to %q", got)
+	}
+}
+
+func TestLineWriterConcurrentClose(t *testing.T) {
+	const writers, perWriter = 16, 200
+	var buf bytes.Buffer
+	w := NewCSVWriter(&buf, &ScanConfig{}, true)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perWriter; j++ {
+				result := testResults()[0]
+				result.Origin = strconv.Itoa(i) + "-" + strconv.Itoa(j)
+				if err := w.Write(result); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	// Close alone must write out everything still buffered
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := ReadResultsCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != writers*perWriter {
+		t.Fatalf("read %d results, want %d", len(results), writers*perWriter)
+	}
+	seen := make(map[string]bool)
+	for _, result := range results {
+		seen[result.Origin] = true
+	}
+	if len(seen) != writers*perWriter {
+		t.Errorf("got %d distinct results, want %d", len(seen), writers*perWriter)
+	}
+}
+
+func TestSQLiteWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.db")
+	w, err := NewSQLiteWriter(path, "192.0.2.0/24", 443, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testResults()
+	for _, result := range want {
+		if err := w.Write(result); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	sessions, err := store.Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || sessions[0].Tag != "test" || sessions[0].Finished.IsZero() {
+		t.Fatalf("bad sessions: %+v", sessions)
+	}
+	got, err := store.Results(sessions[0].ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d results, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].IP != want[i].IP || got[i].Issuer != want[i].Issuer || got[i].ASOrg != want[i].ASOrg ||
+			got[i].Score != want[i].Score {
+			t.Errorf("result %d:\ngot  %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// wsBuffer is how many events a WebSocket client may fall behind before it
+// is disconnected, so that a stalled client cannot hold up the scans
+const wsBuffer = 256
+
+// wsWriteTimeout bounds sending one event to a WebSocket client
+const wsWriteTimeout = 10 * time.Second
+
+// Types of the events of /ws
+const (
+	wsEventResult = "result"
+	wsEventStatus = "status"
+)
+
+// wsEvent is a message of /ws: a result of a scan as it arrives, or the
+// status of a scan when it starts, finishes or a client connects
+type wsEvent struct {
+	Type   string         `json:"type"`
+	Scan   string         `json:"scan"`
+	Result *ScanResult    `json:"result,omitempty"`
+	Status *ScanJobStatus `json:"status,omitempty"`
+}
+
+// wsClient is a connected WebSocket client and the events it follows
+type wsClient struct {
+	// scan is the job followed, all jobs when empty
+	scan string
+	// all also passes results that are not feasible
+	all    bool
+	events chan wsEvent
+}
+
+// wsHub passes the events of all jobs to the WebSocket clients. The zero
+// value is ready to use.
+type wsHub struct {
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+}
+
+func (h *wsHub) subscribe(scan string, all bool) *wsClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients == nil {
+		h.clients = make(map[*wsClient]struct{})
+	}
+	c := &wsClient{scan: scan, all: all, events: make(chan wsEvent, wsBuffer)}
+	h.clients[c] = struct{}{}
+	return c
+}
+
+// unsubscribe removes c, closing its events unless publish already did
+func (h *wsHub) unsubscribe(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.events)
+	}
+}
+
+// publish passes event to the clients following its scan. Clients that
+// fell too far behind are dropped, their events closed.
+func (h *wsHub) publish(event wsEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		if c.scan != "" && c.scan != event.Scan {
+			continue
+		}
+		if event.Result != nil && !event.Result.Feasible && !c.all {
+			continue
+		}
+		select {
+		case c.events <- event:
+		default:
+			delete(h.clients, c)
+			close(c.events)
+		}
+	}
+}
+
+// handleWS streams the results of the scans to a WebSocket client as they
+// arrive, as JSON messages of type "result", with "status" messages when a
+// scan changes state. scan=ID follows one scan instead of all of them and
+// all=true adds the results that are not feasible. Browsers cannot send
+// the bearer token with a WebSocket, it may be given as token=.
+func (srv *Server) handleWS(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if srv.Token != "" && r.Header.Get("Authorization") != "Bearer "+srv.Token && query.Get("token") != srv.Token {
+		writeError(w, http.StatusUnauthorized, "missing or invalid token")
+		return
+	}
+	scan := query.Get("scan")
+	var jobs []*scanJob
+	if scan != "" {
+		job := srv.jobByID(scan)
+		if job == nil {
+			writeError(w, http.StatusNotFound, "scan not found")
+			return
+		}
+		jobs = append(jobs, job)
+	} else {
+		srv.mu.Lock()
+		for _, id := range srv.order {
+			jobs = append(jobs, srv.jobs[id])
+		}
+		srv.mu.Unlock()
+	}
+	all := query.Get("all") == "true"
+	// The token guards the endpoint, so any origin may connect like with
+	// the rest of the API
+	websocket.Server{Handler: func(ws *websocket.Conn) {
+		defer ws.Close()
+		c := srv.hub.subscribe(scan, all)
+		defer srv.hub.unsubscribe(c)
+		// Clients only listen, reading tells when they go away
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var discard []byte
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+		}()
+		send := func(event wsEvent) bool {
+			if err := ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+				return false
+			}
+			return websocket.JSON.Send(ws, event) == nil
+		}
+		for _, job := range jobs {
+			status := job.status()
+			if !send(wsEvent{Type: wsEventStatus, Scan: job.id, Status: &status}) {
+				return
+			}
+		}
+		for {
+			select {
+			case event, ok := <-c.events:
+				if !ok {
+					slog.Warn("Dropping WebSocket client that fell behind", "remote", r.RemoteAddr)
+					return
+				}
+				if !send(event) {
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	}}.ServeHTTP(w, r)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// xrayFingerprint is the uTLS fingerprint suggested to clients
+const xrayFingerprint = "chrome"
+
+// XrayKeys is a freshly generated Reality key pair and short ID
+type XrayKeys struct {
+	PrivateKey string
+	PublicKey  string
+	ShortID    string
+}
+
+// NewXrayKeys generates an X25519 key pair encoded the way `xray x25519`
+// prints it, along with a random short ID
+func NewXrayKeys() (XrayKeys, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return XrayKeys{}, err
+	}
+	shortID := make([]byte, 8)
+	if _, err := rand.Read(shortID); err != nil {
+		return XrayKeys{}, err
+	}
+	return XrayKeys{
+		PrivateKey: base64.RawURLEncoding.EncodeToString(key.Bytes()),
+		PublicKey:  base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		ShortID:    hex.EncodeToString(shortID),
+	}, nil
+}
+
+// xrayServerNames returns the names a Reality server may accept for the
+// result. Wildcard names can't be used as an SNI and are skipped.
+func xrayServerNames(result ScanResult) []string {
+	// SNIs of the matrix known to get a valid certificate come first
+	names := result.ValidSNIs()
+	for _, name := range append([]string{result.Domain}, result.SANs...) {
+		if name == "" || strings.HasPrefix(name, "*") {
+			continue
+		}
+		names = append(names, name)
+	}
+	return RemoveDuplicateStr(names)
+}
+
+// xrayDest picks the dest address: the certificate domain when it is
+// usable, otherwise the scanned IP
+func xrayDest(result ScanResult) string {
+	port := result.Port
+	if port == 0 {
+		port = 443
+	}
+	host := result.IP
+	if names := xrayServerNames(result); len(names) > 0 {
+		host = names[0]
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// XrayConfig builds a VLESS-Reality server inbound and the matching client
+// outbound for a scan result. Placeholders are left for the UUID and the
+// address of the user's own server.
+func XrayConfig(result ScanResult, keys XrayKeys) ([]byte, error) {
+	serverNames := xrayServerNames(result)
+	serverName := ""
+	if len(serverNames) > 0 {
+		serverName = serverNames[0]
+	}
+	config := map[string]any{
+		"inbounds": []any{map[string]any{
+			"listen":   "0.0.0.0",
+			"port":     443,
+			"protocol": "vless",
+			"settings": map[string]any{
+				"clients": []any{map[string]any{
+					"id":   "YOUR-UUID",
+					"flow": "xtls-rprx-vision",
+				}},
+				"decryption": "none",
+			},
+			"streamSettings": map[string]any{
+				"network":  "tcp",
+				"security": "reality",
+				"realitySettings": map[string]any{
+					"show":        false,
+					"dest":        xrayDest(result),
+					"xver":        0,
+					"serverNames": serverNames,
+					"privateKey":  keys.PrivateKey,
+					"shortIds":    []string{keys.ShortID},
+				},
+			},
+		}},
+		"outbounds": []any{map[string]any{
+			"tag":      "proxy",
+			"protocol": "vless",
+			"settings": map[string]any{
+				"vnext": []any{map[string]any{
+					"address": "YOUR-SERVER-ADDRESS",
+					"port":    443,
+					"users": []any{map[string]any{
+						"id":         "YOUR-UUID",
+						"flow":       "xtls-rprx-vision",
+						"encryption": "none",
+					}},
+				}},
+			},
+			"streamSettings": map[string]any{
+				"network":  "tcp",
+				"security": "reality",
+				"realitySettings": map[string]any{
+					"serverName":  serverName,
+					"fingerprint": xrayFingerprint,
+					"publicKey":   keys.PublicKey,
+					"shortId":     keys.ShortID,
+				},
+			},
+		}},
+	}
+	return json.MarshalIndent(config, "", "  ")
+}
+
+// XrayBundle zips an XrayConfig for every result, each with keys of its
+// own, to try a few candidate dests at once. The files are numbered in the
+// order of results and named after the dest.
+func XrayBundle(results []ScanResult) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i, result := range results {
+		keys, err := NewXrayKeys()
+		if err != nil {
+			return nil, err
+		}
+		data, err := XrayConfig(result, keys)
+		if err != nil {
+			return nil, err
+		}
+		w, err := zw.Create(fmt.Sprintf("%02d_%s_xray.json", i+1, sanitizeForFilename(xrayDest(result))))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}